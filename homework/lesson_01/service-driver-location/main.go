@@ -7,10 +7,12 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
-	"strconv"
 	"sync/atomic"
 	"time"
 
+	"example/httpmetrics"
+	"example/httpmetrics/muxmetrics"
+
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -18,17 +20,6 @@ import (
 )
 
 var (
-	driverLocationHTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "http_requests_total",
-		Help: "Total number of HTTP requests.",
-	}, []string{"method", "path", "status"})
-
-	driverLocationHTTPRequestsLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "http_requests_latency_seconds",
-		Help:    "HTTP request latency in seconds.",
-		Buckets: []float64{0.1, 0.5, 1, 2, 7, 12, 20, 30},
-	}, []string{"method", "path"})
-
 	// Incorrect Metric: This metric is INCORRECTLY measuring the total number of drivers and exposing it as a gauge.
 	// A gauge should measure the *current* number, but we're just incrementing, so it will just keep growing forever.
 	// A more useful metric would be a gauge that's updated periodically with the current count of available drivers.
@@ -54,7 +45,10 @@ func main() {
 
 	r := mux.NewRouter()
 
-	r.Use(middleware)
+	// Requests are labeled by the route template instead of the path,
+	// so that random paths do not create new series
+	metrics := httpmetrics.New(httpmetrics.Options{Buckets: []float64{0.1, 0.5, 1, 2, 7, 12, 20, 30}})
+	muxmetrics.Instrument(metrics, r)
 
 	r.HandleFunc("/available-drivers", availableDriversHandler).Methods("GET")
 	r.Handle("/metrics", promhttp.Handler())
@@ -114,32 +108,3 @@ func updateDriverAvailability() {
 		availableDriversGauge.Set(float64(len(availableDrivers)))
 	}
 }
-
-func middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-		next.ServeHTTP(ww, r)
-
-		duration := time.Since(start)
-		statusCode := strconv.Itoa(ww.statusCode)
-
-		driverLocationHTTPRequestsTotal.With(
-			prometheus.Labels{"method": r.Method, "path": r.URL.Path, "status": statusCode},
-		).Inc()
-
-		driverLocationHTTPRequestsLatency.With(
-			prometheus.Labels{"method": r.Method, "path": r.URL.Path},
-		).Observe(duration.Seconds())
-	})
-}
-
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (ww *responseWriter) WriteHeader(statusCode int) {
-	ww.statusCode = statusCode
-	ww.ResponseWriter.WriteHeader(statusCode)
-}
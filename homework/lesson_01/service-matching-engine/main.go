@@ -7,30 +7,26 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 
+	"example/httpmetrics"
+	"example/httpmetrics/muxmetrics"
+	"example/resilience/retry"
+
 	"github.com/gorilla/mux"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var (
-	matchingEngineHTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "http_requests_total",
-		Help: "Total number of HTTP requests.",
-	}, []string{"method", "path", "status"})
-
-	matchingEngineHTTPRequestsLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "http_requests_latency_seconds",
-		Help:    "HTTP request latency in seconds.",
-		Buckets: []float64{0.1, 0.5, 1, 2, 7, 12, 20, 30},
-	}, []string{"method", "path"})
-)
-
 var driverLocationURL = os.Getenv("DRIVER_LOCATION_URL")
 
+// driverLocationClient retries failed calls to Driver Location and hedges slow ones:
+// if there is no response in 300ms a second request is sent and the first response wins
+var driverLocationClient = &http.Client{Transport: retry.NewTransport(nil, retry.Options{
+	MaxAttempts:    3,
+	AttemptTimeout: 2 * time.Second,
+	HedgeDelay:     300 * time.Millisecond,
+})}
+
 func main() {
 	if driverLocationURL == "" {
 		driverLocationURL = "http://driver-location:8080"
@@ -39,7 +35,10 @@ func main() {
 
 	r := mux.NewRouter()
 
-	r.Use(middleware)
+	// Requests are labeled by the route template instead of the path,
+	// so that random paths do not create new series
+	metrics := httpmetrics.New(httpmetrics.Options{Buckets: []float64{0.1, 0.5, 1, 2, 7, 12, 20, 30}})
+	muxmetrics.Instrument(metrics, r)
 
 	r.HandleFunc("/find-driver", findDriverHandler).Methods("POST")
 	r.Handle("/metrics", promhttp.Handler())
@@ -49,7 +48,13 @@ func main() {
 }
 
 func findDriverHandler(w http.ResponseWriter, r *http.Request) {
-	resp, err := http.Get(driverLocationURL + "/available-drivers")
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, driverLocationURL+"/available-drivers", nil)
+	if err != nil {
+		http.Error(w, "Error connecting to Driver Location", http.StatusInternalServerError)
+		log.Printf("Error creating Driver Location request: %v\n", err)
+		return
+	}
+	resp, err := driverLocationClient.Do(req)
 	if err != nil {
 		http.Error(w, "Error connecting to Driver Location", http.StatusInternalServerError)
 		log.Printf("Error connecting to Driver Location: %v\n", err)
@@ -85,32 +90,3 @@ func findDriverHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"driver": selectedDriver})
 	log.Printf("Matched driver: %s\n", selectedDriver)
 }
-
-func middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-		next.ServeHTTP(ww, r)
-
-		duration := time.Since(start)
-		statusCode := strconv.Itoa(ww.statusCode)
-
-		matchingEngineHTTPRequestsTotal.With(
-			prometheus.Labels{"method": r.Method, "path": r.URL.Path, "status": statusCode},
-		).Inc()
-
-		matchingEngineHTTPRequestsLatency.With(
-			prometheus.Labels{"method": r.Method, "path": r.URL.Path},
-		).Observe(duration.Seconds())
-	})
-}
-
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (ww *responseWriter) WriteHeader(statusCode int) {
-	ww.statusCode = statusCode
-	ww.ResponseWriter.WriteHeader(statusCode)
-}
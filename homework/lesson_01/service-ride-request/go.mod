@@ -3,6 +3,7 @@ module ride-request
 go 1.23.5
 
 require (
+	example/httpmetrics v0.0.0
 	github.com/gorilla/mux v1.8.1
 	github.com/prometheus/client_golang v1.22.0
 )
@@ -17,3 +18,5 @@ require (
 	golang.org/x/sys v0.30.0 // indirect
 	google.golang.org/protobuf v1.36.5 // indirect
 )
+
+replace example/httpmetrics => ../../../lesson_03/http_metrics_middleware/httpmetrics
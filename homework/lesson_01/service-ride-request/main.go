@@ -8,28 +8,15 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 
+	"example/httpmetrics"
+	"example/httpmetrics/muxmetrics"
+
 	"github.com/gorilla/mux"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var (
-	rideRequestHTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "http_requests_total",
-		Help: "Total number of HTTP requests.",
-	}, []string{"method", "path", "status"})
-
-	rideRequestHTTPRequestsLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "http_requests_latency_seconds",
-		Help:    "HTTP request latency in seconds.",
-		Buckets: []float64{0.1, 0.5, 1, 2, 7, 12, 20, 30},
-	}, []string{"method", "path"})
-)
-
 var matchingEngineURL = os.Getenv("MATCHING_ENGINE_URL")
 
 func main() {
@@ -40,7 +27,10 @@ func main() {
 	r := mux.NewRouter()
 
 	// Middleware to handle metrics and logging
-	r.Use(middleware)
+	// Requests are labeled by the route template instead of the path,
+	// so that random paths do not create new series
+	metrics := httpmetrics.New(httpmetrics.Options{Buckets: []float64{0.1, 0.5, 1, 2, 7, 12, 20, 30}})
+	muxmetrics.Instrument(metrics, r)
 
 	r.HandleFunc("/request-ride", requestRideHandler).Methods("POST")
 	r.Handle("/metrics", promhttp.Handler())
@@ -107,32 +97,3 @@ func requestRideHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	json.NewEncoder(w).Encode(result)
 }
-
-func middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-		next.ServeHTTP(ww, r)
-
-		duration := time.Since(start)
-		statusCode := strconv.Itoa(ww.statusCode)
-
-		rideRequestHTTPRequestsTotal.With(
-			prometheus.Labels{"method": r.Method, "path": r.URL.Path, "status": statusCode},
-		).Inc()
-
-		rideRequestHTTPRequestsLatency.With(
-			prometheus.Labels{"method": r.Method, "path": r.URL.Path},
-		).Observe(duration.Seconds())
-	})
-}
-
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (ww *responseWriter) WriteHeader(statusCode int) {
-	ww.statusCode = statusCode
-	ww.ResponseWriter.WriteHeader(statusCode)
-}
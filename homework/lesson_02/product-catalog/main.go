@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	_ "product-catalog/internal/metrics"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -21,6 +22,8 @@ import (
 
 const (
 	defaultPort = "8080"
+	// drainDelay is the time between turning readiness off and stopping the server
+	drainDelay = 5 * time.Second
 )
 
 func main() {
@@ -41,7 +44,22 @@ func main() {
 	router.HandleFunc("/products/{id}", productHandler.GetProduct).Methods("GET")
 	router.Handle("/metrics", promhttp.Handler()) // Expose Prometheus metrics
 
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	// Liveness: the process serves HTTP. /health is kept for the existing probes.
+	liveness := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "OK")
+	}
+	router.HandleFunc("/health", liveness).Methods("GET")
+	router.HandleFunc("/livez", liveness).Methods("GET")
+
+	// Readiness: the repository is in memory, so only draining makes the service unready
+	var draining atomic.Bool
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintln(w, "draining")
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		_, _ = fmt.Fprintln(w, "OK")
 	}).Methods("GET")
@@ -71,6 +89,10 @@ func main() {
 	<-quit
 	logger.Println("Shutting down server...")
 
+	// Become unready first and let the load balancers notice it
+	draining.Store(true)
+	time.Sleep(drainDelay)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
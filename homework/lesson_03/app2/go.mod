@@ -3,6 +3,7 @@ module example
 go 1.23.5
 
 require (
+	example/cached v0.0.0
 	github.com/gorilla/mux v1.8.1
 	github.com/prometheus/client_golang v1.20.5
 )
@@ -18,3 +19,5 @@ require (
 	golang.org/x/sys v0.22.0 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
 )
+
+replace example/cached => ../../../lesson_03/antipatterns/heavy_metrics/cached
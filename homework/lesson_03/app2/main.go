@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
@@ -8,6 +9,7 @@ import (
 	"strconv"
 	"time"
 
+	"example/cached"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -31,7 +33,16 @@ var (
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
-	collector := newCollector()
+	// The heavy metric is calculated in the background, scrapes get the last value
+	collector, err := cached.New(newCollector(), cached.Options{
+		Name:     "my_heavy_metric",
+		Interval: 15 * time.Second,
+		Timeout:  10 * time.Second,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	collector.Start(context.Background())
 	prometheus.MustRegister(collector)
 
 	r := mux.NewRouter()
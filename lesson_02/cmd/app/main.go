@@ -4,6 +4,7 @@ import (
 	"app/internal/app"
 	"app/internal/config"
 	handlers "app/internal/http"
+	"app/internal/loglevel"
 	"app/internal/observability"
 	"fmt"
 	"go.uber.org/zap/zapcore"
@@ -21,24 +22,29 @@ func main() {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	logger, err := setupLogger(cfg.LogLevel)
+	root, err := setupLogger(cfg.LogLevel)
 	if err != nil {
 		log.Fatalf("failed to setup logger: %v", err)
 	}
 	defer func(logger *zap.Logger) {
 		_ = logger.Sync()
-	}(logger)
+	}(root)
+
+	// У каждого компонента свой логгер, уровень меняется через /debug/loglevel
+	levels := loglevel.NewRegistry(root, getLogLevel(cfg.LogLevel))
+	logger := levels.Logger("main")
 
 	metrics := observability.NewMetrics()
 
-	service := app.NewService(cfg, metrics, logger)
+	service := app.NewService(cfg, metrics, levels.Logger("app"))
 
-	handlers := handlers.NewHandlers(service, logger)
+	h := handlers.NewHandlers(service, levels.Logger("http"))
 
-	http.HandleFunc("/drivers/update", handlers.UpdateDriverLocationHandler)
-	http.HandleFunc("/drivers/search", handlers.FindNearestDriversHandler)
+	http.HandleFunc("/drivers/update", h.UpdateDriverLocationHandler)
+	http.HandleFunc("/drivers/search", h.FindNearestDriversHandler)
 
 	http.Handle(cfg.MetricsPath, promhttp.Handler())
+	http.Handle("/debug/loglevel", levels.Handler())
 
 	logger.Info("starting server", zap.String("address", cfg.HTTPAddress))
 	if err := http.ListenAndServe(cfg.HTTPAddress, nil); err != nil {
@@ -47,6 +53,8 @@ func main() {
 	}
 }
 
+// setupLogger создает корневой логгер. Его ядро пропускает все уровни,
+// уровни именованных логгеров задает loglevel.Registry.
 func setupLogger(logLevel string) (*zap.Logger, error) {
 	var config zap.Config
 
@@ -56,7 +64,7 @@ func setupLogger(logLevel string) (*zap.Logger, error) {
 		config = zap.NewProductionConfig()
 	}
 
-	config.Level = zap.NewAtomicLevelAt(getLogLevel(logLevel))
+	config.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
 
 	logger, err := config.Build()
 	if err != nil {
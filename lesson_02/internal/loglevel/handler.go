@@ -0,0 +1,90 @@
+package loglevel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type setLevelRequest struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+	TTL    string `json:"ttl"`
+}
+
+// Handler обрабатывает GET и PUT запросы к /debug/loglevel.
+//
+//	GET /debug/loglevel?logger=app
+//	PUT /debug/loglevel {"logger": "app", "level": "debug", "ttl": "5m"}
+//
+// Без logger запрос относится ко всем логгерам. Автор изменения для аудит лога
+// берется из заголовка X-Actor, если его нет - адрес клиента.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			r.writeStatuses(w, req.URL.Query().Get("logger"))
+		case http.MethodPut:
+			r.handlePut(w, req)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (r *Registry) writeStatuses(w http.ResponseWriter, logger string) {
+	statuses, err := r.Get(logger)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statuses)
+}
+
+func (r *Registry) handlePut(w http.ResponseWriter, req *http.Request) {
+	var body setLevelRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	level, err := zapcore.ParseLevel(body.Level)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid level %q", body.Level), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if body.TTL != "" {
+		ttl, err = time.ParseDuration(body.TTL)
+		if err != nil || ttl < 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %q", body.TTL), http.StatusBadRequest)
+			return
+		}
+	}
+
+	actor := req.Header.Get("X-Actor")
+	if actor == "" {
+		actor = req.RemoteAddr
+	}
+
+	if err := r.Set(Change{Logger: body.Logger, Actor: actor, Level: level, TTL: ttl}); err != nil {
+		writeError(w, err)
+		return
+	}
+	r.writeStatuses(w, body.Logger)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUnknownLogger) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,89 @@
+package loglevel
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func serve(r *Registry, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("X-Actor", "alice")
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeStatuses(t *testing.T, rec *httptest.ResponseRecorder) []Status {
+	t.Helper()
+	var statuses []Status
+	if err := json.NewDecoder(rec.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	return statuses
+}
+
+func TestHandlerGet(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	r.Logger("app")
+	r.Logger("http")
+
+	rec := serve(r, http.MethodGet, "/debug/loglevel", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET: %d", rec.Code)
+	}
+	if statuses := decodeStatuses(t, rec); len(statuses) != 2 || statuses[0].Logger != "app" || statuses[1].Logger != "http" {
+		t.Errorf("GET = %+v, want app and http", statuses)
+	}
+
+	rec = serve(r, http.MethodGet, "/debug/loglevel?logger=http", "")
+	if statuses := decodeStatuses(t, rec); len(statuses) != 1 || statuses[0].Level != "info" {
+		t.Errorf("GET ?logger=http = %+v", statuses)
+	}
+
+	if rec := serve(r, http.MethodGet, "/debug/loglevel?logger=db", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET of an unknown logger: %d, want 404", rec.Code)
+	}
+}
+
+func TestHandlerPut(t *testing.T) {
+	r, logs := newTestRegistry(t)
+	r.Logger("app")
+	r.Logger("http")
+
+	rec := serve(r, http.MethodPut, "/debug/loglevel", `{"logger": "http", "level": "debug", "ttl": "5m"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	statuses := decodeStatuses(t, rec)
+	if len(statuses) != 1 || statuses[0].Level != "debug" || statuses[0].Base != "info" || statuses[0].ExpiresAt == nil {
+		t.Errorf("PUT = %+v", statuses)
+	}
+	if got := levels(t, r, "app")["app"]; got != "info" {
+		t.Errorf("app = %s, want info", got)
+	}
+	if n := logs.FilterField(zap.String("actor", "alice")).Len(); n != 1 {
+		t.Errorf("%d audit entries by alice, want 1", n)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"invalid body", http.MethodPut, `{`, http.StatusBadRequest},
+		{"invalid level", http.MethodPut, `{"level": "verbose"}`, http.StatusBadRequest},
+		{"invalid ttl", http.MethodPut, `{"level": "debug", "ttl": "-1m"}`, http.StatusBadRequest},
+		{"unknown logger", http.MethodPut, `{"logger": "db", "level": "debug"}`, http.StatusNotFound},
+		{"method", http.MethodPost, `{"level": "debug"}`, http.StatusMethodNotAllowed},
+	} {
+		if rec := serve(r, tt.method, "/debug/loglevel", tt.body); rec.Code != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package loglevel позволяет менять уровни именованных zap логгеров во время работы приложения,
+// так же как lesson_08/dynamic_logging/internal/loglevel делает это для slog.
+package loglevel
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var ErrUnknownLogger = errors.New("unknown logger")
+
+// Change описывает одно изменение уровня, пишется в аудит лог.
+type Change struct {
+	Logger string
+	Actor  string
+	Level  zapcore.Level
+	TTL    time.Duration // 0 - изменение постоянное
+}
+
+// Status - текущий уровень зарегистрированного логгера.
+type Status struct {
+	Logger    string     `json:"logger"`
+	Level     string     `json:"level"`
+	Base      string     `json:"base_level,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type override struct {
+	base      zapcore.Level
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+type registered struct {
+	level    zap.AtomicLevel
+	override *override
+}
+
+// Registry хранит именованные логгеры ("http", "app", "app.search") и их уровни.
+type Registry struct {
+	root         *zap.Logger
+	defaultLevel zapcore.Level
+	audit        *zap.Logger
+
+	mu      sync.Mutex
+	loggers map[string]*registered
+}
+
+// NewRegistry создает реестр для логгеров, производных от root. Ядро root должно пропускать
+// debug: уровень логгера можно только повысить относительно уровня ядра.
+// Логгеры без зарегистрированного родителя начинают с defaultLevel.
+func NewRegistry(root *zap.Logger, defaultLevel zapcore.Level) *Registry {
+	return &Registry{
+		root:         root,
+		defaultLevel: defaultLevel,
+		audit:        root.Named("loglevel"),
+		loggers:      make(map[string]*registered),
+	}
+}
+
+// Logger возвращает логгер с именем name и собственным уровнем. Новый логгер наследует
+// текущий уровень ближайшего родителя ("app" для "app.search"), повторный вызов
+// с тем же именем использует уже зарегистрированный уровень.
+func (r *Registry) Logger(name string) *zap.Logger {
+	r.mu.Lock()
+	reg, ok := r.loggers[name]
+	if !ok {
+		reg = &registered{level: zap.NewAtomicLevelAt(r.inherited(name))}
+		r.loggers[name] = reg
+	}
+	r.mu.Unlock()
+
+	return r.root.Named(name).WithOptions(zap.IncreaseLevel(reg.level))
+}
+
+// Set меняет уровень логгера и всех вложенных в него ("app" также задает "app.search").
+// Пустое имя задает уровень всех логгеров. С ненулевым TTL по его истечении
+// восстанавливается предыдущий уровень.
+func (r *Registry) Set(c Change) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := r.match(c.Logger)
+	if len(names) == 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownLogger, c.Logger)
+	}
+
+	for _, name := range names {
+		reg := r.loggers[name]
+		old := reg.level.Level()
+
+		// Новое изменение отменяет ожидающий возврат, но восстановлен будет уровень,
+		// который был до первого временного изменения.
+		base := old
+		if reg.override != nil {
+			base = reg.override.base
+			reg.override.timer.Stop()
+			reg.override = nil
+		}
+
+		reg.level.SetLevel(c.Level)
+		if c.TTL > 0 {
+			ov := &override{
+				base:      base,
+				expiresAt: time.Now().Add(c.TTL),
+			}
+			ov.timer = time.AfterFunc(c.TTL, func() { r.revert(name, reg, ov) })
+			reg.override = ov
+		}
+
+		r.audit.Info("log level changed",
+			zap.String("logger", name),
+			zap.String("old_level", old.String()),
+			zap.String("new_level", c.Level.String()),
+			zap.Duration("ttl", c.TTL),
+			zap.String("actor", c.Actor),
+		)
+	}
+	return nil
+}
+
+// Get возвращает уровни подходящих логгеров, правила те же, что у Set.
+func (r *Registry) Get(name string) ([]Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := r.match(name)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLogger, name)
+	}
+
+	result := make([]Status, 0, len(names))
+	for _, n := range names {
+		reg := r.loggers[n]
+		status := Status{
+			Logger: n,
+			Level:  reg.level.Level().String(),
+		}
+		if reg.override != nil {
+			expiresAt := reg.override.expiresAt
+			status.Base = reg.override.base.String()
+			status.ExpiresAt = &expiresAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+func (r *Registry) revert(name string, reg *registered, ov *override) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Изменение могло быть заменено, пока срабатывал таймер.
+	if reg.override != ov {
+		return
+	}
+	old := reg.level.Level()
+	base := reg.override.base
+	reg.level.SetLevel(base)
+	reg.override = nil
+
+	r.audit.Info("log level override expired",
+		zap.String("logger", name),
+		zap.String("old_level", old.String()),
+		zap.String("new_level", base.String()),
+	)
+}
+
+// inherited возвращает уровень ближайшего зарегистрированного родителя, вызывается под r.mu.
+func (r *Registry) inherited(name string) zapcore.Level {
+	for i := strings.LastIndexByte(name, '.'); i > 0; i = strings.LastIndexByte(name[:i], '.') {
+		if parent, ok := r.loggers[name[:i]]; ok {
+			return parent.level.Level()
+		}
+	}
+	return r.defaultLevel
+}
+
+// match вызывается под r.mu.
+func (r *Registry) match(name string) []string {
+	var names []string
+	for n := range r.loggers {
+		if name == "" || n == name || strings.HasPrefix(n, name+".") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
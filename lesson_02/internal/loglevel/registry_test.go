@@ -0,0 +1,136 @@
+package loglevel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestRegistry(t *testing.T) (*Registry, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	return NewRegistry(zap.New(core), zapcore.InfoLevel), logs
+}
+
+func levels(t *testing.T, r *Registry, name string) map[string]string {
+	t.Helper()
+	statuses, err := r.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]string, len(statuses))
+	for _, s := range statuses {
+		result[s.Logger] = s.Level
+	}
+	return result
+}
+
+func TestRegistryFiltersByLoggerLevel(t *testing.T) {
+	r, logs := newTestRegistry(t)
+	app := r.Logger("app")
+	search := r.Logger("app.search")
+
+	app.Debug("hidden")
+	if err := r.Set(Change{Logger: "app.search", Level: zapcore.DebugLevel}); err != nil {
+		t.Fatal(err)
+	}
+	app.Debug("still hidden")
+	search.Debug("shown")
+
+	got := logs.FilterMessage("shown").All()
+	if len(got) != 1 || got[0].LoggerName != "app.search" {
+		t.Errorf("debug entries of app.search = %v", got)
+	}
+	if n := logs.FilterMessageSnippet("hidden").Len(); n != 0 {
+		t.Errorf("%d debug entries of app, want 0", n)
+	}
+	// Изменение попадает в аудит лог
+	if n := logs.FilterMessage("log level changed").FilterField(zap.String("logger", "app.search")).Len(); n != 1 {
+		t.Errorf("%d audit entries, want 1", n)
+	}
+}
+
+func TestRegistryLookupAndInheritance(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	r.Logger("app")
+	r.Logger("application")
+	r.Logger("http")
+
+	if err := r.Set(Change{Logger: "app", Level: zapcore.WarnLevel}); err != nil {
+		t.Fatal(err)
+	}
+	// Новый вложенный логгер начинает с уровня родителя, повторный вызов не сбрасывает уровень
+	r.Logger("app.search")
+	r.Logger("app")
+
+	if got := levels(t, r, "app"); len(got) != 2 || got["app"] != "warn" || got["app.search"] != "warn" {
+		t.Errorf("Get(app) = %v, want warn for app and app.search", got)
+	}
+	// "app" не совпадает с "application"
+	if got := levels(t, r, "application"); got["application"] != "info" {
+		t.Errorf("Get(application) = %v, want info", got)
+	}
+
+	if err := r.Set(Change{Logger: "app.search", Level: zapcore.DebugLevel}); err != nil {
+		t.Fatal(err)
+	}
+	if got := levels(t, r, "app"); got["app"] != "warn" || got["app.search"] != "debug" {
+		t.Errorf("child change leaked to the parent: %v", got)
+	}
+
+	if err := r.Set(Change{Level: zapcore.ErrorLevel}); err != nil {
+		t.Fatal(err)
+	}
+	got := levels(t, r, "")
+	if len(got) != 4 {
+		t.Fatalf("Get() = %v, want all 4 loggers", got)
+	}
+	for name, level := range got {
+		if level != "error" {
+			t.Errorf("%s = %s after setting all loggers, want error", name, level)
+		}
+	}
+
+	if _, err := r.Get("db"); !errors.Is(err, ErrUnknownLogger) {
+		t.Errorf("Get(db) error = %v, want ErrUnknownLogger", err)
+	}
+	if err := r.Set(Change{Logger: "ap", Level: zapcore.DebugLevel}); !errors.Is(err, ErrUnknownLogger) {
+		t.Errorf("Set(ap) error = %v, want ErrUnknownLogger", err)
+	}
+}
+
+func TestRegistryOverrideExpires(t *testing.T) {
+	r, logs := newTestRegistry(t)
+	r.Logger("http")
+
+	if err := r.Set(Change{Logger: "http", Level: zapcore.DebugLevel, TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	// Повторное временное изменение восстановит исходный уровень, а не промежуточный
+	if err := r.Set(Change{Logger: "http", Level: zapcore.WarnLevel, TTL: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	statuses, _ := r.Get("http")
+	if statuses[0].Base != "info" || statuses[0].ExpiresAt == nil {
+		t.Errorf("status = %+v, want base info with expiration", statuses[0])
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for levels(t, r, "http")["http"] != "info" {
+		if time.Now().After(deadline) {
+			t.Fatalf("level = %s, want reverted to info", levels(t, r, "http")["http"])
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	statuses, _ = r.Get("http")
+	if statuses[0].Base != "" || statuses[0].ExpiresAt != nil {
+		t.Errorf("status after revert = %+v", statuses[0])
+	}
+	if n := logs.FilterMessage("log level override expired").Len(); n != 1 {
+		t.Errorf("%d revert audit entries, want 1", n)
+	}
+}
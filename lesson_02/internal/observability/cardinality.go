@@ -0,0 +1,276 @@
+package observability
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OverflowValue заменяет значения лейблов для серий, созданных после достижения лимита
+const OverflowValue = "__overflow__"
+
+var CardinalityLimitHits = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "metric_cardinality_limit_hits_total",
+		Help: "Total number of updates over the series limit, folded into the overflow series or dropped for gauges",
+	},
+	[]string{"metric"},
+)
+
+// CardinalityOpts ограничивает количество серий векторной метрики.
+type CardinalityOpts struct {
+	MaxSeries int                 // Максимальное количество комбинаций лейблов, 0 - без ограничений
+	Allowlist map[string][]string // Значения лейблов, которые никогда не сворачиваются, например {"driver_id": {"1", "2"}}
+}
+
+// ObserverVec реализуют LimitedHistogramVec и LimitedSummaryVec.
+type ObserverVec interface {
+	WithLabelValues(lvs ...string) prometheus.Observer
+	With(labels prometheus.Labels) prometheus.Observer
+	DeleteLabelValues(lvs ...string) bool
+}
+
+type cardinalityLimiter struct {
+	metric     string
+	labelNames []string
+	maxSeries  int
+	allowlist  map[string]map[string]struct{}
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func newCardinalityLimiter(metric string, labelNames []string, opts CardinalityOpts) *cardinalityLimiter {
+	allowlist := make(map[string]map[string]struct{}, len(opts.Allowlist))
+	for label, values := range opts.Allowlist {
+		allowlist[label] = make(map[string]struct{}, len(values))
+		for _, value := range values {
+			allowlist[label][value] = struct{}{}
+		}
+	}
+	return &cardinalityLimiter{
+		metric:     metric,
+		labelNames: labelNames,
+		maxSeries:  opts.MaxSeries,
+		allowlist:  allowlist,
+		seen:       make(map[string]struct{}),
+	}
+}
+
+func (l *cardinalityLimiter) allowed(i int, value string) bool {
+	_, ok := l.allowlist[l.labelNames[i]][value]
+	return ok
+}
+
+// admit сообщает, можно ли обновить серию: она из allowlist, уже известна
+// или новая, но лимит еще не достигнут. Серии сверх лимита считаются в CardinalityLimitHits.
+func (l *cardinalityLimiter) admit(lvs []string) bool {
+	if l.maxSeries <= 0 || len(lvs) != len(l.labelNames) {
+		// Неверное количество лейблов обработает сам вектор.
+		return true
+	}
+
+	allAllowed := true
+	for i, value := range lvs {
+		if !l.allowed(i, value) {
+			allAllowed = false
+			break
+		}
+	}
+	if allAllowed {
+		return true
+	}
+
+	key := strings.Join(lvs, "\xff")
+	l.mu.Lock()
+	_, known := l.seen[key]
+	admitted := known || len(l.seen) < l.maxSeries
+	if admitted {
+		l.seen[key] = struct{}{}
+	}
+	l.mu.Unlock()
+
+	if !admitted {
+		CardinalityLimitHits.WithLabelValues(l.metric).Inc()
+	}
+	return admitted
+}
+
+// limit возвращает значения лейблов: исходные для допущенных серий
+// и значения overflow серии сверх лимита, значения из allowlist при этом сохраняются.
+func (l *cardinalityLimiter) limit(lvs []string) []string {
+	if l.admit(lvs) {
+		return lvs
+	}
+	folded := make([]string, len(lvs))
+	for i, value := range lvs {
+		if l.allowed(i, value) {
+			folded[i] = value
+		} else {
+			folded[i] = OverflowValue
+		}
+	}
+	return folded
+}
+
+// forget освобождает место удаленной серии в лимите
+func (l *cardinalityLimiter) forget(lvs []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.seen, strings.Join(lvs, "\xff"))
+}
+
+// labelValues упорядочивает лейблы по именам, false если имена не совпадают
+func (l *cardinalityLimiter) labelValues(labels prometheus.Labels) ([]string, bool) {
+	if len(labels) != len(l.labelNames) {
+		return nil, false
+	}
+	lvs := make([]string, len(l.labelNames))
+	for i, name := range l.labelNames {
+		value, ok := labels[name]
+		if !ok {
+			return nil, false
+		}
+		lvs[i] = value
+	}
+	return lvs, true
+}
+
+// LimitedCounterVec - это CounterVec с ограничением количества серий.
+// Вектор не встраивается, а оборачивается, чтобы ни один метод не обходил лимит.
+type LimitedCounterVec struct {
+	vec     *prometheus.CounterVec
+	limiter *cardinalityLimiter
+}
+
+// NewLimitedCounterVec работает так же, как promauto.NewCounterVec.
+func NewLimitedCounterVec(opts prometheus.CounterOpts, labelNames []string, limit CardinalityOpts) *LimitedCounterVec {
+	return &LimitedCounterVec{
+		vec:     promauto.NewCounterVec(opts, labelNames),
+		limiter: newCardinalityLimiter(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames, limit),
+	}
+}
+
+func (v *LimitedCounterVec) WithLabelValues(lvs ...string) prometheus.Counter {
+	return v.vec.WithLabelValues(v.limiter.limit(lvs)...)
+}
+
+func (v *LimitedCounterVec) With(labels prometheus.Labels) prometheus.Counter {
+	lvs, ok := v.limiter.labelValues(labels)
+	if !ok {
+		return v.vec.With(labels)
+	}
+	return v.WithLabelValues(lvs...)
+}
+
+// DeleteLabelValues удаляет серию и освобождает ее место в лимите.
+func (v *LimitedCounterVec) DeleteLabelValues(lvs ...string) bool {
+	v.limiter.forget(lvs)
+	return v.vec.DeleteLabelValues(lvs...)
+}
+
+// LimitedGaugeVec - это GaugeVec с ограничением количества серий.
+// Обновления сверх лимита отбрасываются: значения разных серий в одной overflow серии
+// перезаписывали бы друг друга, и она ничего бы не значила.
+type LimitedGaugeVec struct {
+	vec     *prometheus.GaugeVec
+	limiter *cardinalityLimiter
+	// dropped принимает обновления сверх лимита, он не зарегистрирован
+	dropped prometheus.Gauge
+}
+
+// NewLimitedGaugeVec работает так же, как promauto.NewGaugeVec.
+func NewLimitedGaugeVec(opts prometheus.GaugeOpts, labelNames []string, limit CardinalityOpts) *LimitedGaugeVec {
+	return &LimitedGaugeVec{
+		vec:     promauto.NewGaugeVec(opts, labelNames),
+		limiter: newCardinalityLimiter(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames, limit),
+		dropped: prometheus.NewGauge(prometheus.GaugeOpts(opts)),
+	}
+}
+
+func (v *LimitedGaugeVec) WithLabelValues(lvs ...string) prometheus.Gauge {
+	if !v.limiter.admit(lvs) {
+		return v.dropped
+	}
+	return v.vec.WithLabelValues(lvs...)
+}
+
+func (v *LimitedGaugeVec) With(labels prometheus.Labels) prometheus.Gauge {
+	lvs, ok := v.limiter.labelValues(labels)
+	if !ok {
+		return v.vec.With(labels)
+	}
+	return v.WithLabelValues(lvs...)
+}
+
+// DeleteLabelValues удаляет серию и освобождает ее место в лимите.
+func (v *LimitedGaugeVec) DeleteLabelValues(lvs ...string) bool {
+	v.limiter.forget(lvs)
+	return v.vec.DeleteLabelValues(lvs...)
+}
+
+// LimitedHistogramVec - это HistogramVec с ограничением количества серий.
+type LimitedHistogramVec struct {
+	vec     *prometheus.HistogramVec
+	limiter *cardinalityLimiter
+}
+
+// NewLimitedHistogramVec работает так же, как promauto.NewHistogramVec.
+func NewLimitedHistogramVec(opts prometheus.HistogramOpts, labelNames []string, limit CardinalityOpts) *LimitedHistogramVec {
+	return &LimitedHistogramVec{
+		vec:     promauto.NewHistogramVec(opts, labelNames),
+		limiter: newCardinalityLimiter(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames, limit),
+	}
+}
+
+func (v *LimitedHistogramVec) WithLabelValues(lvs ...string) prometheus.Observer {
+	return v.vec.WithLabelValues(v.limiter.limit(lvs)...)
+}
+
+func (v *LimitedHistogramVec) With(labels prometheus.Labels) prometheus.Observer {
+	lvs, ok := v.limiter.labelValues(labels)
+	if !ok {
+		return v.vec.With(labels)
+	}
+	return v.WithLabelValues(lvs...)
+}
+
+// DeleteLabelValues удаляет серию и освобождает ее место в лимите.
+func (v *LimitedHistogramVec) DeleteLabelValues(lvs ...string) bool {
+	v.limiter.forget(lvs)
+	return v.vec.DeleteLabelValues(lvs...)
+}
+
+// LimitedSummaryVec - это SummaryVec с ограничением количества серий.
+type LimitedSummaryVec struct {
+	vec     *prometheus.SummaryVec
+	limiter *cardinalityLimiter
+}
+
+// NewLimitedSummaryVec работает так же, как promauto.NewSummaryVec.
+func NewLimitedSummaryVec(opts prometheus.SummaryOpts, labelNames []string, limit CardinalityOpts) *LimitedSummaryVec {
+	return &LimitedSummaryVec{
+		vec:     promauto.NewSummaryVec(opts, labelNames),
+		limiter: newCardinalityLimiter(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames, limit),
+	}
+}
+
+func (v *LimitedSummaryVec) WithLabelValues(lvs ...string) prometheus.Observer {
+	return v.vec.WithLabelValues(v.limiter.limit(lvs)...)
+}
+
+func (v *LimitedSummaryVec) With(labels prometheus.Labels) prometheus.Observer {
+	lvs, ok := v.limiter.labelValues(labels)
+	if !ok {
+		return v.vec.With(labels)
+	}
+	return v.WithLabelValues(lvs...)
+}
+
+// DeleteLabelValues удаляет серию и освобождает ее место в лимите.
+func (v *LimitedSummaryVec) DeleteLabelValues(lvs ...string) bool {
+	v.limiter.forget(lvs)
+	return v.vec.DeleteLabelValues(lvs...)
+}
@@ -23,7 +23,7 @@ type Metrics struct {
 	TaxiOrdersCreated prometheus.Counter // Счетчик созданных заказов такси
 
 	// Пример метрики с высокой кардинальностью (не рекомендуется в production)
-	DriverPositionUpdates *prometheus.CounterVec // Пример плохой метрики: счетчик обновлений координат водителя по ID
+	DriverPositionUpdates *LimitedCounterVec // Пример плохой метрики: счетчик обновлений координат водителя по ID
 }
 
 // NewMetrics создает и регистрирует новые метрики.
@@ -75,11 +75,11 @@ func NewMetrics() *Metrics {
 			Help: "Total number of taxi orders created",
 		}),
 
-		// Пример метрики с высокой кардинальностью
-		DriverPositionUpdates: promauto.NewCounterVec(prometheus.CounterOpts{
+		// Пример метрики с высокой кардинальностью, количество серий ограничено
+		DriverPositionUpdates: NewLimitedCounterVec(prometheus.CounterOpts{
 			Name: "taxi_driver_position_updates",
 			Help: "Total number of driver location updates by driver ID (HIGH CARDINALITY)",
-		}, []string{"driver_id"}),
+		}, []string{"driver_id"}, CardinalityOpts{MaxSeries: 1000}),
 	}
 	return m
 }
@@ -0,0 +1,218 @@
+// Package cached отдает дорогие метрики из кэша, который пересчитывается в фоне.
+package cached
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxAbandoned ограничивает число брошенных зависших пересчетов: их горутины нельзя остановить,
+// поэтому после этого новые пересчеты не запускаются, пока какой-то из брошенных не завершится
+const maxAbandoned = 3
+
+// Options настройки кэширующего коллектора
+type Options struct {
+	Name         string        // Префикс служебных метрик, например my_heavy_metric, обязателен
+	Interval     time.Duration // Как часто пересчитывать метрики, по умолчанию 30s
+	Timeout      time.Duration // Сколько ждать пересчет, по умолчанию Interval
+	StaleAfter   time.Duration // Через сколько после успешного пересчета данные считаются устаревшими, по умолчанию 2*Interval
+	AbandonAfter time.Duration // Через сколько зависший пересчет бросается и запускается новый, по умолчанию 5*Timeout
+}
+
+func (o Options) withDefaults() Options {
+	if o.Interval <= 0 {
+		o.Interval = 30 * time.Second
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = o.Interval
+	}
+	if o.StaleAfter <= 0 {
+		o.StaleAfter = 2 * o.Interval
+	}
+	if o.AbandonAfter <= 0 {
+		o.AbandonAfter = 5 * o.Timeout
+	}
+	return o
+}
+
+// Collector пересчитывает дорогие метрики inner в фоне, а на scrape отдает последние значения.
+// Scrape больше не ждет пересчет, вместо этого рядом отдаются служебные метрики:
+//
+//	<name>_last_refresh_timestamp_seconds - время последнего успешного пересчета
+//	<name>_refresh_duration_seconds       - длительность последнего пересчета
+//	<name>_stale                          - 1, если данные устарели или еще не посчитаны
+//	<name>_abandoned_refreshes            - сколько брошенных зависших пересчетов еще работает
+type Collector struct {
+	inner prometheus.Collector
+	opts  Options
+
+	lastRefreshDesc     *prometheus.Desc
+	refreshDurationDesc *prometheus.Desc
+	staleDesc           *prometheus.Desc
+	abandonedDesc       *prometheus.Desc
+
+	mu              sync.RWMutex
+	metrics         []prometheus.Metric
+	lastRefresh     time.Time
+	refreshDuration time.Duration
+
+	generation   uint64    // Номер последнего запущенного пересчета
+	running      uint64    // Номер пересчета, который еще работает (inner.Collect не вернулся), 0 - нет такого
+	runningSince time.Time // Когда он запущен
+	abandoned    int       // Брошенные пересчеты, которые еще работают
+}
+
+// New создает коллектор, пересчет запускается через Start
+func New(inner prometheus.Collector, opts Options) (*Collector, error) {
+	if opts.Name == "" {
+		return nil, errors.New("cached: Options.Name is required to name the refresh metrics")
+	}
+	opts = opts.withDefaults()
+	return &Collector{
+		inner: inner,
+		opts:  opts,
+		lastRefreshDesc: prometheus.NewDesc(opts.Name+"_last_refresh_timestamp_seconds",
+			"Unix time of the last successful refresh", nil, nil),
+		refreshDurationDesc: prometheus.NewDesc(opts.Name+"_refresh_duration_seconds",
+			"Duration of the last refresh", nil, nil),
+		staleDesc: prometheus.NewDesc(opts.Name+"_stale",
+			"Whether the served values are stale (1) or fresh (0)", nil, nil),
+		abandonedDesc: prometheus.NewDesc(opts.Name+"_abandoned_refreshes",
+			"Hung refreshes that were abandoned but are still running", nil, nil),
+	}, nil
+}
+
+// Start пересчитывает метрики сразу и затем каждые Interval, пока не отменен ctx
+func (c *Collector) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.opts.Interval)
+		defer ticker.Stop()
+
+		c.refresh()
+		for {
+			select {
+			case <-ticker.C:
+				c.refresh()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// begin возвращает номер нового пересчета или 0, если его нельзя запускать
+func (c *Collector) begin() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.running != 0 {
+		// Предыдущий пересчет, не уложившийся в таймаут, еще идет - второй не запускаем
+		if time.Since(c.runningSince) < c.opts.AbandonAfter {
+			log.Printf("%s: previous refresh is still running, skipping", c.opts.Name)
+			return 0
+		}
+		// Пересчет завис: иначе метрики больше никогда не обновятся
+		if c.abandoned >= maxAbandoned {
+			log.Printf("%s: refresh is hung for %s and %d refreshes are already abandoned, skipping",
+				c.opts.Name, time.Since(c.runningSince), c.abandoned)
+			return 0
+		}
+		log.Printf("%s: refresh is hung for %s, abandoning it", c.opts.Name, time.Since(c.runningSince))
+		c.abandoned++
+	}
+
+	c.generation++
+	c.running = c.generation
+	c.runningSince = time.Now()
+	return c.generation
+}
+
+// finish отмечает, что inner.Collect пересчета generation вернулся
+func (c *Collector) finish(generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running == generation {
+		c.running = 0
+	} else {
+		c.abandoned--
+	}
+}
+
+func (c *Collector) refresh() {
+	generation := c.begin()
+	if generation == 0 {
+		return
+	}
+
+	start := time.Now()
+	done := make(chan []prometheus.Metric, 1)
+	go func() {
+		defer c.finish(generation)
+
+		ch := make(chan prometheus.Metric)
+		go func() {
+			c.inner.Collect(ch)
+			close(ch)
+		}()
+		var metrics []prometheus.Metric
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		done <- metrics
+	}()
+
+	timer := time.NewTimer(c.opts.Timeout)
+	defer timer.Stop()
+
+	select {
+	case metrics := <-done:
+		c.mu.Lock()
+		c.metrics = metrics
+		c.lastRefresh = time.Now()
+		c.refreshDuration = time.Since(start)
+		c.mu.Unlock()
+	case <-timer.C:
+		// Результат опоздавшего пересчета отбрасывается, отдаются прежние значения
+		log.Printf("%s: refresh timed out after %s", c.opts.Name, c.opts.Timeout)
+		c.mu.Lock()
+		c.refreshDuration = time.Since(start)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.inner.Describe(ch)
+	ch <- c.lastRefreshDesc
+	ch <- c.refreshDurationDesc
+	ch <- c.staleDesc
+	ch <- c.abandonedDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	metrics := c.metrics
+	lastRefresh := c.lastRefresh
+	refreshDuration := c.refreshDuration
+	abandoned := c.abandoned
+	c.mu.RUnlock()
+
+	for _, m := range metrics {
+		ch <- m
+	}
+
+	stale := 0.0
+	if lastRefresh.IsZero() || time.Since(lastRefresh) > c.opts.StaleAfter {
+		stale = 1
+	}
+	if !lastRefresh.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastRefreshDesc, prometheus.GaugeValue, float64(lastRefresh.UnixNano())/1e9)
+	}
+	ch <- prometheus.MustNewConstMetric(c.refreshDurationDesc, prometheus.GaugeValue, refreshDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.staleDesc, prometheus.GaugeValue, stale)
+	ch <- prometheus.MustNewConstMetric(c.abandonedDesc, prometheus.GaugeValue, float64(abandoned))
+}
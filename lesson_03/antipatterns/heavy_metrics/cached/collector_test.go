@@ -0,0 +1,180 @@
+package cached
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// slowCollector отдает свое значение, пока не закрыт block
+type slowCollector struct {
+	desc  *prometheus.Desc
+	value atomic.Int64
+	calls atomic.Int64
+
+	mu    sync.Mutex
+	block chan struct{} // nil - не блокироваться
+}
+
+func newSlowCollector() *slowCollector {
+	return &slowCollector{desc: prometheus.NewDesc("test_heavy_metric", "Test", nil, nil)}
+}
+
+func (s *slowCollector) blockWith(block chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.block = block
+}
+
+func (s *slowCollector) Describe(ch chan<- *prometheus.Desc) { ch <- s.desc }
+
+func (s *slowCollector) Collect(ch chan<- prometheus.Metric) {
+	s.calls.Add(1)
+	s.mu.Lock()
+	block := s.block
+	s.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	ch <- prometheus.MustNewConstMetric(s.desc, prometheus.GaugeValue, float64(s.value.Load()))
+}
+
+func newTestCollector(t *testing.T, inner prometheus.Collector, opts Options) *Collector {
+	t.Helper()
+	opts.Name = "test_heavy_metric"
+	c, err := New(inner, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// gather возвращает значения метрик по имени
+func gather(t *testing.T, c *Collector) map[string]float64 {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64, len(families))
+	for _, family := range families {
+		values[family.GetName()] = family.GetMetric()[0].GetGauge().GetValue()
+	}
+	return values
+}
+
+func TestNewRequiresName(t *testing.T) {
+	if _, err := New(newSlowCollector(), Options{}); err == nil {
+		t.Error("New() without a name succeeded")
+	}
+}
+
+func TestCollectorServesCachedValues(t *testing.T) {
+	inner := newSlowCollector()
+	c := newTestCollector(t, inner, Options{Interval: time.Hour})
+
+	// До первого пересчета отдаются только служебные метрики
+	got := gather(t, c)
+	if _, ok := got["test_heavy_metric"]; ok || got["test_heavy_metric_stale"] != 1 {
+		t.Errorf("before refresh: %v, want only stale=1", got)
+	}
+	if _, ok := got["test_heavy_metric_last_refresh_timestamp_seconds"]; ok {
+		t.Error("last refresh timestamp before the first refresh")
+	}
+
+	inner.value.Store(42)
+	c.refresh()
+	inner.value.Store(43)
+	got = gather(t, c)
+	if got["test_heavy_metric"] != 42 || got["test_heavy_metric_stale"] != 0 || got["test_heavy_metric_last_refresh_timestamp_seconds"] == 0 {
+		t.Errorf("after refresh: %v, want the cached value 42, fresh", got)
+	}
+	// Scrape не вызывает inner.Collect
+	if calls := inner.calls.Load(); calls != 1 {
+		t.Errorf("inner collected %d times, want 1", calls)
+	}
+}
+
+func TestCollectorTimeoutKeepsPreviousValues(t *testing.T) {
+	inner := newSlowCollector()
+	c := newTestCollector(t, inner, Options{Interval: time.Hour, Timeout: 10 * time.Millisecond, StaleAfter: 20 * time.Millisecond})
+	inner.value.Store(1)
+	c.refresh()
+
+	block := make(chan struct{})
+	defer close(block)
+	inner.blockWith(block)
+	inner.value.Store(2)
+	start := time.Now()
+	c.refresh()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("refresh took %s, want it bounded by the timeout", elapsed)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	got := gather(t, c)
+	if got["test_heavy_metric"] != 1 || got["test_heavy_metric_stale"] != 1 {
+		t.Errorf("after timeout: %v, want the previous value 1, stale", got)
+	}
+}
+
+func TestCollectorAbandonsHungRefresh(t *testing.T) {
+	inner := newSlowCollector()
+	c := newTestCollector(t, inner, Options{Interval: time.Hour, Timeout: time.Millisecond, AbandonAfter: 20 * time.Millisecond})
+
+	hung := make(chan struct{})
+	inner.blockWith(hung)
+	c.refresh()
+	// Пока пересчет идет меньше AbandonAfter, второй не запускается
+	c.refresh()
+	if calls := inner.calls.Load(); calls != 1 {
+		t.Fatalf("inner collected %d times while the refresh is running, want 1", calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	inner.blockWith(nil)
+	inner.value.Store(7)
+	c.refresh()
+	got := gather(t, c)
+	if inner.calls.Load() != 2 || got["test_heavy_metric"] != 7 || got["test_heavy_metric_abandoned_refreshes"] != 1 {
+		t.Errorf("after abandoning: %d calls, %v; want a new refresh and one abandoned", inner.calls.Load(), got)
+	}
+
+	// Брошенный пересчет завершился
+	close(hung)
+	deadline := time.Now().Add(time.Second)
+	for gather(t, c)["test_heavy_metric_abandoned_refreshes"] != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("abandoned refresh is still counted after it returned")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := gather(t, c)["test_heavy_metric"]; got != 7 {
+		t.Errorf("value = %v, the late result of the abandoned refresh must be dropped", got)
+	}
+}
+
+func TestCollectorLimitsAbandonedRefreshes(t *testing.T) {
+	inner := newSlowCollector()
+	c := newTestCollector(t, inner, Options{Interval: time.Hour, Timeout: time.Millisecond, AbandonAfter: 5 * time.Millisecond})
+	hung := make(chan struct{})
+	defer close(hung)
+	inner.blockWith(hung)
+
+	for i := 0; i < maxAbandoned+3; i++ {
+		c.refresh()
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Первый пересчет и maxAbandoned новых, после этого новые не запускаются
+	if calls := inner.calls.Load(); calls != maxAbandoned+1 {
+		t.Errorf("inner collected %d times, want %d", calls, maxAbandoned+1)
+	}
+	if got := gather(t, c)["test_heavy_metric_abandoned_refreshes"]; got != maxAbandoned {
+		t.Errorf("abandoned = %v, want %d", got, maxAbandoned)
+	}
+}
@@ -2,7 +2,10 @@ module example
 
 go 1.23.5
 
-require github.com/prometheus/client_golang v1.20.5
+require (
+	example/cached v0.0.0
+	github.com/prometheus/client_golang v1.20.5
+)
 
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
@@ -15,3 +18,5 @@ require (
 	golang.org/x/sys v0.22.0 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
 )
+
+replace example/cached => ./cached
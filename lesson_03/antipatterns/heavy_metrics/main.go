@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"example/cached"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
@@ -26,7 +28,7 @@ func (collector *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.heavyMetric
 }
 
-// This fuction runs when Prometheus scrapes the exporter
+// This function is expensive, so it's called by cached.Collector in the background, not on scrape
 func (collector *Collector) Collect(ch chan<- prometheus.Metric) {
 	time.Sleep(time.Second * 3)
 	// Here we set new value for the metric
@@ -34,7 +36,17 @@ func (collector *Collector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func main() {
-	collector := newCollector()
+	// The 3-second calculation runs in the background every 10 seconds,
+	// scrapes get the last values immediately together with my_heavy_metric_stale
+	collector, err := cached.New(newCollector(), cached.Options{
+		Name:     "my_heavy_metric",
+		Interval: 10 * time.Second,
+		Timeout:  5 * time.Second,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	collector.Start(context.Background())
 	prometheus.MustRegister(collector)
 
 	http.Handle("/metrics", promhttp.Handler())
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"example/httpmetrics"
+	"example/httpmetrics/chimetrics"
+	"example/httpmetrics/ginmetrics"
+	"example/httpmetrics/muxmetrics"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Одни и те же метрики для четырех роутеров, роутер различается лейблом router.
+//
+// curl localhost:8080/user/1   # net/http
+// curl localhost:8081/user/2   # chi
+// curl localhost:8082/user/3   # gorilla/mux
+// curl localhost:8083/user/4   # gin
+// curl localhost:8081/random/path
+// curl localhost:8080/metrics | grep http_
+func main() {
+	newMetrics := func(router string) *httpmetrics.Metrics {
+		return httpmetrics.New(httpmetrics.Options{
+			ConstLabels: prometheus.Labels{"router": router},
+		})
+	}
+
+	// net/http
+	std := http.NewServeMux()
+	std.HandleFunc("GET /user/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "User ID: %s\n", r.PathValue("id"))
+	})
+	std.Handle("/metrics", promhttp.Handler())
+	go serve(":8080", newMetrics("net/http").ServeMux(std))
+
+	// chi
+	chiRouter := chi.NewRouter()
+	chiRouter.Use(chimetrics.Middleware(newMetrics("chi")))
+	chiRouter.Get("/user/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "User ID: %s\n", chi.URLParam(r, "id"))
+	})
+	go serve(":8081", chiRouter)
+
+	// gorilla/mux
+	muxRouter := mux.NewRouter()
+	muxRouter.HandleFunc("/user/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "User ID: %s\n", mux.Vars(r)["id"])
+	}).Methods(http.MethodGet)
+	muxmetrics.Instrument(newMetrics("gorilla/mux"), muxRouter)
+	go serve(":8082", muxRouter)
+
+	// gin
+	gin.SetMode(gin.ReleaseMode)
+	ginRouter := gin.New()
+	ginRouter.Use(ginmetrics.Middleware(newMetrics("gin")))
+	ginRouter.GET("/user/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "User ID: %s\n", c.Param("id"))
+	})
+	serve(":8083", ginRouter)
+}
+
+func serve(addr string, handler http.Handler) {
+	fmt.Printf("Server listening on %s\n", addr)
+	log.Fatal(http.ListenAndServe(addr, handler))
+}
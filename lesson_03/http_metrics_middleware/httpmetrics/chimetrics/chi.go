@@ -0,0 +1,25 @@
+// Package chimetrics подключает httpmetrics к chi
+package chimetrics
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"example/httpmetrics"
+)
+
+// Route возвращает шаблон роута chi, например /user/{id}
+func Route(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+	return rctx.RoutePattern()
+}
+
+// Middleware возвращает middleware для chi.Router.Use.
+// Middleware роутера выполняются и для ненайденных роутов, поэтому они тоже попадают в метрики.
+func Middleware(m *httpmetrics.Metrics) func(http.Handler) http.Handler {
+	return m.Middleware(Route)
+}
@@ -0,0 +1,35 @@
+package chimetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"example/httpmetrics"
+)
+
+func TestMiddleware(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	router := chi.NewRouter()
+	router.Use(Middleware(httpmetrics.New(httpmetrics.Options{Registerer: registry})))
+	router.Get("/user/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, path := range []string{"/user/1", "/user/2", "/random/path"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expected := `
+# HELP http_requests_total Total number of HTTP requests
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/user/{id}",status="200"} 2
+http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_requests_total"); err != nil {
+		t.Error(err)
+	}
+}
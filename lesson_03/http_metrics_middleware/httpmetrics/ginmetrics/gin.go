@@ -0,0 +1,29 @@
+// Package ginmetrics подключает httpmetrics к gin
+package ginmetrics
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"example/httpmetrics"
+)
+
+// Middleware возвращает middleware для gin.Engine.Use.
+// Шаблон роута берется из c.FullPath(), для ненайденных роутов он пустой.
+func Middleware(m *httpmetrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m.InFlight().Inc()
+		defer m.InFlight().Dec()
+
+		start := time.Now()
+		c.Next()
+
+		// Size() возвращает -1, если тело не записывалось
+		size := int64(c.Writer.Size())
+		if size < 0 {
+			size = 0
+		}
+		m.Observe(c.Request.Method, c.FullPath(), c.Writer.Status(), size, time.Since(start))
+	}
+}
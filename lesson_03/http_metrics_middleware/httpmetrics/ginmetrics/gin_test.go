@@ -0,0 +1,42 @@
+package ginmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"example/httpmetrics"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := prometheus.NewRegistry()
+	router := gin.New()
+	metrics := httpmetrics.New(httpmetrics.Options{Registerer: registry})
+	router.Use(Middleware(metrics))
+	router.GET("/user/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "User ID: %s", c.Param("id"))
+	})
+
+	for _, path := range []string{"/user/1", "/random/path"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expected := `
+# HELP http_requests_total Total number of HTTP requests
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/user/:id",status="200"} 1
+http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_requests_total"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.ToFloat64(metrics.InFlight()); got != 0 {
+		t.Errorf("in flight = %v after the requests, want 0", got)
+	}
+}
@@ -0,0 +1,136 @@
+// Package httpmetrics - HTTP метрики с шаблоном роута вместо пути запроса.
+//
+// Пакет вынесен в отдельный модуль, чтобы его подключали сервисы из других модулей:
+//
+//	require example/httpmetrics v0.0.0
+//	replace example/httpmetrics => ../../../lesson_03/http_metrics_middleware/httpmetrics
+//
+// Сам пакет работает с net/http, адаптеры роутеров лежат в chimetrics, muxmetrics и ginmetrics,
+// поэтому сервис собирает только свой роутер.
+package httpmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// UnmatchedRoute - значение лейбла route для запросов, которые не попали ни в один роут.
+// Без него каждый случайный путь (сканеры, опечатки) создает новую серию.
+const UnmatchedRoute = "unmatched"
+
+// OtherMethod - значение лейбла method для нестандартных HTTP методов
+const OtherMethod = "OTHER"
+
+// Options настройки метрик
+type Options struct {
+	Namespace   string
+	ConstLabels prometheus.Labels
+	Buckets     []float64             // Бакеты длительности запроса, по умолчанию prometheus.DefBuckets
+	SizeBuckets []float64             // Бакеты размера ответа в байтах
+	Registerer  prometheus.Registerer // По умолчанию prometheus.DefaultRegisterer
+}
+
+// Metrics содержит HTTP метрики и middleware для разных роутеров
+type Metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// RouteFunc возвращает шаблон роута (например /user/{id}) или пустую строку, если роут не найден.
+// Вызывается после обработки запроса, когда роутер уже сохранил найденный роут.
+type RouteFunc func(r *http.Request) string
+
+// New создает и регистрирует метрики
+func New(opts Options) *Metrics {
+	if opts.Buckets == nil {
+		opts.Buckets = prometheus.DefBuckets
+	}
+	if opts.SizeBuckets == nil {
+		opts.SizeBuckets = prometheus.ExponentialBuckets(100, 10, 6) // 100B .. 10MB
+	}
+	if opts.Registerer == nil {
+		opts.Registerer = prometheus.DefaultRegisterer
+	}
+	factory := promauto.With(opts.Registerer)
+	labels := []string{"route", "method", "status"}
+
+	return &Metrics{
+		requests: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "http_requests_total",
+			Help:        "Total number of HTTP requests",
+			ConstLabels: opts.ConstLabels,
+		}, labels),
+		duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "http_request_duration_seconds",
+			Help:        "HTTP request duration in seconds",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.Buckets,
+		}, labels),
+		size: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "http_response_size_bytes",
+			Help:        "HTTP response body size in bytes",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.SizeBuckets,
+		}, labels),
+		inFlight: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Name:        "http_requests_in_flight",
+			Help:        "Number of HTTP requests being served",
+			ConstLabels: opts.ConstLabels,
+		}),
+	}
+}
+
+// Middleware возвращает net/http middleware, роут запроса определяет route
+func (m *Metrics) Middleware(route RouteFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.inFlight.Inc()
+			defer m.inFlight.Dec()
+
+			start := time.Now()
+			ww := NewResponseWriter(w)
+			next.ServeHTTP(ww, r)
+
+			m.Observe(r.Method, route(r), ww.Status(), ww.Size(), time.Since(start))
+		})
+	}
+}
+
+// InFlight возвращает gauge запросов в обработке, для адаптеров роутеров без http.Handler
+func (m *Metrics) InFlight() prometheus.Gauge {
+	return m.inFlight
+}
+
+// Observe записывает завершенный запрос, для адаптеров роутеров без http.Handler.
+// Пустой route считается ненайденным роутом.
+func (m *Metrics) Observe(method, route string, status int, size int64, duration time.Duration) {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	method = normalizeMethod(method)
+	code := strconv.Itoa(status)
+
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.duration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+	m.size.WithLabelValues(route, method, code).Observe(float64(size))
+}
+
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return OtherMethod
+	}
+}
@@ -0,0 +1,66 @@
+package httpmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestMetrics(t *testing.T) (*Metrics, *prometheus.Registry) {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	return New(Options{Registerer: registry}), registry
+}
+
+func requests(route, method, status string) string {
+	return `http_requests_total{method="` + method + `",route="` + route + `",status="` + status + `"} 1`
+}
+
+func assertRequests(t *testing.T, registry *prometheus.Registry, want ...string) {
+	t.Helper()
+	expected := "# HELP http_requests_total Total number of HTTP requests\n# TYPE http_requests_total counter\n" +
+		strings.Join(want, "\n") + "\n"
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_requests_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func serve(handler http.Handler, method, path string) {
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+}
+
+func TestServeMux(t *testing.T) {
+	m, registry := newTestMetrics(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /user/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("id")))
+	})
+	handler := m.ServeMux(mux)
+
+	serve(handler, http.MethodGet, "/user/1")
+	serve(handler, "PURGE", "/random/path")
+
+	assertRequests(t, registry,
+		requests("/user/{id}", "GET", "200"),
+		requests(UnmatchedRoute, OtherMethod, "404"),
+	)
+}
+
+func TestTemplates(t *testing.T) {
+	route := Templates("/user/:id", "/user/{id}/orders", "/health")
+	for path, want := range map[string]string{
+		"/user/1":         "/user/:id",
+		"/user/1/orders/": "/user/{id}/orders",
+		"/health":         "/health",
+		"/user/":          "",
+		"/user/1/cart":    "",
+	} {
+		if got := route(httptest.NewRequest(http.MethodGet, path, nil)); got != want {
+			t.Errorf("route(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
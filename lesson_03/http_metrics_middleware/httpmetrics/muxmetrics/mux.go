@@ -0,0 +1,45 @@
+// Package muxmetrics подключает httpmetrics к gorilla/mux
+package muxmetrics
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"example/httpmetrics"
+)
+
+// Route возвращает шаблон роута gorilla/mux, например /user/{id}
+func Route(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return template
+}
+
+// Instrument подключает метрики к роутеру.
+// Middleware из router.Use не вызываются для ненайденных роутов,
+// поэтому NotFoundHandler и MethodNotAllowedHandler оборачиваются отдельно.
+func Instrument(m *httpmetrics.Metrics, router *mux.Router) {
+	router.Use(m.Middleware(Route))
+
+	unmatched := m.Middleware(func(*http.Request) string { return "" })
+	notFound := router.NotFoundHandler
+	if notFound == nil {
+		notFound = http.NotFoundHandler()
+	}
+	router.NotFoundHandler = unmatched(notFound)
+
+	methodNotAllowed := router.MethodNotAllowedHandler
+	if methodNotAllowed == nil {
+		methodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		})
+	}
+	router.MethodNotAllowedHandler = unmatched(methodNotAllowed)
+}
@@ -0,0 +1,40 @@
+package muxmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"example/httpmetrics"
+)
+
+func TestInstrument(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	router := mux.NewRouter()
+	router.HandleFunc("/user/{id}", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+	Instrument(httpmetrics.New(httpmetrics.Options{Registerer: registry}), router)
+
+	serve := func(method, path string) {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+	}
+	serve(http.MethodGet, "/user/1")
+	serve(http.MethodPost, "/user/1")
+	serve(http.MethodGet, "/random/path")
+
+	// Unmatched requests are counted although router.Use middlewares do not run for them
+	expected := `
+# HELP http_requests_total Total number of HTTP requests
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/user/{id}",status="200"} 1
+http_requests_total{method="GET",route="unmatched",status="404"} 1
+http_requests_total{method="POST",route="unmatched",status="405"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_requests_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,74 @@
+package httpmetrics
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ServeMuxRoute возвращает шаблон роута http.ServeMux (Go 1.22+).
+// ServeMux сохраняет найденный шаблон в r.Pattern, например "GET example.com/user/{id}",
+// в лейбл попадает только путь: "/user/{id}".
+func ServeMuxRoute(r *http.Request) string {
+	pattern := r.Pattern
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i+1:], " \t")
+	}
+	if i := strings.IndexByte(pattern, '/'); i > 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
+
+// ServeMux оборачивает http.ServeMux
+func (m *Metrics) ServeMux(mux *http.ServeMux) http.Handler {
+	return m.Middleware(ServeMuxRoute)(mux)
+}
+
+// Templates возвращает RouteFunc, который сопоставляет путь с шаблонами вида /user/:id или /user/{id}.
+// Подходит для роутеров, которые не сохраняют найденный роут. Первый подошедший шаблон побеждает.
+func Templates(templates ...string) RouteFunc {
+	parsed := make([][]string, len(templates))
+	for i, template := range templates {
+		parsed[i] = splitPath(template)
+	}
+
+	return func(r *http.Request) string {
+		segments := splitPath(r.URL.Path)
+		for i, template := range parsed {
+			if matchTemplate(template, segments) {
+				return templates[i]
+			}
+		}
+		return ""
+	}
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func matchTemplate(template, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i, part := range template {
+		if isParam(part) {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isParam(part string) bool {
+	return strings.HasPrefix(part, ":") || (strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"))
+}
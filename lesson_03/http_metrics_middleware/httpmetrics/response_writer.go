@@ -0,0 +1,80 @@
+package httpmetrics
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter запоминает статус и размер ответа.
+// Если обработчик вызывает только Write, net/http сам отправляет 200, поэтому статус фиксируется при первой записи.
+type ResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+// NewResponseWriter оборачивает w, для собственных middleware с другим набором метрик
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+// Status возвращает финальный статус ответа, 200 если обработчик ничего не записал
+func (w *ResponseWriter) Status() int {
+	return w.status
+}
+
+// Size возвращает размер записанного тела ответа в байтах
+func (w *ResponseWriter) Size() int64 {
+	return w.size
+}
+
+func (w *ResponseWriter) WriteHeader(status int) {
+	// 1xx ответы не финальные, после них будет отправлен настоящий статус
+	if !w.wroteHeader && status >= 200 {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	w.fixStatus(http.StatusOK)
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *ResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.fixStatus(http.StatusOK)
+		flusher.Flush()
+	}
+}
+
+// Hijack передает соединение обработчику, например для WebSocket.
+// Дальше ответ пишется в соединение напрямую, поэтому в метрики попадает 101 Switching Protocols.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.fixStatus(http.StatusSwitchingProtocols)
+	}
+	return conn, rw, err
+}
+
+// Unwrap нужен для http.ResponseController
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *ResponseWriter) fixStatus(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+}
@@ -0,0 +1,109 @@
+package httpmetrics
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseWriterStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		size    int64
+	}{
+		{
+			name:    "nothing written",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			status:  http.StatusOK,
+		},
+		{
+			name: "implicit 200 on write",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+				w.WriteHeader(http.StatusInternalServerError) // superfluous, ignored by net/http
+			},
+			status: http.StatusOK,
+			size:   5,
+		},
+		{
+			name: "explicit status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("not found"))
+			},
+			status: http.StatusNotFound,
+			size:   9,
+		},
+		{
+			name: "1xx before the final status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusCreated)
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "implicit 200 on flush",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.(http.Flusher).Flush()
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ww := NewResponseWriter(httptest.NewRecorder())
+			tt.handler(ww, httptest.NewRequest(http.MethodGet, "/", nil))
+			if ww.Status() != tt.status || ww.Size() != tt.size {
+				t.Errorf("status %d, size %d; want %d, %d", ww.Status(), ww.Size(), tt.status, tt.size)
+			}
+		})
+	}
+}
+
+func TestResponseWriterFlushThroughController(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	ww := NewResponseWriter(recorder)
+	// ResponseController finds the Flusher of the wrapped writer through Unwrap
+	if err := http.NewResponseController(ww).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !recorder.Flushed || ww.Status() != http.StatusOK {
+		t.Errorf("flushed %v, status %d", recorder.Flushed, ww.Status())
+	}
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ww := NewResponseWriter(&hijackRecorder{ResponseRecorder: httptest.NewRecorder(), conn: server})
+	conn, _, err := ww.Hijack()
+	if err != nil || conn != server {
+		t.Fatalf("Hijack() = %v, %v", conn, err)
+	}
+	if ww.Status() != http.StatusSwitchingProtocols {
+		t.Errorf("status %d after hijack, want 101", ww.Status())
+	}
+
+	// A writer without Hijacker reports it instead of panicking
+	if _, _, err := NewResponseWriter(httptest.NewRecorder()).Hijack(); err != http.ErrNotSupported {
+		t.Errorf("Hijack() err = %v, want http.ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,61 @@
+package window
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector отдает статистику окна в Prometheus. Окно считается в момент scrape,
+// поэтому не нужна отдельная горутина, которая периодически обновляет gauge.
+//
+//	<name>{quantile="0.5"}, <name>_min, <name>_max, <name>_mean, <name>_count
+type Collector struct {
+	window    *Window
+	quantile  *prometheus.Desc
+	min       *prometheus.Desc
+	max       *prometheus.Desc
+	mean      *prometheus.Desc
+	count     *prometheus.Desc
+	quantiles []float64
+}
+
+// NewCollector создает коллектор для окна w
+func NewCollector(w *Window, name, help string, constLabels prometheus.Labels) *Collector {
+	return &Collector{
+		window:    w,
+		quantile:  prometheus.NewDesc(name, help+" (quantiles over the sliding window)", []string{"quantile"}, constLabels),
+		min:       prometheus.NewDesc(name+"_min", help+" (min over the sliding window)", nil, constLabels),
+		max:       prometheus.NewDesc(name+"_max", help+" (max over the sliding window)", nil, constLabels),
+		mean:      prometheus.NewDesc(name+"_mean", help+" (mean over the sliding window)", nil, constLabels),
+		count:     prometheus.NewDesc(name+"_count", help+" (number of observations in the sliding window)", nil, constLabels),
+		quantiles: w.Quantiles(),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.quantile
+	ch <- c.min
+	ch <- c.max
+	ch <- c.mean
+	ch <- c.count
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	snapshot := c.window.Snapshot()
+	ch <- prometheus.MustNewConstMetric(c.count, prometheus.GaugeValue, float64(snapshot.Count))
+	// Для пустого окна статистики нет, отдавать NaN или 0 было бы неверно
+	if snapshot.Count == 0 {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.min, prometheus.GaugeValue, snapshot.Min)
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, snapshot.Max)
+	ch <- prometheus.MustNewConstMetric(c.mean, prometheus.GaugeValue, snapshot.Mean)
+	for _, q := range c.quantiles {
+		ch <- prometheus.MustNewConstMetric(c.quantile, prometheus.GaugeValue, snapshot.Quantiles[q], formatQuantile(q))
+	}
+}
+
+func formatQuantile(q float64) string {
+	return strconv.FormatFloat(q, 'f', -1, 64)
+}
@@ -0,0 +1,50 @@
+package window
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RegisterObservableGauges отдает статистику окна через OTel observable gauges
+// <name> (с атрибутом quantile), <name>.min, <name>.max и <name>.mean.
+// Окно считается один раз на каждый сбор метрик.
+func RegisterObservableGauges(meter metric.Meter, w *Window, name, description string) (metric.Registration, error) {
+	quantile, err := meter.Float64ObservableGauge(name, metric.WithDescription(description))
+	if err != nil {
+		return nil, err
+	}
+	minGauge, err := meter.Float64ObservableGauge(name+".min", metric.WithDescription(description+" (min)"))
+	if err != nil {
+		return nil, err
+	}
+	maxGauge, err := meter.Float64ObservableGauge(name+".max", metric.WithDescription(description+" (max)"))
+	if err != nil {
+		return nil, err
+	}
+	mean, err := meter.Float64ObservableGauge(name+".mean", metric.WithDescription(description+" (mean)"))
+	if err != nil {
+		return nil, err
+	}
+
+	quantiles := w.Quantiles()
+	quantileAttrs := make([]metric.ObserveOption, len(quantiles))
+	for i, q := range quantiles {
+		quantileAttrs[i] = metric.WithAttributes(attribute.String("quantile", formatQuantile(q)))
+	}
+
+	return meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		snapshot := w.Snapshot()
+		if snapshot.Count == 0 {
+			return nil
+		}
+		o.ObserveFloat64(minGauge, snapshot.Min)
+		o.ObserveFloat64(maxGauge, snapshot.Max)
+		o.ObserveFloat64(mean, snapshot.Mean)
+		for i, q := range quantiles {
+			o.ObserveFloat64(quantile, snapshot.Quantiles[q], quantileAttrs[i])
+		}
+		return nil
+	}, quantile, minGauge, maxGauge, mean)
+}
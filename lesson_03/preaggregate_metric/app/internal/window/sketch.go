@@ -0,0 +1,94 @@
+package window
+
+import "math"
+
+// sketch - упрощенный DDSketch: значения раскладываются по логарифмическим бакетам,
+// поэтому квантиль считается с относительной погрешностью alpha при фиксированной памяти
+// и без сортировки всех значений. Скетчи с одинаковой точностью можно объединять.
+type sketch struct {
+	gamma    float64
+	logGamma float64
+	positive map[int]uint64
+	negative map[int]uint64
+	zeros    uint64
+	count    uint64
+}
+
+func newSketch(alpha float64) *sketch {
+	gamma := (1 + alpha) / (1 - alpha)
+	return &sketch{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		positive: make(map[int]uint64),
+		negative: make(map[int]uint64),
+	}
+}
+
+func (s *sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// value возвращает середину бакета с учетом относительной погрешности
+func (s *sketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (1 + s.gamma)
+}
+
+func (s *sketch) add(v float64) {
+	switch {
+	case v > 0:
+		s.positive[s.index(v)]++
+	case v < 0:
+		s.negative[s.index(-v)]++
+	default:
+		s.zeros++
+	}
+	s.count++
+}
+
+func (s *sketch) merge(other *sketch) {
+	for i, c := range other.positive {
+		s.positive[i] += c
+	}
+	for i, c := range other.negative {
+		s.negative[i] += c
+	}
+	s.zeros += other.zeros
+	s.count += other.count
+}
+
+func (s *sketch) reset() {
+	clear(s.positive)
+	clear(s.negative)
+	s.zeros = 0
+	s.count = 0
+}
+
+// quantile возвращает значение квантиля q (0..1), NaN для пустого скетча
+func (s *sketch) quantile(q float64) float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	rank := uint64(q * float64(s.count-1))
+
+	// Отрицательные значения идут от больших по модулю к меньшим
+	negative := sortedKeys(s.negative, true)
+	var seen uint64
+	for _, i := range negative {
+		seen += s.negative[i]
+		if seen > rank {
+			return -s.value(i)
+		}
+	}
+	seen += s.zeros
+	if seen > rank {
+		return 0
+	}
+	positive := sortedKeys(s.positive, false)
+	for _, i := range positive {
+		seen += s.positive[i]
+		if seen > rank {
+			return s.value(i)
+		}
+	}
+	return s.value(positive[len(positive)-1])
+}
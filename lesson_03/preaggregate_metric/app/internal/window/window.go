@@ -0,0 +1,167 @@
+package window
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Options настройки окна
+type Options struct {
+	Window           time.Duration // Длина окна, по умолчанию 15s
+	Buckets          int           // Количество бакетов в окне, по умолчанию 15 (по секунде на бакет)
+	RelativeAccuracy float64       // Относительная погрешность квантилей, по умолчанию 1%
+	Quantiles        []float64     // По умолчанию p50, p90, p99
+}
+
+func (o Options) withDefaults() Options {
+	if o.Window <= 0 {
+		o.Window = 15 * time.Second
+	}
+	if o.Buckets <= 0 {
+		o.Buckets = 15
+	}
+	if o.RelativeAccuracy <= 0 || o.RelativeAccuracy >= 1 {
+		o.RelativeAccuracy = 0.01
+	}
+	if o.Quantiles == nil {
+		o.Quantiles = []float64{0.5, 0.9, 0.99}
+	}
+	return o
+}
+
+// Snapshot статистика по окну. Для пустого окна Count = 0, остальные значения NaN.
+type Snapshot struct {
+	Count     uint64
+	Min       float64
+	Max       float64
+	Mean      float64
+	Quantiles map[float64]float64
+}
+
+// bucket хранит значения за отрезок окна длиной Window/Buckets
+type bucket struct {
+	start  int64 // Номер отрезка времени, к которому относятся значения
+	count  uint64
+	sum    float64
+	min    float64
+	max    float64
+	sketch *sketch
+}
+
+// Window агрегирует значения за скользящее окно.
+// Окно разбито на бакеты по времени: устаревший бакет очищается при записи в него,
+// а при чтении бакеты старше окна пропускаются. Безопасен для конкурентного использования.
+type Window struct {
+	opts  Options
+	width time.Duration
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets []bucket
+}
+
+// New создает окно. Длина бакета Window/Buckets должна быть не меньше наносекунды.
+func New(opts Options) (*Window, error) {
+	opts = opts.withDefaults()
+	width := opts.Window / time.Duration(opts.Buckets)
+	if width <= 0 {
+		return nil, fmt.Errorf("window: %s is too short for %d buckets", opts.Window, opts.Buckets)
+	}
+	w := &Window{
+		opts:    opts,
+		width:   width,
+		now:     time.Now,
+		buckets: make([]bucket, opts.Buckets),
+	}
+	for i := range w.buckets {
+		w.buckets[i] = bucket{start: -1, sketch: newSketch(opts.RelativeAccuracy)}
+	}
+	return w, nil
+}
+
+// Quantiles возвращает квантили, которые считаются в Snapshot
+func (w *Window) Quantiles() []float64 {
+	return slices.Clone(w.opts.Quantiles)
+}
+
+// Observe добавляет значение в текущий бакет
+func (w *Window) Observe(v float64) {
+	slot := w.now().UnixNano() / int64(w.width)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	b := &w.buckets[slot%int64(len(w.buckets))]
+	if b.start != slot {
+		b.start = slot
+		b.count = 0
+		b.sum = 0
+		b.sketch.reset()
+	}
+	if b.count == 0 || v < b.min {
+		b.min = v
+	}
+	if b.count == 0 || v > b.max {
+		b.max = v
+	}
+	b.count++
+	b.sum += v
+	b.sketch.add(v)
+}
+
+// Snapshot считает статистику по бакетам, попадающим в окно
+func (w *Window) Snapshot() Snapshot {
+	slot := w.now().UnixNano() / int64(w.width)
+	oldest := slot - int64(len(w.buckets)) + 1
+
+	merged := newSketch(w.opts.RelativeAccuracy)
+	snapshot := Snapshot{
+		Min:       math.NaN(),
+		Max:       math.NaN(),
+		Mean:      math.NaN(),
+		Quantiles: make(map[float64]float64, len(w.opts.Quantiles)),
+	}
+	var sum float64
+
+	w.mu.Lock()
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.start < oldest || b.start > slot || b.count == 0 {
+			continue
+		}
+		if snapshot.Count == 0 || b.min < snapshot.Min {
+			snapshot.Min = b.min
+		}
+		if snapshot.Count == 0 || b.max > snapshot.Max {
+			snapshot.Max = b.max
+		}
+		snapshot.Count += b.count
+		sum += b.sum
+		merged.merge(b.sketch)
+	}
+	w.mu.Unlock()
+
+	if snapshot.Count > 0 {
+		snapshot.Mean = sum / float64(snapshot.Count)
+	}
+	for _, q := range w.opts.Quantiles {
+		// Квантиль не выходит за реальные min/max, которые известны точно
+		snapshot.Quantiles[q] = math.Max(snapshot.Min, math.Min(snapshot.Max, merged.quantile(q)))
+	}
+	return snapshot
+}
+
+func sortedKeys(m map[int]uint64, reverse bool) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if reverse {
+		slices.Reverse(keys)
+	}
+	return keys
+}
@@ -0,0 +1,96 @@
+package window
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func newTestWindow(now *time.Time) *Window {
+	w, err := New(Options{Window: 10 * time.Second, Buckets: 10})
+	if err != nil {
+		panic(err)
+	}
+	w.now = func() time.Time { return *now }
+	return w
+}
+
+func TestNewRejectsEmptyBuckets(t *testing.T) {
+	if _, err := New(Options{Window: 10 * time.Nanosecond, Buckets: 15}); err == nil {
+		t.Error("New() with buckets shorter than a nanosecond succeeded")
+	}
+	if _, err := New(Options{Window: 15 * time.Nanosecond, Buckets: 15}); err != nil {
+		t.Errorf("New() with one-nanosecond buckets: %v", err)
+	}
+}
+
+func TestWindowSnapshot(t *testing.T) {
+	now := time.Unix(1000, 0)
+	w := newTestWindow(&now)
+
+	for i := 1; i <= 1000; i++ {
+		w.Observe(float64(i))
+	}
+	snapshot := w.Snapshot()
+
+	if snapshot.Count != 1000 {
+		t.Fatalf("count = %d, want 1000", snapshot.Count)
+	}
+	if snapshot.Min != 1 || snapshot.Max != 1000 || snapshot.Mean != 500.5 {
+		t.Fatalf("min/max/mean = %v/%v/%v, want 1/1000/500.5", snapshot.Min, snapshot.Max, snapshot.Mean)
+	}
+	for q, want := range map[float64]float64{0.5: 500, 0.9: 900, 0.99: 990} {
+		got := snapshot.Quantiles[q]
+		if math.Abs(got-want)/want > 0.02 {
+			t.Errorf("p%v = %v, want %v +/- 2%%", q*100, got, want)
+		}
+	}
+}
+
+func TestWindowExpiresBuckets(t *testing.T) {
+	now := time.Unix(1000, 0)
+	w := newTestWindow(&now)
+
+	w.Observe(100)
+	now = now.Add(5 * time.Second)
+	w.Observe(5)
+
+	if snapshot := w.Snapshot(); snapshot.Count != 2 || snapshot.Max != 100 {
+		t.Fatalf("count/max = %d/%v, want 2/100", snapshot.Count, snapshot.Max)
+	}
+
+	// The spike leaves the window, the newer value is still there
+	now = now.Add(6 * time.Second)
+	if snapshot := w.Snapshot(); snapshot.Count != 1 || snapshot.Max != 5 {
+		t.Fatalf("count/max = %d/%v, want 1/5", snapshot.Count, snapshot.Max)
+	}
+
+	// The bucket of the spike is reused and reset
+	now = now.Add(4 * time.Second)
+	w.Observe(7)
+	if snapshot := w.Snapshot(); snapshot.Count != 1 || snapshot.Min != 7 {
+		t.Fatalf("count/min = %d/%v, want 1/7", snapshot.Count, snapshot.Min)
+	}
+}
+
+func TestWindowEmpty(t *testing.T) {
+	now := time.Unix(1000, 0)
+	w := newTestWindow(&now)
+
+	snapshot := w.Snapshot()
+	if snapshot.Count != 0 || !math.IsNaN(snapshot.Max) || !math.IsNaN(snapshot.Quantiles[0.5]) {
+		t.Fatalf("unexpected snapshot of empty window: %+v", snapshot)
+	}
+}
+
+func TestSketchNegativeValues(t *testing.T) {
+	s := newSketch(0.01)
+	for _, v := range []float64{-10, -5, 0, 5, 10} {
+		s.add(v)
+	}
+	for q, want := range map[float64]float64{0: -10, 0.25: -5, 0.5: 0, 0.75: 5, 1: 10} {
+		if got := s.quantile(q); math.Abs(got-want) > math.Abs(want)*0.02 {
+			t.Errorf("quantile(%v) = %v, want %v", q, got, want)
+		}
+	}
+}
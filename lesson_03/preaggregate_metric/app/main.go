@@ -1,19 +1,18 @@
 package main
 
 import (
-	"container/ring"
+	"example/internal/window"
 	"fmt"
 	"net/http"
-	"sort"
-	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
 )
 
 const (
-	windowSize = 15 // Size of the sliding window in seconds
+	windowSize = 15 * time.Second // Size of the sliding window
 )
 
 var (
@@ -22,29 +21,35 @@ var (
 		Help: "Instantaneous value that can spike",
 	})
 
-	slidingWindowMaxValueGauge = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "sliding_window_max_value",
-		Help: "Maximum value over the sliding window",
-	})
-
-	slidingWindowMedianValueGauge = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "sliding_window_median_value",
-		Help: "Median value over the sliding window",
-	})
-
-	valueRing = ring.New(windowSize) // Ring buffer
-	mutex     = &sync.Mutex{}
+	// slidingWindow keeps 15 one-second buckets, stats are calculated on scrape:
+	// sliding_window_value_max, sliding_window_value{quantile="0.5"}, ...
+	slidingWindow *window.Window
 )
 
 func init() {
-	prometheus.MustRegister(instantaneousValueGauge, slidingWindowMaxValueGauge, slidingWindowMedianValueGauge)
+	var err error
+	slidingWindow, err = window.New(window.Options{
+		Window:  windowSize,
+		Buckets: 15,
+	})
+	if err != nil {
+		panic(err)
+	}
+	prometheus.MustRegister(
+		instantaneousValueGauge,
+		window.NewCollector(slidingWindow, "sliding_window_value", "Value over the sliding window", nil),
+	)
 }
 
 func main() {
+	// The same window is available for OTel, with the global (here no-op) meter provider
+	if _, err := window.RegisterObservableGauges(otel.Meter("preaggregate"), slidingWindow, "sliding_window.value", "Value over the sliding window"); err != nil {
+		panic(err)
+	}
+
 	http.Handle("/metrics", promhttp.Handler())
 
 	go simulateSpikyValue()
-	go calculateSlidingWindowStats()
 
 	fmt.Println("Server listening on :8080")
 	if err := http.ListenAndServe(":8080", nil); err != nil {
@@ -57,7 +62,6 @@ func simulateSpikyValue() {
 	i := 0
 	for {
 		i++
-		value = float64(i)
 		if i%12 == 0 {
 			value = 100.0
 		} else {
@@ -65,50 +69,8 @@ func simulateSpikyValue() {
 		}
 
 		instantaneousValueGauge.Set(value)
-
-		mutex.Lock()
-		valueRing.Value = value
-		valueRing = valueRing.Next()
-		mutex.Unlock()
+		slidingWindow.Observe(value)
 
 		time.Sleep(1 * time.Second)
 	}
 }
-
-func calculateSlidingWindowStats() {
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		values := make([]float64, 0, windowSize)
-		maxValue := 0.0
-
-		mutex.Lock()
-		valueRing.Do(func(p interface{}) {
-			if p != nil {
-				value := p.(float64)
-				values = append(values, value)
-				if value > maxValue {
-					maxValue = value
-				}
-			}
-		})
-		mutex.Unlock()
-
-		fmt.Printf("values=%v\n", values)
-		sort.Float64s(values)
-		median := calculateMedian(values)
-
-		slidingWindowMaxValueGauge.Set(maxValue)
-		slidingWindowMedianValueGauge.Set(median)
-		fmt.Printf("maxValue=%f, median=%f\n", maxValue, median)
-	}
-}
-
-func calculateMedian(values []float64) float64 {
-	middle := len(values) / 2
-	if len(values)%2 == 1 {
-		return values[middle]
-	}
-	return (values[middle-1] + values[middle]) / 2
-}
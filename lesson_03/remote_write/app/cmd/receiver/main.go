@@ -0,0 +1,25 @@
+package main
+
+import (
+	"example/internal/receiver"
+	"flag"
+	"log"
+	"net/http"
+)
+
+// Локальный приемник remote_write вместо VictoriaMetrics:
+//
+//	go run ./cmd/receiver -addr :9201
+//	REMOTE_WRITE_URL=http://localhost:9201/api/v1/write go run .
+//	curl localhost:9201/api/v1/write
+func main() {
+	addr := flag.String("addr", ":9201", "listen address")
+	flag.Parse()
+
+	http.Handle("/api/v1/write", receiver.New())
+
+	log.Printf("Starting remote_write receiver on %s", *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		log.Fatalf("Failed to start receiver: %v", err)
+	}
+}
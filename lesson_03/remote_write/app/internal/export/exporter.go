@@ -0,0 +1,215 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Sink получатель метрик: Pushgateway, Graphite, StatsD или remote_write
+type Sink interface {
+	// Name имя получателя, попадает в метку sink метрик здоровья
+	Name() string
+	// Send отправляет метрики. Ошибку, которую нет смысла повторять, нужно обернуть в Permanent.
+	Send(ctx context.Context, families []*dto.MetricFamily) error
+}
+
+// Options настройки экспортера
+type Options struct {
+	Interval   time.Duration         // Как часто отправлять метрики, по умолчанию 15s
+	Timeout    time.Duration         // Таймаут одной попытки отправки, по умолчанию 10s
+	Retries    int                   // Количество повторов после неудачной попытки, по умолчанию 3, отрицательное - без повторов
+	Backoff    time.Duration         // Пауза перед первым повтором, дальше удваивается, по умолчанию 500ms
+	MaxBackoff time.Duration         // Максимальная пауза между повторами, по умолчанию 10s
+	Registerer prometheus.Registerer // Куда регистрировать метрики здоровья, по умолчанию prometheus.DefaultRegisterer
+}
+
+func (o Options) withDefaults() Options {
+	if o.Interval <= 0 {
+		o.Interval = 15 * time.Second
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.Retries == 0 {
+		o.Retries = 3
+	}
+	if o.Retries < 0 {
+		o.Retries = 0
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 500 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 10 * time.Second
+	}
+	if o.Registerer == nil {
+		o.Registerer = prometheus.DefaultRegisterer
+	}
+	return o
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent помечает ошибку как неповторяемую, например 400 от remote_write
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Exporter собирает метрики из gatherer и отправляет их во все получатели.
+// Получатели работают параллельно и не мешают друг другу: недоступный Graphite
+// не задерживает remote_write. Состояние каждого получателя видно по метрикам:
+//
+//	metrics_export_sink_up{sink}                          - 1, если последняя отправка успешна
+//	metrics_export_last_success_timestamp_seconds{sink}   - время последней успешной отправки
+//	metrics_export_failures_total{sink}                   - количество неудачных попыток, включая повторы
+type Exporter struct {
+	gatherer prometheus.Gatherer
+	sinks    []Sink
+	opts     Options
+
+	up          *prometheus.GaugeVec
+	lastSuccess *prometheus.GaugeVec
+	failures    *prometheus.CounterVec
+}
+
+// NewExporter создает экспортер, периодическая отправка запускается через Start
+func NewExporter(gatherer prometheus.Gatherer, opts Options, sinks ...Sink) *Exporter {
+	opts = opts.withDefaults()
+	e := &Exporter{
+		gatherer: gatherer,
+		sinks:    sinks,
+		opts:     opts,
+		up: register(opts.Registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "metrics_export_sink_up",
+			Help: "Whether the last export to the sink succeeded (1) or failed (0)",
+		}, []string{"sink"})),
+		lastSuccess: register(opts.Registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "metrics_export_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful export to the sink",
+		}, []string{"sink"})),
+		failures: register(opts.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "metrics_export_failures_total",
+			Help: "Failed export attempts to the sink, including retries",
+		}, []string{"sink"})),
+	}
+	for _, sink := range sinks {
+		e.up.WithLabelValues(sink.Name())
+		e.failures.WithLabelValues(sink.Name())
+	}
+	return e
+}
+
+// register регистрирует коллектор, а если такой уже есть (второй экспортер в том же реестре) - возвращает существующий
+func register[T prometheus.Collector](reg prometheus.Registerer, c T) T {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
+
+// Start отправляет метрики каждые Interval, пока не отменен ctx
+func (e *Exporter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(e.opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := e.Export(ctx); err != nil {
+					log.Printf("metrics export: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Export один раз собирает метрики и отправляет их во все получатели с повторами
+func (e *Exporter) Export(ctx context.Context) error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		// Gather возвращает то, что удалось собрать, вместе с ошибкой - отправляем хотя бы это
+		if len(families) == 0 {
+			return err
+		}
+		log.Printf("metrics export: partial gather: %v", err)
+	}
+
+	errs := make([]error, len(e.sinks))
+	var wg sync.WaitGroup
+	for i, sink := range e.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = e.send(ctx, sink, families)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (e *Exporter) send(ctx context.Context, sink Sink, families []*dto.MetricFamily) error {
+	name := sink.Name()
+	backoff := e.opts.Backoff
+
+	var err error
+	for attempt := 0; attempt <= e.opts.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				e.up.WithLabelValues(name).Set(0)
+				return errors.Join(err, ctx.Err())
+			}
+			backoff = min(backoff*2, e.opts.MaxBackoff)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, e.opts.Timeout)
+		err = sink.Send(attemptCtx, families)
+		cancel()
+		if err == nil {
+			e.up.WithLabelValues(name).Set(1)
+			e.lastSuccess.WithLabelValues(name).SetToCurrentTime()
+			return nil
+		}
+		e.failures.WithLabelValues(name).Inc()
+
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			break
+		}
+	}
+	e.up.WithLabelValues(name).Set(0)
+	return &SinkError{Sink: name, Err: err}
+}
+
+// SinkError ошибка отправки в конкретный получатель после всех повторов
+type SinkError struct {
+	Sink string
+	Err  error
+}
+
+func (e *SinkError) Error() string { return e.Sink + ": " + e.Err.Error() }
+func (e *SinkError) Unwrap() error { return e.Err }
@@ -0,0 +1,428 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"example/internal/receiver"
+	"example/internal/receiver/receivertest"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func newTestRegistry() (*prometheus.Registry, *prometheus.CounterVec, prometheus.Gauge) {
+	reg := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_requests_total",
+		Help:        "Total number of HTTP requests",
+		ConstLabels: prometheus.Labels{"env": "dev"},
+	}, []string{"code"})
+	queue := prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue_size", Help: "Queue size"})
+	reg.MustRegister(requests, queue)
+	return reg, requests, queue
+}
+
+func newTestExporter(t *testing.T, gatherer prometheus.Gatherer, sinks ...Sink) (*Exporter, *prometheus.Registry) {
+	t.Helper()
+	health := prometheus.NewRegistry()
+	return NewExporter(gatherer, Options{
+		Timeout:    time.Second,
+		Retries:    2,
+		Backoff:    time.Millisecond,
+		Registerer: health,
+	}, sinks...), health
+}
+
+func TestGraphite(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	reg, requests, queue := newTestRegistry()
+	requests.WithLabelValues("200").Add(10)
+	queue.Set(3)
+
+	exporter, _ := newTestExporter(t, reg, NewGraphite(GraphiteOptions{
+		Addr:         ln.Addr().String(),
+		PathTemplate: "env.{env}.service_name.http.requests.{code}.count",
+	}))
+	if err := exporter.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			t.Fatalf("malformed line %q", line)
+		}
+		got = append(got, fields[0]+" "+fields[1])
+	}
+	sort.Strings(got)
+	// queue_size has neither env nor code, so only the constant segments remain
+	want := []string{
+		"env.dev.service_name.http.requests.200.count 10",
+		"env.service_name.http.requests.count 3",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got lines\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestGraphitePathTags(t *testing.T) {
+	g := NewGraphite(GraphiteOptions{PathTemplate: "app.{__name__}", Tags: true})
+	s := sample{name: "http_requests_total", labels: []label{{"code", "200"}, {"path", "/api/v1.0"}}}
+	if got, want := g.path(s), "app.http_requests_total;code=200;path=_api_v1_0"; got != want {
+		t.Fatalf("path = %q, want %q", got, want)
+	}
+}
+
+func TestGraphitePathCollision(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines <- strings.Fields(scanner.Text())[0]
+			}
+			conn.Close()
+		}
+	}()
+	read := func(n int) []string {
+		t.Helper()
+		var got []string
+		for range n {
+			select {
+			case line := <-lines:
+				got = append(got, line)
+			case <-time.After(time.Second):
+				t.Fatalf("got %v, want %d lines", got, n)
+			}
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	reg, requests, queue := newTestRegistry()
+	requests.WithLabelValues("200").Inc()
+	requests.WithLabelValues("500").Inc()
+	queue.Set(1)
+	families, _ := reg.Gather()
+
+	// Without {code} both request series end up in the same path, only the first one is sent,
+	// the other points are not affected and the sink is not reported as down
+	g := NewGraphite(GraphiteOptions{Addr: ln.Addr().String(), PathTemplate: "app.{__name__}"})
+	if err := g.Send(context.Background(), families); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read(2), []string{"app.http_requests_total", "app.queue_size"}; !slices.Equal(got, want) {
+		t.Fatalf("paths = %v, want %v", got, want)
+	}
+
+	// With tags the code is kept and the paths differ
+	g = NewGraphite(GraphiteOptions{Addr: ln.Addr().String(), PathTemplate: "app.{__name__}", Tags: true})
+	if err := g.Send(context.Background(), families); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(3); len(got) != 3 {
+		t.Fatalf("paths = %v, want 3", got)
+	}
+}
+
+func TestStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reg, requests, queue := newTestRegistry()
+	exporter, _ := newTestExporter(t, reg, NewStatsD(StatsDOptions{
+		Addr:      conn.LocalAddr().String(),
+		Prefix:    "app.",
+		DogStatsD: true,
+	}))
+
+	read := func() []string {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 2048)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(string(buf[:n]), "\n")
+		sort.Strings(lines)
+		return lines
+	}
+
+	requests.WithLabelValues("200").Add(3)
+	queue.Set(5)
+	if err := exporter.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read(), []string{
+		"app.http_requests_total:3|c|#code:200,env:dev",
+		"app.queue_size:5|g",
+	}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("first export: got %q, want %q", got, want)
+	}
+
+	// Counters are sent as increments since the previous export
+	requests.WithLabelValues("200").Add(2)
+	if err := exporter.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read(), []string{
+		"app.http_requests_total:2|c|#code:200,env:dev",
+		"app.queue_size:5|g",
+	}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("second export: got %q, want %q", got, want)
+	}
+}
+
+func TestStatsDRecordsSentPackets(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reg := prometheus.NewRegistry()
+	small := prometheus.NewCounter(prometheus.CounterOpts{Name: "a_total", Help: "Small"})
+	// The line does not fit into one datagram, so writing the second packet fails
+	huge := prometheus.NewCounter(prometheus.CounterOpts{Name: "b_total", Help: "Huge",
+		ConstLabels: prometheus.Labels{"value": strings.Repeat("x", 69_990)}})
+	reg.MustRegister(small, huge)
+	small.Add(3)
+	huge.Add(5)
+	families, _ := reg.Gather()
+
+	s := NewStatsD(StatsDOptions{Addr: conn.LocalAddr().String(), MaxPacketSize: 70_000})
+	if err := s.Send(context.Background(), families); err == nil {
+		t.Fatal("sending an oversized datagram succeeded")
+	}
+	// The first packet was written, a retry must not send its increment again
+	if got := s.sent["a_total"]; got != 3 {
+		t.Errorf("a_total recorded as %v, want 3", got)
+	}
+	for key := range s.sent {
+		if strings.HasPrefix(key, "b_total") {
+			t.Errorf("b_total recorded although its packet failed")
+		}
+	}
+}
+
+func TestPushgateway(t *testing.T) {
+	type push struct {
+		method, path string
+		families     map[string]*dto.MetricFamily
+	}
+	pushes := make(chan push, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families := make(map[string]*dto.MetricFamily)
+		decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			var family dto.MetricFamily
+			if err := decoder.Decode(&family); err != nil {
+				break
+			}
+			families[family.GetName()] = &family
+		}
+		pushes <- push{method: r.Method, path: r.URL.Path, families: families}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	reg, requests, _ := newTestRegistry()
+	requests.WithLabelValues("500").Inc()
+	exporter, _ := newTestExporter(t, reg, NewPushgateway(PushgatewayOptions{
+		URL:      server.URL,
+		Job:      "batch",
+		Grouping: map[string]string{"instance": "worker-1"},
+	}))
+	if err := exporter.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	p := <-pushes
+	if p.method != http.MethodPut || p.path != "/metrics/job/batch/instance/worker-1" {
+		t.Fatalf("got %s %s, want PUT /metrics/job/batch/instance/worker-1", p.method, p.path)
+	}
+	family, ok := p.families["http_requests_total"]
+	if !ok || family.GetMetric()[0].GetCounter().GetValue() != 1 {
+		t.Fatalf("http_requests_total not pushed: %v", p.families)
+	}
+}
+
+func TestRemoteWrite(t *testing.T) {
+	server := receivertest.NewServer(t)
+
+	reg, requests, queue := newTestRegistry()
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:                        "latency_seconds",
+		Help:                        "Latency",
+		Buckets:                     []float64{0.1, 1},
+		NativeHistogramBucketFactor: 1.1,
+	})
+	reg.MustRegister(latency)
+	requests.WithLabelValues("200").Add(7)
+	queue.Set(2)
+	latency.(prometheus.ExemplarObserver).ObserveWithExemplar(0.5, prometheus.Labels{"trace_id": "abc"})
+
+	exporter, _ := newTestExporter(t, reg, NewRemoteWrite(RemoteWriteOptions{
+		URL:            server.URL,
+		ExternalLabels: map[string]string{"cluster": "local", "env": "prod"},
+	}))
+	if err := exporter.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// External labels don't override labels of the series
+	server.ExpectSeries("http_requests_total", receiver.Labels{"cluster": "local", "code": "200", "env": "dev"}).ToEqual(7)
+	server.ExpectSeries("queue_size", receiver.Labels{"cluster": "local", "env": "prod"}).ToEqual(2)
+	server.ExpectSeries("latency_seconds_bucket", receiver.Labels{"le": "0.1"}).ToEqual(0)
+	server.ExpectSeries("latency_seconds_bucket", receiver.Labels{"le": "1"}).ToEqual(1)
+	server.ExpectSeries("latency_seconds_bucket", receiver.Labels{"le": "1"}).ToHaveExemplar(receiver.Labels{"trace_id": "abc"})
+	server.ExpectSeries("latency_seconds_bucket", receiver.Labels{"le": "+Inf"}).ToEqual(1)
+	server.ExpectSeries("latency_seconds", receiver.Labels{"cluster": "local"}).ToHaveHistogramCount(1)
+
+	// Counters keep growing between exports
+	requests.WithLabelValues("200").Add(3)
+	if err := exporter.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	server.ExpectSeries("http_requests_total", nil).ToReach(10)
+}
+
+func TestRemoteWriteStatusCodes(t *testing.T) {
+	for _, tc := range []struct {
+		status       int
+		wantAttempts int
+	}{
+		{http.StatusServiceUnavailable, 3}, // Retried
+		{http.StatusTooManyRequests, 3},    // Retried
+		{http.StatusBadRequest, 1},         // Permanent
+	} {
+		var mu sync.Mutex
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			attempts++
+			mu.Unlock()
+			http.Error(w, "nope", tc.status)
+		}))
+
+		reg, _, _ := newTestRegistry()
+		exporter, health := newTestExporter(t, reg, NewRemoteWrite(RemoteWriteOptions{URL: server.URL}))
+		err := exporter.Export(context.Background())
+		server.Close()
+
+		var sinkErr *SinkError
+		if !errors.As(err, &sinkErr) || sinkErr.Sink != "remote_write" {
+			t.Fatalf("status %d: err = %v, want SinkError of remote_write", tc.status, err)
+		}
+		if attempts != tc.wantAttempts {
+			t.Errorf("status %d: %d attempts, want %d", tc.status, attempts, tc.wantAttempts)
+		}
+		if got := testutil.ToFloat64(exporter.failures.WithLabelValues("remote_write")); got != float64(tc.wantAttempts) {
+			t.Errorf("status %d: failures_total = %v, want %d", tc.status, got, tc.wantAttempts)
+		}
+		if n, err := testutil.GatherAndCount(health, "metrics_export_sink_up"); err != nil || n != 1 {
+			t.Errorf("status %d: %d sink_up series (%v), want 1", tc.status, n, err)
+		}
+	}
+}
+
+// flakySink fails the first failures sends
+type flakySink struct {
+	mu       sync.Mutex
+	failures int
+	sends    int
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Send(ctx context.Context, families []*dto.MetricFamily) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sends++
+	if s.sends <= s.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestExporterHealth(t *testing.T) {
+	reg, _, _ := newTestRegistry()
+	flaky := &flakySink{failures: 2}
+	down := &flakySink{failures: math.MaxInt}
+	exporter, _ := newTestExporter(t, reg, flaky, NewGraphite(GraphiteOptions{Name: "graphite_down", Addr: "127.0.0.1:1"}))
+
+	// Two failures fit into two retries
+	if err := exporter.Export(context.Background()); err == nil || !strings.Contains(err.Error(), "graphite_down") {
+		t.Fatalf("err = %v, want graphite_down error", err)
+	}
+	if up := testutil.ToFloat64(exporter.up.WithLabelValues("flaky")); up != 1 {
+		t.Errorf("flaky up = %v, want 1", up)
+	}
+	if up := testutil.ToFloat64(exporter.up.WithLabelValues("graphite_down")); up != 0 {
+		t.Errorf("graphite_down up = %v, want 0", up)
+	}
+	if got := testutil.ToFloat64(exporter.failures.WithLabelValues("flaky")); got != 2 {
+		t.Errorf("flaky failures = %v, want 2", got)
+	}
+	if ts := testutil.ToFloat64(exporter.lastSuccess.WithLabelValues("flaky")); ts < float64(time.Now().Add(-time.Minute).Unix()) {
+		t.Errorf("flaky last success = %v, want now", ts)
+	}
+
+	// A cancelled context stops retries
+	exporter, _ = newTestExporter(t, reg, down)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := exporter.Export(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if down.sends != 1 {
+		t.Errorf("down sink got %d sends, want 1", down.sends)
+	}
+}
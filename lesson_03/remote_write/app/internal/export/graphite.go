@@ -0,0 +1,135 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// GraphiteOptions настройки отправки в Graphite по plaintext-протоколу
+type GraphiteOptions struct {
+	Name string // Имя получателя, по умолчанию graphite
+	Addr string // host:port приемника, обычно порт 2003
+
+	// PathTemplate шаблон пути метрики. {__name__} заменяется на имя метрики, {label} - на значение метки.
+	// Сегменты, ставшие пустыми из-за отсутствующей метки, пропускаются.
+	// Например env.{env}.{job}.{__name__}.{code}. По умолчанию {__name__}.
+	PathTemplate string
+	// Tags добавляет метки, не попавшие в шаблон, как теги Graphite: path;label=value.
+	// Без Tags такие метки отбрасываются, и ряды, отличающиеся только ими, попадают в один путь.
+	// Такие ряды не отправляются, кроме первого, а в лог пишется пример пути.
+	Tags bool
+}
+
+// Graphite отправляет точки строками "path value timestamp" по TCP
+type Graphite struct {
+	opts     GraphiteOptions
+	segments []string
+	dialer   net.Dialer
+
+	collisions atomic.Int64 // Сколько рядов пропущено при прошлой отправке, чтобы не писать в лог каждый раз
+}
+
+var templateLabel = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+func NewGraphite(opts GraphiteOptions) *Graphite {
+	if opts.Name == "" {
+		opts.Name = "graphite"
+	}
+	if opts.PathTemplate == "" {
+		opts.PathTemplate = "{__name__}"
+	}
+	return &Graphite{opts: opts, segments: strings.Split(opts.PathTemplate, ".")}
+}
+
+func (g *Graphite) Name() string { return g.opts.Name }
+
+func (g *Graphite) Send(ctx context.Context, families []*dto.MetricFamily) error {
+	conn, err := g.dialer.DialContext(ctx, "tcp", g.opts.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	w := bufio.NewWriter(conn)
+	seen := make(map[string]bool)
+	var collisions int
+	var collision string
+	for _, s := range flatten(families, time.Now()) {
+		// Graphite не принимает NaN и бесконечности
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			continue
+		}
+		path := g.path(s)
+		// Второй ряд в том же пути перезаписал бы точку первого
+		if seen[path] {
+			if collisions == 0 {
+				collision = path
+			}
+			collisions++
+			continue
+		}
+		seen[path] = true
+		fmt.Fprintf(w, "%s %s %d\n", path, strconv.FormatFloat(s.value, 'f', -1, 64), s.timestampMs/1000)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// Это ошибка настройки, а не отправки: остальные точки дошли, поэтому получатель не считается недоступным
+	if previous := g.collisions.Swap(int64(collisions)); collisions > 0 && int64(collisions) != previous {
+		log.Printf("%s: %d series skipped: their path collides with another series, e.g. %q; "+
+			"add the distinguishing labels to PathTemplate or enable Tags", g.opts.Name, collisions, collision)
+	}
+	return nil
+}
+
+// path строит путь точки по шаблону
+func (g *Graphite) path(s sample) string {
+	values := map[string]string{"__name__": s.name}
+	for _, l := range s.labels {
+		values[l.name] = l.value
+	}
+	used := make(map[string]bool)
+
+	segments := make([]string, 0, len(g.segments))
+	for _, segment := range g.segments {
+		segment = templateLabel.ReplaceAllStringFunc(segment, func(placeholder string) string {
+			name := placeholder[1 : len(placeholder)-1]
+			used[name] = true
+			return sanitizeGraphite(values[name])
+		})
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	path := strings.Join(segments, ".")
+
+	if g.opts.Tags {
+		for _, l := range s.labels {
+			if !used[l.name] && l.value != "" {
+				path += ";" + l.name + "=" + sanitizeGraphite(l.value)
+			}
+		}
+	}
+	return path
+}
+
+var graphiteUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_:+\-]`)
+
+// sanitizeGraphite заменяет точки, пробелы и прочие спецсимволы, чтобы значение метки осталось одним сегментом пути
+func sanitizeGraphite(value string) string {
+	return graphiteUnsafe.ReplaceAllString(value, "_")
+}
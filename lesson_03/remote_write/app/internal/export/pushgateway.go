@@ -0,0 +1,48 @@
+package export
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// PushgatewayOptions настройки отправки в Pushgateway
+type PushgatewayOptions struct {
+	Name     string            // Имя получателя, по умолчанию pushgateway
+	URL      string            // Адрес Pushgateway, например http://pushgateway:9091
+	Job      string            // Значение метки job
+	Grouping map[string]string // Дополнительные ключи группировки, например instance
+	Client   *http.Client      // По умолчанию http.DefaultClient
+}
+
+// Pushgateway заменяет группу метрик job + Grouping в Pushgateway (PUT)
+type Pushgateway struct {
+	opts PushgatewayOptions
+}
+
+func NewPushgateway(opts PushgatewayOptions) *Pushgateway {
+	if opts.Name == "" {
+		opts.Name = "pushgateway"
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &Pushgateway{opts: opts}
+}
+
+func (p *Pushgateway) Name() string { return p.opts.Name }
+
+func (p *Pushgateway) Send(ctx context.Context, families []*dto.MetricFamily) error {
+	pusher := push.New(p.opts.URL, p.opts.Job).
+		Client(p.opts.Client).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return families, nil
+		}))
+	for name, value := range p.opts.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher.PushContext(ctx)
+}
@@ -0,0 +1,323 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriteOptions настройки отправки по протоколу Prometheus remote_write 1.0
+type RemoteWriteOptions struct {
+	Name           string            // Имя получателя, по умолчанию remote_write
+	URL            string            // Например http://victoria:8428/api/v1/write
+	ExternalLabels map[string]string // Метки, добавляемые ко всем рядам, например env
+	Headers        map[string]string // Дополнительные заголовки, например Authorization
+	Client         *http.Client      // По умолчанию http.DefaultClient
+}
+
+// RemoteWrite отправляет WriteRequest в protobuf, сжатый snappy.
+// Нативные гистограммы отправляются как есть, вместе с классическими бакетами, если они есть.
+type RemoteWrite struct {
+	opts RemoteWriteOptions
+}
+
+func NewRemoteWrite(opts RemoteWriteOptions) *RemoteWrite {
+	if opts.Name == "" {
+		opts.Name = "remote_write"
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &RemoteWrite{opts: opts}
+}
+
+func (rw *RemoteWrite) Name() string { return rw.opts.Name }
+
+func (rw *RemoteWrite) Send(ctx context.Context, families []*dto.MetricFamily) error {
+	body := snappy.Encode(nil, rw.encode(families, time.Now()))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rw.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for name, value := range rw.opts.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := rw.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	// Как и Prometheus, повторяем только 5xx и 429, остальные 4xx повтор не исправит
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return Permanent(err)
+}
+
+// Номера полей prompb (prometheus/prompb/types.proto и remote.proto)
+const (
+	writeRequestTimeseries = 1
+	writeRequestMetadata   = 3
+
+	timeSeriesLabels     = 1
+	timeSeriesSamples    = 2
+	timeSeriesExemplars  = 3
+	timeSeriesHistograms = 4
+
+	labelName  = 1
+	labelValue = 2
+
+	sampleValue     = 1
+	sampleTimestamp = 2
+
+	exemplarLabels    = 1
+	exemplarValue     = 2
+	exemplarTimestamp = 3
+
+	histogramCountInt       = 1
+	histogramCountFloat     = 2
+	histogramSum            = 3
+	histogramSchema         = 4
+	histogramZeroThreshold  = 5
+	histogramZeroCountInt   = 6
+	histogramZeroCountFloat = 7
+	histogramNegativeSpans  = 8
+	histogramNegativeDeltas = 9
+	histogramNegativeCounts = 10
+	histogramPositiveSpans  = 11
+	histogramPositiveDeltas = 12
+	histogramPositiveCounts = 13
+	histogramTimestamp      = 15
+
+	spanOffset = 1
+	spanLength = 2
+
+	metadataType       = 1
+	metadataFamilyName = 2
+	metadataHelp       = 4
+	metadataUnit       = 5
+)
+
+// metadataTypes переводит тип client_model в MetricMetadata.MetricType
+var metadataTypes = map[dto.MetricType]uint64{
+	dto.MetricType_COUNTER:         1,
+	dto.MetricType_GAUGE:           2,
+	dto.MetricType_HISTOGRAM:       3,
+	dto.MetricType_GAUGE_HISTOGRAM: 4,
+	dto.MetricType_SUMMARY:         5,
+}
+
+// encode собирает WriteRequest: по ряду на каждую точку, нативные гистограммы и метаданные семейств
+func (rw *RemoteWrite) encode(families []*dto.MetricFamily, now time.Time) []byte {
+	external := make([]label, 0, len(rw.opts.ExternalLabels))
+	for name, value := range rw.opts.ExternalLabels {
+		external = append(external, label{name, value})
+	}
+
+	var buf []byte
+	for _, s := range flatten(families, now) {
+		var ts []byte
+		ts = appendLabels(ts, timeSeriesLabels, s.name, withExternal(s.labels, external))
+
+		var smp []byte
+		smp = protowire.AppendTag(smp, sampleValue, protowire.Fixed64Type)
+		smp = protowire.AppendFixed64(smp, math.Float64bits(s.value))
+		smp = protowire.AppendTag(smp, sampleTimestamp, protowire.VarintType)
+		smp = protowire.AppendVarint(smp, uint64(s.timestampMs))
+		ts = appendMessage(ts, timeSeriesSamples, smp)
+
+		if s.exemplar != nil {
+			ts = appendMessage(ts, timeSeriesExemplars, encodeExemplar(s.exemplar, s.timestampMs))
+		}
+		buf = appendMessage(buf, writeRequestTimeseries, ts)
+	}
+
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			h := m.GetHistogram()
+			if h == nil || h.Schema == nil {
+				continue
+			}
+			timestampMs := now.UnixMilli()
+			if m.TimestampMs != nil {
+				timestampMs = m.GetTimestampMs()
+			}
+			var ts []byte
+			ts = appendLabels(ts, timeSeriesLabels, family.GetName(), withExternal(metricLabels(m), external))
+			ts = appendMessage(ts, timeSeriesHistograms, encodeHistogram(h, timestampMs))
+			for _, e := range h.GetExemplars() {
+				ts = appendMessage(ts, timeSeriesExemplars, encodeExemplar(e, timestampMs))
+			}
+			buf = appendMessage(buf, writeRequestTimeseries, ts)
+		}
+	}
+
+	for _, family := range families {
+		var md []byte
+		md = protowire.AppendTag(md, metadataType, protowire.VarintType)
+		md = protowire.AppendVarint(md, metadataTypes[family.GetType()])
+		md = appendString(md, metadataFamilyName, family.GetName())
+		if family.GetHelp() != "" {
+			md = appendString(md, metadataHelp, family.GetHelp())
+		}
+		if family.GetUnit() != "" {
+			md = appendString(md, metadataUnit, family.GetUnit())
+		}
+		buf = appendMessage(buf, writeRequestMetadata, md)
+	}
+	return buf
+}
+
+// withExternal добавляет внешние метки, не перекрывая собственные метки ряда
+func withExternal(labels, external []label) []label {
+	if len(external) == 0 {
+		return labels
+	}
+	result := append([]label(nil), labels...)
+	for _, e := range external {
+		found := false
+		for _, l := range labels {
+			found = found || l.name == e.name
+		}
+		if !found {
+			result = append(result, e)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+// appendLabels добавляет метки вместе с __name__, remote_write требует сортировки по имени
+func appendLabels(b []byte, field protowire.Number, name string, labels []label) []byte {
+	all := make([]label, 0, len(labels)+1)
+	all = append(all, label{"__name__", name})
+	all = append(all, labels...)
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+	for _, l := range all {
+		var lb []byte
+		lb = appendString(lb, labelName, l.name)
+		lb = appendString(lb, labelValue, l.value)
+		b = appendMessage(b, field, lb)
+	}
+	return b
+}
+
+func encodeExemplar(e *dto.Exemplar, fallbackMs int64) []byte {
+	var b []byte
+	for _, lp := range e.GetLabel() {
+		var lb []byte
+		lb = appendString(lb, labelName, lp.GetName())
+		lb = appendString(lb, labelValue, lp.GetValue())
+		b = appendMessage(b, exemplarLabels, lb)
+	}
+	b = protowire.AppendTag(b, exemplarValue, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(e.GetValue()))
+	timestampMs := fallbackMs
+	if e.Timestamp != nil {
+		timestampMs = e.GetTimestamp().AsTime().UnixMilli()
+	}
+	b = protowire.AppendTag(b, exemplarTimestamp, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(timestampMs))
+}
+
+// encodeHistogram кодирует нативную гистограмму, целочисленную или float
+func encodeHistogram(h *dto.Histogram, timestampMs int64) []byte {
+	var b []byte
+	isFloat := h.SampleCountFloat != nil
+	if isFloat {
+		b = appendDouble(b, histogramCountFloat, h.GetSampleCountFloat())
+	} else {
+		b = protowire.AppendTag(b, histogramCountInt, protowire.VarintType)
+		b = protowire.AppendVarint(b, h.GetSampleCount())
+	}
+	b = appendDouble(b, histogramSum, h.GetSampleSum())
+	b = protowire.AppendTag(b, histogramSchema, protowire.VarintType)
+	b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(h.GetSchema())))
+	b = appendDouble(b, histogramZeroThreshold, h.GetZeroThreshold())
+	if isFloat {
+		b = appendDouble(b, histogramZeroCountFloat, h.GetZeroCountFloat())
+	} else {
+		b = protowire.AppendTag(b, histogramZeroCountInt, protowire.VarintType)
+		b = protowire.AppendVarint(b, h.GetZeroCount())
+	}
+
+	b = appendSpans(b, histogramNegativeSpans, h.GetNegativeSpan())
+	b = appendDeltas(b, histogramNegativeDeltas, h.GetNegativeDelta())
+	b = appendCounts(b, histogramNegativeCounts, h.GetNegativeCount())
+	b = appendSpans(b, histogramPositiveSpans, h.GetPositiveSpan())
+	b = appendDeltas(b, histogramPositiveDeltas, h.GetPositiveDelta())
+	b = appendCounts(b, histogramPositiveCounts, h.GetPositiveCount())
+
+	b = protowire.AppendTag(b, histogramTimestamp, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(timestampMs))
+}
+
+func appendSpans(b []byte, field protowire.Number, spans []*dto.BucketSpan) []byte {
+	for _, span := range spans {
+		var sb []byte
+		sb = protowire.AppendTag(sb, spanOffset, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, protowire.EncodeZigZag(int64(span.GetOffset())))
+		sb = protowire.AppendTag(sb, spanLength, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(span.GetLength()))
+		b = appendMessage(b, field, sb)
+	}
+	return b
+}
+
+func appendDeltas(b []byte, field protowire.Number, deltas []int64) []byte {
+	if len(deltas) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, d := range deltas {
+		packed = protowire.AppendVarint(packed, protowire.EncodeZigZag(d))
+	}
+	return appendMessage(b, field, packed)
+}
+
+func appendCounts(b []byte, field protowire.Number, counts []float64) []byte {
+	if len(counts) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, c := range counts {
+		packed = protowire.AppendFixed64(packed, math.Float64bits(c))
+	}
+	return appendMessage(b, field, packed)
+}
+
+func appendMessage(b []byte, field protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, field protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendDouble(b []byte, field protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, field, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
@@ -0,0 +1,132 @@
+package export
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// label пара имя-значение, в sample отсортированы по имени
+type label struct {
+	name, value string
+}
+
+// sample одна точка в плоском виде, как в текстовом формате: гистограммы и summary
+// разворачиваются в _bucket, _sum, _count и квантили
+type sample struct {
+	name        string
+	labels      []label
+	value       float64
+	timestampMs int64
+	monotonic   bool          // Счетчик: counter, а также _bucket, _sum и _count гистограмм и summary
+	exemplar    *dto.Exemplar // Exemplar счетчика или бакета гистограммы
+}
+
+// flatten разворачивает семейства в точки. Метки времени, не заданные в метриках, берутся из now.
+func flatten(families []*dto.MetricFamily, now time.Time) []sample {
+	var samples []sample
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			ts := now.UnixMilli()
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			labels := metricLabels(m)
+			add := func(suffix string, value float64, monotonic bool, extra ...label) *sample {
+				samples = append(samples, sample{
+					name:        name + suffix,
+					labels:      withLabels(labels, extra...),
+					value:       value,
+					timestampMs: ts,
+					monotonic:   monotonic,
+				})
+				return &samples[len(samples)-1]
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue(), true).exemplar = m.GetCounter().GetExemplar()
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue(), false)
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue(), false)
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add("", q.GetValue(), false, label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add("_sum", s.GetSampleSum(), true)
+				add("_count", float64(s.GetSampleCount()), true)
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				monotonic := family.GetType() == dto.MetricType_HISTOGRAM
+				count := float64(h.GetSampleCount())
+				if h.SampleCountFloat != nil {
+					count = h.GetSampleCountFloat()
+				}
+				// У чисто нативной гистограммы нет классических бакетов, остаются только _sum и _count
+				if len(h.GetBucket()) > 0 {
+					infSeen := false
+					for _, b := range h.GetBucket() {
+						value := float64(b.GetCumulativeCount())
+						if b.CumulativeCountFloat != nil {
+							value = b.GetCumulativeCountFloat()
+						}
+						infSeen = infSeen || math.IsInf(b.GetUpperBound(), 1)
+						add("_bucket", value, monotonic, label{"le", formatFloat(b.GetUpperBound())}).exemplar = b.GetExemplar()
+					}
+					if !infSeen {
+						add("_bucket", count, monotonic, label{"le", "+Inf"})
+					}
+				}
+				add("_sum", h.GetSampleSum(), monotonic)
+				add("_count", count, monotonic)
+			}
+		}
+	}
+	return samples
+}
+
+func metricLabels(m *dto.Metric) []label {
+	labels := make([]label, 0, len(m.GetLabel()))
+	for _, lp := range m.GetLabel() {
+		labels = append(labels, label{lp.GetName(), lp.GetValue()})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+// withLabels возвращает новый отсортированный набор меток, extra перекрывают существующие
+func withLabels(labels []label, extra ...label) []label {
+	if len(extra) == 0 {
+		return labels
+	}
+	result := make([]label, 0, len(labels)+len(extra))
+	for _, l := range labels {
+		overridden := false
+		for _, e := range extra {
+			overridden = overridden || e.name == l.name
+		}
+		if !overridden {
+			result = append(result, l)
+		}
+	}
+	result = append(result, extra...)
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,141 @@
+package export
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatsDOptions настройки отправки в StatsD или DogStatsD по UDP
+type StatsDOptions struct {
+	Name          string // Имя получателя, по умолчанию statsd
+	Addr          string // host:port агента, обычно порт 8125
+	Prefix        string // Префикс имен метрик, например myapp.
+	DogStatsD     bool   // Передавать метки тегами |#label:value, иначе они дописываются к имени .label.value
+	MaxPacketSize int    // Максимальный размер UDP-пакета, по умолчанию 1432 байта
+}
+
+// StatsD отправляет gauge как |g, а счетчики как |c с приращением с прошлой успешной отправки.
+// Первая отправка счетчика передает его значение целиком.
+type StatsD struct {
+	opts   StatsDOptions
+	dialer net.Dialer
+
+	mu   sync.Mutex
+	sent map[string]float64 // Ключ точки -> значение счетчика при прошлой отправке
+}
+
+func NewStatsD(opts StatsDOptions) *StatsD {
+	if opts.Name == "" {
+		opts.Name = "statsd"
+	}
+	if opts.MaxPacketSize <= 0 {
+		opts.MaxPacketSize = 1432
+	}
+	return &StatsD{opts: opts, sent: make(map[string]float64)}
+}
+
+func (s *StatsD) Name() string { return s.opts.Name }
+
+func (s *StatsD) Send(ctx context.Context, families []*dto.MetricFamily) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conn, err := s.dialer.DialContext(ctx, "udp", s.opts.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Значения счетчиков запоминаются сразу после записи пакета, в который попало их приращение:
+	// если упадет следующий пакет, повтор не отправит уже ушедшие приращения второй раз,
+	// а приращения неотправленных пакетов не потеряются
+	pending := make(map[string]float64)
+	var packet []byte
+	flush := func() error {
+		if _, err := conn.Write(packet); err != nil {
+			return err
+		}
+		for key, value := range pending {
+			s.sent[key] = value
+		}
+		clear(pending)
+		packet = packet[:0]
+		return nil
+	}
+	for _, smp := range flatten(families, time.Now()) {
+		if math.IsNaN(smp.value) || math.IsInf(smp.value, 0) {
+			continue
+		}
+		name := s.name(smp)
+		value, kind := smp.value, "g"
+		var key string
+		if smp.monotonic {
+			key = name + s.tags(smp)
+			value, kind = smp.value-s.sent[key], "c"
+			if value < 0 { // Счетчик сбросился после рестарта
+				value = smp.value
+			}
+			if value == 0 {
+				continue
+			}
+		}
+
+		line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind + s.tags(smp)
+		if len(packet) > 0 && len(packet)+1+len(line) > s.opts.MaxPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+		if smp.monotonic {
+			pending[key] = smp.value
+		}
+	}
+	if len(packet) > 0 {
+		return flush()
+	}
+	return nil
+}
+
+func (s *StatsD) name(smp sample) string {
+	var b strings.Builder
+	b.WriteString(s.opts.Prefix)
+	b.WriteString(smp.name)
+	if !s.opts.DogStatsD {
+		for _, l := range smp.labels {
+			b.WriteString("." + sanitizeStatsD(l.name) + "." + sanitizeStatsD(l.value))
+		}
+	}
+	return b.String()
+}
+
+func (s *StatsD) tags(smp sample) string {
+	if !s.opts.DogStatsD || len(smp.labels) == 0 {
+		return ""
+	}
+	tags := make([]string, len(smp.labels))
+	for i, l := range smp.labels {
+		tags[i] = sanitizeStatsD(l.name) + ":" + sanitizeStatsD(l.value)
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "@", "_", "\n", "_", ".", "_", " ", "_")
+
+// sanitizeStatsD убирает символы, которые разделяют части строки протокола
+func sanitizeStatsD(value string) string {
+	return statsdReplacer.Replace(value)
+}
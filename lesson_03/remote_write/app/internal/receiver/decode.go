@@ -0,0 +1,293 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Номера полей prompb (prometheus/prompb/types.proto и remote.proto)
+const (
+	writeRequestTimeseries = 1
+
+	timeSeriesLabels     = 1
+	timeSeriesSamples    = 2
+	timeSeriesExemplars  = 3
+	timeSeriesHistograms = 4
+
+	labelName  = 1
+	labelValue = 2
+
+	sampleValue     = 1
+	sampleTimestamp = 2
+
+	exemplarLabels    = 1
+	exemplarValue     = 2
+	exemplarTimestamp = 3
+
+	histogramCountInt       = 1
+	histogramCountFloat     = 2
+	histogramSum            = 3
+	histogramSchema         = 4
+	histogramZeroThreshold  = 5
+	histogramZeroCountInt   = 6
+	histogramZeroCountFloat = 7
+	histogramNegativeSpans  = 8
+	histogramNegativeDeltas = 9
+	histogramNegativeCounts = 10
+	histogramPositiveSpans  = 11
+	histogramPositiveDeltas = 12
+	histogramPositiveCounts = 13
+	histogramTimestamp      = 15
+
+	spanOffset = 1
+	spanLength = 2
+)
+
+// field одно поле protobuf-сообщения: для bytes заполнен v, для varint и fixed64 - x
+type field struct {
+	num protowire.Number
+	typ protowire.Type
+	v   []byte
+	x   uint64
+}
+
+// eachField вызывает fn для каждого поля сообщения, неизвестные поля передаются как есть
+func eachField(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.BytesType:
+			f.v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			f.x, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.x, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var x uint32
+			x, n = protowire.ConsumeFixed32(b)
+			f.x = uint64(x)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeWriteRequest разбирает несжатый WriteRequest
+func decodeWriteRequest(b []byte) ([]*Series, error) {
+	var result []*Series
+	err := eachField(b, func(f field) error {
+		if f.num != writeRequestTimeseries {
+			return nil // Метаданные не храним
+		}
+		s, err := decodeTimeSeries(f.v)
+		if err != nil {
+			return err
+		}
+		result = append(result, s)
+		return nil
+	})
+	return result, err
+}
+
+func decodeTimeSeries(b []byte) (*Series, error) {
+	s := &Series{Labels: make(Labels)}
+	err := eachField(b, func(f field) error {
+		switch f.num {
+		case timeSeriesLabels:
+			name, value, err := decodeLabel(f.v)
+			if err != nil {
+				return err
+			}
+			s.Labels[name] = value
+		case timeSeriesSamples:
+			var smp Sample
+			err := eachField(f.v, func(f field) error {
+				switch f.num {
+				case sampleValue:
+					smp.Value = math.Float64frombits(f.x)
+				case sampleTimestamp:
+					smp.TimestampMs = int64(f.x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			s.Samples = append(s.Samples, smp)
+		case timeSeriesExemplars:
+			e, err := decodeExemplar(f.v)
+			if err != nil {
+				return err
+			}
+			s.Exemplars = append(s.Exemplars, e)
+		case timeSeriesHistograms:
+			h, err := decodeHistogram(f.v)
+			if err != nil {
+				return err
+			}
+			s.Histograms = append(s.Histograms, h)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.Name = s.Labels[MetricName]
+	if s.Name == "" {
+		return nil, errors.New("series without __name__")
+	}
+	delete(s.Labels, MetricName)
+	return s, nil
+}
+
+func decodeLabel(b []byte) (name, value string, err error) {
+	err = eachField(b, func(f field) error {
+		switch f.num {
+		case labelName:
+			name = string(f.v)
+		case labelValue:
+			value = string(f.v)
+		}
+		return nil
+	})
+	return name, value, err
+}
+
+func decodeExemplar(b []byte) (Exemplar, error) {
+	e := Exemplar{Labels: make(Labels)}
+	err := eachField(b, func(f field) error {
+		switch f.num {
+		case exemplarLabels:
+			name, value, err := decodeLabel(f.v)
+			if err != nil {
+				return err
+			}
+			e.Labels[name] = value
+		case exemplarValue:
+			e.Value = math.Float64frombits(f.x)
+		case exemplarTimestamp:
+			e.TimestampMs = int64(f.x)
+		}
+		return nil
+	})
+	return e, err
+}
+
+// decodeHistogram разбирает нативную гистограмму. Целочисленные бакеты приходят дельтами,
+// в Histogram они переводятся в абсолютные значения, как у float-гистограмм.
+func decodeHistogram(b []byte) (Histogram, error) {
+	var h Histogram
+	var positiveDeltas, negativeDeltas []int64
+	err := eachField(b, func(f field) error {
+		var err error
+		switch f.num {
+		case histogramCountInt:
+			h.Count = float64(f.x)
+		case histogramCountFloat:
+			h.Count = math.Float64frombits(f.x)
+		case histogramSum:
+			h.Sum = math.Float64frombits(f.x)
+		case histogramSchema:
+			h.Schema = int32(protowire.DecodeZigZag(f.x))
+		case histogramZeroThreshold:
+			h.ZeroThreshold = math.Float64frombits(f.x)
+		case histogramZeroCountInt:
+			h.ZeroCount = float64(f.x)
+		case histogramZeroCountFloat:
+			h.ZeroCount = math.Float64frombits(f.x)
+		case histogramNegativeSpans:
+			h.NegativeSpans, err = appendSpan(h.NegativeSpans, f.v)
+		case histogramPositiveSpans:
+			h.PositiveSpans, err = appendSpan(h.PositiveSpans, f.v)
+		case histogramNegativeDeltas:
+			negativeDeltas, err = appendDeltas(negativeDeltas, f)
+		case histogramPositiveDeltas:
+			positiveDeltas, err = appendDeltas(positiveDeltas, f)
+		case histogramNegativeCounts:
+			h.NegativeBuckets, err = appendCounts(h.NegativeBuckets, f)
+		case histogramPositiveCounts:
+			h.PositiveBuckets, err = appendCounts(h.PositiveBuckets, f)
+		case histogramTimestamp:
+			h.TimestampMs = int64(f.x)
+		}
+		return err
+	})
+	h.NegativeBuckets = append(h.NegativeBuckets, absolute(negativeDeltas)...)
+	h.PositiveBuckets = append(h.PositiveBuckets, absolute(positiveDeltas)...)
+	return h, err
+}
+
+func appendSpan(spans []Span, b []byte) ([]Span, error) {
+	var span Span
+	err := eachField(b, func(f field) error {
+		switch f.num {
+		case spanOffset:
+			span.Offset = int32(protowire.DecodeZigZag(f.x))
+		case spanLength:
+			span.Length = uint32(f.x)
+		}
+		return nil
+	})
+	return append(spans, span), err
+}
+
+// appendDeltas читает repeated sint64, упакованный или нет
+func appendDeltas(deltas []int64, f field) ([]int64, error) {
+	if f.typ == protowire.VarintType {
+		return append(deltas, protowire.DecodeZigZag(f.x)), nil
+	}
+	b := f.v
+	for len(b) > 0 {
+		x, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		deltas = append(deltas, protowire.DecodeZigZag(x))
+		b = b[n:]
+	}
+	return deltas, nil
+}
+
+// appendCounts читает repeated double, упакованный или нет
+func appendCounts(counts []float64, f field) ([]float64, error) {
+	if f.typ == protowire.Fixed64Type {
+		return append(counts, math.Float64frombits(f.x)), nil
+	}
+	b := f.v
+	for len(b) > 0 {
+		x, n := protowire.ConsumeFixed64(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		counts = append(counts, math.Float64frombits(x))
+		b = b[n:]
+	}
+	return counts, nil
+}
+
+func absolute(deltas []int64) []float64 {
+	counts := make([]float64, len(deltas))
+	var current int64
+	for i, d := range deltas {
+		current += d
+		counts[i] = float64(current)
+	}
+	return counts
+}
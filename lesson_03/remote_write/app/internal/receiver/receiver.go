@@ -0,0 +1,84 @@
+package receiver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// Receiver принимает Prometheus remote_write 1.0 (protobuf, сжатый snappy) и складывает ряды в Store.
+// Подходит вместо VictoriaMetrics в тестах и при локальной отладке:
+//
+//	POST - прием WriteRequest, как /api/v1/write
+//	GET  - последние значения всех рядов в текстовом виде
+type Receiver struct {
+	*Store
+	requests atomic.Int64
+}
+
+func New() *Receiver {
+	return &Receiver{Store: NewStore()}
+}
+
+// Requests количество успешно принятых запросов
+func (r *Receiver) Requests() int64 {
+	return r.requests.Load()
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		r.write(w, req)
+	case http.MethodGet:
+		r.dump(w)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Receiver) write(w http.ResponseWriter, req *http.Request) {
+	if encoding := req.Header.Get("Content-Encoding"); encoding != "snappy" {
+		http.Error(w, "unsupported Content-Encoding "+strconv.Quote(encoding), http.StatusUnsupportedMediaType)
+		return
+	}
+	compressed, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, "snappy: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := decodeWriteRequest(body)
+	if err != nil {
+		http.Error(w, "protobuf: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.Append(series)
+	r.requests.Add(1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *Receiver) dump(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, s := range r.Find("", nil) {
+		if smp, ok := s.Latest(); ok {
+			fmt.Fprintf(w, "%s %s %d\n", s.String(), strconv.FormatFloat(smp.Value, 'g', -1, 64), smp.TimestampMs)
+		}
+		if h, ok := s.LatestHistogram(); ok {
+			fmt.Fprintf(w, "%s histogram{count=%g,sum=%g,schema=%d} %d\n", s.String(), h.Count, h.Sum, h.Schema, h.TimestampMs)
+		}
+		if n := len(s.Exemplars); n > 0 {
+			e := s.Exemplars[n-1]
+			fmt.Fprintf(w, "%s exemplar%s %g %d\n", s.String(), e.Labels.String(), e.Value, e.TimestampMs)
+		}
+	}
+}
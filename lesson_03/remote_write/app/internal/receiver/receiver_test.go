@@ -0,0 +1,115 @@
+package receiver_test
+
+import (
+	"context"
+	"example/internal/export"
+	"example/internal/receiver"
+	"example/internal/receiver/receivertest"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+func send(t *testing.T, url string, families ...*dto.MetricFamily) {
+	t.Helper()
+	sink := export.NewRemoteWrite(export.RemoteWriteOptions{URL: url})
+	if err := sink.Send(context.Background(), families); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReceiverNativeHistogram(t *testing.T) {
+	server := receivertest.NewServer(t)
+	send(t, server.URL, &dto.MetricFamily{
+		Name: proto.String("latency_seconds"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{{Name: proto.String("route"), Value: proto.String("/orders")}},
+			Histogram: &dto.Histogram{
+				SampleCount:   proto.Uint64(8),
+				SampleSum:     proto.Float64(12.5),
+				Schema:        proto.Int32(0),
+				ZeroThreshold: proto.Float64(1e-128),
+				ZeroCount:     proto.Uint64(1),
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(2)},
+					{Offset: proto.Int32(1), Length: proto.Uint32(1)},
+				},
+				PositiveDelta: []int64{2, -1, 3},
+				NegativeSpan:  []*dto.BucketSpan{{Offset: proto.Int32(-2), Length: proto.Uint32(1)}},
+				NegativeDelta: []int64{1},
+			},
+			TimestampMs: proto.Int64(1000),
+		}},
+	})
+
+	server.ExpectSeries("latency_seconds", receiver.Labels{"route": "/orders"}).ToHaveHistogramCount(8)
+	series := server.Find("latency_seconds", nil)
+	if len(series) != 1 {
+		t.Fatalf("got %d series, want 1", len(series))
+	}
+	h, _ := series[0].LatestHistogram()
+	if h.Count != 8 || h.Sum != 12.5 || h.ZeroCount != 1 || h.TimestampMs != 1000 {
+		t.Errorf("count/sum/zero/ts = %v/%v/%v/%v, want 8/12.5/1/1000", h.Count, h.Sum, h.ZeroCount, h.TimestampMs)
+	}
+	// Deltas are turned into absolute bucket counts
+	if !slices.Equal(h.PositiveBuckets, []float64{2, 1, 4}) || !slices.Equal(h.NegativeBuckets, []float64{1}) {
+		t.Errorf("buckets = %v/%v, want [2 1 4]/[1]", h.PositiveBuckets, h.NegativeBuckets)
+	}
+	if want := []receiver.Span{{0, 2}, {1, 1}}; !slices.Equal(h.PositiveSpans, want) || h.NegativeSpans[0].Offset != -2 {
+		t.Errorf("spans = %v/%v", h.PositiveSpans, h.NegativeSpans)
+	}
+}
+
+func TestReceiverRejectsBadRequests(t *testing.T) {
+	server := receivertest.NewServer(t)
+	for _, tc := range []struct {
+		method, encoding string
+		body             []byte
+		want             int
+	}{
+		{http.MethodPost, "", snappy.Encode(nil, nil), http.StatusUnsupportedMediaType},
+		{http.MethodPost, "snappy", []byte("not snappy"), http.StatusBadRequest},
+		{http.MethodPost, "snappy", snappy.Encode(nil, []byte{0xff}), http.StatusBadRequest},
+		{http.MethodPut, "snappy", nil, http.StatusMethodNotAllowed},
+	} {
+		req, _ := http.NewRequest(tc.method, server.URL, strings.NewReader(string(tc.body)))
+		req.Header.Set("Content-Encoding", tc.encoding)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s with %q encoding: status %d, want %d", tc.method, tc.encoding, resp.StatusCode, tc.want)
+		}
+	}
+	if n := server.Requests(); n != 0 {
+		t.Errorf("accepted %d requests, want 0", n)
+	}
+}
+
+func TestReceiverDump(t *testing.T) {
+	server := receivertest.NewServer(t)
+	send(t, server.URL, &dto.MetricFamily{
+		Name:   proto.String("queue_size"),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(3)}, TimestampMs: proto.Int64(1000)}},
+	})
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if got, want := string(body), "queue_size{} 3 1000\n"; got != want {
+		t.Fatalf("dump = %q, want %q", got, want)
+	}
+}
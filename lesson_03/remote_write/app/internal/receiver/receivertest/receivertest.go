@@ -0,0 +1,145 @@
+// Package receivertest запускает приемник remote_write в тестах и ждет, пока до него дойдут данные.
+package receivertest
+
+import (
+	"example/internal/receiver"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Server приемник на httptest-сервере, который закрывается вместе с тестом
+type Server struct {
+	*receiver.Receiver
+	URL string // Адрес для remote_write, заканчивается на /api/v1/write
+	t   testing.TB
+}
+
+// NewServer запускает приемник на httptest-сервере
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	r := receiver.New()
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return &Server{Receiver: r, URL: srv.URL + "/api/v1/write", t: t}
+}
+
+// ExpectSeries начинает проверку рядов с именем name и метками labels.
+// Метки сравниваются как подмножество: ряд может иметь и другие метки.
+func (s *Server) ExpectSeries(name string, labels receiver.Labels) *Expectation {
+	return &Expectation{t: s.t, store: s.Store, name: name, labels: labels, timeout: 5 * time.Second}
+}
+
+// Expectation ждет, пока данные дойдут до приемника. Если подходит несколько рядов,
+// их последние значения складываются, как sum() в PromQL.
+type Expectation struct {
+	t       testing.TB
+	store   *receiver.Store
+	name    string
+	labels  receiver.Labels
+	timeout time.Duration
+}
+
+// Within задает время ожидания, по умолчанию 5s
+func (e *Expectation) Within(timeout time.Duration) *Expectation {
+	e.timeout = timeout
+	return e
+}
+
+// ToReach ждет, пока значение станет не меньше value, например счетчик после нескольких отправок
+func (e *Expectation) ToReach(value float64) {
+	e.t.Helper()
+	e.wait(fmt.Sprintf("to reach %g", value), func(series []receiver.Series) bool {
+		sum, ok := latestSum(series)
+		return ok && sum >= value
+	})
+}
+
+// ToEqual ждет, пока значение станет равно value
+func (e *Expectation) ToEqual(value float64) {
+	e.t.Helper()
+	e.wait(fmt.Sprintf("to equal %g", value), func(series []receiver.Series) bool {
+		sum, ok := latestSum(series)
+		return ok && sum == value
+	})
+}
+
+// ToHaveHistogramCount ждет нативную гистограмму, в которой не меньше count наблюдений
+func (e *Expectation) ToHaveHistogramCount(count float64) {
+	e.t.Helper()
+	e.wait(fmt.Sprintf("to have a native histogram with count >= %g", count), func(series []receiver.Series) bool {
+		total, found := 0.0, false
+		for _, s := range series {
+			if h, ok := s.LatestHistogram(); ok {
+				total += h.Count
+				found = true
+			}
+		}
+		return found && total >= count
+	})
+}
+
+// ToHaveExemplar ждет exemplar, у которого есть все метки labels, например trace_id
+func (e *Expectation) ToHaveExemplar(labels receiver.Labels) {
+	e.t.Helper()
+	e.wait("to have an exemplar "+labels.String(), func(series []receiver.Series) bool {
+		for _, s := range series {
+			for _, ex := range s.Exemplars {
+				if ex.Labels.Matches(labels) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+func (e *Expectation) wait(what string, done func([]receiver.Series) bool) {
+	e.t.Helper()
+	deadline := time.Now().Add(e.timeout)
+	for {
+		series := e.store.Find(e.name, e.labels)
+		if done(series) {
+			return
+		}
+		if time.Now().After(deadline) {
+			e.t.Fatalf("expected %s%s %s within %s, got:\n%s", e.name, e.labels.String(), what, e.timeout, describe(series))
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func latestSum(series []receiver.Series) (float64, bool) {
+	sum, found := 0.0, false
+	for _, s := range series {
+		if smp, ok := s.Latest(); ok {
+			sum += smp.Value
+			found = true
+		}
+	}
+	return sum, found
+}
+
+func describe(series []receiver.Series) string {
+	if len(series) == 0 {
+		return "  no matching series"
+	}
+	var b strings.Builder
+	for _, s := range series {
+		fmt.Fprintf(&b, "  %s", s.String())
+		if smp, ok := s.Latest(); ok {
+			fmt.Fprintf(&b, " = %g", smp.Value)
+		}
+		if h, ok := s.LatestHistogram(); ok {
+			fmt.Fprintf(&b, " histogram count=%g sum=%g", h.Count, h.Sum)
+		}
+		if n := len(s.Exemplars); n > 0 {
+			fmt.Fprintf(&b, " (%d exemplars)", n)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
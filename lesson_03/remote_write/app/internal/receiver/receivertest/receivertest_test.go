@@ -0,0 +1,46 @@
+package receivertest
+
+import (
+	"context"
+	"example/internal/export"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeTB records failures instead of stopping the test
+type fakeTB struct {
+	testing.TB
+	failure string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Fatalf(format string, args ...any) {
+	f.failure = fmt.Sprintf(format, args...)
+}
+
+func TestExpectationFailure(t *testing.T) {
+	server := NewServer(t)
+	sink := export.NewRemoteWrite(export.RemoteWriteOptions{URL: server.URL})
+	err := sink.Send(context.Background(), []*dto.MetricFamily{{
+		Name:   proto.String("jobs_total"),
+		Type:   dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{{Counter: &dto.Counter{Value: proto.Float64(4)}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb := &fakeTB{TB: t}
+	e := server.ExpectSeries("jobs_total", nil).Within(50 * time.Millisecond)
+	e.t = tb
+	e.ToReach(5)
+	if !strings.Contains(tb.failure, "jobs_total{} to reach 5") || !strings.Contains(tb.failure, "jobs_total{} = 4") {
+		t.Fatalf("unexpected failure message: %q", tb.failure)
+	}
+}
@@ -0,0 +1,154 @@
+package receiver
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricName имя метки с именем метрики
+const MetricName = "__name__"
+
+// Labels метки ряда без __name__
+type Labels map[string]string
+
+// String возвращает метки в виде {a="1",b="2"}, отсортированными по имени
+func (l Labels) String() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + strconv.Quote(l[name])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Matches проверяет, что в l есть все метки subset с теми же значениями
+func (l Labels) Matches(subset Labels) bool {
+	for name, value := range subset {
+		if l[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+type Sample struct {
+	TimestampMs int64
+	Value       float64
+}
+
+type Span struct {
+	Offset int32
+	Length uint32
+}
+
+// Histogram нативная гистограмма, счетчики бакетов абсолютные
+type Histogram struct {
+	TimestampMs     int64
+	Count           float64
+	Sum             float64
+	Schema          int32
+	ZeroThreshold   float64
+	ZeroCount       float64
+	NegativeSpans   []Span
+	NegativeBuckets []float64
+	PositiveSpans   []Span
+	PositiveBuckets []float64
+}
+
+type Exemplar struct {
+	Labels      Labels
+	Value       float64
+	TimestampMs int64
+}
+
+// Series все, что пришло по одному ряду, в порядке получения
+type Series struct {
+	Name       string
+	Labels     Labels
+	Samples    []Sample
+	Histograms []Histogram
+	Exemplars  []Exemplar
+}
+
+func (s *Series) String() string {
+	return s.Name + s.Labels.String()
+}
+
+// Latest возвращает последнюю точку ряда
+func (s *Series) Latest() (Sample, bool) {
+	if len(s.Samples) == 0 {
+		return Sample{}, false
+	}
+	return s.Samples[len(s.Samples)-1], true
+}
+
+// LatestHistogram возвращает последнюю нативную гистограмму ряда
+func (s *Series) LatestHistogram() (Histogram, bool) {
+	if len(s.Histograms) == 0 {
+		return Histogram{}, false
+	}
+	return s.Histograms[len(s.Histograms)-1], true
+}
+
+// Store хранит принятые ряды в памяти
+type Store struct {
+	mu     sync.RWMutex
+	series map[string]*Series
+}
+
+func NewStore() *Store {
+	return &Store{series: make(map[string]*Series)}
+}
+
+// Append добавляет точки, гистограммы и exemplars к существующим рядам
+func (s *Store) Append(series []*Series) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, in := range series {
+		key := in.String()
+		existing, ok := s.series[key]
+		if !ok {
+			existing = &Series{Name: in.Name, Labels: in.Labels}
+			s.series[key] = existing
+		}
+		existing.Samples = append(existing.Samples, in.Samples...)
+		existing.Histograms = append(existing.Histograms, in.Histograms...)
+		existing.Exemplars = append(existing.Exemplars, in.Exemplars...)
+	}
+}
+
+// Find возвращает копии рядов с именем name, у которых есть все метки labels.
+// Пустое name подходит под любое имя.
+func (s *Store) Find(name string, labels Labels) []Series {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Series
+	for _, series := range s.series {
+		if (name == "" || series.Name == name) && series.Labels.Matches(labels) {
+			result = append(result, Series{
+				Name:       series.Name,
+				Labels:     series.Labels,
+				Samples:    append([]Sample(nil), series.Samples...),
+				Histograms: append([]Histogram(nil), series.Histograms...),
+				Exemplars:  append([]Exemplar(nil), series.Exemplars...),
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].String() < result[j].String() })
+	return result
+}
+
+// Reset удаляет все ряды
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.series = make(map[string]*Series)
+}
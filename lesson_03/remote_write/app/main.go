@@ -1,8 +1,9 @@
 package main
 
 import (
+	"context"
+	"example/internal/export"
 	"fmt"
-	"github.com/marpaia/graphite-golang"
 	"log"
 	"os"
 	"strconv"
@@ -13,29 +14,36 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func sendToGraphite() {
-	graphiteHost := os.Getenv("GRAPHITE_HOST")
-	graphitePort, _ := strconv.ParseInt(os.Getenv("GRAPHITE_PORT"), 10, 64)
-	graphite, err := graphite.NewGraphite(graphiteHost, int(graphitePort))
-	if err != nil {
-		log.Println("Error connecting to Graphite:", err)
-		return
+// newSinks собирает получателей из переменных окружения, незаданные пропускаются
+func newSinks() []export.Sink {
+	var sinks []export.Sink
+	if host := os.Getenv("GRAPHITE_HOST"); host != "" {
+		sinks = append(sinks, export.NewGraphite(export.GraphiteOptions{
+			Addr:         host + ":" + os.Getenv("GRAPHITE_PORT"),
+			PathTemplate: "env.{env}.service_name.http.requests.{code}.count",
+		}))
 	}
-	env := os.Getenv("ENV")
-	defer graphite.Disconnect()
-
-	for _, httpCode := range []int{200, 201, 202, 300, 400, 404, 500, 502} {
-		count := 1
-		if httpCode == 200 {
-			count = 10
-		}
-		err = graphite.SimpleSend(fmt.Sprintf("env.%s.service_name.http.requests.%d.count", env, httpCode), fmt.Sprintf("%d", count))
-		if err != nil {
-			log.Println("Error sending metric to Graphite:", err)
-		}
+	if url := os.Getenv("PUSHGATEWAY_URL"); url != "" {
+		hostname, _ := os.Hostname()
+		sinks = append(sinks, export.NewPushgateway(export.PushgatewayOptions{
+			URL:      url,
+			Job:      "remote_write_app",
+			Grouping: map[string]string{"instance": hostname},
+		}))
 	}
-
-	log.Println("graphite send completed")
+	if addr := os.Getenv("STATSD_ADDR"); addr != "" {
+		sinks = append(sinks, export.NewStatsD(export.StatsDOptions{
+			Addr:   addr,
+			Prefix: "remote_write_app.",
+		}))
+	}
+	if url := os.Getenv("REMOTE_WRITE_URL"); url != "" {
+		sinks = append(sinks, export.NewRemoteWrite(export.RemoteWriteOptions{
+			URL:            url,
+			ExternalLabels: map[string]string{"job": "remote_write_app"},
+		}))
+	}
+	return sinks
 }
 
 func main() {
@@ -47,6 +55,19 @@ func main() {
 	}, []string{"my_label"})
 	prometheus.MustRegister(metric)
 
+	// Во внешние системы отправляем только метрики отдельного реестра, а не 100к сгенерированных рядов
+	exportRegistry := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_requests_total",
+		Help:        "Total number of HTTP requests",
+		ConstLabels: prometheus.Labels{"env": os.Getenv("ENV")},
+	}, []string{"code"})
+	exportRegistry.MustRegister(requests)
+
+	// Метрики здоровья получателей видны на /metrics
+	exporter := export.NewExporter(exportRegistry, export.Options{Interval: 10 * time.Second}, newSinks()...)
+	exporter.Start(context.Background())
+
 	go func() {
 		for {
 			i := 0
@@ -54,7 +75,13 @@ func main() {
 				metric.WithLabelValues(fmt.Sprintf("%d", i)).Set(float64(time.Now().UnixNano()))
 				i++
 			}
-			sendToGraphite()
+			for _, httpCode := range []int{200, 201, 202, 300, 400, 404, 500, 502} {
+				count := 1
+				if httpCode == 200 {
+					count = 10
+				}
+				requests.WithLabelValues(strconv.Itoa(httpCode)).Add(float64(count))
+			}
 			time.Sleep(time.Second)
 		}
 	}()
@@ -1,45 +1,78 @@
 package app
 
 import (
-	"example/internal/app/mocks"
-	"go.uber.org/mock/gomock"
+	"example/internal/metrictest"
+	"strings"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestMetrics_DoStuff(t *testing.T) {
 	testCases := []struct {
-		name     string
-		label1   string
-		label2   string
-		expCalls int
+		name   string
+		label1 string
+		label2 string
+		calls  int
 	}{
 
 		{
-			name:     "Increment with labels",
-			label1:   "value1",
-			label2:   "value2",
-			expCalls: 1,
+			name:   "Increment with labels",
+			label1: "value1",
+			label2: "value2",
+			calls:  1,
 		},
 		{
-			name:     "Increment with different labels",
-			label1:   "value3",
-			label2:   "value4",
-			expCalls: 1,
+			name:   "Increment with different labels",
+			label1: "value3",
+			label2: "value4",
+			calls:  3,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
+			reg := metrictest.NewRegistry(t)
+			service := New(reg)
 
-			mockPrometheus := mocks.NewMockPrometheusClient(ctrl)
+			for i := 0; i < tc.calls; i++ {
+				service.DoStuff(tc.label1, tc.label2)
+			}
 
-			service := New(mockPrometheus)
+			labels := prometheus.Labels{"label1": tc.label1, "label2": tc.label2}
+			reg.AssertCounter("my_counter", labels, float64(tc.calls))
+			reg.AssertLabelSets("my_counter", labels)
+		})
+	}
+}
 
-			mockPrometheus.EXPECT().Inc(tc.label1, tc.label2).Times(tc.expCalls)
+func TestMetrics_Exposition(t *testing.T) {
+	reg := metrictest.NewRegistry(t)
+	service := New(reg)
+	service.DoStuff("value1", "value2")
+	service.DoStuff("value1", "value3")
 
-			service.DoStuff(tc.label1, tc.label2)
-		})
+	reg.AssertGolden("testdata/metrics.golden")
+}
+
+func TestMetrics_Lint(t *testing.T) {
+	reg := metrictest.NewRegistry(t)
+	service := New(reg)
+	service.DoStuff("value1", "value2")
+
+	// Линтер находит проблемы в имени my_counter: нет суффикса _total и есть тип в имени.
+	// Из-за первой в OpenMetrics счетчик отдается как unknown, это видно в golden-файле.
+	problems, err := metrictest.Lint(reg, metrictest.LintOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`counter metrics should have "_total" suffix`, "metric name should not include type 'counter'"}
+	if len(problems) != len(want) {
+		t.Fatalf("problems = %v, want %q", problems, want)
+	}
+	for i, p := range problems {
+		if p.Metric != "my_counter" || !strings.Contains(p.Text, want[i]) {
+			t.Errorf("problem %d = %s, want my_counter: %s", i, p, want[i])
+		}
 	}
 }
@@ -0,0 +1,94 @@
+package metrictest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+// UpdateGoldenEnv переменная окружения, при UPDATE_GOLDEN=1 golden-файлы перезаписываются:
+//
+//	UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "UPDATE_GOLDEN"
+
+// AssertGolden сравнивает экспозицию в формате OpenMetrics с файлом path.
+// names ограничивает набор метрик, без него сравниваются все.
+// Время exemplars не детерминировано и в файл не попадает.
+func (r *Registry) AssertGolden(path string, names ...string) {
+	r.t.Helper()
+	AssertGolden(r.t, r, path, names...)
+}
+
+// AssertGolden сравнивает экспозицию gatherer в формате OpenMetrics с файлом path
+func AssertGolden(t testing.TB, gatherer prometheus.Gatherer, path string, names ...string) {
+	t.Helper()
+	got, err := OpenMetrics(gatherer, names...)
+	if err != nil {
+		t.Fatalf("encode OpenMetrics: %v", err)
+	}
+
+	if os.Getenv(UpdateGoldenEnv) == "1" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file (run with %s=1 to create it): %v", UpdateGoldenEnv, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("exposition differs from %s (run with %s=1 to update)\n--- got\n%s\n--- want\n%s", path, UpdateGoldenEnv, got, want)
+	}
+}
+
+// OpenMetrics возвращает экспозицию в формате OpenMetrics без времени exemplars
+func OpenMetrics(gatherer prometheus.Gatherer, names ...string) ([]byte, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeOpenMetrics))
+	for _, family := range families {
+		if len(names) > 0 && !slices.Contains(names, family.GetName()) {
+			continue
+		}
+		family = proto.Clone(family).(*dto.MetricFamily)
+		for _, m := range family.GetMetric() {
+			clearExemplarTimestamps(m)
+		}
+		if err := enc.Encode(family); err != nil {
+			return nil, err
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func clearExemplarTimestamps(m *dto.Metric) {
+	if e := m.GetCounter().GetExemplar(); e != nil {
+		e.Timestamp = nil
+	}
+	for _, b := range m.GetHistogram().GetBucket() {
+		if e := b.GetExemplar(); e != nil {
+			e.Timestamp = nil
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package metrictest
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil/promlint"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// LintOptions настройки проверки метрик
+type LintOptions struct {
+	// MaxLabelValues сколько разных значений метки допустимо у одной метрики, по умолчанию 100
+	MaxLabelValues int
+	// ForbiddenLabels метки, которые почти всегда дают неограниченную кардинальность.
+	// По умолчанию id, user_id, request_id, trace_id, span_id, session_id, email, ip, url, uuid.
+	ForbiddenLabels []string
+	// Units допустимые суффиксы единиц, по умолчанию базовые единицы Prometheus
+	Units []string
+	// SkipPromlint отключает стандартные проверки promlint (суффикс _total, help, имена)
+	SkipPromlint bool
+}
+
+func (o LintOptions) withDefaults() LintOptions {
+	if o.MaxLabelValues <= 0 {
+		o.MaxLabelValues = 100
+	}
+	if o.ForbiddenLabels == nil {
+		o.ForbiddenLabels = []string{"id", "user_id", "request_id", "trace_id", "span_id", "session_id", "email", "ip", "url", "uuid"}
+	}
+	if o.Units == nil {
+		o.Units = []string{"seconds", "bytes", "ratio", "meters", "grams", "celsius", "volts", "amperes", "joules", "info"}
+	}
+	return o
+}
+
+// Problem найденная проблема метрики
+type Problem struct {
+	Metric string
+	Text   string
+}
+
+func (p Problem) String() string {
+	return p.Metric + ": " + p.Text
+}
+
+var (
+	// measurementWords слова в имени, которые говорят, что у метрики должна быть единица
+	measurementWords = regexp.MustCompile(`(^|_)(duration|latency|time|elapsed|size|length|age|delay|timeout|lag|memory)(_|$)`)
+	uuidValue        = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	longNumberValue  = regexp.MustCompile(`^[0-9]{6,}$`)
+)
+
+// Lint проверяет метрики на высокую кардинальность меток и отсутствие единиц,
+// а также (если не отключено) стандартными правилами promlint
+func Lint(gatherer prometheus.Gatherer, opts LintOptions) ([]Problem, error) {
+	opts = opts.withDefaults()
+	families, err := gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	for _, family := range families {
+		problems = append(problems, lintUnits(family, opts)...)
+		problems = append(problems, lintCardinality(family, opts)...)
+	}
+
+	if !opts.SkipPromlint {
+		lintProblems, err := promlint.NewWithMetricFamilies(families).Lint()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range lintProblems {
+			problems = append(problems, Problem{Metric: p.Metric, Text: p.Text})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Metric < problems[j].Metric })
+	return problems, nil
+}
+
+// AssertLint падает, если Lint нашел проблемы
+func (r *Registry) AssertLint(opts LintOptions) {
+	r.t.Helper()
+	AssertLint(r.t, r, opts)
+}
+
+// AssertLint падает, если Lint нашел проблемы в метриках gatherer
+func AssertLint(t testing.TB, gatherer prometheus.Gatherer, opts LintOptions) {
+	t.Helper()
+	problems, err := Lint(gatherer, opts)
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	for _, p := range problems {
+		t.Errorf("lint: %s", p)
+	}
+}
+
+// lintUnits требует единицу у гистограмм, summary и метрик, имя которых говорит об измерении
+func lintUnits(family *dto.MetricFamily, opts LintOptions) []Problem {
+	name := strings.TrimSuffix(family.GetName(), "_total")
+	for _, unit := range opts.Units {
+		if strings.HasSuffix(name, "_"+unit) {
+			return nil
+		}
+	}
+
+	switch {
+	case family.GetType() == dto.MetricType_HISTOGRAM || family.GetType() == dto.MetricType_SUMMARY:
+		return []Problem{{family.GetName(), fmt.Sprintf("%s has no unit suffix, expected one of %v", strings.ToLower(family.GetType().String()), opts.Units)}}
+	case measurementWords.MatchString(name):
+		return []Problem{{family.GetName(), fmt.Sprintf("name looks like a measurement but has no unit suffix, expected one of %v", opts.Units)}}
+	}
+	return nil
+}
+
+// lintCardinality ищет запрещенные метки, метки со слишком большим числом значений
+// и значения, похожие на идентификаторы
+func lintCardinality(family *dto.MetricFamily, opts LintOptions) []Problem {
+	values := make(map[string]map[string]struct{})
+	identifiers := make(map[string]string)
+	for _, m := range family.GetMetric() {
+		for _, lp := range m.GetLabel() {
+			if values[lp.GetName()] == nil {
+				values[lp.GetName()] = make(map[string]struct{})
+			}
+			values[lp.GetName()][lp.GetValue()] = struct{}{}
+			if uuidValue.MatchString(lp.GetValue()) || longNumberValue.MatchString(lp.GetValue()) {
+				identifiers[lp.GetName()] = lp.GetValue()
+			}
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []Problem
+	for _, name := range names {
+		switch {
+		case slices.Contains(opts.ForbiddenLabels, name):
+			problems = append(problems, Problem{family.GetName(), fmt.Sprintf("label %q is unbounded by nature, move it to logs, traces or exemplars", name)})
+		case identifiers[name] != "":
+			problems = append(problems, Problem{family.GetName(), fmt.Sprintf("label %q has identifier-like value %q", name, identifiers[name])})
+		case len(values[name]) > opts.MaxLabelValues:
+			problems = append(problems, Problem{family.GetName(), fmt.Sprintf("label %q has %d values, more than %d", name, len(values[name]), opts.MaxLabelValues)})
+		}
+	}
+	return problems
+}
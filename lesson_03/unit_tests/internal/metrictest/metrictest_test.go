@@ -0,0 +1,156 @@
+package metrictest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeTB records failures instead of failing the test. Fatalf stops the assertion like testing.T does.
+type fakeTB struct {
+	testing.TB
+	failures []string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+type fatal struct{}
+
+func (f *fakeTB) Fatalf(format string, args ...any) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+	panic(fatal{})
+}
+
+// run calls an assertion, recovering from Fatalf
+func (f *fakeTB) run(assert func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(fatal); !ok {
+				panic(r)
+			}
+		}
+	}()
+	assert()
+}
+
+func TestRegistryAssertions(t *testing.T) {
+	reg := NewRegistry(t)
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Requests"}, []string{"code"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Help: "Latency", Buckets: []float64{0.1, 1}})
+	reg.MustRegister(requests, latency)
+
+	requests.WithLabelValues("200").Add(2)
+	requests.WithLabelValues("500").Inc()
+	latency.(prometheus.ExemplarObserver).ObserveWithExemplar(0.5, prometheus.Labels{"trace_id": "abc"})
+	latency.Observe(5)
+
+	reg.AssertCounter("requests_total", prometheus.Labels{"code": "200"}, 2)
+	reg.AssertLabelSets("requests_total", prometheus.Labels{"code": "500"}, prometheus.Labels{"code": "200"})
+	reg.AssertHistogramCount("latency_seconds", nil, 2)
+	reg.AssertBucket("latency_seconds", nil, 0.1, 0)
+	reg.AssertBucket("latency_seconds", nil, 1, 1)
+	reg.AssertBucket("latency_seconds", nil, math.Inf(1), 2)
+	reg.AssertExemplar("latency_seconds", nil, prometheus.Labels{"trace_id": "abc"})
+
+	// Failures name the metric and show what is there instead
+	tb := &fakeTB{TB: t}
+	failing := &Registry{Registry: reg.Registry, t: tb}
+	tb.run(func() { failing.AssertCounter("requests_total", prometheus.Labels{"code": "200"}, 3) })
+	tb.run(func() { failing.AssertCounter("requests_total", prometheus.Labels{"code": "404"}, 1) })
+	tb.run(func() { failing.AssertGauge("missing", nil, 1) })
+	want := []string{
+		`counter requests_total{code="200"} = 2, want 3`,
+		`metric requests_total has no series {code="404"}, series: [{code="200"} {code="500"}]`,
+		`metric missing is not registered`,
+	}
+	if len(tb.failures) != len(want) {
+		t.Fatalf("failures = %q, want %d", tb.failures, len(want))
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(tb.failures[i], w) {
+			t.Errorf("failure %d = %q, want prefix %q", i, tb.failures[i], w)
+		}
+	}
+}
+
+func TestMeterProviderAssertions(t *testing.T) {
+	mp := NewMeterProvider(t)
+	meter := mp.Meter("test")
+
+	counter, _ := meter.Int64Counter("orders")
+	gauge, _ := meter.Float64Gauge("queue.size")
+	histogram, _ := meter.Float64Histogram("latency", metric.WithExplicitBucketBoundaries(0.1, 1))
+
+	traceID := trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	counter.Add(ctx, 2, metric.WithAttributes(attribute.String("status", "ok")))
+	counter.Add(ctx, 1, metric.WithAttributes(attribute.String("status", "failed")))
+	gauge.Record(ctx, 7)
+	histogram.Record(ctx, 0.5)
+	histogram.Record(ctx, 0.7)
+	histogram.Record(ctx, 3)
+
+	mp.AssertSum("orders", 2, attribute.String("status", "ok"))
+	mp.AssertAttributeSets("orders", []attribute.KeyValue{attribute.String("status", "failed")}, []attribute.KeyValue{attribute.String("status", "ok")})
+	mp.AssertGauge("queue.size", 7)
+	mp.AssertHistogramCount("latency", 3)
+	mp.AssertBucket("latency", 1, 2)
+	mp.AssertBucket("latency", math.Inf(1), 1)
+	mp.AssertExemplar("latency", traceID.String())
+
+	tb := &fakeTB{TB: t}
+	failing := &MeterProvider{MeterProvider: mp.MeterProvider, reader: mp.reader, t: tb}
+	tb.run(func() { failing.AssertSum("orders", 1, attribute.String("status", "unknown")) })
+	if len(tb.failures) != 1 || !strings.HasPrefix(tb.failures[0], "metric orders has no point {status=unknown}") {
+		t.Fatalf("failures = %q", tb.failures)
+	}
+}
+
+func TestLint(t *testing.T) {
+	reg := NewRegistry(t)
+	reg.MustRegister(
+		prometheus.NewHistogram(prometheus.HistogramOpts{Name: "request_latency", Help: "Latency"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "cache_size", Help: "Cache size"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "memory_bytes", Help: "Memory"}),
+	)
+	orders := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "orders_total", Help: "Orders"}, []string{"user_id", "status", "order"})
+	reg.MustRegister(orders)
+	for i := 0; i < 5; i++ {
+		orders.WithLabelValues(fmt.Sprint(i), fmt.Sprint("status", i), fmt.Sprint(1000000+i)).Inc()
+	}
+
+	problems, err := Lint(reg, LintOptions{MaxLabelValues: 3, SkipPromlint: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`cache_size: name looks like a measurement but has no unit suffix, expected one of [seconds bytes ratio meters grams celsius volts amperes joules info]`,
+		`orders_total: label "order" has identifier-like value "1000004"`,
+		`orders_total: label "status" has 5 values, more than 3`,
+		`orders_total: label "user_id" is unbounded by nature, move it to logs, traces or exemplars`,
+		`request_latency: histogram has no unit suffix, expected one of [seconds bytes ratio meters grams celsius volts amperes joules info]`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
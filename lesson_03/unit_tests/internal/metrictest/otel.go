@@ -0,0 +1,252 @@
+package metrictest
+
+import (
+	"context"
+	"encoding/hex"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// MeterProvider MeterProvider OTel с ManualReader: метрики собираются по требованию теста,
+// без экспортеров и коллектора
+type MeterProvider struct {
+	*sdkmetric.MeterProvider
+	reader *sdkmetric.ManualReader
+	t      testing.TB
+}
+
+// NewMeterProvider создает провайдер, который закрывается вместе с тестом.
+// opts дополняют настройки, например sdkmetric.WithView или sdkmetric.WithExemplarFilter.
+func NewMeterProvider(t testing.TB, opts ...sdkmetric.Option) *MeterProvider {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(append(opts, sdkmetric.WithReader(reader))...)
+	t.Cleanup(func() { mp.Shutdown(context.Background()) })
+	return &MeterProvider{MeterProvider: mp, reader: reader, t: t}
+}
+
+// Collect собирает текущие значения всех метрик
+func (p *MeterProvider) Collect() metricdata.ResourceMetrics {
+	p.t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := p.reader.Collect(context.Background(), &rm); err != nil {
+		p.t.Fatalf("collect: %v", err)
+	}
+	return rm
+}
+
+// AssertSum проверяет значение счетчика (Counter или UpDownCounter) с ровно такими атрибутами
+func (p *MeterProvider) AssertSum(name string, want float64, attrs ...attribute.KeyValue) {
+	p.t.Helper()
+	var got float64
+	switch data := p.data(name).(type) {
+	case metricdata.Sum[int64]:
+		got = float64(point(p.t, name, data.DataPoints, attrs).Value)
+	case metricdata.Sum[float64]:
+		got = point(p.t, name, data.DataPoints, attrs).Value
+	default:
+		p.t.Fatalf("metric %s is a %T, not a sum", name, data)
+	}
+	if got != want {
+		p.t.Errorf("sum %s%s = %v, want %v", name, formatAttrs(attrs), got, want)
+	}
+}
+
+// AssertGauge проверяет значение gauge с ровно такими атрибутами
+func (p *MeterProvider) AssertGauge(name string, want float64, attrs ...attribute.KeyValue) {
+	p.t.Helper()
+	var got float64
+	switch data := p.data(name).(type) {
+	case metricdata.Gauge[int64]:
+		got = float64(point(p.t, name, data.DataPoints, attrs).Value)
+	case metricdata.Gauge[float64]:
+		got = point(p.t, name, data.DataPoints, attrs).Value
+	default:
+		p.t.Fatalf("metric %s is a %T, not a gauge", name, data)
+	}
+	if got != want {
+		p.t.Errorf("gauge %s%s = %v, want %v", name, formatAttrs(attrs), got, want)
+	}
+}
+
+// histogramPoint общая часть точки гистограммы, не зависящая от типа значения
+type histogramPoint struct {
+	count        uint64
+	bounds       []float64
+	bucketCounts []uint64
+	traceIDs     []string
+}
+
+func (p *MeterProvider) histogram(name string, attrs []attribute.KeyValue) histogramPoint {
+	p.t.Helper()
+	switch data := p.data(name).(type) {
+	case metricdata.Histogram[int64]:
+		dp := point(p.t, name, data.DataPoints, attrs)
+		return histogramPoint{dp.Count, dp.Bounds, dp.BucketCounts, traceIDs(dp.Exemplars)}
+	case metricdata.Histogram[float64]:
+		dp := point(p.t, name, data.DataPoints, attrs)
+		return histogramPoint{dp.Count, dp.Bounds, dp.BucketCounts, traceIDs(dp.Exemplars)}
+	default:
+		p.t.Fatalf("metric %s is a %T, not a histogram", name, data)
+		return histogramPoint{}
+	}
+}
+
+// AssertHistogramCount проверяет количество наблюдений гистограммы
+func (p *MeterProvider) AssertHistogramCount(name string, want uint64, attrs ...attribute.KeyValue) {
+	p.t.Helper()
+	if got := p.histogram(name, attrs).count; got != want {
+		p.t.Errorf("histogram %s%s count = %d, want %d", name, formatAttrs(attrs), got, want)
+	}
+}
+
+// AssertBucket проверяет количество наблюдений в бакете с верхней границей upperBound.
+// В отличие от Prometheus, бакеты OTel не накопительные. Последний бакет - math.Inf(1).
+func (p *MeterProvider) AssertBucket(name string, upperBound float64, want uint64, attrs ...attribute.KeyValue) {
+	p.t.Helper()
+	h := p.histogram(name, attrs)
+	for i, count := range h.bucketCounts {
+		bound := math.Inf(1)
+		if i < len(h.bounds) {
+			bound = h.bounds[i]
+		}
+		if bound == upperBound {
+			if count != want {
+				p.t.Errorf("histogram %s%s bucket %v = %d, want %d", name, formatAttrs(attrs), upperBound, count, want)
+			}
+			return
+		}
+	}
+	p.t.Errorf("histogram %s%s has no bucket %v, bounds: %v", name, formatAttrs(attrs), upperBound, h.bounds)
+}
+
+// AssertExemplar проверяет, что у гистограммы есть exemplar из трейса traceID (hex)
+func (p *MeterProvider) AssertExemplar(name string, traceID string, attrs ...attribute.KeyValue) {
+	p.t.Helper()
+	h := p.histogram(name, attrs)
+	for _, id := range h.traceIDs {
+		if id == traceID {
+			return
+		}
+	}
+	p.t.Errorf("histogram %s%s has no exemplar of trace %s, exemplar traces: %v", name, formatAttrs(attrs), traceID, h.traceIDs)
+}
+
+// AssertAttributeSets проверяет, что у name есть ровно такие наборы атрибутов, порядок не важен
+func (p *MeterProvider) AssertAttributeSets(name string, want ...[]attribute.KeyValue) {
+	p.t.Helper()
+	var got []attribute.Set
+	switch data := p.data(name).(type) {
+	case metricdata.Sum[int64]:
+		got = attributeSets(data.DataPoints)
+	case metricdata.Sum[float64]:
+		got = attributeSets(data.DataPoints)
+	case metricdata.Gauge[int64]:
+		got = attributeSets(data.DataPoints)
+	case metricdata.Gauge[float64]:
+		got = attributeSets(data.DataPoints)
+	case metricdata.Histogram[int64]:
+		for _, dp := range data.DataPoints {
+			got = append(got, dp.Attributes)
+		}
+	case metricdata.Histogram[float64]:
+		for _, dp := range data.DataPoints {
+			got = append(got, dp.Attributes)
+		}
+	}
+
+	gotStrings := make([]string, len(got))
+	for i, set := range got {
+		gotStrings[i] = formatSet(set)
+	}
+	wantStrings := make([]string, len(want))
+	for i, attrs := range want {
+		wantStrings[i] = formatAttrs(attrs)
+	}
+	sort.Strings(gotStrings)
+	sort.Strings(wantStrings)
+	if strings.Join(gotStrings, " ") != strings.Join(wantStrings, " ") {
+		p.t.Errorf("%s attribute sets = %v, want %v", name, gotStrings, wantStrings)
+	}
+}
+
+func (p *MeterProvider) data(name string) metricdata.Aggregation {
+	p.t.Helper()
+	rm := p.Collect()
+	var names []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+			names = append(names, m.Name)
+		}
+	}
+	p.t.Fatalf("metric %s was not recorded, recorded metrics: %v", name, names)
+	return nil
+}
+
+// dataPoint точка с атрибутами, общее у DataPoint и HistogramDataPoint
+type dataPoint interface {
+	metricdata.DataPoint[int64] | metricdata.DataPoint[float64] |
+		metricdata.HistogramDataPoint[int64] | metricdata.HistogramDataPoint[float64]
+}
+
+func point[T dataPoint](t testing.TB, name string, points []T, attrs []attribute.KeyValue) T {
+	t.Helper()
+	want := attribute.NewSet(attrs...)
+	var seen []string
+	for _, dp := range points {
+		set := attributesOf(dp)
+		if set.Equals(&want) {
+			return dp
+		}
+		seen = append(seen, formatSet(set))
+	}
+	t.Fatalf("metric %s has no point %s, points: %v", name, formatAttrs(attrs), seen)
+	var zero T
+	return zero
+}
+
+func attributesOf[T dataPoint](dp T) attribute.Set {
+	switch dp := any(dp).(type) {
+	case metricdata.DataPoint[int64]:
+		return dp.Attributes
+	case metricdata.DataPoint[float64]:
+		return dp.Attributes
+	case metricdata.HistogramDataPoint[int64]:
+		return dp.Attributes
+	case metricdata.HistogramDataPoint[float64]:
+		return dp.Attributes
+	}
+	return attribute.Set{}
+}
+
+func attributeSets[N int64 | float64](points []metricdata.DataPoint[N]) []attribute.Set {
+	sets := make([]attribute.Set, len(points))
+	for i, dp := range points {
+		sets[i] = dp.Attributes
+	}
+	return sets
+}
+
+func traceIDs[N int64 | float64](exemplars []metricdata.Exemplar[N]) []string {
+	ids := make([]string, 0, len(exemplars))
+	for _, e := range exemplars {
+		ids = append(ids, hex.EncodeToString(e.TraceID))
+	}
+	return ids
+}
+
+func formatAttrs(attrs []attribute.KeyValue) string {
+	return formatSet(attribute.NewSet(attrs...))
+}
+
+func formatSet(set attribute.Set) string {
+	return "{" + set.Encoded(attribute.DefaultEncoder()) + "}"
+}
@@ -0,0 +1,186 @@
+package metrictest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Registry изолированный реестр для одного теста. Код под тестом регистрирует метрики в нем,
+// а не в prometheus.DefaultRegisterer, поэтому тесты не мешают друг другу и не нужны моки.
+type Registry struct {
+	*prometheus.Registry
+	t testing.TB
+}
+
+func NewRegistry(t testing.TB) *Registry {
+	return &Registry{Registry: prometheus.NewRegistry(), t: t}
+}
+
+// AssertCounter проверяет значение счетчика name с ровно такими метками
+func (r *Registry) AssertCounter(name string, labels prometheus.Labels, want float64) {
+	r.t.Helper()
+	m := r.metric(name, labels, dto.MetricType_COUNTER)
+	if got := m.GetCounter().GetValue(); got != want {
+		r.t.Errorf("counter %s%s = %v, want %v", name, formatLabels(labels), got, want)
+	}
+}
+
+// AssertGauge проверяет значение gauge name с ровно такими метками
+func (r *Registry) AssertGauge(name string, labels prometheus.Labels, want float64) {
+	r.t.Helper()
+	m := r.metric(name, labels, dto.MetricType_GAUGE)
+	if got := m.GetGauge().GetValue(); got != want {
+		r.t.Errorf("gauge %s%s = %v, want %v", name, formatLabels(labels), got, want)
+	}
+}
+
+// AssertHistogramCount проверяет количество наблюдений гистограммы
+func (r *Registry) AssertHistogramCount(name string, labels prometheus.Labels, want uint64) {
+	r.t.Helper()
+	m := r.metric(name, labels, dto.MetricType_HISTOGRAM)
+	if got := m.GetHistogram().GetSampleCount(); got != want {
+		r.t.Errorf("histogram %s%s count = %d, want %d", name, formatLabels(labels), got, want)
+	}
+}
+
+// AssertBucket проверяет накопленный счетчик бакета le, как в name_bucket{le="..."}
+func (r *Registry) AssertBucket(name string, labels prometheus.Labels, le float64, want uint64) {
+	r.t.Helper()
+	h := r.metric(name, labels, dto.MetricType_HISTOGRAM).GetHistogram()
+	if math.IsInf(le, 1) {
+		if got := h.GetSampleCount(); got != want {
+			r.t.Errorf("histogram %s%s bucket le=+Inf = %d, want %d", name, formatLabels(labels), got, want)
+		}
+		return
+	}
+	var bounds []float64
+	for _, b := range h.GetBucket() {
+		if b.GetUpperBound() == le {
+			if got := b.GetCumulativeCount(); got != want {
+				r.t.Errorf("histogram %s%s bucket le=%v = %d, want %d", name, formatLabels(labels), le, got, want)
+			}
+			return
+		}
+		bounds = append(bounds, b.GetUpperBound())
+	}
+	r.t.Errorf("histogram %s%s has no bucket le=%v, buckets: %v", name, formatLabels(labels), le, bounds)
+}
+
+// AssertExemplar проверяет, что у счетчика или одного из бакетов гистограммы есть exemplar
+// со всеми метками exemplarLabels, например trace_id
+func (r *Registry) AssertExemplar(name string, labels, exemplarLabels prometheus.Labels) {
+	r.t.Helper()
+	m := r.metric(name, labels, dto.MetricType_UNTYPED)
+
+	var exemplars []*dto.Exemplar
+	if e := m.GetCounter().GetExemplar(); e != nil {
+		exemplars = append(exemplars, e)
+	}
+	for _, b := range m.GetHistogram().GetBucket() {
+		if e := b.GetExemplar(); e != nil {
+			exemplars = append(exemplars, e)
+		}
+	}
+	exemplars = append(exemplars, m.GetHistogram().GetExemplars()...)
+
+	var seen []string
+	for _, e := range exemplars {
+		if hasLabels(e.GetLabel(), exemplarLabels) {
+			return
+		}
+		seen = append(seen, formatPairs(e.GetLabel()))
+	}
+	r.t.Errorf("%s%s has no exemplar with %s, exemplars: %v", name, formatLabels(labels), formatLabels(exemplarLabels), seen)
+}
+
+// AssertLabelSets проверяет, что у name есть ровно такие наборы меток, порядок не важен
+func (r *Registry) AssertLabelSets(name string, want ...prometheus.Labels) {
+	r.t.Helper()
+	family := r.family(name)
+	var got []string
+	for _, m := range family.GetMetric() {
+		got = append(got, formatPairs(m.GetLabel()))
+	}
+	wantStrings := make([]string, len(want))
+	for i, labels := range want {
+		wantStrings[i] = formatLabels(labels)
+	}
+	sort.Strings(got)
+	sort.Strings(wantStrings)
+	if strings.Join(got, " ") != strings.Join(wantStrings, " ") {
+		r.t.Errorf("%s label sets = %v, want %v", name, got, wantStrings)
+	}
+}
+
+func (r *Registry) family(name string) *dto.MetricFamily {
+	r.t.Helper()
+	families, err := r.Gather()
+	if err != nil {
+		r.t.Fatalf("gather: %v", err)
+	}
+	var names []string
+	for _, family := range families {
+		if family.GetName() == name {
+			return family
+		}
+		names = append(names, family.GetName())
+	}
+	r.t.Fatalf("metric %s is not registered, registered metrics: %v", name, names)
+	return nil
+}
+
+// metric ищет ряд name с ровно такими метками. MetricType_UNTYPED означает любой тип.
+func (r *Registry) metric(name string, labels prometheus.Labels, typ dto.MetricType) *dto.Metric {
+	r.t.Helper()
+	family := r.family(name)
+	if typ != dto.MetricType_UNTYPED && family.GetType() != typ {
+		r.t.Fatalf("metric %s is a %s, not a %s", name, family.GetType(), typ)
+	}
+	var seen []string
+	for _, m := range family.GetMetric() {
+		if len(m.GetLabel()) == len(labels) && hasLabels(m.GetLabel(), labels) {
+			return m
+		}
+		seen = append(seen, formatPairs(m.GetLabel()))
+	}
+	r.t.Fatalf("metric %s has no series %s, series: %v", name, formatLabels(labels), seen)
+	return nil
+}
+
+func hasLabels(pairs []*dto.LabelPair, labels prometheus.Labels) bool {
+	matched := 0
+	for _, lp := range pairs {
+		if value, ok := labels[lp.GetName()]; ok && value == lp.GetValue() {
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+func formatPairs(pairs []*dto.LabelPair) string {
+	labels := make(prometheus.Labels, len(pairs))
+	for _, lp := range pairs {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	return formatLabels(labels)
+}
+
+// formatLabels выводит метки в виде {a="1",b="2"}, отсортированными по имени
+func formatLabels(labels prometheus.Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%q", name, labels[name])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,235 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures the deduplicating handler. Zero values are replaced with defaults.
+type Options struct {
+	Window     time.Duration // Identical records within the window are collapsed into one
+	MaxEntries int           // Max distinct records kept between flushes, least recently seen is flushed first
+}
+
+func (o Options) withDefaults() Options {
+	if o.Window <= 0 {
+		o.Window = 10 * time.Second
+	}
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 1000
+	}
+	return o
+}
+
+// entry accumulates identical records until the next flush.
+type entry struct {
+	key  string
+	next slog.Handler
+	// ctx of the first record, handlers read e.g. the trace ID from it
+	ctx       context.Context
+	record    slog.Record
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// state is shared between the handler and the handlers derived via WithAttrs/WithGroup.
+type state struct {
+	opts Options
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // Front is the most recently seen entry
+	closed  bool       // After Close records go straight to the next handler
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Handler collapses identical records (same level, message, attributes and groups,
+// including the ones added via WithAttrs/WithGroup) into a single record
+// with count, first_seen and last_seen attributes.
+// Records are held until the window ends, the entry is evicted or Close is called.
+type Handler struct {
+	state *state
+	next  slog.Handler
+	// scope encodes the attrs and groups of WithAttrs/WithGroup, so that loggers
+	// derived with the same attrs, e.g. per request, share the entries
+	scope string
+}
+
+// NewHandler starts the flush loop. Close must be called to emit pending records.
+func NewHandler(next slog.Handler, opts Options) *Handler {
+	s := &state{
+		opts:    opts.withDefaults(),
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return &Handler{state: s, next: next}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	key := h.key(r)
+	s := h.state
+
+	s.mu.Lock()
+	if s.closed {
+		// Nothing would flush the entry anymore
+		s.mu.Unlock()
+		return h.next.Handle(ctx, r)
+	}
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.count++
+		e.lastSeen = r.Time
+		s.lru.MoveToFront(el)
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.entries[key] = s.lru.PushFront(&entry{
+		key:  key,
+		next: h.next,
+		// The record is emitted later, when the request may be over
+		ctx:       context.WithoutCancel(ctx),
+		record:    r.Clone(),
+		count:     1,
+		firstSeen: r.Time,
+		lastSeen:  r.Time,
+	})
+
+	var evicted *entry
+	if s.lru.Len() > s.opts.MaxEntries {
+		evicted = s.remove(s.lru.Back())
+	}
+	s.mu.Unlock()
+
+	if evicted != nil {
+		return evicted.emit()
+	}
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	var b strings.Builder
+	b.WriteString(h.scope)
+	for _, a := range attrs {
+		writeAttr(&b, a)
+	}
+	return &Handler{state: h.state, next: h.next.WithAttrs(attrs), scope: b.String()}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &Handler{state: h.state, next: h.next.WithGroup(name), scope: h.scope + "|group:" + strconv.Quote(name)}
+}
+
+// Flush emits all pending records.
+func (h *Handler) Flush() {
+	h.state.flush()
+}
+
+// Close stops the flush loop and emits all pending records.
+// Records handled after Close are passed to the next handler without deduplication.
+func (h *Handler) Close() {
+	s := h.state
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		close(s.stop)
+		<-s.done
+	})
+}
+
+func (h *Handler) key(r slog.Record) string {
+	var b strings.Builder
+	b.WriteString(h.scope)
+	b.WriteString("|record:")
+	b.WriteString(r.Level.String())
+	b.WriteByte(' ')
+	b.WriteString(strconv.Quote(r.Message))
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, a)
+		return true
+	})
+	return b.String()
+}
+
+// writeAttr quotes the key and the value, so that a "|" or "=" inside them
+// can not make different records collide.
+func writeAttr(b *strings.Builder, a slog.Attr) {
+	b.WriteByte('|')
+	b.WriteString(strconv.Quote(a.Key))
+	b.WriteByte('=')
+	b.WriteString(strconv.Quote(a.Value.Resolve().String()))
+}
+
+func (s *state) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.opts.Window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+func (s *state) flush() {
+	s.mu.Lock()
+	pending := make([]*entry, 0, s.lru.Len())
+	// Least recently seen entries go first.
+	for el := s.lru.Back(); el != nil; el = s.lru.Back() {
+		pending = append(pending, s.remove(el))
+	}
+	s.mu.Unlock()
+
+	for _, e := range pending {
+		_ = e.emit()
+	}
+}
+
+// remove must be called with s.mu held.
+func (s *state) remove(el *list.Element) *entry {
+	e := s.lru.Remove(el).(*entry)
+	delete(s.entries, e.key)
+	return e
+}
+
+func (e *entry) emit() error {
+	r := e.record
+	if e.count > 1 {
+		r = e.record.Clone()
+		r.AddAttrs(
+			slog.Int("count", e.count),
+			slog.Time("first_seen", e.firstSeen),
+			slog.Time("last_seen", e.lastSeen),
+		)
+	}
+	return e.next.Handle(e.ctx, r)
+}
@@ -0,0 +1,183 @@
+package dedup
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+type captured struct {
+	ctx    context.Context
+	record slog.Record
+	attrs  []slog.Attr // added via WithAttrs
+}
+
+// captureHandler keeps the records it gets, it is called from the flush loop as well
+type captureHandler struct {
+	mu    *sync.Mutex
+	out   *[]captured
+	attrs []slog.Attr
+}
+
+func newCapture() *captureHandler {
+	return &captureHandler{mu: &sync.Mutex{}, out: &[]captured{}}
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.out = append(*h.out, captured{ctx: ctx, record: r, attrs: h.attrs})
+	return nil
+}
+
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &captureHandler{mu: h.mu, out: h.out, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+func (h *captureHandler) records() []captured {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]captured{}, *h.out...)
+}
+
+func count(r slog.Record) int64 {
+	var n int64 = 1
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "count" {
+			n = a.Value.Int64()
+		}
+		return true
+	})
+	return n
+}
+
+func TestHandlerCollapsesIdenticalRecords(t *testing.T) {
+	next := newCapture()
+	handler := NewHandler(next, Options{Window: time.Hour})
+	defer handler.Close()
+	logger := slog.New(handler)
+
+	for i := 0; i < 3; i++ {
+		logger.Info("retrying", "attempt", 1)
+	}
+	logger.Info("retrying", "attempt", 2)
+	// Loggers derived with the same attrs share the entry, e.g. one logger per request
+	for i := 0; i < 2; i++ {
+		logger.With("component", "retry").Warn("slow")
+	}
+	logger.With("component", "cache").Warn("slow")
+	logger.WithGroup("retry").Warn("slow")
+	handler.Flush()
+
+	got := next.records()
+	want := []struct {
+		message string
+		count   int64
+	}{{"retrying", 3}, {"retrying", 1}, {"slow", 2}, {"slow", 1}, {"slow", 1}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	// Least recently seen first
+	for i, w := range want {
+		if got[i].record.Message != w.message || count(got[i].record) != w.count {
+			t.Errorf("record %d: %q x%d, want %q x%d", i, got[i].record.Message, count(got[i].record), w.message, w.count)
+		}
+	}
+	if len(got[2].attrs) != 1 || got[2].attrs[0].Value.String() != "retry" {
+		t.Errorf("collapsed record attrs = %v, want component=retry", got[2].attrs)
+	}
+}
+
+type ctxKey struct{}
+
+func TestHandlerKeepsFirstContext(t *testing.T) {
+	next := newCapture()
+	handler := NewHandler(next, Options{Window: time.Hour})
+	defer handler.Close()
+	logger := slog.New(handler)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "first"))
+	logger.InfoContext(ctx, "request failed")
+	logger.InfoContext(context.WithValue(context.Background(), ctxKey{}, "second"), "request failed")
+	// The request is over by the time the record is emitted
+	cancel()
+	handler.Flush()
+
+	got := next.records()
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+	if got[0].ctx.Value(ctxKey{}) != "first" || got[0].ctx.Err() != nil {
+		t.Errorf("ctx value %v, err %v; want the first context without cancellation", got[0].ctx.Value(ctxKey{}), got[0].ctx.Err())
+	}
+}
+
+func TestHandlerEvictsLeastRecentlySeen(t *testing.T) {
+	next := newCapture()
+	handler := NewHandler(next, Options{Window: time.Hour, MaxEntries: 2})
+	defer handler.Close()
+	logger := slog.New(handler)
+
+	logger.Info("a")
+	logger.Info("b")
+	logger.Info("a")
+	logger.Info("c") // evicts b, a was seen after it
+
+	got := next.records()
+	if len(got) != 1 || got[0].record.Message != "b" {
+		t.Fatalf("emitted %v, want only b", got)
+	}
+
+	handler.Close()
+	got = next.records()
+	if len(got) != 3 || got[1].record.Message != "a" || count(got[1].record) != 2 || got[2].record.Message != "c" {
+		t.Errorf("after Close got %d records", len(got))
+	}
+}
+
+func TestHandlerPassesRecordsAfterClose(t *testing.T) {
+	next := newCapture()
+	handler := NewHandler(next, Options{Window: time.Hour})
+	logger := slog.New(handler)
+
+	logger.Info("before")
+	handler.Close()
+	logger.Info("after")
+	logger.Info("after")
+
+	got := next.records()
+	if len(got) != 3 || got[0].record.Message != "before" || got[1].record.Message != "after" || got[2].record.Message != "after" {
+		t.Fatalf("emitted %d records, want before and both after records", len(got))
+	}
+}
+
+func TestHandlerFlushesAfterWindow(t *testing.T) {
+	next := newCapture()
+	handler := NewHandler(next, Options{Window: 20 * time.Millisecond})
+	defer handler.Close()
+	logger := slog.New(handler)
+
+	emitted := func() (n int64) {
+		for _, c := range next.records() {
+			n += count(c.record)
+		}
+		return n
+	}
+
+	// Without Flush or Close the records are emitted by the flush loop
+	logger.Info("tick")
+	logger.Info("tick")
+	deadline := time.Now().Add(time.Second)
+	for emitted() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of 2 records emitted after the window", emitted())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,236 @@
+package preagg
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Aggregation is an aggregate emitted for samples observed since the previous scrape.
+type Aggregation string
+
+const (
+	Avg   Aggregation = "avg"
+	Min   Aggregation = "min"
+	Max   Aggregation = "max"
+	Last  Aggregation = "last"  // The latest sample, kept even if there were no new samples
+	Count Aggregation = "count" // Exposed as <name>_samples
+)
+
+// Options configures a Collector.
+type Options struct {
+	Name         string
+	Help         string
+	LabelNames   []string
+	ConstLabels  prometheus.Labels
+	Aggregations []Aggregation // Defaults to Avg
+
+	// InitialWindow is used for the first scrape of a scraper, as there is no previous scrape. Defaults to 15s.
+	InitialWindow time.Duration
+	// MaxAge bounds the buffer: older samples and scrapers not seen for MaxAge are dropped. Defaults to 5m.
+	MaxAge time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if len(o.Aggregations) == 0 {
+		o.Aggregations = []Aggregation{Avg}
+	}
+	if o.InitialWindow <= 0 {
+		o.InitialWindow = 15 * time.Second
+	}
+	if o.MaxAge <= 0 {
+		o.MaxAge = 5 * time.Minute
+	}
+	return o
+}
+
+type sample struct {
+	at    time.Time
+	value float64
+}
+
+type series struct {
+	labelValues []string
+	samples     []sample
+	last        float64
+}
+
+// Collector buffers samples between scrapes and emits aggregates of the samples
+// observed since the previous scrape of the same scraper.
+//
+// Registered directly, all scrapes share one cursor. Use Handler to keep a cursor per scraper,
+// so two Prometheus servers scraping the same target each get all samples.
+type Collector struct {
+	opts  Options
+	descs map[Aggregation]*prometheus.Desc
+	now   func() time.Time
+
+	mu       sync.Mutex
+	series   map[string]*series
+	scrapers map[string]time.Time // Scraper ID -> time of its last scrape
+}
+
+// NewCollector creates a collector; it has to be registered or served through Handler.
+func NewCollector(opts Options) *Collector {
+	opts = opts.withDefaults()
+	descs := make(map[Aggregation]*prometheus.Desc, len(opts.Aggregations))
+	for _, agg := range opts.Aggregations {
+		name := opts.Name + "_" + string(agg)
+		if agg == Count {
+			name = opts.Name + "_samples"
+		}
+		descs[agg] = prometheus.NewDesc(name, opts.Help+" ("+string(agg)+" since the previous scrape)", opts.LabelNames, opts.ConstLabels)
+	}
+	return &Collector{
+		opts:     opts,
+		descs:    descs,
+		now:      time.Now,
+		series:   make(map[string]*series),
+		scrapers: make(map[string]time.Time),
+	}
+}
+
+// Observe buffers a sample; labelValues must match Options.LabelNames.
+func (c *Collector) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(c.opts.LabelNames) {
+		panic("preagg: inconsistent label cardinality for " + c.opts.Name)
+	}
+	now := c.now()
+	key := strings.Join(labelValues, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	// Without scrapes the buffer is still bounded by MaxAge
+	if len(s.samples) > 0 && now.Sub(s.samples[0].at) > c.opts.MaxAge {
+		s.samples = trim(s.samples, now.Add(-c.opts.MaxAge))
+	}
+	s.samples = append(s.samples, sample{at: now, value: value})
+	s.last = value
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+// Collect emits aggregates for the shared default scraper.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.collect("", ch)
+}
+
+// Scraper returns a view of the collector for one scraper with its own cursor.
+func (c *Collector) Scraper(id string) prometheus.Collector {
+	return scraperCollector{c: c, id: id}
+}
+
+type scraperCollector struct {
+	c  *Collector
+	id string
+}
+
+func (s scraperCollector) Describe(ch chan<- *prometheus.Desc) { s.c.Describe(ch) }
+func (s scraperCollector) Collect(ch chan<- prometheus.Metric) { s.c.collect(s.id, ch) }
+
+type aggregate struct {
+	count         int
+	sum, min, max float64
+}
+
+func (c *Collector) collect(scraper string, ch chan<- prometheus.Metric) {
+	now := c.now()
+
+	c.mu.Lock()
+	since, ok := c.scrapers[scraper]
+	if !ok {
+		since = now.Add(-c.opts.InitialWindow)
+	}
+	c.scrapers[scraper] = now
+
+	metrics := make([]prometheus.Metric, 0, len(c.series)*len(c.descs))
+	for _, s := range c.series {
+		agg := aggregate{min: math.Inf(1), max: math.Inf(-1)}
+		for _, smp := range s.samples {
+			if !smp.at.After(since) {
+				continue
+			}
+			agg.count++
+			agg.sum += smp.value
+			agg.min = math.Min(agg.min, smp.value)
+			agg.max = math.Max(agg.max, smp.value)
+		}
+		for _, kind := range c.opts.Aggregations {
+			value, ok := agg.value(kind, s.last)
+			if !ok {
+				continue
+			}
+			metrics = append(metrics, prometheus.MustNewConstMetric(c.descs[kind], prometheus.GaugeValue, value, s.labelValues...))
+		}
+	}
+	c.trim(now)
+	c.mu.Unlock()
+
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// value returns the aggregate; avg, min and max are not emitted when there were no samples
+func (a aggregate) value(kind Aggregation, last float64) (float64, bool) {
+	switch kind {
+	case Avg:
+		return a.sum / float64(a.count), a.count > 0
+	case Min:
+		return a.min, a.count > 0
+	case Max:
+		return a.max, a.count > 0
+	case Last:
+		return last, true
+	case Count:
+		return float64(a.count), true
+	default:
+		return 0, false
+	}
+}
+
+// trim drops stale scrapers and samples already seen by every active scraper.
+// Samples within InitialWindow are kept for scrapers that haven't scraped yet.
+func (c *Collector) trim(now time.Time) {
+	oldest := now.Add(-c.opts.InitialWindow)
+	for id, at := range c.scrapers {
+		if now.Sub(at) > c.opts.MaxAge {
+			delete(c.scrapers, id)
+			continue
+		}
+		if at.Before(oldest) {
+			oldest = at
+		}
+	}
+	if limit := now.Add(-c.opts.MaxAge); oldest.Before(limit) {
+		oldest = limit
+	}
+	for _, s := range c.series {
+		s.samples = trim(s.samples, oldest)
+	}
+}
+
+// trim removes samples observed not after t
+func trim(samples []sample, t time.Time) []sample {
+	i := 0
+	for i < len(samples) && !samples[i].at.After(t) {
+		i++
+	}
+	if i == 0 {
+		return samples
+	}
+	return append(samples[:0], samples[i:]...)
+}
@@ -0,0 +1,81 @@
+package preagg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func gather(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			values[family.GetName()] = m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func TestCollectorPerScraper(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := NewCollector(Options{
+		Name:         "value",
+		LabelNames:   []string{"process"},
+		Aggregations: []Aggregation{Avg, Max, Last, Count},
+	})
+	c.now = func() time.Time { return now }
+
+	observe := func(values ...float64) {
+		for _, v := range values {
+			now = now.Add(time.Second)
+			c.Observe(v, "p")
+		}
+	}
+
+	observe(1, 2, 3)
+	a := gather(t, c.Scraper("a"))
+	if a["value_avg"] != 2 || a["value_samples"] != 3 {
+		t.Fatalf("scraper a: %v", a)
+	}
+
+	observe(10)
+	// Scraper b hasn't scraped yet and sees everything within InitialWindow
+	b := gather(t, c.Scraper("b"))
+	if b["value_avg"] != 4 || b["value_max"] != 10 || b["value_samples"] != 4 {
+		t.Fatalf("scraper b: %v", b)
+	}
+	// Scraper a sees only the sample after its previous scrape
+	a = gather(t, c.Scraper("a"))
+	if a["value_avg"] != 10 || a["value_samples"] != 1 {
+		t.Fatalf("scraper a: %v", a)
+	}
+
+	// No new samples: avg and max are not emitted, last is kept
+	now = now.Add(time.Second)
+	a = gather(t, c.Scraper("a"))
+	if _, ok := a["value_avg"]; ok || a["value_last"] != 10 || a["value_samples"] != 0 {
+		t.Fatalf("scraper a without samples: %v", a)
+	}
+}
+
+func TestCollectorDropsOldSamples(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := NewCollector(Options{Name: "value", MaxAge: time.Minute})
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 120; i++ {
+		now = now.Add(time.Second)
+		c.Observe(1)
+	}
+	if n := len(c.series[""].samples); n > 61 {
+		t.Fatalf("buffer has %d samples, want at most 61", n)
+	}
+}
@@ -0,0 +1,37 @@
+package preagg
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ScraperID identifies the scraper of a request. The "scraper" query parameter
+// (params in the scrape config) wins; otherwise the remote host together with
+// the X-Prometheus-Scrape-Timeout-Seconds header, which differs between scrape jobs, is used.
+func ScraperID(r *http.Request) string {
+	if id := r.URL.Query().Get("scraper"); id != "" {
+		return id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host + "/" + r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+}
+
+// Handler serves gatherer together with collectors, keeping a separate cursor
+// for every scraper, so scrapers don't steal samples from each other.
+// The collectors must not be registered in gatherer.
+func Handler(gatherer prometheus.Gatherer, opts promhttp.HandlerOpts, collectors ...*Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := ScraperID(r)
+		reg := prometheus.NewRegistry()
+		for _, c := range collectors {
+			reg.MustRegister(c.Scraper(id))
+		}
+		promhttp.HandlerFor(prometheus.Gatherers{gatherer, reg}, opts).ServeHTTP(w, r)
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"example/internal/preagg"
 	"fmt"
 	"log"
 	"math/rand"
@@ -9,46 +10,25 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// Metrics
-var (
-	aggregatedProcessGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "process_value_aggregated",
-		Help: "Aggregated gauge value of the process (e.g., average over the scrape interval).",
-	}, []string{"process_name"})
-
-	scrapeCounter = promauto.NewCounter(prometheus.CounterOpts{
-		Name: "prometheus_scrapes_total",
-		Help: "Total number of Prometheus scrapes.",
-	})
-)
+// processValue aggregates per-second values between scrapes:
+// process_value_avg, process_value_min, process_value_max, process_value_samples
+var processValue = preagg.NewCollector(preagg.Options{
+	Name:         "process_value",
+	Help:         "Value of the process",
+	LabelNames:   []string{"process_name"},
+	Aggregations: []preagg.Aggregation{preagg.Avg, preagg.Min, preagg.Max, preagg.Count},
+})
 
 const numProcesses = 5
-const scrapeInterval = 10 * time.Second
-
-// ProcessData stores per-second values.
-type ProcessData struct {
-	values []float64
-	mu     sync.Mutex
-}
-
-// perProcessData stores data for each process.
-var perProcessData = make(map[string]*ProcessData)
 
-// emulateProcess function now stores per-second values.
+// emulateProcess produces a value every second.
 func emulateProcess(processName string, stop chan bool) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
-	data, ok := perProcessData[processName]
-	if !ok {
-		perProcessData[processName] = &ProcessData{values: make([]float64, 0, int64(scrapeInterval.Seconds()))} // Pre-allocate space
-		data = perProcessData[processName]
-	}
-
 	for {
 		select {
 		case <-ticker.C:
@@ -56,9 +36,7 @@ func emulateProcess(processName string, stop chan bool) {
 			if processName == "process-4" {
 				value = rand.Float64() * 10 // Simulate process difference from other processes
 			}
-			data.mu.Lock()
-			data.values = append(data.values, value)
-			data.mu.Unlock()
+			processValue.Observe(value, processName)
 
 		case <-stop:
 			log.Printf("Process %s stopped\n", processName)
@@ -67,27 +45,6 @@ func emulateProcess(processName string, stop chan bool) {
 	}
 }
 
-// aggregateAndExport aggregates the per-second data and exports to Prometheus.
-func aggregateAndExport() {
-	for processName, data := range perProcessData {
-		data.mu.Lock()
-		sum := 0.0
-		for _, v := range data.values {
-			sum += v
-		}
-		var average float64
-		if len(data.values) > 0 {
-			average = sum / float64(len(data.values))
-		} else {
-			average = 0
-		}
-		data.values = data.values[:0] // Clear the stored values
-		data.mu.Unlock()
-
-		aggregatedProcessGauge.With(prometheus.Labels{"process_name": processName}).Set(average)
-	}
-}
-
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
@@ -106,27 +63,14 @@ func main() {
 		}(processName, processStops[i])
 	}
 
-	// Prometheus endpoint
-	http.Handle("/metrics", promhttp.Handler())
+	// Prometheus endpoint, every scraper gets aggregates since its own previous scrape:
+	// curl 'localhost:8080/metrics?scraper=a'; curl 'localhost:8080/metrics?scraper=b'
+	http.Handle("/metrics", preagg.Handler(prometheus.DefaultGatherer, promhttp.HandlerOpts{}, processValue))
 	go func() {
 		log.Fatal(http.ListenAndServe(":8080", nil))
 	}()
 
-	// Aggregate and Export to Prometheus on scrape interval
-	scrapeTicker := time.NewTicker(scrapeInterval)
-	defer scrapeTicker.Stop()
-
-	scrapeDuration := 5 * time.Minute
-	endTime := time.Now().Add(scrapeDuration)
-
-	for time.Now().Before(endTime) {
-		select {
-		case <-scrapeTicker.C:
-			log.Println("Simulating Prometheus scrape...")
-			scrapeCounter.Inc()
-			aggregateAndExport() // Aggregate and export to Prometheus
-		}
-	}
+	time.Sleep(5 * time.Minute)
 
 	// Stop emulated processes
 	for _, stop := range processStops {
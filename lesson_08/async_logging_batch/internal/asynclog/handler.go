@@ -0,0 +1,17 @@
+package asynclog
+
+import (
+	"log/slog"
+)
+
+// NewJSONHandler returns a slog handler that formats records as JSON and
+// passes them to the async writer. Each record is a single Write call,
+// so records are never split between batches.
+func NewJSONHandler(w *Writer, opts *slog.HandlerOptions) slog.Handler {
+	return slog.NewJSONHandler(w, opts)
+}
+
+// NewTextHandler is the text format counterpart of NewJSONHandler.
+func NewTextHandler(w *Writer, opts *slog.HandlerOptions) slog.Handler {
+	return slog.NewTextHandler(w, opts)
+}
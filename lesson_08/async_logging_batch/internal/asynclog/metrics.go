@@ -0,0 +1,49 @@
+package asynclog
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector exposes the writer state as Prometheus metrics.
+type Collector struct {
+	writer     *Writer
+	queueDepth *prometheus.Desc
+	written    *prometheus.Desc
+	dropped    *prometheus.Desc
+}
+
+// NewCollector returns a collector for w. Register it with prometheus.MustRegister.
+func NewCollector(w *Writer, name string) *Collector {
+	labels := prometheus.Labels{"writer": name, "policy": w.opts.Policy.String()}
+	return &Collector{
+		writer: w,
+		queueDepth: prometheus.NewDesc(
+			"async_log_queue_depth",
+			"Number of log records waiting in the queue",
+			nil, labels,
+		),
+		written: prometheus.NewDesc(
+			"async_log_written_records_total",
+			"Total number of log records written to the output",
+			nil, labels,
+		),
+		dropped: prometheus.NewDesc(
+			"async_log_dropped_records_total",
+			"Total number of log records dropped due to queue overflow",
+			nil, labels,
+		),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queueDepth
+	ch <- c.written
+	ch <- c.dropped
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.writer.Stats()
+	ch <- prometheus.MustNewConstMetric(c.queueDepth, prometheus.GaugeValue, float64(stats.QueueDepth))
+	ch <- prometheus.MustNewConstMetric(c.written, prometheus.CounterValue, float64(stats.Written))
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(stats.Dropped))
+}
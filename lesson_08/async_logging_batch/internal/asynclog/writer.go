@@ -0,0 +1,269 @@
+package asynclog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy defines what Write does when the queue is full.
+type OverflowPolicy int
+
+const (
+	// Block waits until the worker frees a slot in the queue.
+	Block OverflowPolicy = iota
+	// DropNewest discards the record being written.
+	DropNewest
+	// DropOldest discards the oldest queued record to make room for the new one.
+	DropOldest
+	// Sample keeps every SampleEvery-th record (blocking for it) and discards the rest.
+	Sample
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop_newest"
+	case DropOldest:
+		return "drop_oldest"
+	case Sample:
+		return "sample"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	ErrClosed       = errors.New("asynclog: writer is closed")
+	ErrFlushTimeout = errors.New("asynclog: flush deadline exceeded")
+)
+
+// Options configures a Writer. Zero values are replaced with defaults.
+type Options struct {
+	QueueSize     int            // Max number of records waiting to be batched
+	BatchSize     int            // Records per batch written to the output
+	FlushInterval time.Duration  // Max time a record stays in a partial batch
+	FlushTimeout  time.Duration  // Deadline for Sync and Close
+	Policy        OverflowPolicy // Behaviour when the queue is full
+	SampleEvery   int            // Used by Sample: keep 1 of N records on overflow
+}
+
+func (o Options) withDefaults() Options {
+	if o.QueueSize <= 0 {
+		o.QueueSize = 100_000
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 1000
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second
+	}
+	if o.FlushTimeout <= 0 {
+		o.FlushTimeout = 5 * time.Second
+	}
+	if o.SampleEvery <= 0 {
+		o.SampleEvery = 10
+	}
+	return o
+}
+
+// Stats is a snapshot of the writer state.
+type Stats struct {
+	QueueDepth int
+	Written    uint64
+	Dropped    uint64
+}
+
+// Writer is an io.Writer that hands records over to a background worker,
+// which writes them to the output in batches by size and by time.
+type Writer struct {
+	out  io.Writer
+	opts Options
+
+	queue    chan []byte
+	flushReq chan chan struct{}
+	quit     chan struct{}
+	done     chan struct{}
+
+	mu     sync.RWMutex // Guards closed against in-flight writes
+	closed bool
+
+	overflowSeen atomic.Uint64
+	written      atomic.Uint64
+	dropped      atomic.Uint64
+	closeOnce    sync.Once
+	closeErr     error
+}
+
+// NewWriter starts the batching worker. Close must be called to flush the tail.
+func NewWriter(out io.Writer, opts Options) *Writer {
+	opts = opts.withDefaults()
+	w := &Writer{
+		out:      out,
+		opts:     opts,
+		queue:    make(chan []byte, opts.QueueSize),
+		flushReq: make(chan chan struct{}),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write queues a copy of p. Callers such as slog handlers reuse their buffers,
+// so the data must not be retained.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	record := make([]byte, len(p))
+	copy(record, p)
+
+	select {
+	case w.queue <- record:
+		return len(p), nil
+	default:
+	}
+
+	switch w.opts.Policy {
+	case DropNewest:
+		w.dropped.Add(1)
+	case DropOldest:
+		for {
+			select {
+			case w.queue <- record:
+				return len(p), nil
+			default:
+			}
+			select {
+			case <-w.queue:
+				w.dropped.Add(1)
+			default:
+			}
+		}
+	case Sample:
+		if w.overflowSeen.Add(1)%uint64(w.opts.SampleEvery) != 0 {
+			w.dropped.Add(1)
+			break
+		}
+		w.queue <- record
+	default:
+		w.queue <- record
+	}
+	// Dropped records are reported as written: a logger must not fail
+	// because the pipeline is saturated.
+	return len(p), nil
+}
+
+// Sync writes out everything queued so far, waiting at most FlushTimeout.
+func (w *Writer) Sync() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrClosed
+	}
+
+	timer := time.NewTimer(w.opts.FlushTimeout)
+	defer timer.Stop()
+
+	ack := make(chan struct{})
+	select {
+	case w.flushReq <- ack:
+	case <-timer.C:
+		return ErrFlushTimeout
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-timer.C:
+		return ErrFlushTimeout
+	}
+}
+
+// Close stops accepting records, drains the queue including the partial
+// batch and waits for the worker at most FlushTimeout.
+func (w *Writer) Close() error {
+	w.closeOnce.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		w.mu.Unlock()
+		close(w.quit)
+
+		select {
+		case <-w.done:
+		case <-time.After(w.opts.FlushTimeout):
+			w.closeErr = ErrFlushTimeout
+		}
+	})
+	return w.closeErr
+}
+
+// Stats returns the current queue depth and record counters.
+func (w *Writer) Stats() Stats {
+	return Stats{
+		QueueDepth: len(w.queue),
+		Written:    w.written.Load(),
+		Dropped:    w.dropped.Load(),
+	}
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch bytes.Buffer
+	count := 0
+
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		// Errors from the output can't be reported to the callers that already
+		// returned, so the batch is counted as written either way.
+		_, _ = w.out.Write(batch.Bytes())
+		w.written.Add(uint64(count))
+		batch.Reset()
+		count = 0
+	}
+	add := func(record []byte) {
+		batch.Write(record)
+		count++
+		if count >= w.opts.BatchSize {
+			flush()
+		}
+	}
+	// drain consumes the records that are in the queue at the moment of the call.
+	drain := func() {
+		for n := len(w.queue); n > 0; n-- {
+			add(<-w.queue)
+		}
+	}
+
+	for {
+		select {
+		case record := <-w.queue:
+			add(record)
+		case <-ticker.C:
+			flush()
+		case ack := <-w.flushReq:
+			drain()
+			flush()
+			close(ack)
+		case <-w.quit:
+			// Writers are gone at this point, so the queue can only shrink.
+			drain()
+			flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package asynclog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that can be written by the worker and read by the test.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWriter_CloseFlushesPartialBatch(t *testing.T) {
+	out := &syncBuffer{}
+	w := NewWriter(out, Options{BatchSize: 1000, FlushInterval: time.Hour})
+
+	for i := 0; i < 1500; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if got := strings.Count(out.String(), "\n"); got != 1500 {
+		t.Fatalf("expected 1500 lines, got %d", got)
+	}
+	if _, err := w.Write([]byte("late\n")); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestWriter_Sync(t *testing.T) {
+	out := &syncBuffer{}
+	w := NewWriter(out, Options{BatchSize: 1000, FlushInterval: time.Hour})
+	defer w.Close()
+
+	w.Write([]byte("first\n"))
+	if err := w.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if out.String() != "first\n" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+}
+
+func TestWriter_FlushInterval(t *testing.T) {
+	out := &syncBuffer{}
+	w := NewWriter(out, Options{BatchSize: 1000, FlushInterval: 10 * time.Millisecond})
+	defer w.Close()
+
+	w.Write([]byte("tick\n"))
+	deadline := time.Now().Add(time.Second)
+	for out.String() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("partial batch was not flushed by interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// blockingWriter holds the worker until release is closed, so the queue fills up.
+type blockingWriter struct {
+	syncBuffer
+	release chan struct{}
+}
+
+func (b *blockingWriter) Write(p []byte) (int, error) {
+	<-b.release
+	return b.syncBuffer.Write(p)
+}
+
+func TestWriter_OverflowPolicies(t *testing.T) {
+	testCases := []struct {
+		name        string
+		policy      OverflowPolicy
+		expDropped  uint64
+		expContains string
+		expMissing  string
+	}{
+		{
+			name:        "drop newest keeps queued records",
+			policy:      DropNewest,
+			expDropped:  5,
+			expContains: "r1\n",
+			expMissing:  "r9\n",
+		},
+		{
+			name:        "drop oldest keeps latest records",
+			policy:      DropOldest,
+			expDropped:  5,
+			expContains: "r9\n",
+			expMissing:  "r1\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &blockingWriter{release: make(chan struct{})}
+			w := NewWriter(out, Options{QueueSize: 4, BatchSize: 1, FlushInterval: time.Hour, Policy: tc.policy})
+
+			// r0 is taken by the worker, which then blocks on the output.
+			w.Write([]byte("r0\n"))
+			for w.Stats().QueueDepth != 0 {
+				time.Sleep(time.Millisecond)
+			}
+			for i := 1; i < 10; i++ {
+				fmt.Fprintf(w, "r%d\n", i)
+			}
+			if got := w.Stats().Dropped; got != tc.expDropped {
+				t.Fatalf("expected %d dropped, got %d", tc.expDropped, got)
+			}
+
+			close(out.release)
+			if err := w.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			if !strings.Contains(out.String(), tc.expContains) {
+				t.Fatalf("expected %q in %q", tc.expContains, out.String())
+			}
+			if strings.Contains(out.String(), tc.expMissing) {
+				t.Fatalf("unexpected %q in %q", tc.expMissing, out.String())
+			}
+		})
+	}
+}
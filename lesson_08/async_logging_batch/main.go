@@ -1,20 +1,20 @@
 package main
 
 import (
+	"example/internal/asynclog"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
-	"strings"
-	"sync"
+	"os/signal"
 	"time"
-)
 
-var (
-	logger     *slog.Logger
-	logChannel = make(chan string, 100_000) // Buffered channel
-	wg         sync.WaitGroup
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+var logger *slog.Logger
+
 func init() {
 	opts := &slog.HandlerOptions{
 		Level: slog.LevelDebug,
@@ -23,26 +23,16 @@ func init() {
 	logger = slog.New(handler)
 }
 
-// worker that processes messages from the channel in batches
-func asyncLogBatchWorker() {
-	defer wg.Done()
-	const BATCH_SIZE = 1000
-	builder := strings.Builder{}
-	index := 0
-	for msg := range logChannel {
-		index += 1
-		builder.Write([]byte(msg))
-		if index >= BATCH_SIZE {
-			os.Stdout.Write([]byte(builder.String()))
-			index = 0
-			builder.Reset()
-		}
-	}
-}
-
-func asyncLogBatch(message string) {
-	select {
-	case logChannel <- message: // Blocking send
+func overflowPolicy() asynclog.OverflowPolicy {
+	switch os.Getenv("OVERFLOW_POLICY") {
+	case "drop_newest":
+		return asynclog.DropNewest
+	case "drop_oldest":
+		return asynclog.DropOldest
+	case "sample":
+		return asynclog.Sample
+	default:
+		return asynclog.Block
 	}
 }
 
@@ -60,6 +50,15 @@ func generateLogMessage(i int) string {
 // wc -l async_batch.log
 // 5000000 async_batch.log
 
+// Records that don't fill the last batch are flushed on Close, so the line count is exact.
+// With a drop policy some records are lost instead of blocking the caller:
+// OVERFLOW_POLICY=drop_oldest go run main.go > async_batch.log
+
+// The queue depth, written and dropped records are exposed on /metrics when METRICS_ADDR is set.
+// The server keeps running after the run until interrupted, so the final values can be scraped:
+// METRICS_ADDR=:2112 OVERFLOW_POLICY=drop_newest go run main.go > async_batch.log
+// curl -s localhost:2112/metrics | grep async_log
+
 func main() {
 	const N = 5_000_000
 	if os.Getenv("SIMPLE_LOGGING") == "1" {
@@ -70,15 +69,38 @@ func main() {
 		os.Stderr.Write([]byte(fmt.Sprintf("Simple completed %v\n", time.Now())))
 	} else {
 		os.Stderr.Write([]byte(fmt.Sprintf("Async started %v\n", time.Now())))
-		wg.Add(1)
-		go asyncLogBatchWorker()
+		writer := asynclog.NewWriter(os.Stdout, asynclog.Options{
+			QueueSize:     100_000,
+			BatchSize:     1000,
+			FlushInterval: time.Second,
+			FlushTimeout:  10 * time.Second,
+			Policy:        overflowPolicy(),
+		})
+		prometheus.MustRegister(asynclog.NewCollector(writer, "stdout"))
+		metricsAddr := os.Getenv("METRICS_ADDR")
+		if metricsAddr != "" {
+			go func() {
+				if err := http.ListenAndServe(metricsAddr, promhttp.Handler()); err != nil {
+					logger.Error("metrics server failed", "error", err)
+				}
+			}()
+		}
 		for i := 0; i < N; i++ {
-			asyncLogBatch(generateLogMessage(i))
+			writer.Write([]byte(generateLogMessage(i)))
 		}
 		os.Stderr.Write([]byte(fmt.Sprintf("Async generated all log messages %v\n", time.Now())))
-		close(logChannel)
 		os.Stderr.Write([]byte(fmt.Sprintf("Async waiting to complete %v\n", time.Now())))
-		wg.Wait()
-		os.Stderr.Write([]byte(fmt.Sprintf("Async started %v\n", time.Now())))
+		if err := writer.Close(); err != nil {
+			logger.Error("failed to flush async writer", "error", err)
+		}
+		stats := writer.Stats()
+		os.Stderr.Write([]byte(fmt.Sprintf("Async completed %v, written %d, dropped %d\n", time.Now(), stats.Written, stats.Dropped)))
+
+		if metricsAddr != "" {
+			os.Stderr.Write([]byte(fmt.Sprintf("Serving metrics on %s, press Ctrl+C to exit\n", metricsAddr)))
+			stop := make(chan os.Signal, 1)
+			signal.Notify(stop, os.Interrupt)
+			<-stop
+		}
 	}
 }
@@ -26,7 +26,8 @@ func main() {
 
 	exampleService := service.NewExampleService(logger)
 	exampleServiceProm := service.NewExampleServiceWithPrometheus(exampleService, "main")
-	exampleHandler := handlers.NewExampleHandler(exampleServiceProm, logger)
+	exampleServiceOTel := service.NewExampleServiceWithOTel(exampleServiceProm, "main")
+	exampleHandler := handlers.NewExampleHandler(exampleServiceOTel, logger)
 
 	r := chi.NewRouter()
 	apiRouter := chi.NewRouter()
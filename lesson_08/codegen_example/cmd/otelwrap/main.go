@@ -0,0 +1,57 @@
+// Command otelwrap generates an OpenTelemetry decorator for an interface of the current package:
+//
+//	//go:generate go run example/cmd/otelwrap -i ExampleService -o example_service_with_otel.go
+package main
+
+import (
+	"example/internal/otelwrap"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	var cfg otelwrap.Config
+	flag.StringVar(&cfg.Interface, "i", "", "interface to wrap")
+	flag.StringVar(&cfg.TypeName, "type", "", "name of the decorator, defaults to <interface>WithOTel")
+	flag.StringVar(&cfg.Scope, "scope", "", "instrumentation scope, defaults to the package name")
+	flag.StringVar(&cfg.MetricName, "metric", "", "duration histogram name, defaults to <interface>.duration")
+	output := flag.String("o", "", "output file")
+	flag.Parse()
+
+	if cfg.Interface == "" || *output == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, path := range paths {
+		// The previous output and tests are not part of the package API
+		if strings.HasSuffix(path, "_test.go") || path == filepath.Base(*output) {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			log.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	src, err := otelwrap.Generate(fset, files, cfg)
+	if err != nil {
+		log.Fatalf("otelwrap: %v", err)
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,600 @@
+// Package otelwrap generates decorators that wrap every method of an interface
+// in an OpenTelemetry span and record its duration to an OTel histogram.
+//
+// Methods are annotated with comments in the interface:
+//
+//	//otel:attr <param> [attribute.key] - record a parameter as a span attribute
+//	//otel:skip                         - call the base implementation without instrumentation
+//
+// Fields of struct parameters (or pointers to them) declared in the same package
+// that have an `otel:"attribute.key"` tag are recorded as span attributes as well.
+package otelwrap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Config configures the generated decorator.
+type Config struct {
+	Interface  string // Name of the interface to wrap
+	TypeName   string // Name of the decorator, defaults to <Interface>WithOTel
+	Scope      string // Instrumentation scope of the tracer and meter, defaults to the package name
+	MetricName string // Name of the duration histogram, defaults to <interface>.duration
+}
+
+func (c Config) withDefaults(pkg string) Config {
+	if c.TypeName == "" {
+		c.TypeName = c.Interface + "WithOTel"
+	}
+	if c.Scope == "" {
+		c.Scope = pkg
+	}
+	if c.MetricName == "" {
+		c.MetricName = strings.ToLower(c.Interface) + ".duration"
+	}
+	return c
+}
+
+// Generate returns the formatted source of the decorator for cfg.Interface declared in one of files,
+// which must all belong to the same package.
+func Generate(fset *token.FileSet, files []*ast.File, cfg Config) ([]byte, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files to parse")
+	}
+	file, iface := findInterface(files, cfg.Interface)
+	if iface == nil {
+		return nil, fmt.Errorf("interface %s not found", cfg.Interface)
+	}
+	cfg = cfg.withDefaults(file.Name.Name)
+
+	g := &generator{
+		structs: collectStructs(files),
+		imports: make(map[string]string),
+		aliases: fileImports(file),
+	}
+	g.context = g.contextName()
+	data := templateData{
+		Config:  cfg,
+		Package: file.Name.Name,
+		Source:  filepath.Base(fset.Position(file.Pos()).Filename),
+		Context: g.context,
+	}
+	for _, field := range iface.Methods.List {
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+		m, err := g.method(field)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", fset.Position(field.Pos()), field.Names[0].Name, err)
+		}
+		data.Methods = append(data.Methods, m)
+		data.HasError = data.HasError || m.ReturnsError
+		data.NeedsBackground = data.NeedsBackground || (m.CtxParam == "" && !m.Skip)
+	}
+	data.Imports = g.importList(data)
+
+	var buf bytes.Buffer
+	if err := decoratorTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+func findInterface(files []*ast.File, name string) (*ast.File, *ast.InterfaceType) {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if iface, ok := ts.Type.(*ast.InterfaceType); ok && ts.Name.Name == name && ts.TypeParams == nil {
+					return file, iface
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func collectStructs(files []*ast.File) map[string]*ast.StructType {
+	structs := make(map[string]*ast.StructType)
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if ts, ok := n.(*ast.TypeSpec); ok {
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					structs[ts.Name.Name] = st
+				}
+			}
+			return true
+		})
+	}
+	return structs
+}
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// fileImports maps the names used in the file to import paths
+func fileImports(file *ast.File) map[string]string {
+	aliases := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(path)
+		if majorVersion.MatchString(name) {
+			name = filepath.Base(filepath.Dir(path))
+		}
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		aliases[name] = path
+	}
+	return aliases
+}
+
+type generator struct {
+	structs map[string]*ast.StructType
+	aliases map[string]string // Import name in the source file -> path
+	imports map[string]string // Path -> name of imports used by the signatures
+	context string            // Name of the context package in the generated file
+}
+
+// contextName returns the name of the context package: its alias in the source file,
+// or stdcontext if the name context is taken by another package
+func (g *generator) contextName() string {
+	for name, path := range g.aliases {
+		if path == "context" && name != "_" && name != "." {
+			return name
+		}
+	}
+	if _, taken := g.aliases["context"]; taken {
+		return "stdcontext"
+	}
+	return "context"
+}
+
+// generatedNames are the identifiers the method bodies use besides the params:
+// the receiver, the locals and the imported packages
+var generatedNames = []string{
+	"_d", "_ctx", "_attrs", "_span", "_since", "_metricAttrs", "_errorType",
+	"attribute", "codes", "errors", "fmt", "metric", "otel", "time", "trace",
+}
+
+// paramNames returns the names of the params in the generated method: unnamed params get p<i>,
+// params colliding with the names of the results or of the generated code get an underscore suffix
+func (g *generator) paramNames(params []flatField, results []string) []string {
+	used := make(map[string]bool)
+	for _, name := range append(append(generatedNames, g.context), results...) {
+		used[name] = true
+	}
+	// Params keeping their names are claimed first, so a renamed one cannot take them
+	keep := make([]bool, len(params))
+	for i, p := range params {
+		if p.name != "" && p.name != "_" && !used[p.name] {
+			keep[i] = true
+			used[p.name] = true
+		}
+	}
+	names := make([]string, len(params))
+	for i, p := range params {
+		if keep[i] {
+			names[i] = p.name
+			continue
+		}
+		name := p.name
+		if name == "" || name == "_" {
+			name = "p" + strconv.Itoa(i)
+		}
+		for used[name] {
+			name += "_"
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+type param struct {
+	Name, Type string
+	Variadic   bool
+}
+
+// guarded attributes of the fields of a pointer param
+type guarded struct {
+	Guard string // e.g. "order != nil"
+	Attrs []string
+}
+
+type method struct {
+	Name         string
+	Params       string
+	Results      string
+	Call         string
+	CtxParam     string // Name of the context.Context param, empty if there is none
+	HasResults   bool
+	ReturnsError bool
+	Skip         bool
+	Attrs        []string
+	Guarded      []guarded
+}
+
+func (g *generator) method(field *ast.Field) (method, error) {
+	fn := field.Type.(*ast.FuncType)
+	m := method{Name: field.Names[0].Name}
+	if fn.TypeParams != nil {
+		return m, errors.New("generic methods are not supported")
+	}
+
+	results := flatten(fn.Results)
+	var resultNames, resultList []string
+	for i, r := range results {
+		g.useImports(r.typ)
+		typ := types.ExprString(r.typ)
+		name := "r" + strconv.Itoa(i)
+		if i == len(results)-1 && typ == "error" {
+			name = "err"
+			m.ReturnsError = true
+		}
+		resultNames = append(resultNames, name)
+		resultList = append(resultList, name+" "+typ)
+	}
+	if len(resultList) > 0 {
+		m.HasResults = true
+		m.Results = "(" + strings.Join(resultList, ", ") + ")"
+	}
+
+	fields := flatten(fn.Params)
+	names := g.paramNames(fields, resultNames)
+	var params []param
+	byName := make(map[string]param, len(fields)) // By the name in the source, for //otel:attr
+	for i, p := range fields {
+		g.useImports(p.typ)
+		_, variadic := p.typ.(*ast.Ellipsis)
+		params = append(params, param{Name: names[i], Type: types.ExprString(p.typ), Variadic: variadic})
+		if p.name != "" && p.name != "_" {
+			byName[p.name] = params[i]
+		}
+	}
+	if len(params) > 0 && params[0].Type == g.context+".Context" {
+		m.CtxParam = params[0].Name
+	}
+
+	var paramList, callList []string
+	for _, p := range params {
+		paramList = append(paramList, p.Name+" "+p.Type)
+		if p.Variadic {
+			callList = append(callList, p.Name+"...")
+		} else {
+			callList = append(callList, p.Name)
+		}
+	}
+	m.Params = strings.Join(paramList, ", ")
+	m.Call = strings.Join(callList, ", ")
+
+	if field.Doc != nil {
+		for _, c := range field.Doc.List {
+			fields := strings.Fields(strings.TrimPrefix(c.Text, "//"))
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "otel:skip":
+				m.Skip = true
+			case "otel:attr":
+				if len(fields) < 2 || len(fields) > 3 {
+					return m, fmt.Errorf("malformed %q, want //otel:attr <param> [key]", c.Text)
+				}
+				p, ok := byName[fields[1]]
+				if !ok {
+					return m, fmt.Errorf("%q: no param %s", c.Text, fields[1])
+				}
+				key := fields[1]
+				if len(fields) == 3 {
+					key = fields[2]
+				}
+				m.Attrs = append(m.Attrs, g.attrExpr(key, p.Type, p.Name))
+			}
+		}
+	}
+	for _, p := range params {
+		guard, attrs := g.structAttrs(p)
+		switch {
+		case len(attrs) == 0:
+		case guard == "":
+			m.Attrs = append(m.Attrs, attrs...)
+		default:
+			m.Guarded = append(m.Guarded, guarded{Guard: guard, Attrs: attrs})
+		}
+	}
+	if m.Skip {
+		m.Attrs, m.Guarded = nil, nil
+	}
+	return m, nil
+}
+
+type flatField struct {
+	name string
+	typ  ast.Expr
+}
+
+func flatten(list *ast.FieldList) []flatField {
+	if list == nil {
+		return nil
+	}
+	var fields []flatField
+	for _, f := range list.List {
+		if len(f.Names) == 0 {
+			fields = append(fields, flatField{typ: f.Type})
+		}
+		for _, name := range f.Names {
+			fields = append(fields, flatField{name: name.Name, typ: f.Type})
+		}
+	}
+	return fields
+}
+
+// useImports remembers imports of the packages referenced by a type
+func (g *generator) useImports(expr ast.Expr) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				if path, ok := g.aliases[ident.Name]; ok {
+					g.imports[path] = ident.Name
+				}
+			}
+		}
+		return true
+	})
+}
+
+// structAttrs returns attributes of the tagged fields of a struct param
+// and the nil check they need if the param is a pointer
+func (g *generator) structAttrs(p param) (string, []string) {
+	typ, guard := p.Type, ""
+	if strings.HasPrefix(typ, "*") {
+		typ, guard = typ[1:], p.Name+" != nil"
+	}
+	st, ok := g.structs[typ]
+	if !ok {
+		return "", nil
+	}
+	var attrs []string
+	for _, field := range st.Fields.List {
+		if field.Tag == nil || len(field.Names) == 0 {
+			continue
+		}
+		tag, _ := strconv.Unquote(field.Tag.Value)
+		key := reflect.StructTag(tag).Get("otel")
+		if key == "" || key == "-" {
+			continue
+		}
+		for _, name := range field.Names {
+			attrs = append(attrs, g.attrExpr(key, types.ExprString(field.Type), p.Name+"."+name.Name))
+		}
+	}
+	return guard, attrs
+}
+
+// attrExpr returns the attribute constructor for a value of type typ
+func (g *generator) attrExpr(key, typ, value string) string {
+	key = strconv.Quote(key)
+	switch typ {
+	case "string":
+		return "attribute.String(" + key + ", " + value + ")"
+	case "bool":
+		return "attribute.Bool(" + key + ", " + value + ")"
+	case "int64":
+		return "attribute.Int64(" + key + ", " + value + ")"
+	case "int", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32", "uint64":
+		return "attribute.Int64(" + key + ", int64(" + value + "))"
+	case "float64":
+		return "attribute.Float64(" + key + ", " + value + ")"
+	case "float32":
+		return "attribute.Float64(" + key + ", float64(" + value + "))"
+	case "[]string":
+		return "attribute.StringSlice(" + key + ", " + value + ")"
+	default:
+		return "attribute.String(" + key + ", fmt.Sprint(" + value + "))"
+	}
+}
+
+type importSpec struct {
+	Name, Path string
+}
+
+// importList merges the imports of the signatures with the ones of the generated code
+func (g *generator) importList(data templateData) [][]importSpec {
+	paths := map[string]string{
+		"time":                               "",
+		"go.opentelemetry.io/otel":           "",
+		"go.opentelemetry.io/otel/attribute": "",
+		"go.opentelemetry.io/otel/metric":    "",
+		"go.opentelemetry.io/otel/trace":     "",
+	}
+	if data.HasError {
+		paths["context"] = ""
+		paths["errors"] = ""
+		paths["go.opentelemetry.io/otel/codes"] = ""
+	}
+	if data.NeedsBackground {
+		paths["context"] = ""
+	}
+	if _, ok := paths["context"]; ok && g.context != "context" {
+		paths["context"] = g.context
+	}
+	for _, m := range data.Methods {
+		attrs := m.Attrs
+		for _, group := range m.Guarded {
+			attrs = append(attrs, group.Attrs...)
+		}
+		for _, a := range attrs {
+			if strings.Contains(a, "fmt.Sprint(") {
+				paths["fmt"] = ""
+			}
+		}
+	}
+	for path, name := range g.imports {
+		if filepath.Base(path) == name {
+			name = ""
+		}
+		paths[path] = name
+	}
+
+	var std, other []importSpec
+	for path, name := range paths {
+		spec := importSpec{Name: name, Path: path}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	for _, group := range [][]importSpec{std, other} {
+		sort.Slice(group, func(i, j int) bool { return group[i].Path < group[j].Path })
+	}
+	return [][]importSpec{std, other}
+}
+
+type templateData struct {
+	Config
+	Package         string
+	Source          string
+	Context         string // Name of the context package
+	Imports         [][]importSpec
+	Methods         []method
+	HasError        bool
+	NeedsBackground bool
+}
+
+var decoratorTemplate = template.Must(template.New("decorator").Parse(`// Code generated by otelwrap. DO NOT EDIT.
+// source: {{.Source}}
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+{{range .}}	{{if .Name}}{{.Name}} {{end}}"{{.Path}}"
+{{end}}
+{{- end}}
+)
+
+// {{.TypeName}} implements {{.Interface}} with every method wrapped in an OpenTelemetry span
+// and its duration recorded to the {{.MetricName}} histogram
+type {{.TypeName}} struct {
+	base         {{.Interface}}
+	instanceName string
+	tracer       trace.Tracer
+	duration     metric.Float64Histogram
+{{- if .HasError}}
+	classify     func(error) string
+{{- end}}
+}
+
+// New{{.TypeName}} returns {{.Interface}} decorated with the global TracerProvider and MeterProvider
+func New{{.TypeName}}(base {{.Interface}}, instanceName string) {{.TypeName}} {
+	duration, err := otel.Meter("{{.Scope}}").Float64Histogram("{{.MetricName}}",
+		metric.WithDescription("Duration of {{.Interface}} methods"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return {{.TypeName}}{
+		base:         base,
+		instanceName: instanceName,
+		tracer:       otel.Tracer("{{.Scope}}"),
+		duration:     duration,
+	}
+}
+{{- if .HasError}}
+
+// WithErrorClassifier sets a function returning the error.type attribute of an error.
+// Empty result falls back to the default classification.
+func (_d {{.TypeName}}) WithErrorClassifier(classify func(error) string) {{.TypeName}} {
+	_d.classify = classify
+	return _d
+}
+
+// errorType classifies an error: the classifier, then context errors,
+// then the ErrorType() string method of the error, otherwise _OTHER
+func (_d {{.TypeName}}) errorType(err error) string {
+	if _d.classify != nil {
+		if errorType := _d.classify(err); errorType != "" {
+			return errorType
+		}
+	}
+	switch {
+	case errors.Is(err, {{.Context}}.Canceled):
+		return "canceled"
+	case errors.Is(err, {{.Context}}.DeadlineExceeded):
+		return "timeout"
+	}
+	var typed interface{ ErrorType() string }
+	if errors.As(err, &typed) {
+		return typed.ErrorType()
+	}
+	return "_OTHER"
+}
+{{- end}}
+{{range .Methods}}
+// {{.Name}} implements {{$.Interface}}
+func (_d {{$.TypeName}}) {{.Name}}({{.Params}}) {{.Results}} {
+{{- if not .Skip}}
+{{- $ctx := or .CtxParam "_ctx"}}
+{{- if or .Attrs .Guarded}}
+	_attrs := []attribute.KeyValue{
+{{- range .Attrs}}
+		{{.}},
+{{- end}}
+	}
+{{- range .Guarded}}
+	if {{.Guard}} {
+		_attrs = append(_attrs,
+{{- range .Attrs}}
+			{{.}},
+{{- end}}
+		)
+	}
+{{- end}}
+{{- end}}
+	{{$ctx}}, _span := _d.tracer.Start({{if .CtxParam}}{{.CtxParam}}{{else}}{{$.Context}}.Background(){{end}}, "{{$.Interface}}.{{.Name}}"{{if or .Attrs .Guarded}}, trace.WithAttributes(_attrs...){{end}})
+	_since := time.Now()
+	defer func() {
+		_metricAttrs := []attribute.KeyValue{
+			attribute.String("instance.name", _d.instanceName),
+			attribute.String("method", "{{.Name}}"),
+		}
+{{- if .ReturnsError}}
+		if err != nil {
+			_errorType := _d.errorType(err)
+			_span.RecordError(err)
+			_span.SetStatus(codes.Error, err.Error())
+			_span.SetAttributes(attribute.String("error.type", _errorType))
+			_metricAttrs = append(_metricAttrs, attribute.String("error.type", _errorType))
+		}
+{{- end}}
+		_d.duration.Record({{$ctx}}, time.Since(_since).Seconds(), metric.WithAttributes(_metricAttrs...))
+		_span.End()
+	}()
+{{- end}}
+	{{if .HasResults}}return {{end}}_d.base.{{.Name}}({{.Call}})
+}
+{{end}}`))
@@ -0,0 +1,111 @@
+package otelwrap
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// UPDATE_GOLDEN=1 go test ./internal/otelwrap rewrites the golden files
+const updateGoldenEnv = "UPDATE_GOLDEN"
+
+func generate(t *testing.T, src string, cfg Config) ([]byte, error) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "input.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Generate(fset, []*ast.File{file}, cfg)
+}
+
+func TestGenerateGolden(t *testing.T) {
+	for _, tc := range []struct {
+		dir string
+		cfg Config
+	}{
+		{"orders", Config{Interface: "OrderService", Scope: "example/orders"}},
+		{"cache", Config{Interface: "Cache", TypeName: "TracedCache", MetricName: "cache.operation.duration"}},
+		{"names", Config{Interface: "Store"}},
+	} {
+		t.Run(tc.dir, func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join("testdata", tc.dir, "input.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := generate(t, string(src), tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tc.dir, "output.golden")
+			if os.Getenv(updateGoldenEnv) == "1" {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden file (run with %s=1 to create it): %v", updateGoldenEnv, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("generated code differs from %s (run with %s=1 to update)\n%s", golden, updateGoldenEnv, got)
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, src, wantErr string
+	}{
+		{
+			name:    "missing interface",
+			src:     "package p\ntype Other interface{ M() }",
+			wantErr: "interface Service not found",
+		},
+		{
+			name:    "embedded interface",
+			src:     "package p\nimport \"io\"\ntype Service interface{ io.Closer }",
+			wantErr: "embedded interfaces are not supported",
+		},
+		{
+			name:    "unknown param",
+			src:     "package p\ntype Service interface{\n//otel:attr id\nM(key string)\n}",
+			wantErr: `"//otel:attr id": no param id`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := generate(t, tc.src, Config{Interface: "Service"})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateShadowedContext(t *testing.T) {
+	// The name context belongs to another package, the standard one is imported as stdcontext
+	src := "package p\nimport context \"example/mycontext\"\ntype Service interface{ M(c context.Context) error }"
+	got, err := generate(t, src, Config{Interface: "Service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`stdcontext "context"`,
+		`context "example/mycontext"`,
+		"M(c context.Context) (err error)",
+		"_d.tracer.Start(stdcontext.Background()",
+		"errors.Is(err, stdcontext.Canceled)",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("generated code has no %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package cache
+
+// Cache is not context-aware and never fails.
+type Cache interface {
+	//otel:attr key cache.key
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
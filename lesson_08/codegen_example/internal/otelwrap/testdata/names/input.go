@@ -0,0 +1,16 @@
+package names
+
+import (
+	stdctx "context"
+	"time"
+)
+
+// Store has params named like the results and the locals of the generated code
+// and imports context under an alias.
+type Store interface {
+	//otel:attr err store.error
+	//otel:attr p1
+	Put(ctx stdctx.Context, err string, r0 int, p1 bool, _ string, _d time.Duration) (int, error)
+	//otel:attr time
+	Touch(time string)
+}
@@ -0,0 +1,44 @@
+package orders
+
+import (
+	"context"
+	"time"
+
+	decimal "github.com/shopspring/decimal"
+)
+
+type Order struct {
+	ID       string `otel:"order.id"`
+	Items    int    `otel:"order.items"`
+	Comment  string
+	DriverID int64 `otel:"driver.id"`
+}
+
+type Filter struct {
+	Statuses []string `otel:"filter.statuses"`
+	Since    time.Time
+}
+
+type OrderService interface {
+	// Create stores a new order.
+	Create(ctx context.Context, order *Order) (string, error)
+
+	// Get returns an order by ID.
+	//otel:attr id order.id
+	Get(ctx context.Context, id string) (*Order, error)
+
+	//otel:attr filter
+	//otel:attr limit query.limit
+	List(ctx context.Context, filter Filter, limit int, tags ...string) ([]Order, int, error)
+
+	//otel:attr amount payment.amount
+	Charge(ctx context.Context, orderID string, amount decimal.Decimal) error
+
+	Notify(context.Context, string) error
+
+	// Ping has neither context nor error.
+	Ping() bool
+
+	//otel:skip
+	Close(ctx context.Context, timeout time.Duration) error
+}
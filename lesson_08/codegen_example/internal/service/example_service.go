@@ -6,7 +6,9 @@ import (
 )
 
 //go:generate gowrap gen -g -p ./ -i ExampleService -t prometheus -o example_service_with_metrics.go
+//go:generate go run example/cmd/otelwrap -i ExampleService -o example_service_with_otel.go
 type ExampleService interface {
+	//otel:attr param example.param
 	ExampleMethod(ctx context.Context, param string) error
 }
 
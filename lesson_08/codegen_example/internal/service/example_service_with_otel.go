@@ -0,0 +1,97 @@
+// Code generated by otelwrap. DO NOT EDIT.
+// source: example_service.go
+
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExampleServiceWithOTel implements ExampleService with every method wrapped in an OpenTelemetry span
+// and its duration recorded to the exampleservice.duration histogram
+type ExampleServiceWithOTel struct {
+	base         ExampleService
+	instanceName string
+	tracer       trace.Tracer
+	duration     metric.Float64Histogram
+	classify     func(error) string
+}
+
+// NewExampleServiceWithOTel returns ExampleService decorated with the global TracerProvider and MeterProvider
+func NewExampleServiceWithOTel(base ExampleService, instanceName string) ExampleServiceWithOTel {
+	duration, err := otel.Meter("service").Float64Histogram("exampleservice.duration",
+		metric.WithDescription("Duration of ExampleService methods"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return ExampleServiceWithOTel{
+		base:         base,
+		instanceName: instanceName,
+		tracer:       otel.Tracer("service"),
+		duration:     duration,
+	}
+}
+
+// WithErrorClassifier sets a function returning the error.type attribute of an error.
+// Empty result falls back to the default classification.
+func (_d ExampleServiceWithOTel) WithErrorClassifier(classify func(error) string) ExampleServiceWithOTel {
+	_d.classify = classify
+	return _d
+}
+
+// errorType classifies an error: the classifier, then context errors,
+// then the ErrorType() string method of the error, otherwise _OTHER
+func (_d ExampleServiceWithOTel) errorType(err error) string {
+	if _d.classify != nil {
+		if errorType := _d.classify(err); errorType != "" {
+			return errorType
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	var typed interface{ ErrorType() string }
+	if errors.As(err, &typed) {
+		return typed.ErrorType()
+	}
+	return "_OTHER"
+}
+
+// ExampleMethod implements ExampleService
+func (_d ExampleServiceWithOTel) ExampleMethod(ctx context.Context, param string) (err error) {
+	_attrs := []attribute.KeyValue{
+		attribute.String("example.param", param),
+	}
+	ctx, _span := _d.tracer.Start(ctx, "ExampleService.ExampleMethod", trace.WithAttributes(_attrs...))
+	_since := time.Now()
+	defer func() {
+		_metricAttrs := []attribute.KeyValue{
+			attribute.String("instance.name", _d.instanceName),
+			attribute.String("method", "ExampleMethod"),
+		}
+		if err != nil {
+			_errorType := _d.errorType(err)
+			_span.RecordError(err)
+			_span.SetStatus(codes.Error, err.Error())
+			_span.SetAttributes(attribute.String("error.type", _errorType))
+			_metricAttrs = append(_metricAttrs, attribute.String("error.type", _errorType))
+		}
+		_d.duration.Record(ctx, time.Since(_since).Seconds(), metric.WithAttributes(_metricAttrs...))
+		_span.End()
+	}()
+	return _d.base.ExampleMethod(ctx, param)
+}
@@ -1,3 +1,7 @@
 module example
 
 go 1.23.5
+
+require go.uber.org/zap v1.27.0
+
+require go.uber.org/multierr v1.10.0 // indirect
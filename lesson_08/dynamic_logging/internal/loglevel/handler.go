@@ -0,0 +1,91 @@
+package loglevel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type setLevelRequest struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+	TTL    string `json:"ttl"`
+}
+
+// Handler serves GET and PUT requests for /debug/loglevel.
+//
+//	GET /debug/loglevel?logger=repository
+//	PUT /debug/loglevel {"logger": "repository", "level": "debug", "ttl": "5m"}
+//
+// The actor for the audit log is taken from the X-Actor header, falling back to the remote address.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			r.handleGet(w, req)
+		case http.MethodPut:
+			r.handlePut(w, req)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (r *Registry) handleGet(w http.ResponseWriter, req *http.Request) {
+	r.writeStatuses(w, req.URL.Query().Get("logger"))
+}
+
+func (r *Registry) writeStatuses(w http.ResponseWriter, logger string) {
+	statuses, err := r.Get(logger)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statuses)
+}
+
+func (r *Registry) handlePut(w http.ResponseWriter, req *http.Request) {
+	var body setLevelRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	level, err := ParseLevel(body.Level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if body.TTL != "" {
+		ttl, err = time.ParseDuration(body.TTL)
+		if err != nil || ttl < 0 {
+			http.Error(w, fmt.Sprintf("Invalid ttl %q", body.TTL), http.StatusBadRequest)
+			return
+		}
+	}
+
+	actor := req.Header.Get("X-Actor")
+	if actor == "" {
+		actor = req.RemoteAddr
+	}
+
+	if err := r.Set(Change{Logger: body.Logger, Actor: actor, Level: level, TTL: ttl}); err != nil {
+		writeError(w, err)
+		return
+	}
+	r.writeStatuses(w, body.Logger)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUnknownLogger) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
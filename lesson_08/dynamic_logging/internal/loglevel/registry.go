@@ -0,0 +1,233 @@
+package loglevel
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var ErrUnknownLogger = errors.New("unknown logger")
+
+// Target is a level that can be changed at runtime.
+type Target interface {
+	Level() slog.Level
+	SetLevel(slog.Level)
+}
+
+type slogTarget struct {
+	v *slog.LevelVar
+}
+
+// Slog adapts a slog.LevelVar, pass the same LevelVar to slog.HandlerOptions.Level.
+func Slog(v *slog.LevelVar) Target {
+	return slogTarget{v: v}
+}
+
+func (t slogTarget) Level() slog.Level     { return t.v.Level() }
+func (t slogTarget) SetLevel(l slog.Level) { t.v.Set(l) }
+
+type zapTarget struct {
+	l zap.AtomicLevel
+}
+
+// Zap adapts a zap.AtomicLevel, e.g. zap.Config.Level.
+func Zap(l zap.AtomicLevel) Target {
+	return zapTarget{l: l}
+}
+
+func (t zapTarget) Level() slog.Level {
+	switch t.l.Level() {
+	case zapcore.DebugLevel:
+		return slog.LevelDebug
+	case zapcore.InfoLevel:
+		return slog.LevelInfo
+	case zapcore.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+func (t zapTarget) SetLevel(l slog.Level) {
+	switch {
+	case l < slog.LevelInfo:
+		t.l.SetLevel(zapcore.DebugLevel)
+	case l < slog.LevelWarn:
+		t.l.SetLevel(zapcore.InfoLevel)
+	case l < slog.LevelError:
+		t.l.SetLevel(zapcore.WarnLevel)
+	default:
+		t.l.SetLevel(zapcore.ErrorLevel)
+	}
+}
+
+// ParseLevel accepts slog level names in any case: debug, info, warn, error.
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid level %q: %w", s, err)
+	}
+	return l, nil
+}
+
+// Change describes a single level update, used for the audit log.
+type Change struct {
+	Logger string
+	Actor  string
+	Level  slog.Level
+	TTL    time.Duration // Zero means the change is permanent
+}
+
+// Status is the current level of a registered logger.
+type Status struct {
+	Logger    string     `json:"logger"`
+	Level     string     `json:"level"`
+	Base      string     `json:"base_level,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type override struct {
+	base      slog.Level
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+type registered struct {
+	target   Target
+	override *override
+}
+
+// Registry keeps named loggers (e.g. "repository", "http") and their levels.
+type Registry struct {
+	audit *slog.Logger
+
+	mu      sync.Mutex
+	loggers map[string]*registered
+}
+
+// NewRegistry creates a registry, every level change is written to audit.
+func NewRegistry(audit *slog.Logger) *Registry {
+	return &Registry{
+		audit:   audit,
+		loggers: make(map[string]*registered),
+	}
+}
+
+// Register adds a named logger. Registering the same name twice replaces the target.
+func (r *Registry) Register(name string, target Target) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loggers[name] = &registered{target: target}
+}
+
+// Set changes the level of the logger and of all loggers nested under it
+// ("repository" also matches "repository.redis"). An empty name matches all loggers.
+// With a non-zero TTL the previous level is restored when the TTL expires.
+func (r *Registry) Set(c Change) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := r.match(c.Logger)
+	if len(names) == 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownLogger, c.Logger)
+	}
+
+	for _, name := range names {
+		reg := r.loggers[name]
+		old := reg.target.Level()
+
+		// A new change replaces the pending revert, but the level to restore
+		// stays the one that was set before the first temporary override.
+		base := old
+		if reg.override != nil {
+			base = reg.override.base
+			reg.override.timer.Stop()
+			reg.override = nil
+		}
+
+		reg.target.SetLevel(c.Level)
+		if c.TTL > 0 {
+			ov := &override{
+				base:      base,
+				expiresAt: time.Now().Add(c.TTL),
+			}
+			ov.timer = time.AfterFunc(c.TTL, func() { r.revert(name, reg, ov) })
+			reg.override = ov
+		}
+
+		r.audit.Info("log level changed",
+			"logger", name,
+			"old_level", old.String(),
+			"new_level", c.Level.String(),
+			"ttl", c.TTL.String(),
+			"actor", c.Actor,
+		)
+	}
+	return nil
+}
+
+// Get returns levels of the matching loggers, see Set for the matching rules.
+func (r *Registry) Get(name string) ([]Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := r.match(name)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLogger, name)
+	}
+
+	result := make([]Status, 0, len(names))
+	for _, n := range names {
+		reg := r.loggers[n]
+		status := Status{
+			Logger: n,
+			Level:  reg.target.Level().String(),
+		}
+		if reg.override != nil {
+			expiresAt := reg.override.expiresAt
+			status.Base = reg.override.base.String()
+			status.ExpiresAt = &expiresAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+func (r *Registry) revert(name string, reg *registered, ov *override) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The override could be replaced while the timer was firing.
+	if reg.override != ov {
+		return
+	}
+	old := reg.target.Level()
+	base := reg.override.base
+	reg.target.SetLevel(base)
+	reg.override = nil
+
+	r.audit.Info("log level override expired",
+		"logger", name,
+		"old_level", old.String(),
+		"new_level", base.String(),
+	)
+}
+
+// match must be called with r.mu held.
+func (r *Registry) match(name string) []string {
+	var names []string
+	for n := range r.loggers {
+		if name == "" || n == name || strings.HasPrefix(n, name+".") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,101 @@
+package loglevel
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestRegistry(t *testing.T) (*Registry, *slog.LevelVar, zap.AtomicLevel) {
+	t.Helper()
+	r := NewRegistry(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	repository := new(slog.LevelVar)
+	redis := zap.NewAtomicLevelAt(zap.InfoLevel)
+	r.Register("repository", Slog(repository))
+	r.Register("repository.redis", Zap(redis))
+	r.Register("repositoryx", Slog(new(slog.LevelVar)))
+	return r, repository, redis
+}
+
+func TestRegistryMatchesNestedLoggers(t *testing.T) {
+	r, repository, redis := newTestRegistry(t)
+
+	if err := r.Set(Change{Logger: "repository", Level: slog.LevelDebug}); err != nil {
+		t.Fatal(err)
+	}
+	if repository.Level() != slog.LevelDebug || redis.Level() != zap.DebugLevel {
+		t.Errorf("levels = %s, %s; want debug for both", repository.Level(), redis.Level())
+	}
+	statuses, err := r.Get("repository")
+	if err != nil || len(statuses) != 2 {
+		t.Fatalf("Get(repository) = %+v, %v; want repository and repository.redis", statuses, err)
+	}
+
+	if err := r.Set(Change{Logger: "repository.redis", Level: slog.LevelWarn}); err != nil {
+		t.Fatal(err)
+	}
+	if repository.Level() != slog.LevelDebug || redis.Level() != zap.WarnLevel {
+		t.Errorf("child change: levels = %s, %s", repository.Level(), redis.Level())
+	}
+
+	if _, err := r.Get("repo"); !errors.Is(err, ErrUnknownLogger) {
+		t.Errorf("Get(repo) error = %v, want ErrUnknownLogger", err)
+	}
+	if statuses, _ := r.Get(""); len(statuses) != 3 {
+		t.Errorf("Get() returned %d loggers, want 3", len(statuses))
+	}
+}
+
+func TestRegistryOverrideExpires(t *testing.T) {
+	r, repository, _ := newTestRegistry(t)
+
+	if err := r.Set(Change{Logger: "repository", Level: slog.LevelDebug, TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set(Change{Logger: "repository", Level: slog.LevelWarn, TTL: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	// The level before the first temporary change is restored
+	deadline := time.Now().Add(time.Second)
+	for repository.Level() != slog.LevelInfo {
+		if time.Now().After(deadline) {
+			t.Fatalf("level = %s, want reverted to INFO", repository.Level())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r, repository, _ := newTestRegistry(t)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/debug/loglevel",
+		strings.NewReader(`{"logger": "repository", "level": "debug"}`)))
+	if rec.Code != http.StatusOK || repository.Level() != slog.LevelDebug {
+		t.Errorf("PUT: %d, level %s", rec.Code, repository.Level())
+	}
+
+	for _, tt := range []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/debug/loglevel?logger=repository.redis", "", http.StatusOK},
+		{http.MethodGet, "/debug/loglevel?logger=cache", "", http.StatusNotFound},
+		{http.MethodPut, "/debug/loglevel", `{"level": "verbose"}`, http.StatusBadRequest},
+		{http.MethodPut, "/debug/loglevel", `{"level": "debug", "ttl": "soon"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/debug/loglevel", "", http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		r.Handler().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s %s: %d, want %d", tt.method, tt.target, tt.body, rec.Code, tt.want)
+		}
+	}
+}
@@ -1,44 +1,61 @@
 package main
 
 import (
-	"fmt"
+	"example/internal/loglevel"
+	"log"
 	"log/slog"
+	"net/http"
 	"os"
 	"time"
-)
 
-var LOG_LEVEL = new(slog.LevelVar)
+	"go.uber.org/zap"
+)
 
+// go run main.go
+//
+// curl localhost:8080/debug/loglevel
+// curl -X PUT localhost:8080/debug/loglevel -H 'X-Actor: alice' -d '{"logger": "repository", "level": "debug", "ttl": "10s"}'
+// curl -X PUT localhost:8080/debug/loglevel -d '{"logger": "legacy", "level": "warn"}'
 func main() {
-	LOG_LEVEL.Set(slog.LevelInfo)
+	auditLogger := slog.New(slog.NewJSONHandler(os.Stderr, nil)).With(slog.String("logger", "audit"))
+	registry := loglevel.NewRegistry(auditLogger)
 
-	opts := &slog.HandlerOptions{
-		Level: LOG_LEVEL,
+	// Every named logger gets its own LevelVar, so levels can be changed independently.
+	newLogger := func(name string) *slog.Logger {
+		level := new(slog.LevelVar)
+		level.Set(slog.LevelInfo)
+		registry.Register(name, loglevel.Slog(level))
+		opts := &slog.HandlerOptions{
+			Level: level,
+		}
+		return slog.New(slog.NewTextHandler(os.Stdout, opts)).With(slog.String("logger", name))
 	}
-	logger := slog.New(
-		slog.NewTextHandler(os.Stdout, opts),
-	)
 
-	go func() {
-		for {
-			time.Sleep(time.Second * 3)
-			if LOG_LEVEL.Level() == slog.LevelInfo {
-				fmt.Println("Set Debug")
-				LOG_LEVEL.Set(slog.LevelDebug)
-			} else {
-				fmt.Println("Set Info")
-				LOG_LEVEL.Set(slog.LevelInfo)
-			}
-		}
-	}()
+	httpLogger := newLogger("http")
+	repoLogger := newLogger("repository")
+	redisLogger := newLogger("repository.redis")
+
+	// zap loggers are controlled through zap.AtomicLevel
+	zapConfig := zap.NewProductionConfig()
+	zapLogger, err := zapConfig.Build()
+	if err != nil {
+		log.Fatalf("failed to build zap logger: %v", err)
+	}
+	defer zapLogger.Sync()
+	registry.Register("legacy", loglevel.Zap(zapConfig.Level))
 
+	http.Handle("/debug/loglevel", registry.Handler())
 	go func() {
-		for {
-			time.Sleep(time.Second)
-			logger.Info("Info")
-			logger.Debug("Debug")
-		}
+		log.Fatal(http.ListenAndServe(":8080", nil))
 	}()
 
-	select {}
+	for {
+		time.Sleep(time.Second)
+		httpLogger.Info("Info")
+		httpLogger.Debug("Debug")
+		repoLogger.Debug("Debug")
+		redisLogger.Debug("Debug")
+		zapLogger.Info("Info")
+		zapLogger.Debug("Debug")
+	}
 }
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/sdk/log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,6 +19,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sony/gobreaker"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
@@ -26,10 +29,22 @@ import (
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
+	"example/driver-location-service/internal/config"
 	"example/driver-location-service/internal/handlers"
+	"example/driver-location-service/internal/metrics"
 	internalMiddleware "example/driver-location-service/internal/middleware"
 	"example/driver-location-service/internal/service"
+
+	"example/resilience/breaker"
+	"example/resilience/retry"
+	"example/servicekit/health"
+	"example/servicekit/lifecycle"
+	"example/servicekit/logging"
+	kitMiddleware "example/servicekit/middleware"
+
 	"go.opentelemetry.io/contrib/bridges/otelslog"
 )
 
@@ -58,14 +73,14 @@ func initTracer() *sdktrace.TracerProvider {
 	return tp
 }
 
-func initMeter() *metric.MeterProvider {
+func initMeter(opts metrics.Options) *metric.MeterProvider {
 	exporter, err := otlpmetricgrpc.New(context.Background())
 	if err != nil {
 		slog.Error("failed to initialize meter", "error", err)
 		os.Exit(1)
 	}
 
-	mp := metric.NewMeterProvider(
+	mp := metrics.NewMeterProvider(opts,
 		metric.WithReader(metric.NewPeriodicReader(exporter)),
 		metric.WithResource(resource.NewWithAttributes(
 			semconv.SchemaURL,
@@ -77,25 +92,147 @@ func initMeter() *metric.MeterProvider {
 	return mp
 }
 
+// newDebugLogging allows per-request debug logs for the configured keys
+func newDebugLogging(cfg *config.Config) *kitMiddleware.DebugLogging {
+	return kitMiddleware.NewDebugLogging(cfg.DebugLogKeys, cfg.DebugLogRate, 5)
+}
+
+// newLoadShedder limits concurrent API requests to MAX_CONCURRENT_REQUESTS.
+// Location updates are critical: losing them breaks the matching, nearby search can be retried.
+func newLoadShedder(cfg *config.Config) *internalMiddleware.LoadShedder {
+	return internalMiddleware.NewLoadShedder(cfg.MaxConcurrentRequests, func(r *http.Request) internalMiddleware.Priority {
+		if r.Method == http.MethodPost {
+			return internalMiddleware.PriorityCritical
+		}
+		return internalMiddleware.PriorityNormal
+	})
+}
+
+// newTrackAnalyzerClient returns a client for the track analyzer with retries and a circuit breaker:
+// every attempt goes through the breaker, when at least 30% of 10+ attempts fail it stops calling for 10 seconds
+func newTrackAnalyzerClient(store *config.Store, logger *slog.Logger) *http.Client {
+	transport, err := breaker.NewTransport(http.DefaultTransport, breaker.Options{
+		Settings: gobreaker.Settings{
+			MaxRequests: 1,
+			Interval:    time.Minute,
+			Timeout:     10 * time.Second,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
+				return counts.Requests >= 10 && failureRatio >= 0.3
+			},
+			OnStateChange: func(name string, from, to gobreaker.State) {
+				logger.Warn("circuit breaker state changed", "name", name, "from", from.String(), "to", to.String())
+			},
+		},
+	})
+	if err != nil {
+		logger.Error("failed to create circuit breaker", "error", err)
+		os.Exit(1)
+	}
+	return &http.Client{Transport: retry.NewTransport(transport, retry.Options{
+		MaxAttempts: 3,
+		AttemptTimeoutFunc: func() time.Duration {
+			return store.Get().TrackAnalyzerAttemptTimeout
+		},
+		// Retries are at most 10% of the calls, so they cannot overload a struggling track analyzer
+		Budget: retry.NewBudget(0.1, 1),
+		ShouldRetry: func(resp *http.Response, err error) bool {
+			// The breaker is open, a retry would be rejected as well
+			return !errors.Is(err, breaker.ErrOpen) && retry.DefaultShouldRetry(resp, err)
+		},
+	})}
+}
+
+// shutdownTimeout is the deadline of the whole shutdown, drainDelay included.
+// Kubernetes kills the pod after terminationGracePeriodSeconds, 30s by default.
+const shutdownTimeout = 25 * time.Second
+
+// drainDelay is the time between turning readiness off and stopping the server,
+// for load balancers to notice it and stop sending new requests
+const drainDelay = 5 * time.Second
+
+func newHealth(redisClient *redis.Client, trackAnalyzerURL string) *health.Health {
+	h := health.New(health.Options{})
+	h.Register(health.Check{Name: "redis", Func: health.RedisPing(redisClient)})
+	// Locations are saved without track-analyzer, it only gets fewer points
+	h.Register(health.Check{Name: "track-analyzer", Func: health.HTTPGet(nil, trackAnalyzerURL+"/livez"), Optional: true})
+	h.Register(health.Check{Name: "otlp", Func: health.TCPDial(health.OTLPEndpoint()), Optional: true})
+	return h
+}
+
+// serveHealthGRPC serves grpc.health.v1 on addr
+func serveHealthGRPC(h *health.Health, addr string, logger *slog.Logger) *grpc.Server {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("failed to listen for grpc health", "error", err)
+		os.Exit(1)
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, h.GRPCServer())
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			logger.Error("grpc health server error", "error", err)
+		}
+	}()
+	return srv
+}
+
+// serveDebug serves the debug endpoints apart from the API, on an address
+// that is not exposed outside of the pod
+func serveDebug(store *config.Store, addr string, logger *slog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/config", store.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		logger.Info("starting debug server", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("debug server error", "error", err)
+		}
+	}()
+	return srv
+}
+
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level:     slog.LevelInfo,
+	// The level is changed when the config is reloaded
+	logLevel := new(slog.LevelVar)
+	logger := slog.New(logging.NewHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:     logLevel,
 		AddSource: true,
-	}))
+	})))
 	slog.SetDefault(logger)
 
-	tp := initTracer()
-	defer tp.Shutdown(context.Background())
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Error("failed to load config", "error", err)
+		os.Exit(1)
+	}
+	level, _ := cfg.SlogLevel()
+	logLevel.Set(level)
+
+	configStore := config.NewStore(cfg, logger)
+	configStore.OnReload(func(cfg *config.Config) {
+		level, _ := cfg.SlogLevel()
+		logLevel.Set(level)
+	})
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	go configStore.ReloadOnSignal(reloadCtx, syscall.SIGHUP)
+
+	metricsOptions := metrics.Options{HistogramMode: cfg.MetricsHistogramMode, Summaries: cfg.MetricsSummaries}
+	metrics.Init(metricsOptions)
 
-	mp := initMeter()
-	defer mp.Shutdown(context.Background())
+	tp := initTracer()
+	mp := initMeter(metricsOptions)
 
 	redisClient := redis.NewClient(&redis.Options{
-		Addr: os.Getenv("REDIS_ADDR"),
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
 	})
-	defer redisClient.Close()
 
-	driverService := service.NewDriverService(redisClient, os.Getenv("TRACK_ANALYZER_URL"), logger)
+	healthChecks := newHealth(redisClient, cfg.TrackAnalyzerURL)
+
+	driverService := service.NewDriverService(redisClient, cfg.TrackAnalyzerURL, newTrackAnalyzerClient(configStore, logger),
+		func() time.Duration { return configStore.Get().TrackAnalyzerTimeout }, logger)
 	driverHandler := handlers.NewDriverHandler(driverService, logger)
 
 	r := chi.NewRouter()
@@ -105,7 +242,7 @@ func main() {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(internalMiddleware.TracingMiddleware)
+	r.Use(kitMiddleware.TracingMiddleware(newDebugLogging(cfg)))
 	r.Use(internalMiddleware.MetricsMiddleware)
 
 	ctx := context.Background()
@@ -122,9 +259,6 @@ func main() {
 		),
 	)
 
-	// Ensure the logger is shutdown before exiting so all pending logs are exported
-	defer lp.Shutdown(ctx)
-
 	// Set the logger provider globally
 	global.SetLoggerProvider(lp)
 
@@ -134,9 +268,12 @@ func main() {
 	otelLogger.Error("Example message from otel error")
 	otelLogger.Warn("Example message from otel warn")
 
-	// Create a subrouter for API endpoints with timeout
+	// Create a subrouter for API endpoints with timeout and load shedding
 	apiRouter := chi.NewRouter()
-	apiRouter.Use(internalMiddleware.TimeoutMiddleware(time.Second))
+	apiRouter.Use(kitMiddleware.DynamicTimeoutMiddleware(func() time.Duration {
+		return configStore.Get().RequestTimeout
+	}))
+	apiRouter.Use(newLoadShedder(cfg).Middleware)
 
 	apiRouter.Route("/api/v1", func(r chi.Router) {
 		r.Post("/drivers/{id}/location", driverHandler.UpdateLocation)
@@ -150,9 +287,11 @@ func main() {
 		EnableOpenMetrics: true,
 	}
 	r.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, opts))
+	r.Handle("/livez", healthChecks.LivenessHandler())
+	r.Handle("/readyz", healthChecks.ReadinessHandler())
 
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.HTTPAddr,
 		Handler: r,
 	}
 
@@ -160,28 +299,53 @@ func main() {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	grpcHealth := serveHealthGRPC(healthChecks, cfg.HealthGRPCAddr, logger)
+	debugSrv := serveDebug(configStore, cfg.DebugAddr, logger)
+
+	// Components stop in the order of the phases, telemetry is flushed last
+	// so that everything logged and traced during the shutdown is exported
+	shutdownManager := lifecycle.New(logger, shutdownTimeout)
+	shutdownManager.Register(lifecycle.PhaseReadiness, "health", func(ctx context.Context) error {
+		// Become unready first and let the load balancers notice it
+		healthChecks.Drain()
+		return lifecycle.Sleep(ctx, drainDelay)
+	})
+	shutdownManager.Register(lifecycle.PhaseHTTP, "http", func(ctx context.Context) error {
+		if err := srv.Shutdown(ctx); err != nil {
+			return errors.Join(err, srv.Close())
+		}
+		return nil
+	})
+	shutdownManager.Register(lifecycle.PhaseHTTP, "grpc health", func(ctx context.Context) error {
+		// Not GracefulStop: Watch streams of the probes never end by themselves
+		grpcHealth.Stop()
+		return nil
+	})
+	shutdownManager.Register(lifecycle.PhaseHTTP, "debug", func(ctx context.Context) error {
+		return debugSrv.Close()
+	})
+	shutdownManager.Register(lifecycle.PhaseWorkers, "track-analyzer sends", driverService.Wait)
+	shutdownManager.Register(lifecycle.PhaseStorage, "redis", func(ctx context.Context) error {
+		return redisClient.Close()
+	})
+	shutdownManager.Register(lifecycle.PhaseTelemetry, "metrics", mp.Shutdown)
+	shutdownManager.Register(lifecycle.PhaseTelemetry, "traces", tp.Shutdown)
+	// Logs go last, with the errors of the metrics and traces flush
+	shutdownManager.Register(lifecycle.PhaseTelemetry, "logs", lp.Shutdown)
+
 	go func() {
-		logger.Info("starting driver location service", "port", "8080")
+		logger.Info("starting driver location service", "addr", cfg.HTTPAddr)
 		serverErrors <- srv.ListenAndServe()
 	}()
 
 	select {
 	case err := <-serverErrors:
 		logger.Error("server error", "error", err)
-		return
-
 	case sig := <-shutdown:
-		logger.Info("shutdown started", "signal", sig)
-		defer logger.Info("shutdown complete", "signal", sig)
-
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+		logger.Info("shutdown signal received", "signal", sig)
+	}
 
-		if err := srv.Shutdown(ctx); err != nil {
-			logger.Error("graceful shutdown failed", "error", err)
-			if err := srv.Close(); err != nil {
-				logger.Error("forcing server close failed", "error", err)
-			}
-		}
+	if err := shutdownManager.Shutdown(context.Background()); err != nil {
+		os.Exit(1)
 	}
 }
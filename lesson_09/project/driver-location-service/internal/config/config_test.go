@@ -0,0 +1,112 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example/servicekit/configstore"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSources(t *testing.T) {
+	t.Setenv(FileEnv, writeFile(t, "redis_addr: redis:6379\nrequest_timeout: 2s\nredis_password: secret\n"))
+	t.Setenv("REQUEST_TIMEOUT", "3s")
+	t.Setenv("DEBUG_LOG_KEYS", "incident-42,incident-43")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The environment overrides the file, the file overrides the defaults
+	if cfg.RedisAddr != "redis:6379" || cfg.RequestTimeout != 3*time.Second || cfg.HTTPAddr != ":8080" {
+		t.Errorf("cfg = %+v", cfg)
+	}
+	if len(cfg.DebugLogKeys) != 2 || cfg.DebugLogKeys[1] != "incident-43" {
+		t.Errorf("DebugLogKeys = %q", cfg.DebugLogKeys)
+	}
+
+	redactedCfg := Redacted(cfg)
+	if redactedCfg["redis_password"] != configstore.Mask || redactedCfg["request_timeout"] != "3s" {
+		t.Errorf("Redacted = %v", redactedCfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "0s")
+	t.Setenv("TRACK_ANALYZER_URL", "track-analyzer:8080")
+	t.Setenv("METRICS_HISTOGRAM_MODE", "native")
+	t.Setenv("TRACK_ANALYZER_ATTEMPT_TIMEOUT", "5s")
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "REQUEST_TIMEOUT must be positive") ||
+		!strings.Contains(err.Error(), "TRACK_ANALYZER_URL must be an http(s) URL") ||
+		!strings.Contains(err.Error(), "TRACK_ANALYZER_ATTEMPT_TIMEOUT must be positive and at most TRACK_ANALYZER_TIMEOUT (3s)") ||
+		!strings.Contains(err.Error(), "METRICS_HISTOGRAM_MODE must be classic or both") {
+		t.Errorf("err = %v, want all invalid values reported", err)
+	}
+
+	t.Setenv(FileEnv, writeFile(t, "request_timout: 2s\n"))
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "request_timout") {
+		t.Errorf("err = %v, want the misspelled key reported", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeFile(t, "log_level: INFO\n")
+	t.Setenv(FileEnv, path)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var reloaded *Config
+	store.OnReload(func(cfg *Config) { reloaded = cfg })
+
+	if err := os.WriteFile(path, []byte("log_level: DEBUG\nhttp_addr: :9000\ntrack_analyzer_timeout: 5s\ntrack_analyzer_attempt_timeout: 2s\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	// The log level and the timeouts are applied, the address needs a restart
+	if got := store.Get(); got.LogLevel != "DEBUG" || got.HTTPAddr != ":8080" || reloaded != got ||
+		got.TrackAnalyzerTimeout != 5*time.Second || got.TrackAnalyzerAttemptTimeout != 2*time.Second {
+		t.Errorf("after reload cfg = %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("log_level: LOUD\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil || store.Get().LogLevel != "DEBUG" {
+		t.Errorf("reload of an invalid config: err = %v, log level %q, want it kept", err, store.Get().LogLevel)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.RedisPassword = "secret"
+	cfg.DebugLogKeys = []string{"incident-42"}
+
+	redactedCfg := Redacted(cfg)
+	for _, key := range []string{"redis_password", "debug_log_keys"} {
+		if redactedCfg[key] != configstore.Mask {
+			t.Errorf("%s = %v, want it redacted", key, redactedCfg[key])
+		}
+	}
+	// An unset secret is shown as empty, so that it is clear it is not set
+	if got := Redacted(Default())["debug_log_keys"]; got == configstore.Mask {
+		t.Errorf("unset debug_log_keys = %v, want it not redacted", got)
+	}
+}
@@ -72,17 +72,23 @@ func (h *DriverHandler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
 
 	var location models.Location
 	if err := json.NewDecoder(r.Body).Decode(&location); err != nil {
-		logger.Error("failed to decode location", "error", err)
+		logger.ErrorContext(ctx, "failed to decode location", "error", err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to decode location")
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	logger.DebugContext(ctx, "received location update",
+		"latitude", location.Latitude,
+		"longitude", location.Longitude,
+		"timestamp", location.Timestamp,
+	)
+
 	if err := h.driverService.UpdateLocation(context.WithoutCancel(ctx), driverID, location); err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to update location")
-		logger.Error("failed to update location", "error", err)
+		logger.ErrorContext(ctx, "failed to update location", "error", err)
 		http.Error(w, "Failed to update location", http.StatusInternalServerError)
 		return
 	}
@@ -91,11 +97,11 @@ func (h *DriverHandler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
 	h.locationUpdates.Add(ctx, 1, metric.WithAttributes(
 		attribute.String("driver_id", driverID),
 	))
-	logger.Info("Updated otel metric driver.location.updates")
+	logger.InfoContext(ctx, "Updated otel metric driver.location.updates")
 
-	metrics.LocationUpdates.WithLabelValues(driverID).Inc()
+	metrics.Add(ctx, metrics.LocationUpdates.WithLabelValues(driverID), 1)
 
-	logger.Info("location updated successfully",
+	logger.InfoContext(ctx, "location updated successfully",
 		"latitude", location.Latitude,
 		"longitude", location.Longitude,
 	)
@@ -115,14 +121,14 @@ func (h *DriverHandler) FindNearbyDrivers(w http.ResponseWriter, r *http.Request
 
 	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
 	if err != nil {
-		logger.Error("invalid latitude", "error", err)
+		logger.ErrorContext(ctx, "invalid latitude", "error", err)
 		http.Error(w, "Invalid latitude", http.StatusBadRequest)
 		return
 	}
 
 	lon, err := strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
 	if err != nil {
-		logger.Error("invalid longitude", "error", err)
+		logger.ErrorContext(ctx, "invalid longitude", "error", err)
 		http.Error(w, "Invalid longitude", http.StatusBadRequest)
 		return
 	}
@@ -132,7 +138,7 @@ func (h *DriverHandler) FindNearbyDrivers(w http.ResponseWriter, r *http.Request
 	if rad := r.URL.Query().Get("radius"); rad != "" {
 		radius, err = strconv.ParseFloat(rad, 64)
 		if err != nil {
-			logger.Error("invalid radius", "error", err)
+			logger.ErrorContext(ctx, "invalid radius", "error", err)
 			http.Error(w, "Invalid radius", http.StatusBadRequest)
 			return
 		}
@@ -146,16 +152,16 @@ func (h *DriverHandler) FindNearbyDrivers(w http.ResponseWriter, r *http.Request
 
 	drivers, err := h.driverService.FindNearby(ctx, lat, lon, radius)
 	if err != nil {
-		logger.Error("failed to find nearby drivers", "error", err)
+		logger.ErrorContext(ctx, "failed to find nearby drivers", "error", err)
 		http.Error(w, "Failed to find nearby drivers", http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("found nearby drivers", "count", len(drivers))
+	logger.InfoContext(ctx, "found nearby drivers", "count", len(drivers))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(drivers); err != nil {
-		logger.Error("failed to encode response", "error", err)
+		logger.ErrorContext(ctx, "failed to encode response", "error", err)
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func limitHits(t *testing.T, metric string) float64 {
+	t.Helper()
+	return testutil.ToFloat64(CardinalityLimitHits.WithLabelValues(metric))
+}
+
+func TestLimitedCounterVecOverflow(t *testing.T) {
+	v := NewLimitedCounterVec(prometheus.CounterOpts{Name: "test_counter_overflow_total"},
+		[]string{"driver_id", "status"},
+		CardinalityOpts{MaxSeries: 2, Allowlist: map[string][]string{"driver_id": {"vip"}, "status": {"ok"}}},
+	)
+
+	v.WithLabelValues("1", "ok").Inc()
+	v.With(prometheus.Labels{"status": "ok", "driver_id": "2"}).Inc()
+	// Known series are updated over the limit
+	v.WithLabelValues("1", "ok").Inc()
+	// New series are folded, the allowlisted values are kept
+	v.WithLabelValues("3", "ok").Inc()
+	v.WithLabelValues("4", "failed").Inc()
+	// Allowlisted series bypass the limit
+	v.WithLabelValues("vip", "ok").Inc()
+
+	for _, tt := range []struct {
+		lvs  []string
+		want float64
+	}{
+		{[]string{"1", "ok"}, 2},
+		{[]string{"2", "ok"}, 1},
+		{[]string{OverflowValue, "ok"}, 1},
+		{[]string{OverflowValue, OverflowValue}, 1},
+		{[]string{"vip", "ok"}, 1},
+	} {
+		if got := testutil.ToFloat64(v.vec.WithLabelValues(tt.lvs...)); got != tt.want {
+			t.Errorf("series %q = %v, want %v", tt.lvs, got, tt.want)
+		}
+	}
+	if got := testutil.CollectAndCount(v.vec); got != 5 {
+		t.Errorf("%d series, want 5", got)
+	}
+	if got := limitHits(t, "test_counter_overflow_total"); got != 2 {
+		t.Errorf("limit hits = %v, want 2", got)
+	}
+}
+
+func TestLimitedVecDeleteFreesSeries(t *testing.T) {
+	v := NewLimitedHistogramVec(prometheus.HistogramOpts{Name: "test_histogram_delete"},
+		[]string{"driver_id"}, CardinalityOpts{MaxSeries: 1})
+
+	v.WithLabelValues("1").Observe(1)
+	if !v.DeleteLabelValues("1") {
+		t.Fatal("DeleteLabelValues() = false for an existing series")
+	}
+	// The place of the deleted series is taken by a new one
+	v.WithLabelValues("2").Observe(1)
+	if got := testutil.CollectAndCount(v.vec); got != 1 {
+		t.Errorf("%d series, want 1", got)
+	}
+	if got := limitHits(t, "test_histogram_delete"); got != 0 {
+		t.Errorf("limit hits = %v, want 0", got)
+	}
+}
+
+func TestLimitedGaugeVecDropsOverLimit(t *testing.T) {
+	v := NewLimitedGaugeVec(prometheus.GaugeOpts{Name: "test_gauge_drop"},
+		[]string{"driver_id"}, CardinalityOpts{MaxSeries: 1})
+
+	v.WithLabelValues("1").Set(10)
+	v.WithLabelValues("2").Set(20)
+	v.With(prometheus.Labels{"driver_id": "3"}).Set(30)
+
+	if got := testutil.CollectAndCount(v.vec); got != 1 {
+		t.Errorf("%d series, want only the first one", got)
+	}
+	if got := testutil.ToFloat64(v.vec.WithLabelValues("1")); got != 10 {
+		t.Errorf("gauge = %v, want 10", got)
+	}
+	if got := limitHits(t, "test_gauge_drop"); got != 2 {
+		t.Errorf("limit hits = %v, want 2", got)
+	}
+}
+
+func TestLimiterBypass(t *testing.T) {
+	unlimited := NewLimitedSummaryVec(prometheus.SummaryOpts{Name: "test_summary_unlimited"},
+		[]string{"driver_id"}, CardinalityOpts{})
+	for _, id := range []string{"1", "2", "3"} {
+		unlimited.WithLabelValues(id).Observe(1)
+	}
+	if got := testutil.CollectAndCount(unlimited.vec); got != 3 {
+		t.Errorf("%d series without a limit, want 3", got)
+	}
+
+	// A wrong label count reaches the vector, which panics as usual
+	limited := NewLimitedCounterVec(prometheus.CounterOpts{Name: "test_counter_label_count_total"},
+		[]string{"driver_id"}, CardinalityOpts{MaxSeries: 1})
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a wrong label count")
+		}
+	}()
+	limited.WithLabelValues("1", "extra")
+}
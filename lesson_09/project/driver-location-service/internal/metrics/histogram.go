@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Histogram modes, set by METRICS_HISTOGRAM_MODE
+const (
+	HistogramModeClassic = "classic" // Only classic buckets
+	HistogramModeNative  = "native"  // Only native (sparse) buckets
+	HistogramModeBoth    = "both"    // Native buckets with classic ones for compatibility, the default
+)
+
+// Options configure the histograms, main fills them from the config.
+type Options struct {
+	// HistogramMode controls which buckets histograms expose, empty means HistogramModeBoth.
+	// Native histograms are scraped only over protobuf, with --enable-feature=native-histograms in Prometheus,
+	// the text format always contains classic buckets.
+	HistogramMode string
+	// Summaries brings back client side summaries.
+	// Summary quantiles can't be aggregated across instances, prefer histogram_quantile over histograms.
+	Summaries bool
+}
+
+// withHistogramMode configures opts according to mode
+func withHistogramMode(mode string, opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	if mode == HistogramModeClassic {
+		return opts
+	}
+	// Each bucket is at most 10% wider than the previous one
+	opts.NativeHistogramBucketFactor = 1.1
+	opts.NativeHistogramMaxBucketNumber = 160
+	opts.NativeHistogramMinResetDuration = time.Hour
+	if mode == HistogramModeNative {
+		opts.Buckets = nil
+	}
+	return opts
+}
+
+// NewMeterProvider returns the OTel meter provider for the histogram mode.
+// Exemplars use the SDK default filter: measurements made within a sampled span get its
+// trace_id and span_id, OTEL_METRICS_EXEMPLAR_FILTER overrides it.
+func NewMeterProvider(opts Options, options ...metric.Option) *metric.MeterProvider {
+	if opts.HistogramMode == HistogramModeNative {
+		// Exponential histograms are the OTel equivalent of Prometheus native histograms
+		options = append(options, metric.WithView(metric.NewView(
+			metric.Instrument{Kind: metric.InstrumentKindHistogram},
+			metric.Stream{Aggregation: metric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}},
+		)))
+	}
+	return metric.NewMeterProvider(options...)
+}
+
+// exemplarLabels returns trace_id exemplar labels for the sampled span in ctx
+func exemplarLabels(ctx context.Context) prometheus.Labels {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if !spanCtx.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": spanCtx.TraceID().String()}
+}
+
+// Observe records value with the trace_id exemplar from ctx, if the observer supports exemplars
+func Observe(ctx context.Context, observer prometheus.Observer, value float64) {
+	labels := exemplarLabels(ctx)
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && labels != nil {
+		exemplarObserver.ObserveWithExemplar(value, labels)
+		return
+	}
+	observer.Observe(value)
+}
+
+// Add increments counter with the trace_id exemplar from ctx
+func Add(ctx context.Context, counter prometheus.Counter, value float64) {
+	labels := exemplarLabels(ctx)
+	if exemplarAdder, ok := counter.(prometheus.ExemplarAdder); ok && labels != nil {
+		exemplarAdder.AddWithExemplar(value, labels)
+		return
+	}
+	counter.Add(value)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithHistogramMode(t *testing.T) {
+	opts := prometheus.HistogramOpts{Buckets: prometheus.DefBuckets}
+
+	if got := withHistogramMode(HistogramModeClassic, opts); got.NativeHistogramBucketFactor != 0 || len(got.Buckets) == 0 {
+		t.Errorf("classic: factor %v, %d buckets; want only classic buckets", got.NativeHistogramBucketFactor, len(got.Buckets))
+	}
+	for _, mode := range []string{"", HistogramModeBoth} {
+		if got := withHistogramMode(mode, opts); got.NativeHistogramBucketFactor == 0 || len(got.Buckets) == 0 {
+			t.Errorf("%q: factor %v, %d buckets; want native and classic buckets", mode, got.NativeHistogramBucketFactor, len(got.Buckets))
+		}
+	}
+	if got := withHistogramMode(HistogramModeNative, opts); got.NativeHistogramBucketFactor == 0 || got.Buckets != nil {
+		t.Errorf("native: factor %v, buckets %v; want only native buckets", got.NativeHistogramBucketFactor, got.Buckets)
+	}
+}
+
+// sampledContext returns a context with a sampled remote span
+func sampledContext(t *testing.T) (context.Context, trace.TraceID) {
+	t.Helper()
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	return trace.ContextWithSpanContext(context.Background(), spanCtx), traceID
+}
+
+// recordDuration records one sampled and one unsampled measurement and returns the collected histogram
+func recordDuration(t *testing.T, mode string) (metricdata.Aggregation, trace.TraceID) {
+	t.Helper()
+	reader := metric.NewManualReader()
+	mp := NewMeterProvider(Options{HistogramMode: mode}, metric.WithReader(reader))
+	defer mp.Shutdown(context.Background())
+
+	histogram, err := mp.Meter("test").Float64Histogram("http.server.request.duration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, traceID := sampledContext(t)
+	histogram.Record(ctx, 0.25)
+	histogram.Record(context.Background(), 0.5)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.ScopeMetrics) != 1 || len(rm.ScopeMetrics[0].Metrics) != 1 {
+		t.Fatalf("collected %+v, want one metric", rm.ScopeMetrics)
+	}
+	return rm.ScopeMetrics[0].Metrics[0].Data, traceID
+}
+
+func assertExemplars(t *testing.T, exemplars []metricdata.Exemplar[float64], traceID trace.TraceID) {
+	t.Helper()
+	// Only the measurement within the sampled span has an exemplar
+	if len(exemplars) != 1 || trace.TraceID(exemplars[0].TraceID) != traceID || exemplars[0].Value != 0.25 {
+		t.Errorf("exemplars = %+v, want one with trace_id %s", exemplars, traceID)
+	}
+}
+
+func TestNewMeterProviderNative(t *testing.T) {
+	data, traceID := recordDuration(t, HistogramModeNative)
+	histogram, ok := data.(metricdata.ExponentialHistogram[float64])
+	if !ok {
+		t.Fatalf("data = %T, want an exponential histogram", data)
+	}
+	if len(histogram.DataPoints) != 1 || histogram.DataPoints[0].Count != 2 {
+		t.Fatalf("data points = %+v", histogram.DataPoints)
+	}
+	assertExemplars(t, histogram.DataPoints[0].Exemplars, traceID)
+}
+
+func TestNewMeterProviderClassic(t *testing.T) {
+	for _, mode := range []string{HistogramModeClassic, HistogramModeBoth} {
+		data, traceID := recordDuration(t, mode)
+		histogram, ok := data.(metricdata.Histogram[float64])
+		if !ok {
+			t.Fatalf("%s: data = %T, want an explicit bucket histogram", mode, data)
+		}
+		if len(histogram.DataPoints) != 1 || histogram.DataPoints[0].Count != 2 {
+			t.Fatalf("%s: data points = %+v", mode, histogram.DataPoints)
+		}
+		assertExemplars(t, histogram.DataPoints[0].Exemplars, traceID)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// driverLimit caps the number of driver_id series per metric
+var driverLimit = CardinalityOpts{MaxSeries: 1000}
+
 var (
 	HttpRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -14,15 +17,75 @@ var (
 		[]string{"path", "method", "status"},
 	)
 
+	HttpRequestsInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being served",
+		},
+	)
+
+	HttpRequestsShed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_shed_total",
+			Help: "Requests rejected by the load shedder, reason is queue_time (rejected on arrival) or deadline (expired while queued)",
+		},
+		[]string{"priority", "reason"},
+	)
+
+	HttpRequestsQueued = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_requests_queued",
+			Help: "Requests waiting for the load shedder",
+		},
+		[]string{"priority"},
+	)
+
+	LocationUpdates = NewLimitedCounterVec(
+		prometheus.CounterOpts{
+			Name: "driver_location_updates_total",
+			Help: "Total number of driver location updates",
+		},
+		[]string{"driver_id"},
+		driverLimit,
+	)
+)
+
+// The metrics below depend on Options, Init creates them
+var (
+	HttpRequestDuration *prometheus.HistogramVec
+	HttpResponseSize    *prometheus.HistogramVec
+	// HttpRequestDurationSummary is nil unless Options.Summaries
+	HttpRequestDurationSummary *prometheus.SummaryVec
+)
+
+// Init registers the histograms and summaries configured by opts.
+// It is called once from main, before the metrics are used.
+func Init(opts Options) {
 	HttpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
+		withHistogramMode(opts.HistogramMode, prometheus.HistogramOpts{
 			Name:    "http_request_duration_seconds",
 			Help:    "HTTP request duration in seconds",
 			Buckets: prometheus.DefBuckets,
-		},
+		}),
 		[]string{"path", "method"},
 	)
-	HttpRequestDurationSummary = promauto.NewSummaryVec(
+
+	HttpResponseSize = promauto.NewHistogramVec(
+		withHistogramMode(opts.HistogramMode, prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "HTTP response body size in bytes",
+			Buckets: prometheus.ExponentialBuckets(100, 10, 6),
+		}),
+		[]string{"path", "method"},
+	)
+
+	if opts.Summaries {
+		HttpRequestDurationSummary = newHttpRequestDurationSummary()
+	}
+}
+
+func newHttpRequestDurationSummary() *prometheus.SummaryVec {
+	return promauto.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Name: "http_request_duration_seconds_summary",
 			Help: "HTTP request duration in seconds (summary)",
@@ -36,12 +99,4 @@ var (
 		},
 		[]string{"path", "method"},
 	)
-
-	LocationUpdates = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "driver_location_updates_total",
-			Help: "Total number of driver location updates",
-		},
-		[]string{"driver_id"},
-	)
-)
+}
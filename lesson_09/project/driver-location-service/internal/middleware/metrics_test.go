@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+
+	"example/driver-location-service/internal/metrics"
+)
+
+func TestMain(m *testing.M) {
+	metrics.Init(metrics.Options{HistogramMode: metrics.HistogramModeNative})
+	os.Exit(m.Run())
+}
+
+func TestMetricsMiddlewareRecordsOTelDuration(t *testing.T) {
+	reader := metric.NewManualReader()
+	mp := metrics.NewMeterProvider(metrics.Options{HistogramMode: metrics.HistogramModeNative}, metric.WithReader(reader))
+	defer mp.Shutdown(context.Background())
+	// requestDuration is created from the global meter and delegates to the provider set later
+	otel.SetMeterProvider(mp)
+
+	r := chi.NewRouter()
+	r.Use(MetricsMiddleware)
+	r.Get("/api/v1/drivers/{driverID}/nearby", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/drivers/42/nearby", nil).WithContext(ctx)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var duration *metricdata.ExponentialHistogram[float64]
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if h, ok := m.Data.(metricdata.ExponentialHistogram[float64]); ok && m.Name == "http.server.request.duration" {
+				duration = &h
+			}
+		}
+	}
+	if duration == nil || len(duration.DataPoints) != 1 {
+		t.Fatalf("http.server.request.duration = %+v, want one exponential data point", duration)
+	}
+	point := duration.DataPoints[0]
+	if route, _ := point.Attributes.Value(attribute.Key("http.route")); route.AsString() != "/api/v1/drivers/{driverID}/nearby" {
+		t.Errorf("http.route = %q, want the route pattern", route.AsString())
+	}
+	if status, _ := point.Attributes.Value(attribute.Key("http.response.status_code")); status.AsInt64() != http.StatusAccepted {
+		t.Errorf("http.response.status_code = %d, want 202", status.AsInt64())
+	}
+	if len(point.Exemplars) != 1 || trace.TraceID(point.Exemplars[0].TraceID) != traceID {
+		t.Errorf("exemplars = %+v, want one with trace_id %s", point.Exemplars, traceID)
+	}
+
+	// The Prometheus histogram is recorded too
+	if got := testutil.CollectAndCount(metrics.HttpRequestDuration); got != 1 {
+		t.Errorf("%d http_request_duration_seconds series, want 1", got)
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"example/driver-location-service/internal/domain/models"
+	"example/resilience/breaker"
 	"fmt"
 	"go.opentelemetry.io/otel/codes"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
@@ -21,18 +25,34 @@ type DriverService interface {
 	UpdateLocation(ctx context.Context, driverID string, location models.Location) error
 	FindNearby(ctx context.Context, lat, lon float64, radius float64) ([]models.Driver, error)
 	RemoveDriver(ctx context.Context, driverID string) error
+	// Wait blocks until the points sent in background are delivered or ctx is done.
+	// It is called on shutdown once no more locations are updated.
+	Wait(ctx context.Context) error
 }
 
 type driverService struct {
 	redis       *redis.Client
 	trackingURL string
+	client      *http.Client
+	// sendTimeout limits sending a point with all the retries, it is read for every
+	// point so that it can be changed without a restart
+	sendTimeout func() time.Duration
 	logger      *slog.Logger
+	// sends tracks the points sent to the track analyzer in background
+	sends sync.WaitGroup
 }
 
-func NewDriverService(redis *redis.Client, trackingURL string, logger *slog.Logger) DriverService {
+// NewDriverService creates the service. client is used for calls to the track analyzer,
+// http.DefaultClient if nil.
+func NewDriverService(redis *redis.Client, trackingURL string, client *http.Client, sendTimeout func() time.Duration, logger *slog.Logger) DriverService {
+	if client == nil {
+		client = http.DefaultClient
+	}
 	return &driverService{
 		redis:       redis,
 		trackingURL: trackingURL,
+		client:      client,
+		sendTimeout: sendTimeout,
 		logger:      logger,
 	}
 }
@@ -67,16 +87,24 @@ func (s *driverService) UpdateLocation(ctx context.Context, driverID string, loc
 		Location:  location,
 		Timestamp: time.Now().Unix(),
 	}
+	// The key is made once for all the attempts, so the track analyzer stores a retry
+	// only once. Timestamp has a second resolution and can not identify the point.
+	idempotencyKey := uuid.NewString()
 
+	// The send outlives the request, so it keeps the trace but not the cancellation
+	sendCtx := context.WithoutCancel(ctx)
+	s.sends.Add(1)
 	go func() {
+		defer s.sends.Done()
+		ctx := sendCtx
 		spanCtx := trace.SpanContextFromContext(ctx)
 		logger := s.logger.With(
 			slog.String("traceID", spanCtx.TraceID().String()),
 			slog.String("driverID", driverID),
 		)
 
-		if err := s.sendToTrackAnalyzer(ctx, point); err != nil {
-			logger.Error("failed to send point to track analyzer",
+		if err := s.sendToTrackAnalyzer(ctx, point, idempotencyKey); err != nil {
+			logger.ErrorContext(ctx, "failed to send point to track analyzer",
 				"error", err,
 				"latitude", location.Latitude,
 				"longitude", location.Longitude,
@@ -87,8 +115,23 @@ func (s *driverService) UpdateLocation(ctx context.Context, driverID string, loc
 	return s.redis.Set(ctx, key, data, 0).Err()
 }
 
-func (s *driverService) sendToTrackAnalyzer(ctx context.Context, point models.GpsPoint) error {
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
+func (s *driverService) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.sends.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("points still being sent: %w", ctx.Err())
+	}
+}
+
+func (s *driverService) sendToTrackAnalyzer(ctx context.Context, point models.GpsPoint, idempotencyKey string) error {
+	// The client retries, every attempt has its own timeout within this one
+	ctx, cancel := context.WithTimeout(ctx, s.sendTimeout())
 	defer cancel()
 
 	// Create a new span for the HTTP request
@@ -105,7 +148,7 @@ func (s *driverService) sendToTrackAnalyzer(ctx context.Context, point models.Gp
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to marshal point")
-		logger.Error("failed to marshal point",
+		logger.ErrorContext(ctx, "failed to marshal point",
 			"error", err,
 			"latitude", point.Location.Latitude,
 			"longitude", point.Location.Longitude,
@@ -119,7 +162,7 @@ func (s *driverService) sendToTrackAnalyzer(ctx context.Context, point models.Gp
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to create request")
-		logger.Error("failed to create request",
+		logger.ErrorContext(ctx, "failed to create request",
 			"error", err,
 			"url", s.trackingURL,
 		)
@@ -127,15 +170,31 @@ func (s *driverService) sendToTrackAnalyzer(ctx context.Context, point models.Gp
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	// The key identifies the point, so the request may be retried
+	req.Header.Set("Idempotency-Key", idempotencyKey)
 
 	// Inject trace context into HTTP headers
 	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	resp, err := http.DefaultClient.Do(req)
+	logger.DebugContext(ctx, "sending point to track analyzer",
+		"url", req.URL.String(),
+		"payload", string(data),
+	)
+
+	resp, err := s.client.Do(req)
+	if errors.Is(err, breaker.ErrOpen) {
+		// The track analyzer is known to be down, the call was not made
+		span.SetStatus(codes.Error, "circuit breaker is open")
+		logger.WarnContext(ctx, "track analyzer circuit breaker is open",
+			"error", err,
+			"url", req.URL.String(),
+		)
+		return fmt.Errorf("failed to send request: %w", err)
+	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to send request")
-		logger.Error("failed to send request",
+		logger.ErrorContext(ctx, "failed to send request",
 			"error", err,
 			"url", req.URL.String(),
 		)
@@ -145,13 +204,14 @@ func (s *driverService) sendToTrackAnalyzer(ctx context.Context, point models.Gp
 
 	if resp.StatusCode != http.StatusOK {
 		span.SetStatus(codes.Error, "unexpected status code from track analyzer")
-		logger.Error("unexpected status code from track analyzer",
+		logger.ErrorContext(ctx, "unexpected status code from track analyzer",
 			"statusCode", resp.StatusCode,
 			"url", req.URL.String(),
 		)
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
+	logger.DebugContext(ctx, "point sent to track analyzer", "statusCode", resp.StatusCode)
 	span.SetStatus(codes.Ok, "sent location")
 	return nil
 }
@@ -177,10 +237,12 @@ func (s *driverService) FindNearby(ctx context.Context, lat, lon float64, radius
 	}).Result()
 
 	if err != nil {
-		logger.Error("failed to query locations", "error", err)
+		logger.ErrorContext(ctx, "failed to query locations", "error", err)
 		return nil, fmt.Errorf("failed to query locations: %w", err)
 	}
 
+	logger.DebugContext(ctx, "found locations in radius", "count", len(locations))
+
 	drivers := make([]models.Driver, 0, len(locations))
 	for _, loc := range locations {
 		key := fmt.Sprintf("driver:%s", loc.Name)
@@ -210,12 +272,12 @@ func (s *driverService) RemoveDriver(ctx context.Context, driverID string) error
 	key := fmt.Sprintf("driver:%s", driverID)
 
 	if err := s.redis.ZRem(ctx, geoKey, driverID).Err(); err != nil {
-		logger.Error("failed to remove from geo index", "error", err)
+		logger.ErrorContext(ctx, "failed to remove from geo index", "error", err)
 		return fmt.Errorf("failed to remove from geo index: %w", err)
 	}
 
 	if err := s.redis.Del(ctx, key).Err(); err != nil {
-		logger.Error("failed to remove driver data", "error", err)
+		logger.ErrorContext(ctx, "failed to remove driver data", "error", err)
 		return fmt.Errorf("failed to remove driver data: %w", err)
 	}
 
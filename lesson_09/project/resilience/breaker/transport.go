@@ -0,0 +1,158 @@
+// Package breaker is an http.RoundTripper with a circuit breaker per host.
+// State, transitions and rejected calls are reported as OTel metrics,
+// rejected calls also as events of the current span.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	stateKey = attribute.Key("circuit.state")
+	nameKey  = attribute.Key("circuit.name")
+	fromKey  = attribute.Key("circuit.state.from")
+	toKey    = attribute.Key("circuit.state.to")
+)
+
+// ErrOpen is returned for calls rejected by an open or a half-open breaker
+var ErrOpen = errors.New("circuit breaker rejected the call")
+
+// Options settings of the transport
+type Options struct {
+	// Settings of every breaker. Name is replaced by the host,
+	// OnStateChange is called after the transition is recorded.
+	Settings gobreaker.Settings
+	// IsFailure tells whether a call counts against the breaker.
+	// DefaultIsFailure by default.
+	IsFailure func(resp *http.Response, err error) bool
+	// MeterProvider for the breaker metrics, the global one by default
+	MeterProvider metric.MeterProvider
+}
+
+// DefaultIsFailure counts 5xx, 429 and transport errors: timeouts of the client
+// or of the request context, refused and reset connections.
+// A call canceled by the caller says nothing about the host and is not a failure.
+func DefaultIsFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// Transport is an http.RoundTripper with a circuit breaker per host
+type Transport struct {
+	base http.RoundTripper
+	opts Options
+
+	mu       sync.Mutex
+	breakers map[string]*gobreaker.TwoStepCircuitBreaker
+
+	transitions metric.Int64Counter
+	rejected    metric.Int64Counter
+}
+
+// NewTransport wraps base, http.DefaultTransport if nil
+func NewTransport(base http.RoundTripper, opts Options) (*Transport, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = DefaultIsFailure
+	}
+	if opts.MeterProvider == nil {
+		opts.MeterProvider = otel.GetMeterProvider()
+	}
+	t := &Transport{
+		base:     base,
+		opts:     opts,
+		breakers: make(map[string]*gobreaker.TwoStepCircuitBreaker),
+	}
+
+	meter := opts.MeterProvider.Meter("example/breaker")
+	var err error
+	if t.transitions, err = meter.Int64Counter("circuit_breaker.transitions",
+		metric.WithDescription("Circuit breaker state transitions"),
+	); err != nil {
+		return nil, err
+	}
+	if t.rejected, err = meter.Int64Counter("circuit_breaker.rejected",
+		metric.WithDescription("Calls rejected by an open or a half-open circuit breaker"),
+	); err != nil {
+		return nil, err
+	}
+	state, err := meter.Int64ObservableGauge("circuit_breaker.state",
+		metric.WithDescription("Circuit breaker state: 0 closed, 1 half-open, 2 open"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for host, cb := range t.breakers {
+			s := cb.State()
+			o.ObserveInt64(state, int64(s), metric.WithAttributes(nameKey.String(host), stateKey.String(s.String())))
+		}
+		return nil
+	}, state); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RoundTrip sends the request unless the breaker of its host is open
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	cb := t.breaker(host)
+
+	done, err := cb.Allow()
+	if err != nil {
+		state := cb.State().String()
+		attrs := []attribute.KeyValue{nameKey.String(host), stateKey.String(state)}
+		t.rejected.Add(req.Context(), 1, metric.WithAttributes(attrs...))
+		trace.SpanFromContext(req.Context()).AddEvent("circuit_breaker.rejected", trace.WithAttributes(attrs...))
+		return nil, fmt.Errorf("%w: %s: %w", ErrOpen, host, err)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	done(!t.opts.IsFailure(resp, err))
+	return resp, err
+}
+
+// State returns the breaker state of host
+func (t *Transport) State(host string) gobreaker.State {
+	return t.breaker(host).State()
+}
+
+func (t *Transport) breaker(host string) *gobreaker.TwoStepCircuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cb, ok := t.breakers[host]; ok {
+		return cb
+	}
+
+	settings := t.opts.Settings
+	settings.Name = host
+	onStateChange := settings.OnStateChange
+	settings.OnStateChange = func(name string, from, to gobreaker.State) {
+		t.transitions.Add(context.Background(), 1, metric.WithAttributes(
+			nameKey.String(name), fromKey.String(from.String()), toKey.String(to.String()),
+		))
+		if onStateChange != nil {
+			onStateChange(name, from, to)
+		}
+	}
+	cb := gobreaker.NewTwoStepCircuitBreaker(settings)
+	t.breakers[host] = cb
+	return cb
+}
@@ -0,0 +1,197 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTransportOpensAndRecovers(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	reader := sdkmetric.NewManualReader()
+	spans := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer("test")
+
+	transport, err := NewTransport(nil, Options{
+		Settings: gobreaker.Settings{
+			Timeout:     50 * time.Millisecond,
+			ReadyToTrip: func(counts gobreaker.Counts) bool { return counts.ConsecutiveFailures >= 3 },
+		},
+		MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+
+	get := func() (*http.Response, error) {
+		ctx, span := tracer.Start(context.Background(), "call")
+		defer span.End()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	// 5xx responses reach the caller and count as failures
+	for range 3 {
+		resp, err := get()
+		if err != nil || resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("closed breaker: %v, %v, want the 500 response", resp, err)
+		}
+	}
+	if state := transport.State(host); state != gobreaker.StateOpen {
+		t.Fatalf("state after 3 failures = %s, want open", state)
+	}
+
+	if _, err := get(); !errors.Is(err, ErrOpen) || !errors.Is(err, gobreaker.ErrOpenState) {
+		t.Fatalf("open breaker error = %v, want ErrOpen", err)
+	}
+	ended := spans.Ended()
+	events := ended[len(ended)-1].Events()
+	if len(events) != 1 || events[0].Name != "circuit_breaker.rejected" ||
+		!hasAttr(events[0].Attributes, attribute.String("circuit.state", "open")) {
+		t.Fatalf("span events of a rejected call = %+v, want circuit_breaker.rejected with circuit.state=open", events)
+	}
+
+	status.Store(http.StatusOK)
+	time.Sleep(60 * time.Millisecond)
+	if resp, err := get(); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("half-open probe: %v, %v, want 200", resp, err)
+	}
+	if state := transport.State(host); state != gobreaker.StateClosed {
+		t.Fatalf("state after a successful probe = %s, want closed", state)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			for _, dp := range data.DataPoints {
+				to, _ := dp.Attributes.Value("circuit.state.to")
+				got[m.Name+" "+to.AsString()] += dp.Value
+			}
+		case metricdata.Gauge[int64]:
+			got[m.Name] = data.DataPoints[0].Value
+		}
+	}
+	want := map[string]int64{
+		"circuit_breaker.transitions open":      1,
+		"circuit_breaker.transitions half-open": 1,
+		"circuit_breaker.transitions closed":    1,
+		"circuit_breaker.rejected ":             1,
+		"circuit_breaker.state":                 int64(gobreaker.StateClosed),
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %d, want %d (all: %v)", name, got[name], value, got)
+		}
+	}
+}
+
+func TestTransportBreakerPerHost(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	var changes []string
+	transport, err := NewTransport(nil, Options{
+		Settings: gobreaker.Settings{
+			Timeout:     time.Minute,
+			ReadyToTrip: func(counts gobreaker.Counts) bool { return counts.ConsecutiveFailures >= 1 },
+			OnStateChange: func(name string, from, to gobreaker.State) {
+				changes = append(changes, name+" "+from.String()+" -> "+to.String())
+			},
+		},
+		MeterProvider: sdkmetric.NewMeterProvider(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(failing.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, err := client.Get(failing.URL); !errors.Is(err, ErrOpen) {
+		t.Fatalf("second call to the failing host: %v, want ErrOpen", err)
+	}
+	// The open breaker of one host does not reject calls to another
+	resp, err = client.Get(healthy.URL)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("call to the healthy host: %v, %v, want 200", resp, err)
+	}
+	resp.Body.Close()
+
+	// The caller's OnStateChange is kept and gets the host as the name
+	failingHost := strings.TrimPrefix(failing.URL, "http://")
+	if len(changes) != 1 || changes[0] != failingHost+" closed -> open" {
+		t.Errorf("state changes = %v, want only %s closed -> open", changes, failingHost)
+	}
+}
+
+func TestDefaultIsFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   bool
+	}{
+		{"ok", http.StatusOK, nil, false},
+		{"client error", http.StatusNotFound, nil, false},
+		{"too many requests", http.StatusTooManyRequests, nil, true},
+		{"server error", http.StatusBadGateway, nil, true},
+		{"timeout", 0, context.DeadlineExceeded, true},
+		{"canceled by caller", 0, context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if got := DefaultIsFailure(resp, tt.err); got != tt.want {
+				t.Errorf("DefaultIsFailure = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func hasAttr(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, a := range attrs {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
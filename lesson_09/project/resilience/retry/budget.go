@@ -0,0 +1,59 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// Budget limits retries to a share of the traffic. Every request deposits Ratio
+// tokens and every retry or hedge withdraws one, so while the downstream is down
+// retries add at most Ratio more load instead of multiplying it by the number of attempts.
+// MinPerSecond tokens are added over time for low traffic.
+type Budget struct {
+	ratio        float64
+	minPerSecond float64
+	max          float64
+
+	mu      sync.Mutex
+	tokens  float64
+	updated time.Time
+}
+
+// NewBudget allows ratio retries per request (0.1 is 10% of traffic),
+// but at least minPerSecond retries per second
+func NewBudget(ratio, minPerSecond float64) *Budget {
+	return &Budget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		// Unused budget is kept for 10 seconds of the minimum rate and 100 requests
+		max:     minPerSecond*10 + ratio*100,
+		tokens:  minPerSecond * 10,
+		updated: time.Now(),
+	}
+}
+
+// deposit records a request
+func (b *Budget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens = min(b.tokens+b.ratio, b.max)
+}
+
+// withdraw takes a token for a retry, false if the budget is exhausted
+func (b *Budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *Budget) refill() {
+	now := time.Now()
+	b.tokens = min(b.tokens+now.Sub(b.updated).Seconds()*b.minPerSecond, b.max)
+	b.updated = now
+}
@@ -0,0 +1,359 @@
+// Package retry is an http.RoundTripper with retries, exponential backoff with jitter,
+// a retry budget, Retry-After handling and hedged requests. Every attempt is a child
+// span of the request span with the http.resend_count attribute.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AttemptBaggageKey is the baggage member with the number of the attempt.
+// A service handling a retried request does not retry its own calls:
+// retries at every level of a call chain multiply the load on the last service.
+const AttemptBaggageKey = "retry.attempt"
+
+// Options settings of the transport
+type Options struct {
+	// MaxAttempts including the first one, 3 by default.
+	// Only idempotent requests are retried: GET, HEAD, OPTIONS, TRACE, PUT, DELETE
+	// and requests with the Idempotency-Key header.
+	MaxAttempts int
+	// AttemptTimeout limits every attempt, so that a hung one leaves time for a retry
+	// within the deadline of the request. 0 means no limit.
+	AttemptTimeout time.Duration
+	// AttemptTimeoutFunc, if set, is called for every request instead of AttemptTimeout,
+	// so that the limit can be changed without recreating the transport
+	AttemptTimeoutFunc func() time.Duration
+	// InitialBackoff before the first retry, 100ms by default. The backoff doubles
+	// with every retry, the actual wait is random from 0 to the backoff (full jitter).
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff, 2s by default
+	MaxBackoff time.Duration
+	// MaxRetryAfter is the longest Retry-After the transport waits for, 5s by default.
+	// A response asking to wait longer is returned to the caller.
+	MaxRetryAfter time.Duration
+	// Budget limits retries and hedges, 10% of requests plus 1 per second by default
+	Budget *Budget
+	// HedgeDelay enables hedging of safe requests (GET, HEAD, OPTIONS, TRACE): if there is no response
+	// within HedgeDelay another attempt is sent in parallel and the first response wins.
+	// Set it around the p95 latency of the downstream. 0 disables hedging.
+	HedgeDelay time.Duration
+	// MaxHedges is the number of extra parallel attempts, 1 by default
+	MaxHedges int
+	// ShouldRetry tells whether the result of an attempt is worth retrying,
+	// DefaultShouldRetry by default
+	ShouldRetry func(resp *http.Response, err error) bool
+	// TracerProvider for the attempt spans, the global one by default
+	TracerProvider trace.TracerProvider
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 3
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = 100 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 2 * time.Second
+	}
+	if o.MaxRetryAfter <= 0 {
+		o.MaxRetryAfter = 5 * time.Second
+	}
+	if o.Budget == nil {
+		o.Budget = NewBudget(0.1, 1)
+	}
+	if o.MaxHedges <= 0 {
+		o.MaxHedges = 1
+	}
+	if o.ShouldRetry == nil {
+		o.ShouldRetry = DefaultShouldRetry
+	}
+	if o.TracerProvider == nil {
+		o.TracerProvider = otel.GetTracerProvider()
+	}
+	return o
+}
+
+// DefaultShouldRetry retries transport errors, timeouts of an attempt, 429, 502, 503 and 504.
+// Other 5xx usually mean a bug that a retry does not fix. A request canceled by the caller is not retried.
+func DefaultShouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Transport is an http.RoundTripper that retries and hedges requests
+type Transport struct {
+	base   http.RoundTripper
+	opts   Options
+	tracer trace.Tracer
+}
+
+// NewTransport wraps base, http.DefaultTransport if nil
+func NewTransport(base http.RoundTripper, opts Options) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	opts = opts.withDefaults()
+	return &Transport{
+		base:   base,
+		opts:   opts,
+		tracer: opts.TracerProvider.Tracer("example/retry"),
+	}
+}
+
+// result of an attempt
+type result struct {
+	resp        *http.Response
+	err         error
+	resendCount int
+	// cancel cancels the context of the attempt, the winner's is canceled when its body is closed
+	cancel context.CancelFunc
+}
+
+func (r result) discard() {
+	if r.resp != nil {
+		io.Copy(io.Discard, r.resp.Body)
+		r.resp.Body.Close()
+	}
+	r.cancel()
+}
+
+// RoundTrip sends the request, retrying it while the result is retryable,
+// attempts and budget allow
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	t.opts.Budget.deposit()
+
+	maxAttempts := t.opts.MaxAttempts
+	if !isIdempotent(req.Method) && req.Header.Get("Idempotency-Key") == "" {
+		maxAttempts = 1
+	}
+	// A request with a body can be resent only if the body can be read again
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxAttempts = 1
+	}
+	if attempt, _ := strconv.Atoi(baggage.FromContext(ctx).Member(AttemptBaggageKey).Value()); attempt > 0 {
+		maxAttempts = 1
+	}
+	hedge := t.opts.HedgeDelay > 0 && isSafe(req.Method) && maxAttempts > 1
+
+	var (
+		sent int // attempts sent, the resend count of the next one
+		last result
+	)
+	backoff := t.opts.InitialBackoff
+	for {
+		if hedge {
+			last = t.hedged(req, &sent, maxAttempts)
+		} else {
+			ctx, cancel := context.WithCancel(ctx)
+			last = t.attempt(ctx, cancel, req, sent, false)
+			sent++
+		}
+		if !t.opts.ShouldRetry(last.resp, last.err) || sent >= maxAttempts || ctx.Err() != nil {
+			return last.resp, last.err
+		}
+
+		wait := time.Duration(rand.Int64N(int64(backoff) + 1))
+		backoff = min(backoff*2, t.opts.MaxBackoff)
+		if last.resp != nil {
+			if retryAfter, ok := parseRetryAfter(last.resp.Header.Get("Retry-After")); ok {
+				if retryAfter > t.opts.MaxRetryAfter {
+					return last.resp, last.err
+				}
+				wait = retryAfter
+			}
+		}
+		if !t.opts.Budget.withdraw() {
+			return last.resp, last.err
+		}
+		last.discard()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// hedged sends the request and up to MaxHedges copies HedgeDelay apart.
+// It returns the first result that should not be retried and cancels the others,
+// or the last result if all of them should be retried.
+func (t *Transport) hedged(req *http.Request, sent *int, maxAttempts int) result {
+	results := make(chan result, 1+t.opts.MaxHedges)
+	cancels := make(map[int]context.CancelFunc)
+	launch := func(hedge bool) {
+		ctx, cancel := context.WithCancel(req.Context())
+		resendCount := *sent
+		cancels[resendCount] = cancel
+		*sent++
+		go func() { results <- t.attempt(ctx, cancel, req, resendCount, hedge) }()
+	}
+
+	launch(false)
+	inFlight, hedges := 1, 0
+	timer := time.NewTimer(t.opts.HedgeDelay)
+	defer timer.Stop()
+
+	var last result
+	for inFlight > 0 {
+		select {
+		case <-timer.C:
+			if hedges < t.opts.MaxHedges && *sent < maxAttempts && t.opts.Budget.withdraw() {
+				launch(true)
+				inFlight++
+				hedges++
+				timer.Reset(t.opts.HedgeDelay)
+			}
+		case r := <-results:
+			inFlight--
+			if last.cancel != nil {
+				last.discard()
+			}
+			if !t.opts.ShouldRetry(r.resp, r.err) {
+				// The winner's context is canceled when its body is closed
+				for resendCount, cancel := range cancels {
+					if resendCount != r.resendCount {
+						cancel()
+					}
+				}
+				go drain(results, inFlight)
+				return r
+			}
+			last = r
+		}
+	}
+	return last
+}
+
+func drain(results <-chan result, n int) {
+	for range n {
+		(<-results).discard()
+	}
+}
+
+// attempt sends the request once in a child span
+func (t *Transport) attempt(ctx context.Context, cancel context.CancelFunc, req *http.Request, resendCount int, hedge bool) result {
+	timeout := t.opts.AttemptTimeout
+	if t.opts.AttemptTimeoutFunc != nil {
+		timeout = t.opts.AttemptTimeoutFunc()
+	}
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancelParent := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelParent()
+		}
+	}
+	ctx, span := t.tracer.Start(ctx, "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("url.full", req.URL.String()),
+	)
+	if resendCount > 0 {
+		span.SetAttributes(attribute.Int("http.resend_count", resendCount))
+		if member, err := baggage.NewMember(AttemptBaggageKey, strconv.Itoa(resendCount)); err == nil {
+			if bag, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+				ctx = baggage.ContextWithBaggage(ctx, bag)
+			}
+		}
+	}
+	if hedge {
+		span.SetAttributes(attribute.Bool("http.hedge", true))
+	}
+
+	attemptReq := req.Clone(ctx)
+	if resendCount > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			span.End()
+			return result{err: fmt.Errorf("get body for a retry: %w", err), resendCount: resendCount, cancel: cancel}
+		}
+		attemptReq.Body = body
+	}
+	// The attempt span is the parent of the server span downstream
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(attemptReq.Header))
+
+	resp, err := t.base.RoundTrip(attemptReq)
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		cancel()
+	default:
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	}
+	span.End()
+	return result{resp: resp, err: err, resendCount: resendCount, cancel: cancel}
+}
+
+// cancelOnClose cancels the context of the attempt when the caller is done with the body
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// isSafe methods only read, sending them in parallel is harmless
+func isSafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// isIdempotent methods have the same effect when sent twice
+func isIdempotent(method string) bool {
+	return isSafe(method) || method == http.MethodPut || method == http.MethodDelete
+}
+
+// parseRetryAfter parses delay-seconds or an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,254 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// statuses replies with the given statuses in turn, the last one repeats
+func statuses(codes ...int) (http.Handler, *atomic.Int32) {
+	var calls atomic.Int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		code := codes[min(n, len(codes)-1)]
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(code)
+		io.WriteString(w, r.Header.Get("Baggage"))
+	}), &calls
+}
+
+func newTransport(spans *tracetest.SpanRecorder, opts Options) *Transport {
+	opts.InitialBackoff = time.Millisecond
+	if opts.Budget == nil {
+		opts.Budget = NewBudget(1, 100)
+	}
+	if spans != nil {
+		opts.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	}
+	return NewTransport(nil, opts)
+}
+
+func TestRetriesWithSpans(t *testing.T) {
+	handler, calls := statuses(http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	spans := tracetest.NewSpanRecorder()
+	client := &http.Client{Transport: newTransport(spans, Options{})}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("status %d after %d calls, want 200 after 3", resp.StatusCode, calls.Load())
+	}
+	// The attempt number goes downstream so that it does not retry on its own
+	if !strings.Contains(string(body), AttemptBaggageKey+"=2") {
+		t.Errorf("baggage of the last attempt = %q, want %s=2", body, AttemptBaggageKey)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("%d spans, want one per attempt", len(ended))
+	}
+	for i, span := range ended {
+		var resendCount int64 = -1
+		for _, attr := range span.Attributes() {
+			if attr.Key == "http.resend_count" {
+				resendCount = attr.Value.AsInt64()
+			}
+		}
+		if i == 0 && resendCount != -1 || i > 0 && resendCount != int64(i) {
+			t.Errorf("span %d http.resend_count = %d", i, resendCount)
+		}
+	}
+}
+
+func TestDoesNotRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler []int
+		opts    Options
+		request func(url string) *http.Request
+		calls   int32
+	}{
+		{
+			name:    "not retryable status",
+			handler: []int{http.StatusInternalServerError, http.StatusOK},
+			request: func(url string) *http.Request { r, _ := http.NewRequest(http.MethodGet, url, nil); return r },
+			calls:   1,
+		},
+		{
+			name:    "post without idempotency key",
+			handler: []int{http.StatusServiceUnavailable, http.StatusOK},
+			request: func(url string) *http.Request {
+				r, _ := http.NewRequest(http.MethodPost, url, strings.NewReader("{}"))
+				return r
+			},
+			calls: 1,
+		},
+		{
+			name:    "budget exhausted",
+			handler: []int{http.StatusServiceUnavailable, http.StatusOK},
+			opts:    Options{Budget: NewBudget(0, 0)},
+			request: func(url string) *http.Request { r, _ := http.NewRequest(http.MethodGet, url, nil); return r },
+			calls:   1,
+		},
+		{
+			name:    "retried upstream",
+			handler: []int{http.StatusServiceUnavailable, http.StatusOK},
+			request: func(url string) *http.Request {
+				member, _ := baggage.NewMember(AttemptBaggageKey, "1")
+				bag, _ := baggage.New(member)
+				r, _ := http.NewRequestWithContext(baggage.ContextWithBaggage(context.Background(), bag), http.MethodGet, url, nil)
+				return r
+			},
+			calls: 1,
+		},
+		{
+			name:    "post with idempotency key",
+			handler: []int{http.StatusServiceUnavailable, http.StatusOK},
+			request: func(url string) *http.Request {
+				r, _ := http.NewRequest(http.MethodPost, url, strings.NewReader("{}"))
+				r.Header.Set("Idempotency-Key", "42")
+				return r
+			},
+			calls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, calls := statuses(tt.handler...)
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			resp, err := newTransport(nil, tt.opts).RoundTrip(tt.request(server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if calls.Load() != tt.calls {
+				t.Errorf("calls = %d, want %d", calls.Load(), tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resp, err := newTransport(nil, Options{}).RoundTrip(httptest.NewRequest(http.MethodGet, server.URL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Fatalf("status %d after %d calls, want the 503 returned without waiting 2 minutes", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	for name, opts := range map[string]Options{
+		"static": {AttemptTimeout: 50 * time.Millisecond},
+		// The func wins over the static value, it is read for every attempt
+		"func": {AttemptTimeout: time.Minute, AttemptTimeoutFunc: func() time.Duration { return 50 * time.Millisecond }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			calls.Store(0)
+			client := &http.Client{Transport: newTransport(nil, opts)}
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != "ok" || calls.Load() != 2 {
+				t.Fatalf("body %q after %d calls, want the second attempt to succeed", body, calls.Load())
+			}
+		})
+	}
+}
+
+func TestHedging(t *testing.T) {
+	var calls atomic.Int32
+	firstCanceled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+				close(firstCanceled)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		io.WriteString(w, "hedge")
+	}))
+	defer server.Close()
+
+	spans := tracetest.NewSpanRecorder()
+	client := &http.Client{Transport: newTransport(spans, Options{HedgeDelay: 20 * time.Millisecond})}
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hedge" || time.Since(start) > time.Second {
+		t.Fatalf("body %q after %v, want the hedged response without waiting for the slow one", body, time.Since(start))
+	}
+
+	select {
+	case <-firstCanceled:
+	case <-time.After(time.Second):
+		t.Fatal("the slow attempt was not canceled")
+	}
+
+	var hedged bool
+	for _, span := range spans.Ended() {
+		for _, attr := range span.Attributes() {
+			if attr == attribute.Bool("http.hedge", true) {
+				hedged = true
+			}
+		}
+	}
+	if !hedged {
+		t.Error("no span with http.hedge=true")
+	}
+}
@@ -0,0 +1,193 @@
+// Package configstore loads a typed configuration and reloads it at runtime.
+//
+// Values come from the defaults, then the YAML file from CONFIG_FILE, then the
+// environment, each source overriding the previous one. Fields tagged reload:"true"
+// are applied on SIGHUP without a restart, see Store. Fields tagged secret:"true"
+// are redacted when the configuration is shown, see Redacted.
+package configstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable with the path to the YAML file
+const FileEnv = "CONFIG_FILE"
+
+// Mask replaces the values of the secrets
+const Mask = "[REDACTED]"
+
+// Config is a pointer to a configuration struct with yaml and envconfig tags
+type Config interface {
+	// Validate returns all the invalid values at once, named as environment variables
+	Validate() error
+}
+
+// Load overrides the defaults in cfg with the file and the environment, then validates it
+func Load(cfg Config) error {
+	if path := os.Getenv(FileEnv); path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return err
+		}
+	}
+	// Without default tags envconfig keeps the values of the unset variables
+	if err := envconfig.Process("", cfg); err != nil {
+		return fmt.Errorf("environment: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	return nil
+}
+
+func loadFile(path string, cfg Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	// A misspelled key would silently keep the default
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Store holds the current configuration of type T and reloads it
+type Store[T any] struct {
+	current atomic.Pointer[T]
+	load    func() (*T, error)
+	logger  *slog.Logger
+
+	mu       sync.Mutex
+	onReload []func(*T)
+}
+
+// NewStore creates a store with cfg as the current configuration,
+// load is called to read the configuration again on Reload
+func NewStore[T any](cfg *T, load func() (*T, error), logger *slog.Logger) *Store[T] {
+	s := &Store[T]{load: load, logger: logger}
+	s.current.Store(cfg)
+	return s
+}
+
+// Get returns the current configuration, it must not be modified
+func (s *Store[T]) Get() *T {
+	return s.current.Load()
+}
+
+// OnReload registers fn to be called with the new configuration after a reload
+func (s *Store[T]) OnReload(fn func(*T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReload = append(s.onReload, fn)
+}
+
+// Reload loads the configuration again and applies the fields tagged reload:"true".
+// The other fields are used at startup only: their changes are logged and ignored.
+// On an error the current configuration is kept.
+func (s *Store[T]) Reload() error {
+	next, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.current.Load()
+	applied := *current
+	var changed, ignored []string
+	for _, field := range fields[T]() {
+		nextValue := reflect.ValueOf(next).Elem().FieldByIndex(field.Index)
+		if reflect.DeepEqual(reflect.ValueOf(current).Elem().FieldByIndex(field.Index).Interface(), nextValue.Interface()) {
+			continue
+		}
+		name := field.Tag.Get("envconfig")
+		if field.Tag.Get("reload") != "true" {
+			ignored = append(ignored, name)
+			continue
+		}
+		reflect.ValueOf(&applied).Elem().FieldByIndex(field.Index).Set(nextValue)
+		changed = append(changed, name)
+	}
+	if len(ignored) > 0 {
+		s.logger.Warn("config changes require a restart, ignored", "fields", ignored)
+	}
+	if len(changed) == 0 {
+		s.logger.Info("config reloaded, nothing changed")
+		return nil
+	}
+
+	s.current.Store(&applied)
+	for _, fn := range s.onReload {
+		fn(&applied)
+	}
+	s.logger.Info("config reloaded", "changed", changed)
+	return nil
+}
+
+// ReloadOnSignal reloads the configuration on every signal until ctx is done
+func (s *Store[T]) ReloadOnSignal(ctx context.Context, signals ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			if err := s.Reload(); err != nil {
+				s.logger.Error("config reload failed, keeping the current config", "error", err)
+			}
+		}
+	}
+}
+
+// Handler serves the current configuration as JSON with the secrets redacted
+func (s *Store[T]) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Redacted(s.Get()))
+	})
+}
+
+// Redacted returns the configuration keyed by the file keys, with non-empty
+// fields tagged secret:"true" replaced
+func Redacted[T any](cfg *T) map[string]any {
+	value := reflect.ValueOf(cfg).Elem()
+	result := make(map[string]any)
+	for _, field := range fields[T]() {
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		fieldValue := value.FieldByIndex(field.Index)
+		switch {
+		case field.Tag.Get("secret") == "true" && !fieldValue.IsZero():
+			result[key] = Mask
+		case fieldValue.Type().String() == "time.Duration":
+			result[key] = fieldValue.Interface().(fmt.Stringer).String()
+		default:
+			result[key] = fieldValue.Interface()
+		}
+	}
+	return result
+}
+
+func fields[T any]() []reflect.StructField {
+	return reflect.VisibleFields(reflect.TypeFor[T]())
+}
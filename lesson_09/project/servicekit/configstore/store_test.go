@@ -0,0 +1,105 @@
+package configstore
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Addr     string        `yaml:"addr" envconfig:"TEST_ADDR"`
+	Password string        `yaml:"password" envconfig:"TEST_PASSWORD" secret:"true"`
+	Timeout  time.Duration `yaml:"timeout" envconfig:"TEST_TIMEOUT" reload:"true"`
+}
+
+func (c *testConfig) Validate() error {
+	if c.Timeout <= 0 {
+		return errors.New("TEST_TIMEOUT must be positive")
+	}
+	return nil
+}
+
+func loadTestConfig() (*testConfig, error) {
+	cfg := &testConfig{Addr: ":8080", Timeout: time.Second}
+	if err := Load(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv(FileEnv, writeFile(t, "addr: :9000\ntimeout: 2s\n"))
+	t.Setenv("TEST_TIMEOUT", "3s")
+	cfg, err := loadTestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The environment overrides the file, the file overrides the defaults
+	if cfg.Addr != ":9000" || cfg.Timeout != 3*time.Second {
+		t.Errorf("cfg = %+v", cfg)
+	}
+
+	t.Setenv("TEST_TIMEOUT", "0s")
+	if _, err := loadTestConfig(); err == nil || !strings.Contains(err.Error(), "TEST_TIMEOUT must be positive") {
+		t.Errorf("err = %v, want the validation error", err)
+	}
+	t.Setenv(FileEnv, writeFile(t, "adr: :9000\n"))
+	if _, err := loadTestConfig(); err == nil || !strings.Contains(err.Error(), "adr") {
+		t.Errorf("err = %v, want the misspelled key reported", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeFile(t, "timeout: 2s\n")
+	t.Setenv(FileEnv, path)
+	cfg, err := loadTestConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(cfg, loadTestConfig, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var reloaded *testConfig
+	store.OnReload(func(cfg *testConfig) { reloaded = cfg })
+
+	if err := os.WriteFile(path, []byte("timeout: 5s\naddr: :9000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	// The timeout is applied, the address needs a restart
+	if got := store.Get(); got.Timeout != 5*time.Second || got.Addr != ":8080" || reloaded != got {
+		t.Errorf("after reload cfg = %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("timeout: 0s\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil || store.Get().Timeout != 5*time.Second {
+		t.Errorf("reload of an invalid config: err = %v, timeout %s, want it kept", err, store.Get().Timeout)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	redacted := Redacted(&testConfig{Addr: ":8080", Password: "secret", Timeout: time.Second})
+	if redacted["password"] != Mask || redacted["timeout"] != "1s" || redacted["addr"] != ":8080" {
+		t.Errorf("Redacted = %v", redacted)
+	}
+	// An unset secret is shown as empty, so that it is clear it is not set
+	if got := Redacted(&testConfig{})["password"]; got != "" {
+		t.Errorf("unset password = %v, want empty", got)
+	}
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// LivenessService is the grpc.health.v1 service name of the liveness check,
+// the empty name is the readiness of the whole server
+const LivenessService = "liveness"
+
+type grpcServer struct {
+	healthpb.UnimplementedHealthServer
+	health *Health
+}
+
+// GRPCServer serves the checks as grpc.health.v1
+func (h *Health) GRPCServer() healthpb.HealthServer {
+	return &grpcServer{health: h}
+}
+
+func (s *grpcServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	servingStatus, err := s.status(ctx, req.GetService())
+	if err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: servingStatus}, nil
+}
+
+// Watch sends the status when it changes, checking it every CacheTTL
+func (s *grpcServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ticker := time.NewTicker(s.health.opts.CacheTTL)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		servingStatus, err := s.status(stream.Context(), req.GetService())
+		if status.Code(err) == codes.NotFound {
+			// As the reference implementation, an unknown service is reported and watched further
+			servingStatus = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		} else if err != nil {
+			return err
+		}
+		if servingStatus != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: servingStatus}); err != nil {
+				return err
+			}
+			last = servingStatus
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *grpcServer) status(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	switch service {
+	case LivenessService:
+		return healthpb.HealthCheckResponse_SERVING, nil
+	case "":
+		if s.health.Ready(ctx).Ready {
+			return healthpb.HealthCheckResponse_SERVING, nil
+		}
+		return healthpb.HealthCheckResponse_NOT_SERVING, nil
+	}
+	return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, status.Errorf(codes.NotFound, "unknown service %q", service)
+}
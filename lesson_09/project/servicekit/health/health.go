@@ -0,0 +1,166 @@
+// Package health runs liveness and readiness checks of a service and serves them
+// over HTTP (/livez, /readyz) and grpc.health.v1.
+//
+// Liveness only tells that the process is able to serve: restarting it does not help
+// when Redis is down, so dependencies affect readiness only.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckFunc checks a dependency, it must return when ctx is done
+type CheckFunc func(ctx context.Context) error
+
+// Check is a dependency of the service
+type Check struct {
+	Name string
+	Func CheckFunc
+	// Timeout of one run, Options.Timeout by default
+	Timeout time.Duration
+	// Optional checks are reported but do not make the service unready:
+	// it keeps working without the dependency, e.g. without telemetry export.
+	Optional bool
+}
+
+// Options of the checks
+type Options struct {
+	// Timeout of a check, 1s by default
+	Timeout time.Duration
+	// CacheTTL is how long a result is reused, 5s by default, so that frequent
+	// probes from several sources do not multiply the load on the dependencies
+	CacheTTL time.Duration
+}
+
+// Health keeps the checks and the draining state
+type Health struct {
+	opts     Options
+	checks   []*check
+	draining atomic.Bool
+}
+
+type check struct {
+	Check
+
+	mu        sync.Mutex
+	result    Result
+	checkedAt time.Time
+}
+
+// Result of a check
+type Result struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	Optional  bool      `json:"optional,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the readiness of the service with the results of all checks
+type Report struct {
+	Ready    bool     `json:"ready"`
+	Draining bool     `json:"draining,omitempty"`
+	Checks   []Result `json:"checks"`
+}
+
+func New(opts Options) *Health {
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = 5 * time.Second
+	}
+	return &Health{opts: opts}
+}
+
+// Register adds a check, it must be called before the checks are served
+func (h *Health) Register(c Check) {
+	if c.Timeout <= 0 {
+		c.Timeout = h.opts.Timeout
+	}
+	h.checks = append(h.checks, &check{Check: c})
+}
+
+// Drain makes the service unready for good. It is called first on shutdown, so that
+// load balancers stop sending new requests while the running ones complete.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Ready runs the checks in parallel, reusing results younger than CacheTTL
+func (h *Health) Ready(ctx context.Context) Report {
+	report := Report{
+		Ready:    !h.draining.Load(),
+		Draining: h.draining.Load(),
+		Checks:   make([]Result, len(h.checks)),
+	}
+	var wg sync.WaitGroup
+	for i, c := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = c.run(h.opts.CacheTTL)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if !result.Healthy && !result.Optional {
+			report.Ready = false
+		}
+	}
+	return report
+}
+
+// run returns the cached result or runs the check. Concurrent callers wait for one run.
+func (c *check) run(cacheTTL time.Duration) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < cacheTTL {
+		return c.result
+	}
+
+	// The result is shared, so it does not depend on the context of the probe that ran it
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.Func(ctx)
+
+	c.checkedAt = time.Now()
+	c.result = Result{
+		Name:      c.Name,
+		Healthy:   err == nil,
+		Optional:  c.Optional,
+		Duration:  c.checkedAt.Sub(start).String(),
+		CheckedAt: c.checkedAt,
+	}
+	if err != nil {
+		c.result.Error = err.Error()
+	}
+	return c.result
+}
+
+// LivenessHandler always answers 200 while the process serves HTTP
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+}
+
+// ReadinessHandler answers with the report, 503 if the service is not ready
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Ready(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestReadiness(t *testing.T) {
+	h := New(Options{CacheTTL: time.Hour})
+	var redisCalls atomic.Int32
+	redisErr := errors.New("connection refused")
+	h.Register(Check{Name: "redis", Func: func(ctx context.Context) error {
+		redisCalls.Add(1)
+		return redisErr
+	}})
+	h.Register(Check{Name: "otlp", Optional: true, Func: func(ctx context.Context) error {
+		return errors.New("no collector")
+	}})
+
+	report := h.Ready(context.Background())
+	if report.Ready || report.Checks[0].Error != redisErr.Error() || report.Checks[1].Healthy {
+		t.Fatalf("report = %+v, want unready because of redis", report)
+	}
+
+	// The result is cached
+	redisErr = nil
+	for range 10 {
+		h.Ready(context.Background())
+	}
+	if redisCalls.Load() != 1 {
+		t.Errorf("redis checked %d times, want the cached result", redisCalls.Load())
+	}
+}
+
+func TestOptionalCheckAndTimeout(t *testing.T) {
+	h := New(Options{Timeout: 20 * time.Millisecond})
+	h.Register(Check{Name: "track-analyzer", Optional: true, Func: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	start := time.Now()
+	report := h.Ready(context.Background())
+	if !report.Ready || report.Checks[0].Healthy || time.Since(start) > time.Second {
+		t.Fatalf("report = %+v after %v, want ready with a timed out optional check", report, time.Since(start))
+	}
+}
+
+func TestDrain(t *testing.T) {
+	h := New(Options{})
+	h.Register(Check{Name: "redis", Func: func(ctx context.Context) error { return nil }})
+
+	rec := httptest.NewRecorder()
+	h.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("readyz = %d before shutdown", rec.Code)
+	}
+
+	h.Drain()
+	rec = httptest.NewRecorder()
+	h.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz = %d while draining, want 503", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("livez = %d while draining, want 200", rec.Code)
+	}
+
+	server := h.GRPCServer()
+	for service, want := range map[string]healthpb.HealthCheckResponse_ServingStatus{
+		"":              healthpb.HealthCheckResponse_NOT_SERVING,
+		LivenessService: healthpb.HealthCheckResponse_SERVING,
+	} {
+		resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil || resp.GetStatus() != want {
+			t.Errorf("grpc Check(%q) = %v, %v, want %v", service, resp.GetStatus(), err, want)
+		}
+	}
+	if _, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"}); err == nil {
+		t.Error("grpc Check of an unknown service succeeded")
+	}
+}
@@ -0,0 +1,194 @@
+// Package lifecycle stops the components of a service in order on shutdown.
+//
+// Each component registers a stop hook in a phase. The phases run one after another,
+// so that nothing is closed while something else still uses it: the server stops
+// taking requests before the workers are awaited, the workers finish before Redis
+// is closed, and the telemetry is flushed last. The telemetry has a budget of its own,
+// so a stuck phase before it does not leave the flush without time to export the
+// errors of that very phase. Register the log provider after the
+// metric and trace providers, so that the errors of their flush are exported as well.
+// The records of the manager after the last hook only reach the local handler.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// Phase orders the stop hooks, lower phases stop first
+type Phase int
+
+const (
+	// PhaseReadiness turns readiness off and waits for load balancers to notice it
+	PhaseReadiness Phase = iota
+	// PhaseHTTP stops the servers, letting in-flight requests complete
+	PhaseHTTP
+	// PhaseWorkers awaits the background work started by the requests
+	PhaseWorkers
+	// PhaseStorage closes the connections to the storage
+	PhaseStorage
+	// PhaseTelemetry flushes metrics, traces and logs
+	PhaseTelemetry
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseReadiness:
+		return "readiness"
+	case PhaseHTTP:
+		return "http"
+	case PhaseWorkers:
+		return "workers"
+	case PhaseStorage:
+		return "storage"
+	case PhaseTelemetry:
+		return "telemetry"
+	}
+	return fmt.Sprintf("phase(%d)", int(p))
+}
+
+// telemetryShare is the part of the shutdown timeout reserved for PhaseTelemetry
+const telemetryShare = 5
+
+// abandonGrace is how long a hook is awaited after the deadline before it is abandoned
+const abandonGrace = 100 * time.Millisecond
+
+// StopFunc stops a component, it must return when ctx is done
+type StopFunc func(ctx context.Context) error
+
+type hook struct {
+	phase Phase
+	name  string
+	stop  StopFunc
+}
+
+// Manager keeps the stop hooks
+type Manager struct {
+	logger  *slog.Logger
+	timeout time.Duration
+	hooks   []hook
+}
+
+// New creates a manager. timeout is the deadline of the whole shutdown, 30s if not positive.
+func New(logger *slog.Logger, timeout time.Duration) *Manager {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &Manager{logger: logger, timeout: timeout}
+}
+
+// Register adds a stop hook. Hooks of the same phase run in the order of registration.
+func (m *Manager) Register(phase Phase, name string, stop StopFunc) {
+	m.hooks = append(m.hooks, hook{phase: phase, name: name, stop: stop})
+}
+
+// Shutdown runs the hooks phase by phase and returns their joined errors.
+//
+// Every hook is called even after a failure or the deadline: a hook that gets a done
+// context still releases what it can, e.g. closes connections without waiting.
+// A hook that does not return in time is abandoned, so the deadline holds
+// up to a short grace per hook.
+//
+// The phases before PhaseTelemetry share the timeout less a fifth of it. The telemetry
+// gets what is left of the timeout, but never less than that fifth.
+func (m *Manager) Shutdown(parent context.Context) error {
+	start := time.Now()
+	reserve := m.timeout / telemetryShare
+	ctx, cancel := context.WithDeadline(parent, start.Add(m.timeout-reserve))
+	defer cancel()
+
+	hooks := make([]hook, len(m.hooks))
+	copy(hooks, m.hooks)
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].phase < hooks[j].phase })
+
+	m.logger.Info("shutdown started", "timeout", m.timeout.String())
+
+	var errs []error
+	for i := 0; i < len(hooks); {
+		phase := hooks[i].phase
+		phaseStart := time.Now()
+		phaseCtx := ctx
+		if phase >= PhaseTelemetry {
+			deadline := start.Add(m.timeout)
+			if floor := phaseStart.Add(reserve); deadline.Before(floor) {
+				deadline = floor
+			}
+			var cancelPhase context.CancelFunc
+			phaseCtx, cancelPhase = context.WithDeadline(parent, deadline)
+			defer cancelPhase()
+		}
+		m.logger.Info("shutdown phase started", "phase", phase.String())
+
+		failed := false
+		for ; i < len(hooks) && hooks[i].phase == phase; i++ {
+			if err := m.run(phaseCtx, hooks[i]); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", phase, hooks[i].name, err))
+				failed = true
+			}
+		}
+
+		level := slog.LevelInfo
+		if failed {
+			level = slog.LevelWarn
+		}
+		m.logger.Log(phaseCtx, level, "shutdown phase completed",
+			"phase", phase.String(),
+			"duration", time.Since(phaseStart).String(),
+			"failed", failed,
+		)
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		m.logger.Error("shutdown completed with errors", "duration", time.Since(start).String(), "error", err)
+	} else {
+		m.logger.Info("shutdown completed", "duration", time.Since(start).String())
+	}
+	return err
+}
+
+func (m *Manager) run(ctx context.Context, h hook) error {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- h.stop(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// A hook called after the deadline gets a moment to release what it can
+		grace := time.NewTimer(abandonGrace)
+		defer grace.Stop()
+		select {
+		case err = <-done:
+		case <-grace.C:
+			err = fmt.Errorf("abandoned: %w", ctx.Err())
+		}
+	}
+
+	attrs := []any{"phase", h.phase.String(), "component", h.name, "duration", time.Since(start).String()}
+	if err != nil {
+		m.logger.Error("component stop failed", append(attrs, "error", err)...)
+	} else {
+		m.logger.Info("component stopped", attrs...)
+	}
+	return err
+}
+
+// Sleep waits for d or until ctx is done, for delays that are part of the shutdown
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	m := New(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	var stopped []string
+	stop := func(name string, err error) StopFunc {
+		return func(ctx context.Context) error {
+			stopped = append(stopped, name)
+			return err
+		}
+	}
+	// Registered out of order on purpose
+	m.Register(PhaseTelemetry, "logs", stop("logs", nil))
+	m.Register(PhaseStorage, "redis", stop("redis", errors.New("already closed")))
+	m.Register(PhaseTelemetry, "traces", stop("traces", nil))
+	m.Register(PhaseReadiness, "health", stop("health", nil))
+	m.Register(PhaseWorkers, "track-analyzer sends", stop("track-analyzer sends", nil))
+	m.Register(PhaseHTTP, "http", stop("http", nil))
+
+	err := m.Shutdown(context.Background())
+	want := []string{"health", "http", "track-analyzer sends", "redis", "logs", "traces"}
+	if !reflect.DeepEqual(stopped, want) {
+		t.Errorf("stopped %v, want %v", stopped, want)
+	}
+	if err == nil || err.Error() != "storage: redis: already closed" {
+		t.Errorf("err = %v, want the redis error", err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	m := New(slog.New(slog.NewTextHandler(io.Discard, nil)), 20*time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	m.Register(PhaseWorkers, "stuck", func(ctx context.Context) error {
+		<-block
+		return nil
+	})
+	var telemetryCtxErr error
+	var telemetryBudget time.Duration
+	m.Register(PhaseTelemetry, "traces", func(ctx context.Context) error {
+		telemetryCtxErr = ctx.Err()
+		deadline, _ := ctx.Deadline()
+		telemetryBudget = time.Until(deadline)
+		return nil
+	})
+
+	start := time.Now()
+	err := m.Shutdown(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("shutdown took %v, want the deadline to hold", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the stuck worker abandoned", err)
+	}
+	// The stuck worker does not eat the time reserved for the flush
+	if telemetryCtxErr != nil || telemetryBudget <= 0 {
+		t.Errorf("telemetry hook got ctx error %v and %v left, want its own budget", telemetryCtxErr, telemetryBudget)
+	}
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type debugKey struct{}
+
+// WithDebug marks the context so that debug records are logged for it
+// regardless of the configured level.
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugKey{}, true)
+}
+
+// DebugEnabled reports whether the context was marked with WithDebug.
+func DebugEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(debugKey{}).(bool)
+	return enabled
+}
+
+// Handler lowers the effective level to debug for contexts marked with WithDebug.
+// Only the *Context logger methods pass the request context to the handler.
+type Handler struct {
+	slog.Handler
+}
+
+func NewHandler(h slog.Handler) *Handler {
+	return &Handler{Handler: h}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= slog.LevelDebug && DebugEnabled(ctx) {
+		return true
+	}
+	return h.Handler.Enabled(ctx, level)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name)}
+}
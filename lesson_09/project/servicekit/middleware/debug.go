@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+
+	"example/servicekit/logging"
+)
+
+const (
+	// DebugBaggageKey is the baggage member that carries the debug token to downstream services
+	DebugBaggageKey = "debug"
+	// DebugHeader lets a client request debug logs without setting baggage itself
+	DebugHeader = "X-Debug-Key"
+)
+
+// debugTokenTTL is how long a debug token in the baggage is accepted
+const debugTokenTTL = time.Minute
+
+// DebugLogging enables debug logs for a single request when it carries an allowed key in the
+// X-Debug-Key header, or a debug token made with an allowed key in the baggage. The number of
+// such requests is rate limited.
+//
+// The key itself is never put into the baggage: the baggage is sent to every downstream
+// service and vendor, and anyone who sees the key could enable debug logs. The token is an
+// HMAC of the trace ID and an expiry with the key, so a token seen in the baggage enables
+// debug logs only for the rest of the same trace and only until it expires.
+type DebugLogging struct {
+	keys    map[string]struct{}
+	limiter *rate.Limiter
+	now     func() time.Time
+}
+
+func NewDebugLogging(keys []string, perSecond float64, burst int) *DebugLogging {
+	allowed := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if key != "" {
+			allowed[key] = struct{}{}
+		}
+	}
+	return &DebugLogging{
+		keys:    allowed,
+		limiter: rate.NewLimiter(rate.Limit(perSecond), burst),
+		now:     time.Now,
+	}
+}
+
+// debugToken is "<expiry unix seconds>.<HMAC of trace ID and expiry>". Services with the same
+// DEBUG_LOG_KEYS accept the tokens of each other.
+func debugToken(key string, traceID trace.TraceID, expiry int64) string {
+	exp := strconv.FormatInt(expiry, 10)
+	return exp + "." + hex.EncodeToString(debugMAC(key, traceID, exp))
+}
+
+func debugMAC(key string, traceID trace.TraceID, expiry string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(traceID.String() + "." + expiry))
+	return mac.Sum(nil)[:16]
+}
+
+// validToken reports whether the token was made with an allowed key for the trace and has not expired
+func (d *DebugLogging) validToken(token string, traceID trace.TraceID) bool {
+	exp, macHex, ok := strings.Cut(token, ".")
+	if !ok || !traceID.IsValid() {
+		return false
+	}
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || d.now().Unix() > expiry {
+		return false
+	}
+	got, err := hex.DecodeString(macHex)
+	if err != nil {
+		return false
+	}
+	for key := range d.keys {
+		if hmac.Equal(got, debugMAC(key, traceID, exp)) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns a context with debug logging enabled, and a debug token added to the baggage
+// so that it's propagated to downstream services. ctx must carry the span of the request.
+func (d *DebugLogging) apply(ctx context.Context, r *http.Request) (context.Context, bool) {
+	if d == nil || len(d.keys) == 0 {
+		return ctx, false
+	}
+
+	traceID := trace.SpanContextFromContext(ctx).TraceID()
+	bag := baggage.FromContext(ctx)
+	var allowed bool
+	var headerKey string // Set if the key came in the header and is not in the baggage yet
+	if token := bag.Member(DebugBaggageKey).Value(); token != "" {
+		allowed = d.validToken(token, traceID)
+	} else if headerKey = r.Header.Get(DebugHeader); headerKey != "" {
+		_, allowed = d.keys[headerKey]
+	}
+	if !allowed || !d.limiter.Allow() {
+		return ctx, false
+	}
+
+	// Without a trace the token could not be checked downstream, the debug logs stay local
+	if headerKey != "" && traceID.IsValid() {
+		token := debugToken(headerKey, traceID, d.now().Add(debugTokenTTL).Unix())
+		member, err := baggage.NewMember(DebugBaggageKey, token)
+		if err == nil {
+			if bag, err = bag.SetMember(member); err == nil {
+				ctx = baggage.ContextWithBaggage(ctx, bag)
+			}
+		}
+	}
+	return logging.WithDebug(ctx), true
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+
+	"example/servicekit/logging"
+)
+
+func debugRequest(key string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if key != "" {
+		r.Header.Set(DebugHeader, key)
+	}
+	return r
+}
+
+// withTrace returns a context within the trace, as the tracing middleware makes it
+func withTrace(ctx context.Context, id byte) context.Context {
+	return trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{id},
+		SpanID:  trace.SpanID{id},
+	}))
+}
+
+func withDebugBaggage(t *testing.T, traceID byte, value string) context.Context {
+	t.Helper()
+	member, err := baggage.NewMember(DebugBaggageKey, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return withTrace(baggage.ContextWithBaggage(context.Background(), bag), traceID)
+}
+
+func TestDebugLoggingAllowlist(t *testing.T) {
+	d := NewDebugLogging([]string{"incident-42", ""}, 100, 100)
+
+	for _, tt := range []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{"allowed key", "incident-42", true},
+		{"unknown key", "incident-43", false},
+		{"no key", "", false},
+	} {
+		ctx, ok := d.apply(context.Background(), debugRequest(tt.key))
+		if ok != tt.want || logging.DebugEnabled(ctx) != tt.want {
+			t.Errorf("%s: enabled = %v, context marked = %v; want %v", tt.name, ok, logging.DebugEnabled(ctx), tt.want)
+		}
+	}
+
+	// Without keys nothing is enabled, a nil DebugLogging is allowed too
+	if _, ok := NewDebugLogging(nil, 100, 100).apply(context.Background(), debugRequest("incident-42")); ok {
+		t.Error("enabled without allowed keys")
+	}
+	var disabled *DebugLogging
+	if _, ok := disabled.apply(context.Background(), debugRequest("incident-42")); ok {
+		t.Error("enabled by a nil DebugLogging")
+	}
+}
+
+func TestDebugLoggingRateLimit(t *testing.T) {
+	d := NewDebugLogging([]string{"incident-42"}, 0.001, 2)
+
+	for i := 0; i < 2; i++ {
+		if _, ok := d.apply(context.Background(), debugRequest("incident-42")); !ok {
+			t.Fatalf("request %d within the burst was not enabled", i)
+		}
+	}
+	if _, ok := d.apply(context.Background(), debugRequest("incident-42")); ok {
+		t.Error("request over the limit was enabled")
+	}
+}
+
+func TestDebugLoggingBaggage(t *testing.T) {
+	upstream := NewDebugLogging([]string{"incident-42"}, 100, 100)
+	downstream := NewDebugLogging([]string{"incident-42"}, 100, 100)
+
+	ctx, ok := upstream.apply(withTrace(context.Background(), 1), debugRequest("incident-42"))
+	if !ok {
+		t.Fatal("not enabled by the header")
+	}
+	token := baggage.FromContext(ctx).Member(DebugBaggageKey).Value()
+	if token == "" || token == "incident-42" {
+		t.Fatalf("baggage %s = %q, want a debug token", DebugBaggageKey, token)
+	}
+
+	// The downstream service gets only the baggage
+	if _, ok := downstream.apply(withDebugBaggage(t, 1, token), debugRequest("")); !ok {
+		t.Error("not enabled by the token in the baggage")
+	}
+	expiry := time.Now().Add(time.Minute).Unix()
+	for name, ctx := range map[string]context.Context{
+		"key":                  withDebugBaggage(t, 1, "incident-42"),
+		"token of another key": withDebugBaggage(t, 1, debugToken("incident-43", trace.TraceID{1}, expiry)),
+		// A token seen in one trace can not be replayed in another
+		"token of another trace": withDebugBaggage(t, 2, token),
+		"token without a trace":  withTrace(withDebugBaggage(t, 1, token), 0),
+		"expired token":          withDebugBaggage(t, 1, debugToken("incident-42", trace.TraceID{1}, time.Now().Add(-time.Second).Unix())),
+	} {
+		if _, ok := downstream.apply(ctx, debugRequest("")); ok {
+			t.Errorf("enabled by the %s in the baggage", name)
+		}
+	}
+	// The baggage takes precedence, an invalid token is not overridden by the header
+	if _, ok := downstream.apply(withDebugBaggage(t, 1, "forged"), debugRequest("incident-42")); ok {
+		t.Error("enabled by the header next to an invalid baggage token")
+	}
+
+	// The token expires after debugTokenTTL
+	downstream.now = func() time.Time { return time.Now().Add(debugTokenTTL + time.Second) }
+	if _, ok := downstream.apply(withDebugBaggage(t, 1, token), debugRequest("")); ok {
+		t.Error("enabled by the token after its TTL")
+	}
+}
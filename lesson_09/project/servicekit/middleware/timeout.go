@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TimeoutMiddleware sets a deadline on the request context. The handler runs in
+// the request goroutine and is expected to stop when the context is done: Redis,
+// HTTP clients and the load shedder all respect it. If the deadline passes before
+// the handler has written anything, the client gets 504 and later writes of the
+// handler are discarded, so a slow handler can not corrupt the response.
+func TimeoutMiddleware(timeout time.Duration) func(next http.Handler) http.Handler {
+	return DynamicTimeoutMiddleware(func() time.Duration { return timeout })
+}
+
+// DynamicTimeoutMiddleware is TimeoutMiddleware with the timeout read for every
+// request, so that it can be changed without a restart
+func DynamicTimeoutMiddleware(timeout func() time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout())
+			defer cancel()
+
+			tw := &timeoutWriter{w: w, ctx: ctx}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			tw.timeoutIfUnwritten()
+		})
+	}
+}
+
+// timeoutWriter replaces the response with 504 if nothing was written before the deadline.
+// It is used only from the handler goroutine, so it needs no locking.
+type timeoutWriter struct {
+	w        http.ResponseWriter
+	ctx      context.Context
+	written  bool
+	timedOut bool
+}
+
+// timeoutIfUnwritten writes 504 if the deadline passed and the response was not started
+func (tw *timeoutWriter) timeoutIfUnwritten() bool {
+	if tw.timedOut {
+		return true
+	}
+	if tw.written || !errors.Is(tw.ctx.Err(), context.DeadlineExceeded) {
+		return false
+	}
+	tw.timedOut = true
+	tw.w.WriteHeader(http.StatusGatewayTimeout)
+	tw.w.Write([]byte("Request timeout"))
+	return true
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.w.Header()
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	if tw.timeoutIfUnwritten() {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.written = true
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	if tw.timeoutIfUnwritten() {
+		return
+	}
+	tw.written = true
+	tw.w.WriteHeader(statusCode)
+}
+
+// Hijack implements the http.Hijacker interface
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := tw.w.(http.Hijacker); ok {
+		tw.written = true
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Flush implements the http.Flusher interface
+func (tw *timeoutWriter) Flush() {
+	if flusher, ok := tw.w.(http.Flusher); ok && !tw.timedOut {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
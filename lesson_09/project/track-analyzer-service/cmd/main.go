@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"github.com/grafana/pyroscope-go"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,21 +14,33 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 
+	"example/track-analyzer-service/internal/config"
 	"example/track-analyzer-service/internal/handlers"
+	"example/track-analyzer-service/internal/metrics"
 	internalMiddleware "example/track-analyzer-service/internal/middleware"
 	"example/track-analyzer-service/internal/repository"
 	"example/track-analyzer-service/internal/service"
+
+	"example/servicekit/health"
+	"example/servicekit/lifecycle"
+	"example/servicekit/logging"
+	kitMiddleware "example/servicekit/middleware"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-redis/redis/v8"
 	otelpyroscope "github.com/grafana/otel-profiling-go"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func initTracer() *sdktrace.TracerProvider {
@@ -54,20 +68,124 @@ func initTracer() *sdktrace.TracerProvider {
 	return tp
 }
 
+func initMeter(opts metrics.Options) *metric.MeterProvider {
+	exporter, err := otlpmetricgrpc.New(context.Background())
+	if err != nil {
+		slog.Error("failed to initialize meter", "error", err)
+		os.Exit(1)
+	}
+
+	mp := metrics.NewMeterProvider(opts,
+		metric.WithReader(metric.NewPeriodicReader(exporter)),
+		metric.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("track-analyzer-service"),
+		)),
+	)
+	otel.SetMeterProvider(mp)
+
+	return mp
+}
+
+// newDebugLogging allows per-request debug logs for the configured keys
+func newDebugLogging(cfg *config.Config) *kitMiddleware.DebugLogging {
+	return kitMiddleware.NewDebugLogging(cfg.DebugLogKeys, cfg.DebugLogRate, 5)
+}
+
+// newLoadShedder limits concurrent API requests to MAX_CONCURRENT_REQUESTS.
+// Reads of the tracks are analytics and are shed first, new points are kept.
+func newLoadShedder(cfg *config.Config) *internalMiddleware.LoadShedder {
+	return internalMiddleware.NewLoadShedder(cfg.MaxConcurrentRequests, func(r *http.Request) internalMiddleware.Priority {
+		if r.Method == http.MethodGet {
+			return internalMiddleware.PriorityLow
+		}
+		return internalMiddleware.PriorityNormal
+	})
+}
+
+// shutdownTimeout is the deadline of the whole shutdown, drainDelay included.
+// Kubernetes kills the pod after terminationGracePeriodSeconds, 30s by default.
+const shutdownTimeout = 25 * time.Second
+
+// drainDelay is the time between turning readiness off and stopping the server,
+// for load balancers to notice it and stop sending new requests
+const drainDelay = 5 * time.Second
+
+func newHealth(redisClient *redis.Client) *health.Health {
+	h := health.New(health.Options{})
+	h.Register(health.Check{Name: "redis", Func: health.RedisPing(redisClient)})
+	h.Register(health.Check{Name: "otlp", Func: health.TCPDial(health.OTLPEndpoint()), Optional: true})
+	return h
+}
+
+// serveHealthGRPC serves grpc.health.v1 on addr
+func serveHealthGRPC(h *health.Health, addr string, logger *slog.Logger) *grpc.Server {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("failed to listen for grpc health", "error", err)
+		os.Exit(1)
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, h.GRPCServer())
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			logger.Error("grpc health server error", "error", err)
+		}
+	}()
+	return srv
+}
+
+// serveDebug serves the debug endpoints apart from the API, on an address
+// that is not exposed outside of the pod
+func serveDebug(store *config.Store, addr string, logger *slog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/config", store.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		logger.Info("starting debug server", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("debug server error", "error", err)
+		}
+	}()
+	return srv
+}
+
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level:     slog.LevelInfo,
+	// The level is changed when the config is reloaded
+	logLevel := new(slog.LevelVar)
+	logger := slog.New(logging.NewHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:     logLevel,
 		AddSource: true,
-	}))
+	})))
 	slog.SetDefault(logger)
 
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Error("failed to load config", "error", err)
+		os.Exit(1)
+	}
+	level, _ := cfg.SlogLevel()
+	logLevel.Set(level)
+
+	configStore := config.NewStore(cfg, logger)
+	configStore.OnReload(func(cfg *config.Config) {
+		level, _ := cfg.SlogLevel()
+		logLevel.Set(level)
+	})
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	go configStore.ReloadOnSignal(reloadCtx, syscall.SIGHUP)
+
+	metricsOptions := metrics.Options{HistogramMode: cfg.MetricsHistogramMode, Summaries: cfg.MetricsSummaries}
+	metrics.Init(metricsOptions)
+
 	tp := initTracer()
-	defer tp.Shutdown(context.Background())
+	mp := initMeter(metricsOptions)
 
 	// Initialize Pyroscope
 	profiler, err := pyroscope.Start(pyroscope.Config{
 		ApplicationName: "track-analyzer-service",
-		ServerAddress:   os.Getenv("PYROSCOPE_SERVER_ADDRESS"),
+		ServerAddress:   cfg.PyroscopeServerAddress,
 		ProfileTypes: []pyroscope.ProfileType{
 			pyroscope.ProfileCPU,
 			pyroscope.ProfileAllocObjects,
@@ -78,16 +196,24 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	_ = profiler
-	// profiler.Stop()
 
 	redisClient := redis.NewClient(&redis.Options{
-		Addr: os.Getenv("REDIS_ADDR"),
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
 	})
-	defer redisClient.Close()
 
-	featureService := service.NewFeatureService()
-	trackRepo := repository.NewRedisTrackRepository(redisClient, featureService)
+	healthChecks := newHealth(redisClient)
+
+	featureCtx, stopFeatures := context.WithCancel(context.Background())
+	featureService := service.NewFeatureService(redisClient, logger)
+	featuresStopped := make(chan struct{})
+	go func() {
+		defer close(featuresStopped)
+		featureService.Run(featureCtx)
+	}()
+	trackRepo := repository.NewRedisTrackRepository(redisClient, featureService, func() int {
+		return configStore.Get().AnalysisWindow
+	})
 
 	trackHandler := handlers.NewTrackHandler(trackRepo, logger, featureService)
 	featureHandler := handlers.NewFeatureHandler(featureService, logger)
@@ -99,18 +225,25 @@ func main() {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(internalMiddleware.TracingMiddleware)
+	r.Use(kitMiddleware.TracingMiddleware(newDebugLogging(cfg)))
 	r.Use(internalMiddleware.MetricsMiddleware)
 
-	// Create a subrouter for API endpoints with timeout
+	// Create a subrouter for API endpoints with timeout and load shedding
 	apiRouter := chi.NewRouter()
-	apiRouter.Use(internalMiddleware.TimeoutMiddleware(time.Second))
+	apiRouter.Use(kitMiddleware.DynamicTimeoutMiddleware(func() time.Duration {
+		return configStore.Get().RequestTimeout
+	}))
+	apiRouter.Use(newLoadShedder(cfg).Middleware)
 
 	apiRouter.Route("/api/v1", func(r chi.Router) {
 		r.Post("/tracks/{driverID}/points", trackHandler.AddPoint)
 		r.Get("/tracks/{driverID}/points", trackHandler.GetRecentPoints)
 		r.Route("/features", func(r chi.Router) {
+			r.Get("/", featureHandler.ListFeatures)
+			r.Get("/{name}", featureHandler.GetFeature)
 			r.Put("/{name}", featureHandler.SetFeature)
+			r.Delete("/{name}", featureHandler.DeleteFeature)
+			r.Get("/{name}/history", featureHandler.GetHistory)
 		})
 	})
 
@@ -121,9 +254,11 @@ func main() {
 		EnableOpenMetrics: true,
 	}
 	r.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, opts))
+	r.Handle("/livez", healthChecks.LivenessHandler())
+	r.Handle("/readyz", healthChecks.ReadinessHandler())
 
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.HTTPAddr,
 		Handler: r,
 	}
 
@@ -134,8 +269,52 @@ func main() {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
 	// Start the service listening for requests.
+	grpcHealth := serveHealthGRPC(healthChecks, cfg.HealthGRPCAddr, logger)
+	debugSrv := serveDebug(configStore, cfg.DebugAddr, logger)
+
+	// Components stop in the order of the phases, telemetry is flushed last
+	// so that everything logged and traced during the shutdown is exported
+	shutdownManager := lifecycle.New(logger, shutdownTimeout)
+	shutdownManager.Register(lifecycle.PhaseReadiness, "health", func(ctx context.Context) error {
+		// Become unready first and let the load balancers notice it
+		healthChecks.Drain()
+		return lifecycle.Sleep(ctx, drainDelay)
+	})
+	shutdownManager.Register(lifecycle.PhaseHTTP, "http", func(ctx context.Context) error {
+		if err := srv.Shutdown(ctx); err != nil {
+			return errors.Join(err, srv.Close())
+		}
+		return nil
+	})
+	shutdownManager.Register(lifecycle.PhaseHTTP, "grpc health", func(ctx context.Context) error {
+		// Not GracefulStop: Watch streams of the probes never end by themselves
+		grpcHealth.Stop()
+		return nil
+	})
+	shutdownManager.Register(lifecycle.PhaseHTTP, "debug", func(ctx context.Context) error {
+		return debugSrv.Close()
+	})
+	shutdownManager.Register(lifecycle.PhaseWorkers, "feature flag sync", func(ctx context.Context) error {
+		stopFeatures()
+		select {
+		case <-featuresStopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	shutdownManager.Register(lifecycle.PhaseStorage, "redis", func(ctx context.Context) error {
+		return redisClient.Close()
+	})
+	shutdownManager.Register(lifecycle.PhaseTelemetry, "profiles", func(ctx context.Context) error {
+		// Uploads the last profiles
+		return profiler.Stop()
+	})
+	shutdownManager.Register(lifecycle.PhaseTelemetry, "metrics", mp.Shutdown)
+	shutdownManager.Register(lifecycle.PhaseTelemetry, "traces", tp.Shutdown)
+
 	go func() {
-		logger.Info("starting track analyzer service", "port", "8081")
+		logger.Info("starting track analyzer service", "addr", cfg.HTTPAddr)
 		serverErrors <- srv.ListenAndServe()
 	}()
 
@@ -143,20 +322,11 @@ func main() {
 	select {
 	case err := <-serverErrors:
 		logger.Error("server error", "error", err)
-		return
-
 	case sig := <-shutdown:
-		logger.Info("shutdown started", "signal", sig)
-		defer logger.Info("shutdown complete", "signal", sig)
-
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+		logger.Info("shutdown signal received", "signal", sig)
+	}
 
-		if err := srv.Shutdown(ctx); err != nil {
-			logger.Error("graceful shutdown failed", "error", err)
-			if err := srv.Close(); err != nil {
-				logger.Error("forcing server close failed", "error", err)
-			}
-		}
+	if err := shutdownManager.Shutdown(context.Background()); err != nil {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,112 @@
+// Package featureprovider is an OpenFeature provider for the feature flags of track-analyzer.
+// The flags are stored in Redis, so any service with access to it can evaluate them:
+//
+//	openfeature.SetProvider(featureprovider.NewRedisProvider(ctx, redisClient, logger))
+//	client := openfeature.NewClient("checkout")
+//	delay, _ := client.IntValue(ctx, "add-point-delay-value-start", 0, openfeature.EvaluationContext{})
+package featureprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/open-feature/go-sdk/openfeature"
+
+	"example/track-analyzer-service/internal/service"
+)
+
+// Provider evaluates flags from the local copy of a FeatureService
+type Provider struct {
+	features *service.FeatureService
+}
+
+var _ openfeature.FeatureProvider = (*Provider)(nil)
+
+// NewProvider creates a provider for features, which must be running
+func NewProvider(features *service.FeatureService) *Provider {
+	return &Provider{features: features}
+}
+
+// NewRedisProvider creates a provider with its own copy of the flags, kept up to date until ctx is done
+func NewRedisProvider(ctx context.Context, client *redis.Client, logger *slog.Logger) *Provider {
+	features := service.NewFeatureService(client, logger)
+	go features.Run(ctx)
+	return NewProvider(features)
+}
+
+func (p *Provider) Metadata() openfeature.Metadata {
+	return openfeature.Metadata{Name: "track-analyzer-redis"}
+}
+
+func (p *Provider) Hooks() []openfeature.Hook {
+	return nil
+}
+
+func (p *Provider) BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, evalCtx openfeature.FlattenedContext) openfeature.BoolResolutionDetail {
+	value, detail := evaluate(ctx, p.features, flag, evalCtx, defaultValue, service.Flag.BoolValue)
+	return openfeature.BoolResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *Provider) StringEvaluation(ctx context.Context, flag string, defaultValue string, evalCtx openfeature.FlattenedContext) openfeature.StringResolutionDetail {
+	value, detail := evaluate(ctx, p.features, flag, evalCtx, defaultValue, service.Flag.StringValue)
+	return openfeature.StringResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *Provider) FloatEvaluation(ctx context.Context, flag string, defaultValue float64, evalCtx openfeature.FlattenedContext) openfeature.FloatResolutionDetail {
+	value, detail := evaluate(ctx, p.features, flag, evalCtx, defaultValue, service.Flag.FloatValue)
+	return openfeature.FloatResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *Provider) IntEvaluation(ctx context.Context, flag string, defaultValue int64, evalCtx openfeature.FlattenedContext) openfeature.IntResolutionDetail {
+	value, detail := evaluate(ctx, p.features, flag, evalCtx, defaultValue, service.Flag.IntValue)
+	return openfeature.IntResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+func (p *Provider) ObjectEvaluation(ctx context.Context, flag string, defaultValue interface{}, evalCtx openfeature.FlattenedContext) openfeature.InterfaceResolutionDetail {
+	value, detail := evaluate(ctx, p.features, flag, evalCtx, defaultValue, service.Flag.ObjectValue)
+	return openfeature.InterfaceResolutionDetail{Value: value, ProviderResolutionDetail: detail}
+}
+
+// evaluate matches the rules of the flag against the targeting key as the driver ID,
+// string attributes of the evaluation context and the baggage of ctx
+func evaluate[T any](ctx context.Context, features *service.FeatureService, name string, evalCtx openfeature.FlattenedContext, defaultValue T, value func(service.Flag) (T, error)) (T, openfeature.ProviderResolutionDetail) {
+	ec := service.NewEvaluationContext(ctx)
+	for key, attr := range evalCtx {
+		if s, ok := attr.(string); ok {
+			if key == openfeature.TargetingKey {
+				ec.DriverID = s
+			} else {
+				ec.Attributes[key] = s
+			}
+		}
+	}
+
+	flag, resolution, ok := features.Evaluate(name, ec)
+	if !ok {
+		return defaultValue, openfeature.ProviderResolutionDetail{
+			ResolutionError: openfeature.NewFlagNotFoundResolutionError(fmt.Sprintf("flag %q not found", name)),
+			Reason:          openfeature.DefaultReason,
+		}
+	}
+
+	result, err := value(flag)
+	if err != nil {
+		resolutionError := openfeature.NewParseErrorResolutionError(err.Error())
+		if errors.Is(err, service.ErrFlagType) {
+			resolutionError = openfeature.NewTypeMismatchResolutionError(err.Error())
+		}
+		return defaultValue, openfeature.ProviderResolutionDetail{
+			ResolutionError: resolutionError,
+			Reason:          openfeature.ErrorReason,
+		}
+	}
+	return result, openfeature.ProviderResolutionDetail{
+		// OpenFeature reasons are the upper case semantic convention ones
+		Reason:  openfeature.Reason(strings.ToUpper(string(resolution.Reason))),
+		Variant: resolution.Variant,
+	}
+}
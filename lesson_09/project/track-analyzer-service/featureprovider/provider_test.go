@@ -0,0 +1,121 @@
+package featureprovider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/open-feature/go-sdk/openfeature"
+
+	"example/track-analyzer-service/internal/service"
+)
+
+func mustFlag(t *testing.T, value string, rules ...service.Rule) service.Flag {
+	t.Helper()
+	flag, err := service.NewFlag("", json.RawMessage(value), rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flag
+}
+
+// newTestClient stores the flags in Redis and returns an OpenFeature client
+// evaluating them through a provider with its own copy, as another service would
+func newTestClient(t *testing.T, flags map[string]service.Flag) *openfeature.Client {
+	t.Helper()
+	server := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	writer := service.NewFeatureService(redisClient, logger)
+	for name, flag := range flags {
+		if _, err := writer.SetFeature(context.Background(), name, flag, service.Change{Actor: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	provider := NewRedisProvider(ctx, redisClient, logger)
+	deadline := time.Now().Add(2 * time.Second)
+	for name := range flags {
+		for _, ok := provider.features.Lookup(name); !ok; _, ok = provider.features.Lookup(name) {
+			if time.Now().After(deadline) {
+				t.Fatalf("provider did not load the flag %q", name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if err := openfeature.SetNamedProviderAndWait(t.Name(), provider); err != nil {
+		t.Fatal(err)
+	}
+	return openfeature.NewClient(t.Name())
+}
+
+func TestProviderResolution(t *testing.T) {
+	everyone := 100.0
+	client := newTestClient(t, map[string]service.Flag{
+		"slow-save": mustFlag(t, "true"),
+		"add-point-delay": mustFlag(t, "100", service.Rule{
+			Variant:    "eu",
+			Value:      json.RawMessage("500"),
+			Attributes: map[string]string{"region": "eu"},
+		}),
+		"new-analysis": mustFlag(t, "false", service.Rule{Value: json.RawMessage("true"), Percentage: &everyone}),
+	})
+	ctx := context.Background()
+
+	slowSave, err := client.BooleanValueDetails(ctx, "slow-save", false, openfeature.EvaluationContext{})
+	if err != nil || !slowSave.Value || slowSave.Reason != openfeature.StaticReason || slowSave.Variant != service.DefaultVariant {
+		t.Errorf("slow-save = %+v, %v; want true, STATIC, default", slowSave, err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		evalCtx openfeature.EvaluationContext
+		value   int64
+		reason  openfeature.Reason
+		variant string
+	}{
+		{"matching attribute", openfeature.NewEvaluationContext("42", map[string]any{"region": "eu"}), 500, openfeature.TargetingMatchReason, "eu"},
+		{"other attribute", openfeature.NewEvaluationContext("42", map[string]any{"region": "us"}), 100, openfeature.DefaultReason, service.DefaultVariant},
+	} {
+		delay, err := client.IntValueDetails(ctx, "add-point-delay", 0, tt.evalCtx)
+		if err != nil || delay.Value != tt.value || delay.Reason != tt.reason || delay.Variant != tt.variant {
+			t.Errorf("%s: add-point-delay = %+v, %v; want %d, %s, %s", tt.name, delay, err, tt.value, tt.reason, tt.variant)
+		}
+	}
+
+	// The targeting key is the driver ID of the percentage rollout
+	rollout, err := client.BooleanValueDetails(ctx, "new-analysis", false, openfeature.NewEvaluationContext("42", nil))
+	if err != nil || !rollout.Value || rollout.Reason != openfeature.SplitReason || rollout.Variant != "rule-0" {
+		t.Errorf("new-analysis = %+v, %v; want true, SPLIT, rule-0", rollout, err)
+	}
+	// Without a driver ID the rollout can not place the request and the default value is used
+	rollout, err = client.BooleanValueDetails(ctx, "new-analysis", true, openfeature.EvaluationContext{})
+	if err != nil || rollout.Value || rollout.Reason != openfeature.DefaultReason {
+		t.Errorf("new-analysis without a targeting key = %+v, %v; want false, DEFAULT", rollout, err)
+	}
+}
+
+func TestProviderErrors(t *testing.T) {
+	client := newTestClient(t, map[string]service.Flag{"add-point-delay": mustFlag(t, "100")})
+	ctx := context.Background()
+
+	mismatch, err := client.BooleanValueDetails(ctx, "add-point-delay", true, openfeature.EvaluationContext{})
+	if err == nil || !mismatch.Value || mismatch.ErrorCode != openfeature.TypeMismatchCode || mismatch.Reason != openfeature.ErrorReason {
+		t.Errorf("bool of an int flag = %+v, %v; want the default value and TYPE_MISMATCH", mismatch, err)
+	}
+
+	notFound, err := client.StringValueDetails(ctx, "missing", "fallback", openfeature.EvaluationContext{})
+	if err == nil || notFound.Value != "fallback" || notFound.ErrorCode != openfeature.FlagNotFoundCode {
+		t.Errorf("missing flag = %+v, %v; want the default value and FLAG_NOT_FOUND", notFound, err)
+	}
+}
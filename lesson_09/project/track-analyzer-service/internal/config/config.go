@@ -0,0 +1,141 @@
+// Package config loads the typed configuration of the service.
+//
+// Values come from the defaults, then the YAML file from CONFIG_FILE, then the
+// environment, each source overriding the previous one. Fields tagged reload:"true"
+// are applied on SIGHUP without a restart, see Store.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"example/servicekit/configstore"
+)
+
+// FileEnv names the environment variable with the path to the YAML file
+const FileEnv = configstore.FileEnv
+
+type Config struct {
+	HTTPAddr       string `yaml:"http_addr" envconfig:"HTTP_ADDR"`
+	HealthGRPCAddr string `yaml:"health_grpc_addr" envconfig:"HEALTH_GRPC_ADDR"`
+	// DebugAddr serves /debug/config, it listens on the loopback by default
+	// because the config reveals the debug log keys and the topology
+	DebugAddr string `yaml:"debug_addr" envconfig:"DEBUG_ADDR"`
+
+	RedisAddr     string `yaml:"redis_addr" envconfig:"REDIS_ADDR"`
+	RedisPassword string `yaml:"redis_password" envconfig:"REDIS_PASSWORD" secret:"true"`
+
+	PyroscopeServerAddress string `yaml:"pyroscope_server_address" envconfig:"PYROSCOPE_SERVER_ADDRESS"`
+
+	// MaxConcurrentRequests is the limit of the load shedder
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests" envconfig:"MAX_CONCURRENT_REQUESTS"`
+	// RequestTimeout is the deadline of an API request
+	RequestTimeout time.Duration `yaml:"request_timeout" envconfig:"REQUEST_TIMEOUT" reload:"true"`
+	// AnalysisWindow is the number of the latest points a track is analyzed by
+	AnalysisWindow int `yaml:"analysis_window" envconfig:"ANALYSIS_WINDOW" reload:"true"`
+
+	LogLevel string `yaml:"log_level" envconfig:"LOG_LEVEL" reload:"true"`
+	// DebugLogKeys allow per-request debug logs, at most DebugLogRate requests per second.
+	// Anyone who knows a key can turn the debug logs on, so the keys are secret.
+	DebugLogKeys []string `yaml:"debug_log_keys" envconfig:"DEBUG_LOG_KEYS" secret:"true"`
+	DebugLogRate float64  `yaml:"debug_log_rate" envconfig:"DEBUG_LOG_RATE"`
+
+	// MetricsHistogramMode is classic or both, see metrics.Options. Native alone is
+	// rejected: the dashboards read _bucket series from VictoriaMetrics
+	// which does not store native histograms
+	MetricsHistogramMode string `yaml:"metrics_histogram_mode" envconfig:"METRICS_HISTOGRAM_MODE"`
+	// MetricsSummaries brings back the client side summaries
+	MetricsSummaries bool `yaml:"metrics_summaries" envconfig:"METRICS_SUMMARIES"`
+}
+
+// maxAnalysisWindow bounds the points read from Redis and analyzed on every new point
+const maxAnalysisWindow = 10000
+
+// Default returns the configuration used when no source sets a value
+func Default() *Config {
+	return &Config{
+		HTTPAddr:               ":8080",
+		HealthGRPCAddr:         ":9092",
+		DebugAddr:              "127.0.0.1:6061",
+		RedisAddr:              "localhost:6379",
+		PyroscopeServerAddress: "http://localhost:4040",
+		MaxConcurrentRequests:  100,
+		RequestTimeout:         time.Second,
+		AnalysisWindow:         100,
+		LogLevel:               "INFO",
+		DebugLogRate:           1,
+		MetricsHistogramMode:   "both",
+	}
+}
+
+// Load reads and validates the configuration
+func Load() (*Config, error) {
+	cfg := Default()
+	if err := configstore.Load(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Store holds the current configuration and reloads it
+type Store = configstore.Store[Config]
+
+func NewStore(cfg *Config, logger *slog.Logger) *Store {
+	return configstore.NewStore(cfg, Load, logger)
+}
+
+// Redacted returns the configuration keyed by the file keys, with the secrets replaced
+func Redacted(cfg *Config) map[string]any {
+	return configstore.Redacted(cfg)
+}
+
+// Validate returns all the invalid values at once, named as environment variables
+func (c *Config) Validate() error {
+	var errs []error
+	if c.HTTPAddr == "" {
+		errs = append(errs, errors.New("HTTP_ADDR must not be empty"))
+	}
+	if c.HealthGRPCAddr == "" {
+		errs = append(errs, errors.New("HEALTH_GRPC_ADDR must not be empty"))
+	}
+	if c.DebugAddr == "" {
+		errs = append(errs, errors.New("DEBUG_ADDR must not be empty"))
+	}
+	if c.RedisAddr == "" {
+		errs = append(errs, errors.New("REDIS_ADDR must not be empty"))
+	}
+	if u, err := url.Parse(c.PyroscopeServerAddress); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("PYROSCOPE_SERVER_ADDRESS must be an http(s) URL, got %q", c.PyroscopeServerAddress))
+	}
+	if c.MaxConcurrentRequests <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_CONCURRENT_REQUESTS must be positive, got %d", c.MaxConcurrentRequests))
+	}
+	if c.RequestTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("REQUEST_TIMEOUT must be positive, got %s", c.RequestTimeout))
+	}
+	if c.AnalysisWindow < 1 || c.AnalysisWindow > maxAnalysisWindow {
+		errs = append(errs, fmt.Errorf("ANALYSIS_WINDOW must be between 1 and %d, got %d", maxAnalysisWindow, c.AnalysisWindow))
+	}
+	if _, err := c.SlogLevel(); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+	if c.DebugLogRate <= 0 {
+		errs = append(errs, fmt.Errorf("DEBUG_LOG_RATE must be positive, got %v", c.DebugLogRate))
+	}
+	switch c.MetricsHistogramMode {
+	case "classic", "both":
+	default:
+		errs = append(errs, fmt.Errorf("METRICS_HISTOGRAM_MODE must be classic or both, got %q", c.MetricsHistogramMode))
+	}
+	return errors.Join(errs...)
+}
+
+// SlogLevel parses LogLevel: DEBUG, INFO, WARN or ERROR, optionally with an offset like WARN+1
+func (c *Config) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	return level, err
+}
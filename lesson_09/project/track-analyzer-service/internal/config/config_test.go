@@ -0,0 +1,67 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example/servicekit/configstore"
+)
+
+func TestAnalysisWindow(t *testing.T) {
+	t.Setenv("ANALYSIS_WINDOW", "0")
+	t.Setenv("PYROSCOPE_SERVER_ADDRESS", "pyroscope:4040")
+	t.Setenv("METRICS_HISTOGRAM_MODE", "native")
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "ANALYSIS_WINDOW must be between 1 and 10000") ||
+		!strings.Contains(err.Error(), "PYROSCOPE_SERVER_ADDRESS must be an http(s) URL") ||
+		!strings.Contains(err.Error(), "METRICS_HISTOGRAM_MODE must be classic or both") {
+		t.Errorf("err = %v, want all invalid values reported", err)
+	}
+}
+
+func TestReloadAnalysisWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("analysis_window: 100\nredis_password: secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(FileEnv, path)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := os.WriteFile(path, []byte("analysis_window: 20\nredis_password: secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if store.Get().AnalysisWindow != 20 {
+		t.Errorf("AnalysisWindow = %d after reload, want 20", store.Get().AnalysisWindow)
+	}
+	if got := Redacted(store.Get())["redis_password"]; got != configstore.Mask {
+		t.Errorf("redis_password = %v, want it redacted", got)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.RedisPassword = "secret"
+	cfg.DebugLogKeys = []string{"incident-42"}
+
+	redactedCfg := Redacted(cfg)
+	for _, key := range []string{"redis_password", "debug_log_keys"} {
+		if redactedCfg[key] != configstore.Mask {
+			t.Errorf("%s = %v, want it redacted", key, redactedCfg[key])
+		}
+	}
+	// An unset secret is shown as empty, so that it is clear it is not set
+	if got := Redacted(Default())["debug_log_keys"]; got == configstore.Mask {
+		t.Errorf("unset debug_log_keys = %v, want it not redacted", got)
+	}
+}
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"log/slog"
 
@@ -11,6 +14,9 @@ import (
 	"example/track-analyzer-service/internal/service"
 )
 
+// ActorHeader names the operator changing a flag in the history, changes without it are rejected
+const ActorHeader = "X-Actor"
+
 type FeatureHandler struct {
 	featureService *service.FeatureService
 	logger         *slog.Logger
@@ -23,14 +29,50 @@ func NewFeatureHandler(featureService *service.FeatureService, logger *slog.Logg
 	}
 }
 
+// FeatureRequest sets a flag, null value deletes it. Without type the type
+// is inferred from the value, see service.NewFlag.
 type FeatureRequest struct {
-	Value interface{} `json:"value"`
+	Type  service.FlagType `json:"type,omitempty"`
+	Value json.RawMessage  `json:"value"`
+	Rules []service.Rule   `json:"rules,omitempty"`
+}
+
+func (h *FeatureHandler) ListFeatures(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	flags, err := h.featureService.ListFeatures(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "failed to list feature flags", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, flags)
+}
+
+func (h *FeatureHandler) GetFeature(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	featureName := chi.URLParam(r, "name")
+
+	flag, err := h.featureService.GetFeature(ctx, featureName)
+	if err != nil {
+		h.writeError(w, r, err, featureName)
+		return
+	}
+	w.Header().Set("ETag", quoteETag(flag.ETag))
+	writeJSON(w, flag)
 }
 
+// SetFeature creates or replaces a flag. With If-Match it is replaced only if it was not
+// changed since the ETag was read, with If-None-Match: * it is only created.
 func (h *FeatureHandler) SetFeature(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	featureName := chi.URLParam(r, "name")
 
+	change, err := changeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var req FeatureRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.ErrorContext(ctx, "failed to decode request body",
@@ -41,17 +83,114 @@ func (h *FeatureHandler) SetFeature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert number to int if it's float64 (default JSON number type)
-	if value, ok := req.Value.(float64); ok {
-		req.Value = int(value)
+	if len(req.Value) == 0 || string(req.Value) == "null" {
+		h.DeleteFeature(w, r)
+		return
 	}
 
-	h.featureService.SetFeature(ctx, featureName, req.Value)
+	flag, err := service.NewFlag(req.Type, req.Value, req.Rules...)
+	if err != nil {
+		http.Error(w, "Invalid feature value: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	etag, err := h.featureService.SetFeature(ctx, featureName, flag, change)
+	if err != nil {
+		h.writeError(w, r, err, featureName)
+		return
+	}
 
 	h.logger.InfoContext(ctx, "feature flag updated",
 		"feature", featureName,
-		"value", req.Value,
+		"type", flag.Type,
+		"value", string(flag.Value),
+		"rules", len(flag.Rules),
 	)
 
+	w.Header().Set("ETag", quoteETag(etag))
 	w.WriteHeader(http.StatusOK)
 }
+
+func (h *FeatureHandler) DeleteFeature(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	featureName := chi.URLParam(r, "name")
+
+	change, err := changeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.featureService.DeleteFeature(ctx, featureName, change); err != nil {
+		h.writeError(w, r, err, featureName)
+		return
+	}
+	h.logger.InfoContext(ctx, "feature flag deleted", "feature", featureName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetHistory returns the latest changes of a flag, ?limit= of them (50 by default)
+func (h *FeatureHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	featureName := chi.URLParam(r, "name")
+
+	limit := int64(50)
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			http.Error(w, "Limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	history, err := h.featureService.History(ctx, featureName, limit)
+	if err != nil {
+		h.writeError(w, r, err, featureName)
+		return
+	}
+	writeJSON(w, history)
+}
+
+func (h *FeatureHandler) writeError(w http.ResponseWriter, r *http.Request, err error, featureName string) {
+	switch {
+	case errors.Is(err, service.ErrFlagNotFound):
+		http.Error(w, "Feature not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrPreconditionFailed):
+		http.Error(w, "Feature was changed, read it again and retry", http.StatusPreconditionFailed)
+	default:
+		h.logger.ErrorContext(r.Context(), "feature flag request failed", "error", err, "feature", featureName)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// changeFromRequest reads the actor and the preconditions of a change.
+// If-None-Match only supports "*": a flag is not cached, so an ETag there would mean nothing.
+func changeFromRequest(r *http.Request) (service.Change, error) {
+	actor := strings.TrimSpace(r.Header.Get(ActorHeader))
+	if actor == "" {
+		return service.Change{}, errors.New(ActorHeader + " header is required to record the change")
+	}
+	ifNoneMatch := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if ifNoneMatch != "" && ifNoneMatch != "*" {
+		return service.Change{}, errors.New(`If-None-Match only supports "*"`)
+	}
+	return service.Change{
+		Actor:       actor,
+		IfMatch:     unquoteETag(r.Header.Get("If-Match")),
+		IfNoneMatch: ifNoneMatch,
+	}, nil
+}
+
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
+
+// unquoteETag strips the quotes and the weak prefix, "*" is kept as is
+func unquoteETag(value string) string {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	return strings.Trim(value, `"`)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
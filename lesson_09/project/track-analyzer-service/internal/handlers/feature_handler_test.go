@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-redis/redis/v8"
+
+	"example/track-analyzer-service/internal/service"
+)
+
+// newFeatureRouter mounts the handler the same way main does
+func newFeatureRouter(t *testing.T) http.Handler {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewFeatureHandler(service.NewFeatureService(client, logger), logger)
+
+	r := chi.NewRouter()
+	r.Route("/features", func(r chi.Router) {
+		r.Get("/", h.ListFeatures)
+		r.Get("/{name}", h.GetFeature)
+		r.Put("/{name}", h.SetFeature)
+		r.Delete("/{name}", h.DeleteFeature)
+		r.Get("/{name}/history", h.GetHistory)
+	})
+	return r
+}
+
+func do(router http.Handler, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSetFeatureConditional(t *testing.T) {
+	router := newFeatureRouter(t)
+
+	created := do(router, http.MethodPut, "/features/delay", `{"value": 100}`, "If-None-Match", "*", ActorHeader, "alice")
+	if created.Code != http.StatusOK || created.Header().Get("ETag") == "" {
+		t.Fatalf("create: %d, ETag %q", created.Code, created.Header().Get("ETag"))
+	}
+	etag := created.Header().Get("ETag")
+
+	if rec := do(router, http.MethodPut, "/features/delay", `{"value": 200}`, "If-None-Match", "*", ActorHeader, "alice"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("repeated create: %d, want 412", rec.Code)
+	}
+	if rec := do(router, http.MethodGet, "/features/delay", ""); rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag {
+		t.Errorf("get: %d, ETag %q, want %q", rec.Code, rec.Header().Get("ETag"), etag)
+	}
+
+	// Weak ETags are accepted as well
+	updated := do(router, http.MethodPut, "/features/delay", `{"value": 200}`, "If-Match", "W/"+etag, ActorHeader, "alice")
+	if updated.Code != http.StatusOK || updated.Header().Get("ETag") == etag {
+		t.Fatalf("update: %d, ETag %q", updated.Code, updated.Header().Get("ETag"))
+	}
+	if rec := do(router, http.MethodPut, "/features/delay", `{"value": 300}`, "If-Match", etag, ActorHeader, "alice"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("update with a stale ETag: %d, want 412", rec.Code)
+	}
+	if rec := do(router, http.MethodDelete, "/features/delay", "", "If-Match", etag, ActorHeader, "alice"); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("delete with a stale ETag: %d, want 412", rec.Code)
+	}
+
+	if rec := do(router, http.MethodPut, "/features/delay", `{"type": "bool", "value": 1}`, ActorHeader, "alice"); rec.Code != http.StatusBadRequest {
+		t.Errorf("value of a wrong type: %d, want 400", rec.Code)
+	}
+}
+
+func TestChangeRequiresActorAndValidIfNoneMatch(t *testing.T) {
+	router := newFeatureRouter(t)
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		body    string
+		headers []string
+	}{
+		{"put without actor", http.MethodPut, `{"value": 100}`, nil},
+		{"delete without actor", http.MethodDelete, "", nil},
+		{"put with a blank actor", http.MethodPut, `{"value": 100}`, []string{ActorHeader, " "}},
+		{"If-None-Match with an ETag", http.MethodPut, `{"value": 100}`, []string{ActorHeader, "alice", "If-None-Match", `"abc"`}},
+	} {
+		if rec := do(router, tc.method, "/features/delay", tc.body, tc.headers...); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", tc.name, rec.Code)
+		}
+	}
+	if rec := do(router, http.MethodGet, "/features/delay", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get after rejected changes: %d, want 404", rec.Code)
+	}
+}
+
+func TestDeleteFeatureHandler(t *testing.T) {
+	router := newFeatureRouter(t)
+
+	if rec := do(router, http.MethodDelete, "/features/delay", "", ActorHeader, "alice"); rec.Code != http.StatusNotFound {
+		t.Errorf("delete of a missing flag: %d, want 404", rec.Code)
+	}
+	do(router, http.MethodPut, "/features/delay", `{"value": 100}`, ActorHeader, "alice")
+	if rec := do(router, http.MethodDelete, "/features/delay", "", ActorHeader, "alice"); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d, want 204", rec.Code)
+	}
+	if rec := do(router, http.MethodGet, "/features/delay", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete: %d, want 404", rec.Code)
+	}
+
+	// A null value deletes the flag too
+	do(router, http.MethodPut, "/features/delay", `{"value": 100}`, ActorHeader, "alice")
+	if rec := do(router, http.MethodPut, "/features/delay", `{"value": null}`, ActorHeader, "alice"); rec.Code != http.StatusNoContent {
+		t.Errorf("put of null: %d, want 204", rec.Code)
+	}
+}
+
+func TestGetHistoryHandler(t *testing.T) {
+	router := newFeatureRouter(t)
+
+	do(router, http.MethodPut, "/features/delay", `{"value": 100}`, ActorHeader, "alice")
+	do(router, http.MethodPut, "/features/delay", `{"value": 200}`, ActorHeader, "bob")
+	do(router, http.MethodDelete, "/features/delay", "", ActorHeader, "carol")
+
+	rec := do(router, http.MethodGet, "/features/delay/history", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("history: %d", rec.Code)
+	}
+	var history []service.HistoryEntry
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ action, actor string }{{"delete", "carol"}, {"update", "bob"}, {"create", "alice"}}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d entries, want %d", len(history), len(want))
+	}
+	for i, w := range want {
+		if history[i].Action != w.action || history[i].Actor != w.actor {
+			t.Errorf("entry %d = %s by %s, want %s by %s", i, history[i].Action, history[i].Actor, w.action, w.actor)
+		}
+	}
+
+	rec = do(router, http.MethodGet, "/features/delay/history?limit=1", "")
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil || len(history) != 1 || history[0].Action != "delete" {
+		t.Errorf("history?limit=1 = %+v, %v; want the delete", history, err)
+	}
+
+	for _, limit := range []string{"0", "1001", "abc"} {
+		if rec := do(router, http.MethodGet, "/features/delay/history?limit="+limit, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: %d, want 400", limit, rec.Code)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"math"
 	"math/rand"
@@ -50,29 +51,45 @@ func (h *TrackHandler) AddPoint(w http.ResponseWriter, r *http.Request) {
 
 	driverID := chi.URLParam(r, "driverID")
 	logger = logger.With(slog.String("driverID", driverID))
+	// Feature flags are targeted by driver
+	ctx = service.WithDriverID(ctx, driverID)
 
 	var point models.GpsPoint
 	if err := json.NewDecoder(r.Body).Decode(&point); err != nil {
-		logger.Error("failed to decode point", "error", err)
+		logger.ErrorContext(ctx, "failed to decode point", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	logger.DebugContext(ctx, "received point",
+		"latitude", point.Location.Latitude,
+		"longitude", point.Location.Longitude,
+		"timestamp", point.Timestamp,
+	)
+
 	data, err := json.Marshal(point)
 	if err != nil {
-		logger.Error("failed to marshal point", "error", err)
+		logger.ErrorContext(ctx, "failed to marshal point", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if err := h.repo.SavePoint(ctx, driverID, data); err != nil {
-		logger.Error("failed to save point", "error", err)
+	// The sender retries a point with the same Idempotency-Key, a retry of a saved point
+	// is answered as a success without storing and counting it again
+	err = h.repo.SavePoint(ctx, driverID, data, r.Header.Get("Idempotency-Key"))
+	if errors.Is(err, repository.ErrDuplicatePoint) {
+		logger.InfoContext(ctx, "duplicate point ignored", "idempotencyKey", r.Header.Get("Idempotency-Key"))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to save point", "error", err)
 		http.Error(w, "Failed to save point", http.StatusInternalServerError)
 		return
 	}
 
-	metrics.ProcessedPoints.WithLabelValues(driverID).Inc()
-	logger.Info("point processed successfully",
+	metrics.Add(ctx, metrics.ProcessedPoints.WithLabelValues(driverID), 1)
+	logger.InfoContext(ctx, "point processed successfully",
 		"latitude", point.Location.Latitude,
 		"longitude", point.Location.Longitude,
 	)
@@ -99,7 +116,7 @@ func (h *TrackHandler) GetRecentPoints(w http.ResponseWriter, r *http.Request) {
 		var err error
 		count, err = strconv.Atoi(countStr)
 		if err != nil {
-			logger.Error("invalid count parameter", "error", err)
+			logger.ErrorContext(ctx, "invalid count parameter", "error", err)
 			http.Error(w, "Invalid count parameter", http.StatusBadRequest)
 			return
 		}
@@ -111,16 +128,16 @@ func (h *TrackHandler) GetRecentPoints(w http.ResponseWriter, r *http.Request) {
 
 	points, err := h.repo.GetRecentPoints(ctx, driverID, count)
 	if err != nil {
-		logger.Error("failed to get recent points", "error", err)
+		logger.ErrorContext(ctx, "failed to get recent points", "error", err)
 		http.Error(w, "Failed to get recent points", http.StatusInternalServerError)
 		return
 	}
 
-	logger.Info("retrieved recent points", "count", len(points))
+	logger.InfoContext(ctx, "retrieved recent points", "count", len(points))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(points); err != nil {
-		logger.Error("failed to encode response", "error", err)
+		logger.ErrorContext(ctx, "failed to encode response", "error", err)
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
@@ -133,9 +150,17 @@ func (h *TrackHandler) randomWait(ctx context.Context, logger *slog.Logger) {
 	s := 0.0
 	if min > 0 && max > 0 && max > min {
 		randomValue := min + h.random.Intn(max-min+1)
-		logger.Info("Random sleep", "value", randomValue)
-		time.Sleep(time.Millisecond * time.Duration(randomValue))
+		logger.InfoContext(ctx, "Random sleep", "value", randomValue)
+		// The timeout middleware answers only when the handler returns
+		select {
+		case <-time.After(time.Millisecond * time.Duration(randomValue)):
+		case <-ctx.Done():
+			return
+		}
 		for i := 0; i < 10_000_000; i++ {
+			if i%1_000_000 == 0 && ctx.Err() != nil {
+				return
+			}
 			s = math.Max(float64(i), 100) // generate cpu load
 		}
 	}
@@ -0,0 +1,276 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OverflowValue replaces label values of series created after the limit is reached
+const OverflowValue = "__overflow__"
+
+var CardinalityLimitHits = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "metric_cardinality_limit_hits_total",
+		Help: "Total number of updates over the series limit, folded into the overflow series or dropped for gauges",
+	},
+	[]string{"metric"},
+)
+
+// CardinalityOpts limits the number of series of a vector metric.
+type CardinalityOpts struct {
+	MaxSeries int                 // Max distinct label combinations, zero means no limit
+	Allowlist map[string][]string // Label values that are never folded, e.g. {"driver_id": {"1", "2"}}
+}
+
+// ObserverVec is implemented by LimitedHistogramVec and LimitedSummaryVec.
+type ObserverVec interface {
+	WithLabelValues(lvs ...string) prometheus.Observer
+	With(labels prometheus.Labels) prometheus.Observer
+	DeleteLabelValues(lvs ...string) bool
+}
+
+type cardinalityLimiter struct {
+	metric     string
+	labelNames []string
+	maxSeries  int
+	allowlist  map[string]map[string]struct{}
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func newCardinalityLimiter(metric string, labelNames []string, opts CardinalityOpts) *cardinalityLimiter {
+	allowlist := make(map[string]map[string]struct{}, len(opts.Allowlist))
+	for label, values := range opts.Allowlist {
+		allowlist[label] = make(map[string]struct{}, len(values))
+		for _, value := range values {
+			allowlist[label][value] = struct{}{}
+		}
+	}
+	return &cardinalityLimiter{
+		metric:     metric,
+		labelNames: labelNames,
+		maxSeries:  opts.MaxSeries,
+		allowlist:  allowlist,
+		seen:       make(map[string]struct{}),
+	}
+}
+
+func (l *cardinalityLimiter) allowed(i int, value string) bool {
+	_, ok := l.allowlist[l.labelNames[i]][value]
+	return ok
+}
+
+// admit reports whether the series may be updated: it is allowlisted, already known
+// or new under the limit. A series over the limit is counted in CardinalityLimitHits.
+func (l *cardinalityLimiter) admit(lvs []string) bool {
+	if l.maxSeries <= 0 || len(lvs) != len(l.labelNames) {
+		// Wrong label count is reported by the wrapped vector.
+		return true
+	}
+
+	allAllowed := true
+	for i, value := range lvs {
+		if !l.allowed(i, value) {
+			allAllowed = false
+			break
+		}
+	}
+	if allAllowed {
+		return true
+	}
+
+	key := strings.Join(lvs, "\xff")
+	l.mu.Lock()
+	_, known := l.seen[key]
+	admitted := known || len(l.seen) < l.maxSeries
+	if admitted {
+		l.seen[key] = struct{}{}
+	}
+	l.mu.Unlock()
+
+	if !admitted {
+		CardinalityLimitHits.WithLabelValues(l.metric).Inc()
+	}
+	return admitted
+}
+
+// limit returns the label values to use: the original ones for admitted series
+// and the ones of the overflow series, which keeps the allowlisted values, over the limit.
+func (l *cardinalityLimiter) limit(lvs []string) []string {
+	if l.admit(lvs) {
+		return lvs
+	}
+	folded := make([]string, len(lvs))
+	for i, value := range lvs {
+		if l.allowed(i, value) {
+			folded[i] = value
+		} else {
+			folded[i] = OverflowValue
+		}
+	}
+	return folded
+}
+
+// forget frees the place of a deleted series under the limit
+func (l *cardinalityLimiter) forget(lvs []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.seen, strings.Join(lvs, "\xff"))
+}
+
+// labelValues orders labels by the label names, false if they do not match
+func (l *cardinalityLimiter) labelValues(labels prometheus.Labels) ([]string, bool) {
+	if len(labels) != len(l.labelNames) {
+		return nil, false
+	}
+	lvs := make([]string, len(l.labelNames))
+	for i, name := range l.labelNames {
+		value, ok := labels[name]
+		if !ok {
+			return nil, false
+		}
+		lvs[i] = value
+	}
+	return lvs, true
+}
+
+// LimitedCounterVec is a CounterVec with a cap on the number of series.
+// The vector is wrapped, not embedded, so that no method can bypass the limit.
+type LimitedCounterVec struct {
+	vec     *prometheus.CounterVec
+	limiter *cardinalityLimiter
+}
+
+// NewLimitedCounterVec works like promauto.NewCounterVec.
+func NewLimitedCounterVec(opts prometheus.CounterOpts, labelNames []string, limit CardinalityOpts) *LimitedCounterVec {
+	return &LimitedCounterVec{
+		vec:     promauto.NewCounterVec(opts, labelNames),
+		limiter: newCardinalityLimiter(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames, limit),
+	}
+}
+
+func (v *LimitedCounterVec) WithLabelValues(lvs ...string) prometheus.Counter {
+	return v.vec.WithLabelValues(v.limiter.limit(lvs)...)
+}
+
+func (v *LimitedCounterVec) With(labels prometheus.Labels) prometheus.Counter {
+	lvs, ok := v.limiter.labelValues(labels)
+	if !ok {
+		return v.vec.With(labels)
+	}
+	return v.WithLabelValues(lvs...)
+}
+
+// DeleteLabelValues deletes the series and frees its place under the limit.
+func (v *LimitedCounterVec) DeleteLabelValues(lvs ...string) bool {
+	v.limiter.forget(lvs)
+	return v.vec.DeleteLabelValues(lvs...)
+}
+
+// LimitedGaugeVec is a GaugeVec with a cap on the number of series.
+// Updates over the limit are dropped: values of different series set into one
+// overflow series would overwrite each other, so it would mean nothing.
+type LimitedGaugeVec struct {
+	vec     *prometheus.GaugeVec
+	limiter *cardinalityLimiter
+	// dropped takes the updates over the limit, it is not registered
+	dropped prometheus.Gauge
+}
+
+// NewLimitedGaugeVec works like promauto.NewGaugeVec.
+func NewLimitedGaugeVec(opts prometheus.GaugeOpts, labelNames []string, limit CardinalityOpts) *LimitedGaugeVec {
+	return &LimitedGaugeVec{
+		vec:     promauto.NewGaugeVec(opts, labelNames),
+		limiter: newCardinalityLimiter(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames, limit),
+		dropped: prometheus.NewGauge(prometheus.GaugeOpts(opts)),
+	}
+}
+
+func (v *LimitedGaugeVec) WithLabelValues(lvs ...string) prometheus.Gauge {
+	if !v.limiter.admit(lvs) {
+		return v.dropped
+	}
+	return v.vec.WithLabelValues(lvs...)
+}
+
+func (v *LimitedGaugeVec) With(labels prometheus.Labels) prometheus.Gauge {
+	lvs, ok := v.limiter.labelValues(labels)
+	if !ok {
+		return v.vec.With(labels)
+	}
+	return v.WithLabelValues(lvs...)
+}
+
+// DeleteLabelValues deletes the series and frees its place under the limit.
+func (v *LimitedGaugeVec) DeleteLabelValues(lvs ...string) bool {
+	v.limiter.forget(lvs)
+	return v.vec.DeleteLabelValues(lvs...)
+}
+
+// LimitedHistogramVec is a HistogramVec with a cap on the number of series.
+type LimitedHistogramVec struct {
+	vec     *prometheus.HistogramVec
+	limiter *cardinalityLimiter
+}
+
+// NewLimitedHistogramVec works like promauto.NewHistogramVec.
+func NewLimitedHistogramVec(opts prometheus.HistogramOpts, labelNames []string, limit CardinalityOpts) *LimitedHistogramVec {
+	return &LimitedHistogramVec{
+		vec:     promauto.NewHistogramVec(opts, labelNames),
+		limiter: newCardinalityLimiter(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames, limit),
+	}
+}
+
+func (v *LimitedHistogramVec) WithLabelValues(lvs ...string) prometheus.Observer {
+	return v.vec.WithLabelValues(v.limiter.limit(lvs)...)
+}
+
+func (v *LimitedHistogramVec) With(labels prometheus.Labels) prometheus.Observer {
+	lvs, ok := v.limiter.labelValues(labels)
+	if !ok {
+		return v.vec.With(labels)
+	}
+	return v.WithLabelValues(lvs...)
+}
+
+// DeleteLabelValues deletes the series and frees its place under the limit.
+func (v *LimitedHistogramVec) DeleteLabelValues(lvs ...string) bool {
+	v.limiter.forget(lvs)
+	return v.vec.DeleteLabelValues(lvs...)
+}
+
+// LimitedSummaryVec is a SummaryVec with a cap on the number of series.
+type LimitedSummaryVec struct {
+	vec     *prometheus.SummaryVec
+	limiter *cardinalityLimiter
+}
+
+// NewLimitedSummaryVec works like promauto.NewSummaryVec.
+func NewLimitedSummaryVec(opts prometheus.SummaryOpts, labelNames []string, limit CardinalityOpts) *LimitedSummaryVec {
+	return &LimitedSummaryVec{
+		vec:     promauto.NewSummaryVec(opts, labelNames),
+		limiter: newCardinalityLimiter(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), labelNames, limit),
+	}
+}
+
+func (v *LimitedSummaryVec) WithLabelValues(lvs ...string) prometheus.Observer {
+	return v.vec.WithLabelValues(v.limiter.limit(lvs)...)
+}
+
+func (v *LimitedSummaryVec) With(labels prometheus.Labels) prometheus.Observer {
+	lvs, ok := v.limiter.labelValues(labels)
+	if !ok {
+		return v.vec.With(labels)
+	}
+	return v.WithLabelValues(lvs...)
+}
+
+// DeleteLabelValues deletes the series and frees its place under the limit.
+func (v *LimitedSummaryVec) DeleteLabelValues(lvs ...string) bool {
+	v.limiter.forget(lvs)
+	return v.vec.DeleteLabelValues(lvs...)
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// driverLimit caps the number of driver_id series per metric
+var driverLimit = CardinalityOpts{MaxSeries: 1000}
+
 var (
 	HttpRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -14,61 +17,134 @@ var (
 		[]string{"path", "method", "status"},
 	)
 
-	HttpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
+	HttpRequestsInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being served",
 		},
-		[]string{"path", "method"},
 	)
 
-	HttpRequestDurationSummary = promauto.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Name: "http_request_duration_seconds_summary",
-			Help: "HTTP request duration in seconds (summary)",
-			Objectives: map[float64]float64{
-				0.5:  0.05,  // 50th percentile, +/- 5%
-				0.75: 0.01,  // 75th percentile, +/- 1%
-				0.9:  0.01,  // 90th percentile, +/- 1%
-				0.95: 0.005, // 95th percentile, +/- 0.5%
-				0.99: 0.001, // 99th percentile, +/- 0.1%
-			},
+	HttpRequestsShed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_shed_total",
+			Help: "Requests rejected by the load shedder, reason is queue_time (rejected on arrival) or deadline (expired while queued)",
 		},
-		[]string{"path", "method"},
+		[]string{"priority", "reason"},
 	)
 
-	ProcessedPoints = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "processed_gps_points_total",
-			Help: "Total number of processed GPS points",
+	HttpRequestsQueued = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_requests_queued",
+			Help: "Requests waiting for the load shedder",
 		},
-		[]string{"driver_id"},
+		[]string{"priority"},
 	)
 
-	AnalysisLatency = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "track_analysis_duration_seconds",
-			Help:    "Time spent analyzing GPS tracks",
-			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1},
+	ProcessedPoints = NewLimitedCounterVec(
+		prometheus.CounterOpts{
+			Name: "processed_gps_points_total",
+			Help: "Total number of processed GPS points",
 		},
 		[]string{"driver_id"},
+		driverLimit,
 	)
 
-	GpsAccuracy = promauto.NewGaugeVec(
+	GpsAccuracy = NewLimitedGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "gps_accuracy_meters",
 			Help: "Estimated GPS accuracy in meters",
 		},
 		[]string{"driver_id"},
+		driverLimit,
 	)
+)
+
+// The metrics below depend on Options, Init creates them
+var (
+	HttpRequestDuration *prometheus.HistogramVec
+	HttpResponseSize    *prometheus.HistogramVec
+	// HttpRequestDurationSummary is nil unless Options.Summaries
+	HttpRequestDurationSummary *prometheus.SummaryVec
 
-	PointsInAnalysis = promauto.NewSummaryVec(
+	AnalysisLatency *LimitedHistogramVec
+	// PointsInAnalysis is a histogram, or a summary if Options.Summaries
+	PointsInAnalysis ObserverVec
+)
+
+// Init registers the histograms and summaries configured by opts.
+// It is called once from main, before the metrics are used.
+func Init(opts Options) {
+	HttpRequestDuration = promauto.NewHistogramVec(
+		withHistogramMode(opts.HistogramMode, prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		}),
+		[]string{"path", "method"},
+	)
+
+	HttpResponseSize = promauto.NewHistogramVec(
+		withHistogramMode(opts.HistogramMode, prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "HTTP response body size in bytes",
+			Buckets: prometheus.ExponentialBuckets(100, 10, 6),
+		}),
+		[]string{"path", "method"},
+	)
+
+	if opts.Summaries {
+		HttpRequestDurationSummary = newHttpRequestDurationSummary()
+	}
+
+	AnalysisLatency = NewLimitedHistogramVec(
+		withHistogramMode(opts.HistogramMode, prometheus.HistogramOpts{
+			Name:    "track_analysis_duration_seconds",
+			Help:    "Time spent analyzing GPS tracks",
+			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1},
+		}),
+		[]string{"driver_id"},
+		driverLimit,
+	)
+
+	PointsInAnalysis = newPointsInAnalysis(opts)
+}
+
+func newHttpRequestDurationSummary() *prometheus.SummaryVec {
+	return promauto.NewSummaryVec(
 		prometheus.SummaryOpts{
-			Name:       "points_in_analysis",
-			Help:       "Number of points used in track analysis",
-			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			Name: "http_request_duration_seconds_summary",
+			Help: "HTTP request duration in seconds (summary)",
+			Objectives: map[float64]float64{
+				0.5:  0.05,  // 50th percentile, +/- 5%
+				0.75: 0.01,  // 75th percentile, +/- 1%
+				0.9:  0.01,  // 90th percentile, +/- 1%
+				0.95: 0.005, // 95th percentile, +/- 0.5%
+				0.99: 0.001, // 99th percentile, +/- 0.1%
+			},
 		},
+		[]string{"path", "method"},
+	)
+}
+
+func newPointsInAnalysis(opts Options) ObserverVec {
+	if opts.Summaries {
+		return NewLimitedSummaryVec(
+			prometheus.SummaryOpts{
+				Name:       "points_in_analysis",
+				Help:       "Number of points used in track analysis",
+				Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+			},
+			[]string{"driver_id"},
+			driverLimit,
+		)
+	}
+	return NewLimitedHistogramVec(
+		withHistogramMode(opts.HistogramMode, prometheus.HistogramOpts{
+			Name:    "points_in_analysis",
+			Help:    "Number of points used in track analysis",
+			Buckets: []float64{1, 2, 5, 10, 25, 50, 100},
+		}),
 		[]string{"driver_id"},
+		driverLimit,
 	)
-)
+}
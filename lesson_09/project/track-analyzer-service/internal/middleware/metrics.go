@@ -1,66 +1,72 @@
 package middleware
 
 import (
-	"github.com/prometheus/client_golang/prometheus"
-	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"strconv"
 	"time"
 
+	"example/httpmetrics"
+	"example/httpmetrics/chimetrics"
 	"example/track-analyzer-service/internal/metrics"
 
-	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
 )
 
-type responseWriter struct {
-	http.ResponseWriter
-	status int
-}
-
-func NewResponseWriter(w http.ResponseWriter) *responseWriter {
-	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
-}
-
-func (w *responseWriter) WriteHeader(status int) {
-	w.status = status
-	w.ResponseWriter.WriteHeader(status)
-}
-
-func (w *responseWriter) Status() int {
-	return w.status
-}
+// requestDuration is the OTel counterpart of metrics.HttpRequestDuration.
+// Measurements are recorded with the request context, so the SDK attaches trace exemplars to them.
+var requestDuration, _ = otel.Meter("http").Float64Histogram(
+	"http.server.request.duration",
+	otelmetric.WithDescription("HTTP request duration"),
+	otelmetric.WithUnit("s"),
+)
 
 func MetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		start := time.Now()
 
-		ww := NewResponseWriter(w)
+		metrics.HttpRequestsInFlight.Inc()
+		defer metrics.HttpRequestsInFlight.Dec()
+
+		ww := httpmetrics.NewResponseWriter(w)
 		next.ServeHTTP(ww, r)
 
-		routePattern := chi.RouteContext(ctx).RoutePattern()
+		routePattern := chimetrics.Route(r)
 		if routePattern == "" {
 			routePattern = "undefined"
 		}
 
-		spanCtx := trace.SpanContextFromContext(ctx)
-		traceID := spanCtx.TraceID().String()
-		traceLabels := prometheus.Labels{"trace_id": traceID}
+		duration := time.Since(start).Seconds()
 
-		metrics.HttpRequestsTotal.WithLabelValues(
+		metrics.Add(ctx, metrics.HttpRequestsTotal.WithLabelValues(
 			routePattern,
 			r.Method,
 			strconv.Itoa(ww.Status()),
-		).(prometheus.ExemplarAdder).AddWithExemplar(1, traceLabels)
+		), 1)
 
-		metrics.HttpRequestDuration.WithLabelValues(
+		metrics.Observe(ctx, metrics.HttpRequestDuration.WithLabelValues(
 			routePattern,
 			r.Method,
-		).(prometheus.ExemplarObserver).ObserveWithExemplar(time.Since(start).Seconds(), traceLabels)
+		), duration)
 
-		metrics.HttpRequestDurationSummary.WithLabelValues(
+		metrics.Observe(ctx, metrics.HttpResponseSize.WithLabelValues(
 			routePattern,
 			r.Method,
-		).Observe(time.Since(start).Seconds())
+		), float64(ww.Size()))
+
+		requestDuration.Record(ctx, duration, otelmetric.WithAttributes(
+			attribute.String("http.route", routePattern),
+			attribute.String("http.request.method", r.Method),
+			attribute.Int("http.response.status_code", ww.Status()),
+		))
+
+		if metrics.HttpRequestDurationSummary != nil {
+			metrics.HttpRequestDurationSummary.WithLabelValues(
+				routePattern,
+				r.Method,
+			).Observe(duration)
+		}
 	})
 }
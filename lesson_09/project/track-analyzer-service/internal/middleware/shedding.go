@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"container/heap"
+	"net/http"
+	"sync"
+	"time"
+
+	"example/track-analyzer-service/internal/metrics"
+)
+
+// PriorityHeader sets the priority of a request: critical, normal or low
+const PriorityHeader = "X-Priority"
+
+// Priority of a request for the load shedder, higher is served first and shed last
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityCritical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityCritical:
+		return "critical"
+	}
+	return "normal"
+}
+
+// ParsePriority parses the value of PriorityHeader
+func ParsePriority(value string) (Priority, bool) {
+	switch value {
+	case "low":
+		return PriorityLow, true
+	case "normal":
+		return PriorityNormal, true
+	case "critical":
+		return PriorityCritical, true
+	}
+	return PriorityNormal, false
+}
+
+// LoadShedder runs at most maxConcurrent requests at a time, the rest wait in
+// a priority queue. A request is rejected with 503 right away if its estimated
+// queue time exceeds the deadline of its context: it would time out anyway,
+// and rejecting it early leaves the capacity to requests that can make it.
+type LoadShedder struct {
+	maxConcurrent int
+	// defaultPriority is the priority of requests without PriorityHeader
+	defaultPriority func(r *http.Request) Priority
+
+	mu      sync.Mutex
+	running int
+	queue   waitQueue
+	seq     uint64
+	// serviceTime is the moving average of the handler time in seconds
+	serviceTime float64
+}
+
+// NewLoadShedder creates a shedder. defaultPriority gives the priority of requests
+// without PriorityHeader, e.g. by route; nil means normal.
+func NewLoadShedder(maxConcurrent int, defaultPriority func(r *http.Request) Priority) *LoadShedder {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 100
+	}
+	if defaultPriority == nil {
+		defaultPriority = func(*http.Request) Priority { return PriorityNormal }
+	}
+	return &LoadShedder{
+		maxConcurrent:   maxConcurrent,
+		defaultPriority: defaultPriority,
+		serviceTime:     0.01,
+	}
+}
+
+// Middleware must be placed after TimeoutMiddleware, which sets the deadline
+func (s *LoadShedder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priority, ok := ParsePriority(r.Header.Get(PriorityHeader))
+		if !ok {
+			priority = s.defaultPriority(r)
+		}
+
+		if reason := s.acquire(r, priority); reason != "" {
+			metrics.HttpRequestsShed.WithLabelValues(priority.String(), reason).Inc()
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Service overloaded", http.StatusServiceUnavailable)
+			return
+		}
+
+		start := time.Now()
+		defer func() { s.release(time.Since(start)) }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire waits for a slot, it returns the reason if the request is shed
+func (s *LoadShedder) acquire(r *http.Request, priority Priority) string {
+	s.mu.Lock()
+	if s.running < s.maxConcurrent && s.queue.ahead(priority) == 0 {
+		s.running++
+		s.mu.Unlock()
+		return ""
+	}
+
+	// Requests of lower priority do not delay this one, they are overtaken
+	wait := time.Duration(float64(s.queue.ahead(priority)+1) / float64(s.maxConcurrent) * s.serviceTime * float64(time.Second))
+	if deadline, ok := r.Context().Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		s.mu.Unlock()
+		return "queue_time"
+	}
+
+	s.seq++
+	waiter := &waiter{priority: priority, seq: s.seq, ready: make(chan struct{})}
+	heap.Push(&s.queue, waiter)
+	metrics.HttpRequestsQueued.WithLabelValues(priority.String()).Inc()
+	s.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return ""
+	case <-r.Context().Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if waiter.index < 0 {
+			// The slot was handed over at the same moment, give it to the next one
+			s.handOver()
+		} else {
+			heap.Remove(&s.queue, waiter.index)
+			metrics.HttpRequestsQueued.WithLabelValues(priority.String()).Dec()
+		}
+		return "deadline"
+	}
+}
+
+func (s *LoadShedder) release(duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serviceTime += (duration.Seconds() - s.serviceTime) * 0.1
+	s.handOver()
+}
+
+// handOver passes the slot of a finished request to the first waiter, s.mu must be held
+func (s *LoadShedder) handOver() {
+	if s.queue.Len() == 0 {
+		s.running--
+		return
+	}
+	waiter := heap.Pop(&s.queue).(*waiter)
+	metrics.HttpRequestsQueued.WithLabelValues(waiter.priority.String()).Dec()
+	close(waiter.ready)
+}
+
+type waiter struct {
+	priority Priority
+	seq      uint64
+	ready    chan struct{}
+	// index in the queue, -1 once popped
+	index int
+}
+
+// waitQueue is a heap of waiters: higher priority first, then first come first served
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
+
+// ahead counts the waiters served before a request of priority p
+func (q waitQueue) ahead(p Priority) int {
+	n := 0
+	for _, w := range q {
+		if w.priority >= p {
+			n++
+		}
+	}
+	return n
+}
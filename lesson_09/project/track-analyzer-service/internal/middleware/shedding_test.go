@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingShedder has one slot taken by a request blocked until release is closed
+func blockingShedder() (shedder *LoadShedder, release chan struct{}, handler http.Handler, served chan Priority) {
+	shedder = NewLoadShedder(1, nil)
+	release = make(chan struct{})
+	served = make(chan Priority, 10)
+	started := make(chan struct{})
+	handler = shedder.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priority, _ := ParsePriority(r.Header.Get(PriorityHeader))
+		if r.Header.Get("X-Block") != "" {
+			close(started)
+			<-release
+		}
+		served <- priority
+	}))
+	go handler.ServeHTTP(httptest.NewRecorder(), blockingRequest())
+	<-started
+	return shedder, release, handler, served
+}
+
+func blockingRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Block", "1")
+	return r
+}
+
+func requestWithPriority(ctx context.Context, priority Priority) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	r.Header.Set(PriorityHeader, priority.String())
+	return r
+}
+
+func TestShedsWhenQueueTimeExceedsDeadline(t *testing.T) {
+	shedder, release, handler, _ := blockingShedder()
+	defer close(release)
+	shedder.mu.Lock()
+	shedder.serviceTime = 1
+	shedder.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, requestWithPriority(ctx, PriorityNormal))
+	if rec.Code != http.StatusServiceUnavailable || time.Since(start) > 50*time.Millisecond {
+		t.Fatalf("got %d after %v, want 503 without waiting for the deadline", rec.Code, time.Since(start))
+	}
+}
+
+func TestServesHigherPriorityFirst(t *testing.T) {
+	shedder, release, handler, served := blockingShedder()
+
+	var wg sync.WaitGroup
+	for i, priority := range []Priority{PriorityLow, PriorityCritical} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), requestWithPriority(context.Background(), priority))
+		}()
+		// Queue them in order, so that the critical one comes later
+		for {
+			shedder.mu.Lock()
+			n := shedder.queue.Len()
+			shedder.mu.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	<-served // the blocking request
+	if first, second := <-served, <-served; first != PriorityCritical || second != PriorityLow {
+		t.Fatalf("served %v then %v, want critical before low", first, second)
+	}
+}
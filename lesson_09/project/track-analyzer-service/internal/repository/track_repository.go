@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"example/track-analyzer-service/internal/domain/models"
 	"example/track-analyzer-service/internal/metrics"
 	"example/track-analyzer-service/internal/service"
@@ -18,26 +19,57 @@ import (
 type TrackRepository interface {
 	SaveTrackAnalysis(ctx context.Context, analysis *models.TrackAnalysis) error
 	GetRecentPoints(ctx context.Context, driverID string, count int) ([]models.GpsPoint, error)
-	SavePoint(ctx context.Context, driverID string, pointData []byte) error
+	// SavePoint stores the point and analyzes the track. A point with an idempotency key
+	// that was already saved is not stored again, ErrDuplicatePoint is returned.
+	SavePoint(ctx context.Context, driverID string, pointData []byte, idempotencyKey string) error
+}
+
+// ErrDuplicatePoint is returned for a retried point that was already saved
+var ErrDuplicatePoint = errors.New("point was already saved")
+
+// idempotencyTTL is how long a saved point is remembered, longer than the retries of a sender
+const idempotencyTTL = 10 * time.Minute
+
+// savePointScript remembers the idempotency key and pushes the point in one step, so that
+// a retry arriving concurrently can not push the point a second time.
+// KEYS: points list, idempotency key (empty if the point has no key). ARGV: point, TTL in seconds.
+// Returns the length of the list, or -1 if the key was already remembered.
+var savePointScript = redis.NewScript(`
+if KEYS[2] ~= '' and not redis.call('SET', KEYS[2], '1', 'NX', 'EX', ARGV[2]) then
+	return -1
+end
+return redis.call('LPUSH', KEYS[1], ARGV[1])
+`)
+
+func idempotencyRedisKey(driverID, key string) string {
+	if key == "" {
+		return ""
+	}
+	return fmt.Sprintf("track:idempotency:%s:%s", driverID, key)
 }
 
 type redisTrackRepository struct {
 	client         *redis.Client
 	trackService   *service.TrackService
 	featureService *service.FeatureService
+	// analysisWindow returns the number of the latest points a track is analyzed by,
+	// it is read for every point so that it can be changed without a restart
+	analysisWindow func() int
 }
 
-func NewRedisTrackRepository(client *redis.Client, featureService *service.FeatureService) TrackRepository {
+func NewRedisTrackRepository(client *redis.Client, featureService *service.FeatureService, analysisWindow func() int) TrackRepository {
 	return &redisTrackRepository{
 		client:         client,
 		trackService:   service.NewTrackService(),
 		featureService: featureService,
+		analysisWindow: analysisWindow,
 	}
 }
 
 func (r *redisTrackRepository) SaveTrackAnalysis(ctx context.Context, analysis *models.TrackAnalysis) error {
 	ctx, span := tracing.TrackAnalysisSpan(ctx, analysis.DriverID)
 	defer span.End()
+	ctx = service.WithDriverID(ctx, analysis.DriverID)
 
 	key := fmt.Sprintf("track:analysis:%s", analysis.DriverID)
 	data, err := json.Marshal(analysis)
@@ -74,7 +106,7 @@ func (r *redisTrackRepository) GetRecentPoints(ctx context.Context, driverID str
 
 	start := time.Now()
 	defer func() {
-		metrics.AnalysisLatency.WithLabelValues(driverID).Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, metrics.AnalysisLatency.WithLabelValues(driverID), time.Since(start).Seconds())
 	}()
 
 	key := fmt.Sprintf("track:points:%s", driverID)
@@ -98,7 +130,7 @@ func (r *redisTrackRepository) GetRecentPoints(ctx context.Context, driverID str
 
 	// If we have points, analyze them
 	if len(points) > 0 {
-		metrics.PointsInAnalysis.WithLabelValues(driverID).Observe(float64(len(points)))
+		metrics.Observe(ctx, metrics.PointsInAnalysis.WithLabelValues(driverID), float64(len(points)))
 		analysis := r.trackService.AnalyzeTrack(ctx, points)
 		return analysis.Points, nil
 	}
@@ -107,29 +139,38 @@ func (r *redisTrackRepository) GetRecentPoints(ctx context.Context, driverID str
 	return points, nil
 }
 
-func (r *redisTrackRepository) SavePoint(ctx context.Context, driverID string, pointData []byte) error {
+func (r *redisTrackRepository) SavePoint(ctx context.Context, driverID string, pointData []byte, idempotencyKey string) error {
 	ctx, span := tracing.SavePointSpan(ctx, driverID)
 	defer span.End()
 
 	start := time.Now()
 	defer func() {
-		metrics.AnalysisLatency.WithLabelValues(driverID).Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, metrics.AnalysisLatency.WithLabelValues(driverID), time.Since(start).Seconds())
 	}()
 
 	key := fmt.Sprintf("track:points:%s", driverID)
 
-	// Save the point
-	if err := r.client.LPush(ctx, key, pointData).Err(); err != nil {
+	// Save the point unless it is a retry of a saved one
+	length, err := savePointScript.Run(ctx, r.client,
+		[]string{key, idempotencyRedisKey(driverID, idempotencyKey)},
+		pointData, int64(idempotencyTTL/time.Second),
+	).Int64()
+	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to save point to Redis")
 		return fmt.Errorf("failed to save point: %w", err)
 	}
+	if length < 0 {
+		span.AddEvent("duplicate-point")
+		span.SetStatus(codes.Ok, "duplicate point ignored")
+		return ErrDuplicatePoint
+	}
 
 	// Increment processed points counter
-	metrics.ProcessedPoints.WithLabelValues(driverID).Inc()
+	metrics.Add(ctx, metrics.ProcessedPoints.WithLabelValues(driverID), 1)
 
-	// Get last 100 points for analysis
-	data, err := r.client.LRange(ctx, key, 0, 99).Result()
+	// Get the latest points for analysis
+	data, err := r.client.LRange(ctx, key, 0, int64(r.analysisWindow())-1).Result()
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "failed to get points for analysis")
@@ -149,7 +190,7 @@ func (r *redisTrackRepository) SavePoint(ctx context.Context, driverID string, p
 
 	// Analyze track if we have enough points
 	if len(points) > 0 {
-		metrics.PointsInAnalysis.WithLabelValues(driverID).Observe(float64(len(points)))
+		metrics.Observe(ctx, metrics.PointsInAnalysis.WithLabelValues(driverID), float64(len(points)))
 		analysis := r.trackService.AnalyzeTrack(ctx, points)
 		if err := r.SaveTrackAnalysis(ctx, analysis); err != nil {
 			span.RecordError(err)
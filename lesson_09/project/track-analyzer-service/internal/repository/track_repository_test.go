@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"example/track-analyzer-service/internal/metrics"
+	"example/track-analyzer-service/internal/service"
+)
+
+func TestMain(m *testing.M) {
+	metrics.Init(metrics.Options{})
+	os.Exit(m.Run())
+}
+
+func newTestRepository(t *testing.T) (TrackRepository, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	featureService := service.NewFeatureService(client, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return NewRedisTrackRepository(client, featureService, func() int { return 10 }), server
+}
+
+func TestSavePointIdempotencyKey(t *testing.T) {
+	repo, server := newTestRepository(t)
+	ctx := context.Background()
+	point := []byte(`{"driver_id":"42","location":{"latitude":55.75,"longitude":37.61},"timestamp":1}`)
+
+	if err := repo.SavePoint(ctx, "42", point, "42:1"); err != nil {
+		t.Fatal(err)
+	}
+	// A retry of the saved point is not stored again
+	if err := repo.SavePoint(ctx, "42", point, "42:1"); !errors.Is(err, ErrDuplicatePoint) {
+		t.Errorf("retry err = %v, want ErrDuplicatePoint", err)
+	}
+	if err := repo.SavePoint(ctx, "42", point, "42:2"); err != nil {
+		t.Fatal(err)
+	}
+	// Without a key every point is stored
+	for i := 0; i < 2; i++ {
+		if err := repo.SavePoint(ctx, "42", point, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points, err := server.List("track:points:42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 4 {
+		t.Errorf("stored %d points, want 4", len(points))
+	}
+	if ttl := server.TTL("track:idempotency:42:42:1"); ttl != idempotencyTTL {
+		t.Errorf("idempotency key TTL = %s, want %s", ttl, idempotencyTTL)
+	}
+
+	// After the TTL the key is forgotten
+	server.FastForward(idempotencyTTL)
+	if err := repo.SavePoint(ctx, "42", point, "42:1"); err != nil {
+		t.Errorf("after TTL err = %v, want the point saved", err)
+	}
+}
+
+func TestSavePointSameSecond(t *testing.T) {
+	repo, server := newTestRepository(t)
+	ctx := context.Background()
+	// Two locations of a driver within a second have the same timestamp,
+	// the sender tells them apart by the key
+	first := []byte(`{"driver_id":"42","location":{"latitude":55.75,"longitude":37.61},"timestamp":1700000000}`)
+	second := []byte(`{"driver_id":"42","location":{"latitude":55.76,"longitude":37.62},"timestamp":1700000000}`)
+
+	if err := repo.SavePoint(ctx, "42", first, "6f1c2a4e-0d7b-4a55-9a3e-1b2c3d4e5f60"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SavePoint(ctx, "42", second, "a9e8d7c6-b5a4-4f3e-8d2c-1b0a9f8e7d6c"); err != nil {
+		t.Errorf("second point err = %v, want it saved", err)
+	}
+
+	points, err := server.List("track:points:42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 {
+		t.Errorf("stored %d points, want 2", len(points))
+	}
+}
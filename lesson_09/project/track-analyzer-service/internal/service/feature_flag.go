@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// FlagType is the type of the value of a feature flag
+type FlagType string
+
+const (
+	FlagBool   FlagType = "bool"
+	FlagInt    FlagType = "int"
+	FlagFloat  FlagType = "float"
+	FlagString FlagType = "string"
+	FlagJSON   FlagType = "json"
+)
+
+// ErrFlagType is returned when a flag is read as a type it does not have
+var ErrFlagType = errors.New("feature flag type mismatch")
+
+// Flag is a typed value of a feature flag as it is stored in Redis.
+// Rules can give other values to some drivers or requests, see Evaluate.
+type Flag struct {
+	Type  FlagType        `json:"type"`
+	Value json.RawMessage `json:"value"`
+	Rules []Rule          `json:"rules,omitempty"`
+}
+
+// NewFlag checks that value and the values of the rules are JSON values of the given type.
+// An empty type is inferred from the value: a number without fraction and exponent is int,
+// other numbers are float, objects and arrays are json.
+func NewFlag(flagType FlagType, value json.RawMessage, rules ...Rule) (Flag, error) {
+	value = bytes.TrimSpace(value)
+	if flagType == "" {
+		flagType = inferFlagType(value)
+	}
+	flag := Flag{Type: flagType, Value: value, Rules: rules}
+
+	var err error
+	switch flagType {
+	case FlagBool:
+		_, err = flag.BoolValue()
+	case FlagInt:
+		_, err = flag.IntValue()
+	case FlagFloat:
+		_, err = flag.FloatValue()
+	case FlagString:
+		_, err = flag.StringValue()
+	case FlagJSON:
+		_, err = flag.ObjectValue()
+	default:
+		return Flag{}, fmt.Errorf("unknown feature flag type %q", flagType)
+	}
+	if err != nil {
+		return Flag{}, err
+	}
+	for i, rule := range rules {
+		if err := rule.validate(flagType); err != nil {
+			return Flag{}, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return flag, nil
+}
+
+func inferFlagType(value json.RawMessage) FlagType {
+	if len(value) == 0 {
+		return FlagJSON
+	}
+	switch value[0] {
+	case 't', 'f':
+		return FlagBool
+	case '"':
+		return FlagString
+	case '{', '[', 'n':
+		return FlagJSON
+	}
+	if bytes.ContainsAny(value, ".eE") {
+		return FlagFloat
+	}
+	return FlagInt
+}
+
+func (f Flag) BoolValue() (bool, error) {
+	var value bool
+	return value, f.decode(&value, FlagBool)
+}
+
+func (f Flag) IntValue() (int64, error) {
+	var value int64
+	return value, f.decode(&value, FlagInt)
+}
+
+// FloatValue reads float flags and int flags as well
+func (f Flag) FloatValue() (float64, error) {
+	var value float64
+	return value, f.decode(&value, FlagFloat, FlagInt)
+}
+
+func (f Flag) StringValue() (string, error) {
+	var value string
+	return value, f.decode(&value, FlagString)
+}
+
+// ObjectValue returns the value of a json flag as decoded by encoding/json
+func (f Flag) ObjectValue() (any, error) {
+	var value any
+	return value, f.decode(&value, FlagJSON)
+}
+
+func (f Flag) decode(value any, types ...FlagType) error {
+	for _, t := range types {
+		if f.Type == t {
+			if err := json.Unmarshal(f.Value, value); err != nil {
+				return fmt.Errorf("decode %s feature flag: %w", f.Type, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s flag read as %s", ErrFlagType, f.Type, types[0])
+}
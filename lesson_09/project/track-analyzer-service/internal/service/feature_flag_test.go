@@ -0,0 +1,76 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestNewFlag(t *testing.T) {
+	tests := []struct {
+		flagType FlagType
+		value    string
+		want     FlagType
+		wantErr  bool
+	}{
+		{value: "true", want: FlagBool},
+		{value: "700", want: FlagInt},
+		// A float must not be truncated to int
+		{value: "1.5", want: FlagFloat},
+		{value: "2.0", want: FlagFloat},
+		{value: "1e3", want: FlagFloat},
+		{value: `"on"`, want: FlagString},
+		{value: `{"percent": 10}`, want: FlagJSON},
+		{value: "[1, 2]", want: FlagJSON},
+		{flagType: FlagFloat, value: "2", want: FlagFloat},
+		{flagType: FlagString, value: `"2"`, want: FlagString},
+		{flagType: FlagInt, value: "1.5", wantErr: true},
+		{flagType: FlagBool, value: `"true"`, wantErr: true},
+		{flagType: "decimal", value: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.flagType)+" "+tt.value, func(t *testing.T) {
+			flag, err := NewFlag(tt.flagType, json.RawMessage(tt.value))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s flag, want an error", flag.Type)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flag.Type != tt.want {
+				t.Errorf("type = %s, want %s", flag.Type, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagValues(t *testing.T) {
+	intFlag, _ := NewFlag("", json.RawMessage("3"))
+	if value, err := intFlag.FloatValue(); err != nil || value != 3 {
+		t.Errorf("int flag as float = %v, %v, want 3", value, err)
+	}
+
+	floatFlag, _ := NewFlag("", json.RawMessage("0.25"))
+	if _, err := floatFlag.IntValue(); !errors.Is(err, ErrFlagType) {
+		t.Errorf("float flag as int error = %v, want ErrFlagType", err)
+	}
+
+	jsonFlag, _ := NewFlag("", json.RawMessage(`{"regions": ["eu"]}`))
+	value, err := jsonFlag.ObjectValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regions := value.(map[string]any)["regions"].([]any); len(regions) != 1 || regions[0] != "eu" {
+		t.Errorf("json flag = %v", value)
+	}
+
+	// Stored flags are read back with the same type
+	data, _ := json.Marshal(floatFlag)
+	decoded, err := decodeFlag(string(data))
+	if err != nil || decoded.Type != FlagFloat {
+		t.Errorf("decoded %s flag, %v", decoded.Type, err)
+	}
+}
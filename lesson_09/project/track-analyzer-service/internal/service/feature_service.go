@@ -2,91 +2,438 @@ package service
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"example/track-analyzer-service/internal/tracing"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/go-redis/redis/v8"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type FeatureValue interface{}
+const (
+	// featureFlagsKey is the Redis hash of the flags: name -> JSON encoded Flag
+	featureFlagsKey = "feature:flags"
+	// featureUpdatesChannel announces the name of a changed flag
+	featureUpdatesChannel = "feature:updates"
+	// featureHistoryLength is the approximate number of changes kept per flag
+	featureHistoryLength = 1000
+	// featureResyncInterval of the full reload, in case an update was lost while reconnecting
+	featureResyncInterval = 30 * time.Second
 
+	featureProviderName        = "track-analyzer-redis"
+	featureFlagEvaluationEvent = "feature_flag.evaluation"
+)
+
+// FeatureService keeps feature flags in Redis, so they survive restarts and are the
+// same on all replicas. Reads are served from a local copy: a change is published to
+// featureUpdatesChannel and every replica reloads the changed flag.
 type FeatureService struct {
-	flags sync.Map
+	client *redis.Client
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+func NewFeatureService(client *redis.Client, logger *slog.Logger) *FeatureService {
+	return &FeatureService{
+		client: client,
+		logger: logger,
+		flags:  make(map[string]Flag),
+	}
+}
+
+// Run loads the flags and keeps the local copy up to date until ctx is done
+func (s *FeatureService) Run(ctx context.Context) {
+	// Subscribe before the load, so that no update is missed in between
+	pubsub := s.client.Subscribe(ctx, featureUpdatesChannel)
+	defer pubsub.Close()
+
+	if err := s.reload(ctx); err != nil {
+		s.logger.ErrorContext(ctx, "failed to load feature flags", "error", err)
+	}
+
+	ticker := time.NewTicker(featureResyncInterval)
+	defer ticker.Stop()
+	updates := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.reload(ctx); err != nil {
+				s.logger.ErrorContext(ctx, "failed to reload feature flags", "error", err)
+			}
+		case msg, ok := <-updates:
+			if !ok {
+				return
+			}
+			if err := s.reloadFlag(ctx, msg.Payload); err != nil {
+				s.logger.ErrorContext(ctx, "failed to reload feature flag", "feature", msg.Payload, "error", err)
+			}
+		}
+	}
+}
+
+func (s *FeatureService) reload(ctx context.Context) error {
+	values, err := s.client.HGetAll(ctx, featureFlagsKey).Result()
+	if err != nil {
+		return err
+	}
+	flags := make(map[string]Flag, len(values))
+	for name, value := range values {
+		flag, err := decodeFlag(value)
+		if err != nil {
+			s.logger.WarnContext(ctx, "skipping invalid feature flag", "feature", name, "error", err)
+			continue
+		}
+		flags[name] = flag
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FeatureService) reloadFlag(ctx context.Context, name string) error {
+	value, err := s.client.HGet(ctx, featureFlagsKey, name).Result()
+	if errors.Is(err, redis.Nil) {
+		s.mu.Lock()
+		delete(s.flags, name)
+		s.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	flag, err := decodeFlag(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.flags[name] = flag
+	s.mu.Unlock()
+	return nil
 }
 
-func NewFeatureService() *FeatureService {
-	return &FeatureService{}
+func decodeFlag(value string) (Flag, error) {
+	var stored Flag
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return Flag{}, err
+	}
+	return NewFlag(stored.Type, stored.Value, stored.Rules...)
+}
+
+var (
+	// ErrFlagNotFound is returned for a flag that does not exist
+	ErrFlagNotFound = errors.New("feature flag not found")
+	// ErrPreconditionFailed is returned when the flag was changed since the ETag was read
+	ErrPreconditionFailed = errors.New("feature flag was changed by someone else")
+)
+
+// StoredFlag is a flag with the ETag of its stored version
+type StoredFlag struct {
+	Name string `json:"name"`
+	Flag
+	ETag string `json:"etag"`
+}
+
+// Change describes who changes a flag and on which condition, as the If-Match
+// and If-None-Match headers: IfMatch is an ETag or "*" for any existing version,
+// IfNoneMatch "*" allows only creating a flag. Empty values mean no condition.
+type Change struct {
+	Actor       string
+	IfMatch     string
+	IfNoneMatch string
+}
+
+// HistoryEntry is a change of a flag. Old or New is empty when the flag was created or deleted.
+type HistoryEntry struct {
+	Time    time.Time       `json:"time"`
+	Action  string          `json:"action"`
+	Actor   string          `json:"actor"`
+	Old     json.RawMessage `json:"old,omitempty"`
+	New     json.RawMessage `json:"new,omitempty"`
+	TraceID string          `json:"trace_id,omitempty"`
 }
 
-func (s *FeatureService) SetFeature(ctx context.Context, name string, value FeatureValue) {
-	_, span := tracing.StartSpan(ctx, "feature.set",
+// etag of a stored flag, the same as redis.sha1hex in changeFeatureScript
+func etag(data string) string {
+	sum := sha1.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// changeFeatureScript checks the precondition, sets or deletes the flag, appends the change
+// to the history stream and announces it in one step, so that concurrent changes can not
+// be lost between the check and the write.
+// KEYS: flags hash, history stream. ARGV: name, If-Match, If-None-Match, new value
+// (empty deletes), actor, trace ID, updates channel, history length.
+// Returns 1 if changed, 0 if the flag to delete does not exist, -1 if the precondition failed.
+var changeFeatureScript = redis.NewScript(`
+local old = redis.call('HGET', KEYS[1], ARGV[1])
+if ARGV[3] == '*' and old then
+	return -1
+end
+if ARGV[2] ~= '' then
+	if not old then
+		return -1
+	end
+	if ARGV[2] ~= '*' and redis.sha1hex(old) ~= ARGV[2] then
+		return -1
+	end
+end
+
+local action
+if ARGV[4] == '' then
+	if not old then
+		return 0
+	end
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	action = 'delete'
+else
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[4])
+	action = old and 'update' or 'create'
+end
+redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[8], '*',
+	'action', action, 'actor', ARGV[5], 'old', old or '', 'new', ARGV[4], 'trace_id', ARGV[6])
+redis.call('PUBLISH', ARGV[7], ARGV[1])
+return 1
+`)
+
+func featureHistoryKey(name string) string {
+	return "feature:history:" + name
+}
+
+func (s *FeatureService) change(ctx context.Context, name string, data string, change Change) (int64, error) {
+	traceID := ""
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		traceID = spanCtx.TraceID().String()
+	}
+	return changeFeatureScript.Run(ctx, s.client,
+		[]string{featureFlagsKey, featureHistoryKey(name)},
+		name, change.IfMatch, change.IfNoneMatch, data, change.Actor, traceID, featureUpdatesChannel, featureHistoryLength,
+	).Int64()
+}
+
+// SetFeature stores the flag if the precondition of change holds, records the change
+// in the history and announces it to the other replicas. It returns the new ETag.
+func (s *FeatureService) SetFeature(ctx context.Context, name string, flag Flag, change Change) (string, error) {
+	ctx, span := tracing.StartSpan(ctx, "feature.set",
 		attribute.String("feature_name", name),
-		attribute.String("feature_type", getFeatureType(value)),
+		attribute.String("feature_type", string(flag.Type)),
 	)
 	defer span.End()
 
-	if value == nil {
-		s.flags.Delete(name)
-		span.SetStatus(codes.Ok, "feature deleted")
-		return
+	data, err := json.Marshal(flag)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to marshal feature")
+		return "", fmt.Errorf("failed to marshal feature: %w", err)
 	}
-	s.flags.Store(name, value)
+	result, err := s.change(ctx, name, string(data), change)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to save feature")
+		return "", fmt.Errorf("failed to save feature: %w", err)
+	}
+	if result < 0 {
+		span.SetStatus(codes.Error, "precondition failed")
+		return "", ErrPreconditionFailed
+	}
+
+	s.mu.Lock()
+	s.flags[name] = flag
+	s.mu.Unlock()
 	span.SetStatus(codes.Ok, "feature set successfully")
+	return etag(string(data)), nil
 }
 
-func (s *FeatureService) GetBoolFeature(ctx context.Context, name string, defaultValue bool) bool {
-	_, span := tracing.StartSpan(ctx, "feature.get_bool",
+// DeleteFeature removes the flag if the precondition of change holds,
+// reads return the default value afterwards
+func (s *FeatureService) DeleteFeature(ctx context.Context, name string, change Change) error {
+	ctx, span := tracing.StartSpan(ctx, "feature.delete",
 		attribute.String("feature_name", name),
-		attribute.Bool("default_value", defaultValue),
 	)
 	defer span.End()
 
-	value, ok := s.flags.Load(name)
-	if !ok {
-		span.SetStatus(codes.Ok, "feature not found, using default")
-		return defaultValue
+	result, err := s.change(ctx, name, "", change)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to delete feature")
+		return fmt.Errorf("failed to delete feature: %w", err)
 	}
-	boolValue, ok := value.(bool)
-	if !ok {
-		span.SetStatus(codes.Ok, "feature type mismatch, using default")
-		return defaultValue
+	switch result {
+	case -1:
+		span.SetStatus(codes.Error, "precondition failed")
+		return ErrPreconditionFailed
+	case 0:
+		span.SetStatus(codes.Ok, "feature not found")
+		return ErrFlagNotFound
 	}
-	span.SetStatus(codes.Ok, "feature retrieved successfully")
-	return boolValue
+
+	s.mu.Lock()
+	delete(s.flags, name)
+	s.mu.Unlock()
+	span.SetStatus(codes.Ok, "feature deleted")
+	return nil
+}
+
+// GetFeature reads the flag from Redis, unlike the local copy it is always the latest version
+func (s *FeatureService) GetFeature(ctx context.Context, name string) (StoredFlag, error) {
+	data, err := s.client.HGet(ctx, featureFlagsKey, name).Result()
+	if errors.Is(err, redis.Nil) {
+		return StoredFlag{}, ErrFlagNotFound
+	}
+	if err != nil {
+		return StoredFlag{}, fmt.Errorf("failed to get feature: %w", err)
+	}
+	flag, err := decodeFlag(data)
+	if err != nil {
+		return StoredFlag{}, err
+	}
+	return StoredFlag{Name: name, Flag: flag, ETag: etag(data)}, nil
+}
+
+// ListFeatures reads all flags from Redis sorted by name. Invalid flags are skipped.
+func (s *FeatureService) ListFeatures(ctx context.Context) ([]StoredFlag, error) {
+	values, err := s.client.HGetAll(ctx, featureFlagsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list features: %w", err)
+	}
+	flags := make([]StoredFlag, 0, len(values))
+	for name, data := range values {
+		flag, err := decodeFlag(data)
+		if err != nil {
+			s.logger.WarnContext(ctx, "skipping invalid feature flag", "feature", name, "error", err)
+			continue
+		}
+		flags = append(flags, StoredFlag{Name: name, Flag: flag, ETag: etag(data)})
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, nil
+}
+
+// History returns up to limit latest changes of the flag, the latest first.
+// The history is kept after the flag is deleted.
+func (s *FeatureService) History(ctx context.Context, name string, limit int64) ([]HistoryEntry, error) {
+	messages, err := s.client.XRevRangeN(ctx, featureHistoryKey(name), "+", "-", limit).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feature history: %w", err)
+	}
+	entries := make([]HistoryEntry, 0, len(messages))
+	for _, msg := range messages {
+		entry := HistoryEntry{
+			Action:  fmt.Sprint(msg.Values["action"]),
+			Actor:   fmt.Sprint(msg.Values["actor"]),
+			TraceID: fmt.Sprint(msg.Values["trace_id"]),
+		}
+		if old := fmt.Sprint(msg.Values["old"]); old != "" {
+			entry.Old = json.RawMessage(old)
+		}
+		if value := fmt.Sprint(msg.Values["new"]); value != "" {
+			entry.New = json.RawMessage(value)
+		}
+		// The ID of a stream entry starts with its time in milliseconds
+		if ms, err := strconv.ParseInt(strings.SplitN(msg.ID, "-", 2)[0], 10, 64); err == nil {
+			entry.Time = time.UnixMilli(ms).UTC()
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Lookup returns the flag from the local copy
+func (s *FeatureService) Lookup(name string) (Flag, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	flag, ok := s.flags[name]
+	return flag, ok
+}
+
+func (s *FeatureService) GetBoolFeature(ctx context.Context, name string, defaultValue bool) bool {
+	return getFeature(ctx, s, "feature.get_bool", name, defaultValue, Flag.BoolValue)
 }
 
 func (s *FeatureService) GetIntFeature(ctx context.Context, name string, defaultValue int) int {
-	_, span := tracing.StartSpan(ctx, "feature.get_int",
+	return int(getFeature(ctx, s, "feature.get_int", name, int64(defaultValue), Flag.IntValue))
+}
+
+func (s *FeatureService) GetFloatFeature(ctx context.Context, name string, defaultValue float64) float64 {
+	return getFeature(ctx, s, "feature.get_float", name, defaultValue, Flag.FloatValue)
+}
+
+func (s *FeatureService) GetStringFeature(ctx context.Context, name string, defaultValue string) string {
+	return getFeature(ctx, s, "feature.get_string", name, defaultValue, Flag.StringValue)
+}
+
+// GetJSONFeature returns the value of a json flag as decoded by encoding/json
+func (s *FeatureService) GetJSONFeature(ctx context.Context, name string, defaultValue any) any {
+	return getFeature(ctx, s, "feature.get_json", name, defaultValue, Flag.ObjectValue)
+}
+
+// Evaluate applies the rules of the flag to ec, see Flag.Evaluate
+func (s *FeatureService) Evaluate(name string, ec EvaluationContext) (Flag, Resolution, bool) {
+	flag, ok := s.Lookup(name)
+	if !ok {
+		return Flag{}, Resolution{}, false
+	}
+	flag, resolution := flag.Evaluate(name, ec)
+	return flag, resolution, true
+}
+
+// getFeature evaluates the flag for the driver and the baggage of ctx. The result is added
+// to the span of the caller as a feature_flag.evaluation event, so that the trace shows
+// the cohort of the request.
+func getFeature[T any](ctx context.Context, s *FeatureService, spanName, name string, defaultValue T, value func(Flag) (T, error)) T {
+	ec := NewEvaluationContext(ctx)
+	attrs := []attribute.KeyValue{
+		semconv.FeatureFlagKey(name),
+		semconv.FeatureFlagProviderName(featureProviderName),
+	}
+	if ec.DriverID != "" {
+		attrs = append(attrs, semconv.FeatureFlagContextID(ec.DriverID))
+	}
+	parent := trace.SpanFromContext(ctx)
+	_, span := tracing.StartSpan(ctx, spanName,
 		attribute.String("feature_name", name),
-		attribute.Int("default_value", defaultValue),
+		attribute.String("default_value", fmt.Sprint(defaultValue)),
 	)
 	defer span.End()
+	defer func() {
+		span.SetAttributes(attrs...)
+		parent.AddEvent(featureFlagEvaluationEvent, trace.WithAttributes(attrs...))
+	}()
 
-	value, ok := s.flags.Load(name)
+	flag, resolution, ok := s.Evaluate(name, ec)
 	if !ok {
+		attrs = append(attrs, semconv.FeatureFlagResultReasonDefault, semconv.FeatureFlagResultVariant(DefaultVariant))
 		span.SetStatus(codes.Ok, "feature not found, using default")
 		return defaultValue
 	}
-	intValue, ok := value.(int)
-	if !ok {
+	result, err := value(flag)
+	if err != nil {
+		attrs = append(attrs, semconv.FeatureFlagResultReasonError, semconv.FeatureFlagEvaluationErrorMessage(err.Error()))
 		span.SetStatus(codes.Ok, "feature type mismatch, using default")
 		return defaultValue
 	}
+	attrs = append(attrs,
+		semconv.FeatureFlagResultReasonKey.String(string(resolution.Reason)),
+		semconv.FeatureFlagResultVariant(resolution.Variant),
+	)
 	span.SetStatus(codes.Ok, "feature retrieved successfully")
-	return intValue
-}
-
-func getFeatureType(value FeatureValue) string {
-	if value == nil {
-		return "nil"
-	}
-	switch value.(type) {
-	case bool:
-		return "bool"
-	case int:
-		return "int"
-	default:
-		return "unknown"
-	}
+	return result
 }
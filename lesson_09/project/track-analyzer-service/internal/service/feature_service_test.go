@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestFeatureService(t *testing.T, server *miniredis.Miniredis) *FeatureService {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewFeatureService(client, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func mustFlag(t *testing.T, value string) Flag {
+	t.Helper()
+	flag, err := NewFlag("", json.RawMessage(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flag
+}
+
+func TestSetFeaturePreconditions(t *testing.T) {
+	s := newTestFeatureService(t, miniredis.RunT(t))
+	ctx := context.Background()
+
+	created, err := s.SetFeature(ctx, "slow-save", mustFlag(t, "true"), Change{Actor: "alice", IfNoneMatch: "*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The ETag computed by the script is the same as the one returned to the client
+	stored, err := s.GetFeature(ctx, "slow-save")
+	if err != nil || stored.ETag != created {
+		t.Fatalf("GetFeature() ETag = %q, %v; want %q", stored.ETag, err, created)
+	}
+
+	if _, err := s.SetFeature(ctx, "slow-save", mustFlag(t, "false"), Change{IfNoneMatch: "*"}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("create of an existing flag: err = %v, want ErrPreconditionFailed", err)
+	}
+	updated, err := s.SetFeature(ctx, "slow-save", mustFlag(t, "false"), Change{IfMatch: created})
+	if err != nil || updated == created {
+		t.Fatalf("update with the current ETag: %q, %v", updated, err)
+	}
+	if _, err := s.SetFeature(ctx, "slow-save", mustFlag(t, "true"), Change{IfMatch: created}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("update with a stale ETag: err = %v, want ErrPreconditionFailed", err)
+	}
+	if _, err := s.SetFeature(ctx, "missing", mustFlag(t, "true"), Change{IfMatch: "*"}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("If-Match: * of a missing flag: err = %v, want ErrPreconditionFailed", err)
+	}
+
+	if flag, ok := s.Lookup("slow-save"); !ok || string(flag.Value) != "false" {
+		t.Errorf("local copy = %s, want the last successful update", flag.Value)
+	}
+}
+
+func TestDeleteFeature(t *testing.T) {
+	s := newTestFeatureService(t, miniredis.RunT(t))
+	ctx := context.Background()
+
+	if err := s.DeleteFeature(ctx, "delay", Change{}); !errors.Is(err, ErrFlagNotFound) {
+		t.Errorf("delete of a missing flag: err = %v, want ErrFlagNotFound", err)
+	}
+	etag, err := s.SetFeature(ctx, "delay", mustFlag(t, "100"), Change{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteFeature(ctx, "delay", Change{IfMatch: "stale"}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("delete with a stale ETag: err = %v, want ErrPreconditionFailed", err)
+	}
+	if err := s.DeleteFeature(ctx, "delay", Change{IfMatch: etag}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Lookup("delay"); ok {
+		t.Error("deleted flag is still in the local copy")
+	}
+	if _, err := s.GetFeature(ctx, "delay"); !errors.Is(err, ErrFlagNotFound) {
+		t.Errorf("GetFeature() after delete: err = %v, want ErrFlagNotFound", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	s := newTestFeatureService(t, miniredis.RunT(t))
+	ctx := context.Background()
+
+	if _, err := s.SetFeature(ctx, "delay", mustFlag(t, "100"), Change{Actor: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetFeature(ctx, "delay", mustFlag(t, "200"), Change{Actor: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	// A failed change is not recorded
+	if _, err := s.SetFeature(ctx, "delay", mustFlag(t, "300"), Change{Actor: "eve", IfNoneMatch: "*"}); err == nil {
+		t.Fatal("create of an existing flag succeeded")
+	}
+	if err := s.DeleteFeature(ctx, "delay", Change{Actor: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := s.History(ctx, "delay", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ action, actor, old, new string }{
+		{"delete", "carol", "200", ""},
+		{"update", "bob", "100", "200"},
+		{"create", "alice", "", "100"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d entries, want %d", len(history), len(want))
+	}
+	for i, w := range want {
+		entry := history[i]
+		if entry.Action != w.action || entry.Actor != w.actor || flagValue(t, entry.Old) != w.old || flagValue(t, entry.New) != w.new {
+			t.Errorf("entry %d = %s by %s, %s -> %s; want %+v", i, entry.Action, entry.Actor, entry.Old, entry.New, w)
+		}
+		if time.Since(entry.Time) > time.Minute {
+			t.Errorf("entry %d time = %s", i, entry.Time)
+		}
+	}
+
+	latest, err := s.History(ctx, "delay", 1)
+	if err != nil || len(latest) != 1 || latest[0].Action != "delete" {
+		t.Errorf("History(limit 1) = %+v, %v; want the delete", latest, err)
+	}
+}
+
+// flagValue returns the value of a stored flag from a history entry, empty for no flag
+func flagValue(t *testing.T, data json.RawMessage) string {
+	t.Helper()
+	if len(data) == 0 {
+		return ""
+	}
+	var flag Flag
+	if err := json.Unmarshal(data, &flag); err != nil {
+		t.Fatal(err)
+	}
+	return string(flag.Value)
+}
+
+func TestRunSyncsReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	writer := newTestFeatureService(t, server)
+	replica := newTestFeatureService(t, server)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		replica.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("replica did not get the %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// The replica may subscribe after the first change, the reload on start covers it
+	if _, err := writer.SetFeature(context.Background(), "delay", mustFlag(t, "100"), Change{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("created flag", func() bool { _, ok := replica.Lookup("delay"); return ok })
+
+	if err := writer.DeleteFeature(context.Background(), "delay", Change{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("delete", func() bool { _, ok := replica.Lookup("delay"); return !ok })
+}
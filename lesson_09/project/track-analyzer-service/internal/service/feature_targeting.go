@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// Rule gives its value to the requests it matches. All conditions set in a rule must match,
+// a rule without conditions matches everything.
+type Rule struct {
+	// Variant names the cohort in traces, rule-<index> by default
+	Variant string          `json:"variant,omitempty"`
+	Value   json.RawMessage `json:"value"`
+	// Percentage of drivers from 0 to 100. A driver is in the cohort by the hash of its ID
+	// and the flag name, so it stays there on every request and when the percentage grows.
+	Percentage *float64 `json:"percentage,omitempty"`
+	// Attributes that must all be equal, from the baggage of the request
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// From and Until limit the rule to a time window [From, Until)
+	From  *time.Time `json:"from,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+}
+
+func (r Rule) validate(flagType FlagType) error {
+	if _, err := NewFlag(flagType, r.Value); err != nil {
+		return err
+	}
+	if r.Percentage != nil && (*r.Percentage < 0 || *r.Percentage > 100) {
+		return fmt.Errorf("percentage %v is out of 0..100", *r.Percentage)
+	}
+	if r.From != nil && r.Until != nil && !r.Until.After(*r.From) {
+		return fmt.Errorf("until %s is not after from %s", r.Until, r.From)
+	}
+	return nil
+}
+
+func (r Rule) matches(flagName string, ec EvaluationContext) bool {
+	if r.From != nil && ec.Now.Before(*r.From) {
+		return false
+	}
+	if r.Until != nil && !ec.Now.Before(*r.Until) {
+		return false
+	}
+	for name, value := range r.Attributes {
+		if actual, ok := ec.Attributes[name]; !ok || actual != value {
+			return false
+		}
+	}
+	if r.Percentage != nil {
+		if ec.DriverID == "" {
+			return false
+		}
+		return rolloutBucket(flagName, ec.DriverID) < *r.Percentage*100
+	}
+	return true
+}
+
+// rolloutBucket places a driver into one of 10000 buckets. The flag name is a part of the
+// hash, so that the first 10% of drivers are not the same for every flag.
+func rolloutBucket(flagName, driverID string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(flagName))
+	h.Write([]byte{0})
+	h.Write([]byte(driverID))
+	return float64(h.Sum32() % 10000)
+}
+
+// EvaluationContext is what the rules of a flag are matched against
+type EvaluationContext struct {
+	DriverID   string
+	Attributes map[string]string
+	Now        time.Time
+}
+
+type driverIDKey struct{}
+
+// WithDriverID sets the driver for the evaluations of flags with ctx
+func WithDriverID(ctx context.Context, driverID string) context.Context {
+	return context.WithValue(ctx, driverIDKey{}, driverID)
+}
+
+// NewEvaluationContext takes the driver from WithDriverID and the attributes from the baggage
+func NewEvaluationContext(ctx context.Context) EvaluationContext {
+	driverID, _ := ctx.Value(driverIDKey{}).(string)
+	members := baggage.FromContext(ctx).Members()
+	attributes := make(map[string]string, len(members))
+	for _, member := range members {
+		attributes[member.Key()] = member.Value()
+	}
+	return EvaluationContext{DriverID: driverID, Attributes: attributes, Now: time.Now()}
+}
+
+// Reason why a flag has its value, as in the OTel feature flag semantic conventions
+type Reason string
+
+const (
+	// ReasonStatic the flag has no rules
+	ReasonStatic Reason = "static"
+	// ReasonDefault no rule matched
+	ReasonDefault Reason = "default"
+	// ReasonTargetingMatch a rule matched by attributes or time
+	ReasonTargetingMatch Reason = "targeting_match"
+	// ReasonSplit a percentage rule matched
+	ReasonSplit Reason = "split"
+)
+
+// DefaultVariant is the variant of the value of the flag itself
+const DefaultVariant = "default"
+
+// Resolution tells which variant of a flag was chosen and why
+type Resolution struct {
+	Variant string
+	Reason  Reason
+}
+
+// Evaluate returns the flag with the value of the first matching rule,
+// the value of the flag itself if none matches
+func (f Flag) Evaluate(name string, ec EvaluationContext) (Flag, Resolution) {
+	if len(f.Rules) == 0 {
+		return f, Resolution{Variant: DefaultVariant, Reason: ReasonStatic}
+	}
+	for i, rule := range f.Rules {
+		if !rule.matches(name, ec) {
+			continue
+		}
+		resolution := Resolution{Variant: rule.Variant, Reason: ReasonTargetingMatch}
+		if resolution.Variant == "" {
+			resolution.Variant = "rule-" + strconv.Itoa(i)
+		}
+		if rule.Percentage != nil {
+			resolution.Reason = ReasonSplit
+		}
+		return Flag{Type: f.Type, Value: rule.Value}, resolution
+	}
+	return Flag{Type: f.Type, Value: f.Value}, Resolution{Variant: DefaultVariant, Reason: ReasonDefault}
+}
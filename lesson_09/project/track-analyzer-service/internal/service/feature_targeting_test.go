@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func percentage(p float64) *float64 {
+	return &p
+}
+
+func TestPercentageRollout(t *testing.T) {
+	flag := func(p float64) Flag {
+		f, err := NewFlag(FlagBool, json.RawMessage("false"), Rule{Variant: "slow", Value: json.RawMessage("true"), Percentage: percentage(p)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	small, large := flag(10), flag(30)
+
+	var inSmall, inLarge int
+	for i := range 10000 {
+		ec := EvaluationContext{DriverID: fmt.Sprintf("driver-%d", i)}
+		value, smallResolution := small.Evaluate("slow-save-track-analysis", ec)
+		_, largeResolution := large.Evaluate("slow-save-track-analysis", ec)
+		if smallResolution.Variant == "slow" {
+			inSmall++
+			// Growing the rollout keeps the drivers that already have the feature
+			if largeResolution.Variant != "slow" {
+				t.Fatalf("%s left the cohort when the percentage grew", ec.DriverID)
+			}
+		}
+		if largeResolution.Variant == "slow" {
+			inLarge++
+		}
+		if again, _ := small.Evaluate("slow-save-track-analysis", ec); string(again.Value) != string(value.Value) {
+			t.Fatalf("evaluation of %s is not deterministic", ec.DriverID)
+		}
+	}
+	if inSmall < 900 || inSmall > 1100 || inLarge < 2850 || inLarge > 3150 {
+		t.Errorf("%d and %d of 10000 drivers in 10%% and 30%% rollouts", inSmall, inLarge)
+	}
+
+	if _, resolution := small.Evaluate("slow-save-track-analysis", EvaluationContext{}); resolution.Reason != ReasonDefault {
+		t.Errorf("request without driver: %+v, want the default value", resolution)
+	}
+}
+
+func TestRuleConditions(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	from, until := now.Add(-time.Hour), now.Add(time.Hour)
+	flag, err := NewFlag(FlagInt, json.RawMessage("0"),
+		Rule{Variant: "beta", Value: json.RawMessage("900"), Attributes: map[string]string{"tenant": "beta"}},
+		Rule{Value: json.RawMessage("700"), From: &from, Until: &until},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ec      EvaluationContext
+		value   string
+		variant string
+		reason  Reason
+	}{
+		{"attribute", EvaluationContext{Attributes: map[string]string{"tenant": "beta"}, Now: now.Add(-2 * time.Hour)}, "900", "beta", ReasonTargetingMatch},
+		{"window", EvaluationContext{Attributes: map[string]string{"tenant": "prod"}, Now: now}, "700", "rule-1", ReasonTargetingMatch},
+		{"window end is excluded", EvaluationContext{Now: until}, "0", DefaultVariant, ReasonDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, resolution := flag.Evaluate("add-point-delay-value-start", tt.ec)
+			if string(value.Value) != tt.value || resolution.Variant != tt.variant || resolution.Reason != tt.reason {
+				t.Errorf("got %s %+v, want %s %s %s", value.Value, resolution, tt.value, tt.variant, tt.reason)
+			}
+		})
+	}
+
+	if _, err := NewFlag(FlagInt, json.RawMessage("0"), Rule{Value: json.RawMessage("1.5")}); err == nil {
+		t.Error("rule value of another type is accepted")
+	}
+	if _, err := NewFlag(FlagInt, json.RawMessage("0"), Rule{Value: json.RawMessage("1"), Percentage: percentage(120)}); err == nil {
+		t.Error("percentage over 100 is accepted")
+	}
+}
+
+func TestEvaluationEventOnCallerSpan(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	features := NewFeatureService(nil, slog.Default())
+	features.flags["slow-save-track-analysis"], _ = NewFlag(FlagBool, json.RawMessage("false"),
+		Rule{Variant: "canary", Value: json.RawMessage("true"), Attributes: map[string]string{"cohort": "canary"}})
+
+	member, _ := baggage.NewMember("cohort", "canary")
+	bag, _ := baggage.New(member)
+	ctx := baggage.ContextWithBaggage(WithDriverID(context.Background(), "42"), bag)
+	ctx, span := provider.Tracer("test").Start(ctx, "SaveTrackAnalysis")
+	enabled := features.GetBoolFeature(ctx, "slow-save-track-analysis", false)
+	span.End()
+
+	if !enabled {
+		t.Fatal("the canary rule did not match the baggage")
+	}
+	var events []sdktrace.Event
+	for _, s := range spans.Ended() {
+		if s.Name() == "SaveTrackAnalysis" {
+			events = s.Events()
+		}
+	}
+	if len(events) != 1 || events[0].Name != "feature_flag.evaluation" {
+		t.Fatalf("caller span events = %v, want one feature_flag.evaluation", events)
+	}
+	want := map[attribute.Key]string{
+		"feature_flag.key":            "slow-save-track-analysis",
+		"feature_flag.result.variant": "canary",
+		"feature_flag.result.reason":  "targeting_match",
+		"feature_flag.context.id":     "42",
+	}
+	for _, attr := range events[0].Attributes {
+		if value, ok := want[attr.Key]; ok {
+			if attr.Value.AsString() != value {
+				t.Errorf("%s = %s, want %s", attr.Key, attr.Value.AsString(), value)
+			}
+			delete(want, attr.Key)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("missing attributes %v", want)
+	}
+}
@@ -31,7 +31,7 @@ func (s *TrackService) AnalyzeTrack(ctx context.Context, points []models.GpsPoin
 	driverID := points[0].DriverID
 
 	if len(points) < 2 {
-		metrics.PointsInAnalysis.WithLabelValues(driverID).Observe(float64(len(points)))
+		metrics.Observe(ctx, metrics.PointsInAnalysis.WithLabelValues(driverID), float64(len(points)))
 		span.SetStatus(codes.Ok, "insufficient points for analysis")
 		return &models.TrackAnalysis{
 			DriverID:     driverID,
@@ -97,8 +97,8 @@ func (s *TrackService) AnalyzeTrack(ctx context.Context, points []models.GpsPoin
 	confidence := 1.0 - (float64(anomalyCount) / float64(len(points)))
 
 	// Record metrics
-	metrics.PointsInAnalysis.WithLabelValues(driverID).Observe(float64(len(points)))
-	metrics.AnalysisLatency.WithLabelValues(driverID).Observe(time.Since(start).Seconds())
+	metrics.Observe(ctx, metrics.PointsInAnalysis.WithLabelValues(driverID), float64(len(points)))
+	metrics.Observe(ctx, metrics.AnalysisLatency.WithLabelValues(driverID), time.Since(start).Seconds())
 
 	span.SetAttributes(
 		attribute.Float64("average_speed", averageSpeed),
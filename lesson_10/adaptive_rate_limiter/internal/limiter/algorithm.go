@@ -0,0 +1,115 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// Sample is a single observation the limit is adjusted from
+type Sample struct {
+	// RTT is the time the request took
+	RTT time.Duration
+	// InFlight is the number of requests in flight when the request started
+	InFlight int
+	// Dropped means the request failed in a way that signals overload:
+	// a 5xx, a timeout or a high error rate reported by an external source
+	Dropped bool
+}
+
+// Algorithm computes a new concurrency limit from the current one and a sample
+type Algorithm interface {
+	Update(limit float64, sample Sample) float64
+}
+
+// AIMD is additive increase, multiplicative decrease: the limit grows by one
+// for every successful request while the limiter is busy enough to need it,
+// and is cut by BackoffRatio on a dropped or too slow request
+type AIMD struct {
+	// BackoffRatio the limit is multiplied by on a drop, 0.9 by default
+	BackoffRatio float64
+	// Timeout is the RTT above which a request counts as dropped, 0 disables it
+	Timeout time.Duration
+}
+
+func (a AIMD) Update(limit float64, sample Sample) float64 {
+	if sample.Dropped || (a.Timeout > 0 && sample.RTT > a.Timeout) {
+		ratio := a.BackoffRatio
+		if ratio <= 0 || ratio >= 1 {
+			ratio = 0.9
+		}
+		return limit * ratio
+	}
+	// Growing the limit while it is mostly unused would only let it drift up
+	// to a value that has never been tested under load
+	if float64(sample.InFlight)*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// Gradient compares the short-term RTT with the long-term one. While they match
+// the limit grows by a queue of sqrt(limit), when latency rises the limit shrinks
+// proportionally to the ratio. Same idea as Gradient2 in Netflix concurrency-limits.
+// Gradient keeps the RTT averages, so it must not be shared between limiters.
+type Gradient struct {
+	// Tolerance is how much the short-term RTT may exceed the long-term one
+	// before the limit goes down, 1.5 by default
+	Tolerance float64
+	// Smoothing is the weight of the new limit, 0.2 by default
+	Smoothing float64
+	// BackoffRatio the limit is multiplied by on a drop, 0.9 by default
+	BackoffRatio float64
+	// LongWindow is the number of samples the long-term RTT averages over, 600 by default
+	LongWindow int
+
+	shortRTT, longRTT float64
+	samples           int
+}
+
+func (g *Gradient) Update(limit float64, sample Sample) float64 {
+	if g.Tolerance <= 0 {
+		g.Tolerance = 1.5
+	}
+	if g.Smoothing <= 0 || g.Smoothing > 1 {
+		g.Smoothing = 0.2
+	}
+	if g.BackoffRatio <= 0 || g.BackoffRatio >= 1 {
+		g.BackoffRatio = 0.9
+	}
+	if g.LongWindow <= 0 {
+		g.LongWindow = 600
+	}
+
+	if sample.Dropped {
+		return limit * g.BackoffRatio
+	}
+
+	rtt := float64(sample.RTT)
+	g.samples++
+	if g.samples == 1 {
+		g.shortRTT, g.longRTT = rtt, rtt
+	}
+	// Short-term RTT reacts within a few requests, long-term one follows it slowly
+	g.shortRTT += (rtt - g.shortRTT) / 10
+	window := min(g.samples, g.LongWindow)
+	g.longRTT += (rtt - g.longRTT) / float64(window)
+
+	// After a long overload the long-term RTT drifts up and hides it,
+	// pull it back as the short-term one recovers
+	if g.shortRTT > 0 && g.longRTT/g.shortRTT > 2 {
+		g.longRTT *= 0.95
+	}
+
+	// Do not grow a limit that is not used
+	if float64(sample.InFlight) < limit/2 {
+		return limit
+	}
+
+	gradient := 1.0
+	if g.shortRTT > 0 {
+		gradient = math.Max(0.5, math.Min(1, g.Tolerance*g.longRTT/g.shortRTT))
+	}
+	queue := math.Sqrt(limit)
+	newLimit := limit*gradient + queue
+	return limit*(1-g.Smoothing) + newLimit*g.Smoothing
+}
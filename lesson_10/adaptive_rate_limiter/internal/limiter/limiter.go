@@ -0,0 +1,214 @@
+// Package limiter is an adaptive concurrency limiter. Instead of a fixed number
+// of requests per minute it limits requests in flight and adjusts the limit
+// from the latency and errors it observes, optionally also from an external
+// error rate such as a PromQL query.
+package limiter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Options settings of the limiter
+type Options struct {
+	// Algorithm adjusts the limit, AIMD by default
+	Algorithm Algorithm
+	// InitialLimit is the limit before any samples, 20 by default
+	InitialLimit int
+	// MinLimit the limit never goes below, 1 by default
+	MinLimit int
+	// MaxLimit the limit never goes above, 1000 by default
+	MaxLimit int
+	// Registerer for the limiter metrics, prometheus.DefaultRegisterer by default
+	Registerer prometheus.Registerer
+}
+
+func (o Options) withDefaults() Options {
+	if o.Algorithm == nil {
+		o.Algorithm = AIMD{}
+	}
+	if o.MinLimit <= 0 {
+		o.MinLimit = 1
+	}
+	if o.MaxLimit <= 0 {
+		o.MaxLimit = 1000
+	}
+	if o.InitialLimit <= 0 {
+		o.InitialLimit = 20
+	}
+	o.InitialLimit = min(max(o.InitialLimit, o.MinLimit), o.MaxLimit)
+	if o.Registerer == nil {
+		o.Registerer = prometheus.DefaultRegisterer
+	}
+	return o
+}
+
+// Limiter limits the number of requests in flight
+type Limiter struct {
+	opts Options
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+
+	limitGauge    prometheus.Gauge
+	inFlightGauge prometheus.Gauge
+	rejected      prometheus.Counter
+	outcomes      *prometheus.CounterVec
+}
+
+// New creates a limiter and registers its metrics
+func New(opts Options) *Limiter {
+	opts = opts.withDefaults()
+	l := &Limiter{
+		opts:  opts,
+		limit: float64(opts.InitialLimit),
+		limitGauge: register(opts.Registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "adaptive_limiter_limit",
+			Help: "Current concurrency limit.",
+		})),
+		inFlightGauge: register(opts.Registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "adaptive_limiter_inflight",
+			Help: "Requests currently in flight.",
+		})),
+		rejected: register(opts.Registerer, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "adaptive_limiter_rejected_total",
+			Help: "Requests rejected because the limit was reached.",
+		})),
+		outcomes: register(opts.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "adaptive_limiter_requests_total",
+			Help: "Admitted requests by outcome: success, dropped or ignored.",
+		}, []string{"outcome"})),
+	}
+	l.limitGauge.Set(l.limit)
+	return l
+}
+
+// register registers c or returns the already registered collector of the same kind
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
+
+// Limit returns the current limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of requests in flight
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Acquire takes a slot for a request. If the limit is reached it returns false,
+// otherwise the caller must release the token with one of its methods.
+func (l *Limiter) Acquire() (*Token, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		l.rejected.Inc()
+		return nil, false
+	}
+	l.inFlight++
+	l.inFlightGauge.Set(float64(l.inFlight))
+	return &Token{limiter: l, start: time.Now(), inFlight: l.inFlight}, true
+}
+
+// Token is a slot taken by Acquire
+type Token struct {
+	limiter  *Limiter
+	start    time.Time
+	inFlight int
+	once     sync.Once
+}
+
+// Success releases the slot of a request that completed normally
+func (t *Token) Success() {
+	t.release("success", &Sample{RTT: time.Since(t.start), InFlight: t.inFlight})
+}
+
+// Dropped releases the slot of a request that failed because of overload
+func (t *Token) Dropped() {
+	t.release("dropped", &Sample{RTT: time.Since(t.start), InFlight: t.inFlight, Dropped: true})
+}
+
+// Ignore releases the slot without adjusting the limit, e.g. when the client went away
+func (t *Token) Ignore() {
+	t.release("ignored", nil)
+}
+
+func (t *Token) release(outcome string, sample *Sample) {
+	t.once.Do(func() {
+		l := t.limiter
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.inFlight--
+		l.inFlightGauge.Set(float64(l.inFlight))
+		l.outcomes.WithLabelValues(outcome).Inc()
+		if sample != nil {
+			l.update(*sample)
+		}
+	})
+}
+
+// update applies a sample to the limit, l.mu must be held
+func (l *Limiter) update(sample Sample) {
+	limit := l.opts.Algorithm.Update(l.limit, sample)
+	if math.IsNaN(limit) {
+		return
+	}
+	l.limit = math.Min(math.Max(limit, float64(l.opts.MinLimit)), float64(l.opts.MaxLimit))
+	l.limitGauge.Set(math.Floor(l.limit))
+}
+
+// ErrorRateSource returns the current error rate of the service from 0 to 1
+type ErrorRateSource func(ctx context.Context) (float64, error)
+
+// Watch polls source every interval and backs the limit off while the error
+// rate is above threshold. In-process samples stay the main input, an external
+// source only adds errors the limiter cannot see itself, e.g. from other replicas.
+// Watch returns when ctx is done.
+func (l *Limiter) Watch(ctx context.Context, interval time.Duration, threshold float64, source ErrorRateSource) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		errorRate, err := source(ctx)
+		if err != nil {
+			log.Printf("Error querying error rate: %v", err)
+			continue
+		}
+		if errorRate <= threshold {
+			continue
+		}
+
+		l.mu.Lock()
+		l.update(Sample{InFlight: l.inFlight, Dropped: true})
+		log.Printf("Error rate %f is above %f, limit backed off to %d", errorRate, threshold, int(l.limit))
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,153 @@
+package limiter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAcquireRejectsOverLimit(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	l := New(Options{InitialLimit: 2, Registerer: reg})
+
+	first, ok := l.Acquire()
+	if !ok {
+		t.Fatal("first request rejected")
+	}
+	if _, ok := l.Acquire(); !ok {
+		t.Fatal("second request rejected")
+	}
+	if _, ok := l.Acquire(); ok {
+		t.Fatal("third request admitted over the limit of 2")
+	}
+	if got := testutil.ToFloat64(l.rejected); got != 1 {
+		t.Errorf("rejected = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(l.inFlightGauge); got != 2 {
+		t.Errorf("inflight = %v, want 2", got)
+	}
+
+	first.Success()
+	first.Success() // releasing twice must not free a second slot
+	if got := l.InFlight(); got != 1 {
+		t.Errorf("InFlight() = %d, want 1", got)
+	}
+}
+
+func TestAIMD(t *testing.T) {
+	l := New(Options{InitialLimit: 10, MaxLimit: 20, Algorithm: AIMD{BackoffRatio: 0.5}, Registerer: prometheus.NewRegistry()})
+
+	// The limit grows only while it is actually used
+	idle, _ := l.Acquire()
+	idle.Success()
+	if got := l.Limit(); got != 10 {
+		t.Fatalf("limit after an idle success = %d, want 10", got)
+	}
+
+	var tokens []*Token
+	for range 5 {
+		token, _ := l.Acquire()
+		tokens = append(tokens, token)
+	}
+	tokens[4].Success()
+	if got := l.Limit(); got != 11 {
+		t.Fatalf("limit after a busy success = %d, want 11", got)
+	}
+	tokens[3].Dropped()
+	if got := l.Limit(); got != 5 {
+		t.Fatalf("limit after a drop = %d, want 5", got)
+	}
+	if got := testutil.ToFloat64(l.limitGauge); got != 5 {
+		t.Errorf("limit gauge = %v, want 5", got)
+	}
+}
+
+func TestGradientShrinksOnLatency(t *testing.T) {
+	g := &Gradient{}
+	limit := 50.0
+	for range 100 {
+		limit = g.Update(limit, Sample{RTT: 10 * time.Millisecond, InFlight: int(limit)})
+	}
+	grown := limit
+	if grown <= 50 {
+		t.Fatalf("limit = %v with stable latency, want it to grow", grown)
+	}
+
+	for range 20 {
+		limit = g.Update(limit, Sample{RTT: 100 * time.Millisecond, InFlight: int(limit)})
+	}
+	if limit >= grown {
+		t.Fatalf("limit = %v after latency went up 10x, want it below %v", limit, grown)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l := New(Options{InitialLimit: 1, Algorithm: AIMD{BackoffRatio: 0.5}, Registerer: prometheus.NewRegistry()})
+	release := make(chan struct{})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			<-release
+		}
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/block", nil))
+	}()
+	for l.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("over the limit: status %d, Retry-After %q, want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	close(release)
+	<-done
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/error", nil))
+	if got := testutil.ToFloat64(l.outcomes.WithLabelValues("dropped")); got != 1 {
+		t.Errorf("dropped = %v, want 1 for a 5xx response", got)
+	}
+
+	// The client going away says nothing about the capacity of the service
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if got := testutil.ToFloat64(l.outcomes.WithLabelValues("ignored")); got != 1 {
+		t.Errorf("ignored = %v, want 1 for a canceled request", got)
+	}
+}
+
+func TestWatchBacksOffOnExternalErrorRate(t *testing.T) {
+	l := New(Options{InitialLimit: 100, Algorithm: AIMD{BackoffRatio: 0.5}, Registerer: prometheus.NewRegistry()})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rates := make(chan float64)
+	go l.Watch(ctx, time.Millisecond, 0.05, func(ctx context.Context) (float64, error) {
+		select {
+		case rate := <-rates:
+			return rate, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	})
+
+	rates <- 0.01
+	rates <- 0.2
+	rates <- 0.01 // the previous value is applied before the source is asked again
+	if got := l.Limit(); got != 50 {
+		t.Fatalf("limit = %d, want 50 after one error rate above the threshold", got)
+	}
+}
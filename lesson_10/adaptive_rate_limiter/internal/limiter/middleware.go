@@ -0,0 +1,53 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Middleware rejects requests with 429 Too Many Requests while the limit is reached.
+// Responses with status 5xx and requests that ran out of their deadline count as dropped,
+// requests canceled by the client do not change the limit.
+// The signature fits both net/http and chi.Router.Use.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := l.Acquire()
+		if !ok {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Concurrency limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			switch err := r.Context().Err(); {
+			case errors.Is(err, context.DeadlineExceeded), rw.status >= http.StatusInternalServerError:
+				token.Dropped()
+			case err != nil:
+				token.Ignore()
+			default:
+				token.Success()
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
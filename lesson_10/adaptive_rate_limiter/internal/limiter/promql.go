@@ -0,0 +1,40 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// PromQLErrorRate returns a source that evaluates query, e.g.
+// rate(app_requests_errors_total[1m]) / rate(app_requests_total[1m]).
+// An empty result or NaN (no traffic) means no errors.
+func PromQLErrorRate(client v1.API, query string) ErrorRateSource {
+	return func(ctx context.Context) (float64, error) {
+		result, warnings, err := client.Query(ctx, query, time.Now())
+		if err != nil {
+			return 0, fmt.Errorf("query failed: %w", err)
+		}
+		if len(warnings) > 0 {
+			log.Printf("Warnings: %v", warnings)
+		}
+
+		vector, ok := result.(model.Vector)
+		if !ok {
+			return 0, fmt.Errorf("unexpected result type: %s", result.Type())
+		}
+		if len(vector) == 0 {
+			return 0, nil
+		}
+		value := float64(vector[0].Value)
+		if math.IsNaN(value) {
+			return 0, nil
+		}
+		return value, nil
+	}
+}
@@ -1,53 +1,95 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"log"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"time"
 
+	"example/resilience/breaker"
+
 	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
-var ErrExternalService = errors.New("Error calling external service")
 var errorPropability = 0.5
 
-func callExternalService() (string, error) {
-	if rand.Float64() < errorPropability {
-		return "", ErrExternalService
-	}
-
-	return "result", nil
+// newExternalService is a flaky service: half of the requests fail with 503
+func newExternalService() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() < errorPropability {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("result"))
+	}))
 }
 
 func main() {
-	var cb *gobreaker.CircuitBreaker
-	settings := gobreaker.Settings{
-		Name:        "external_service",
-		MaxRequests: 1,           // Max number of requests when half-open
-		Interval:    time.Second, // Time until switch to half-open
-		Timeout:     time.Second, // Time to wait for a response before tripping
-		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
-			log.Printf("Failure ratio %v", failureRatio)
-			return counts.Requests > 10 && failureRatio >= 0.3
-		},
-		OnStateChange: func(name string, from, to gobreaker.State) {
-			log.Printf("Circuit Breaker '%s' changed from '%s' to '%s'\n", name, from, to)
+	// Metrics and spans are printed to stdout: the breaker state gauge,
+	// transitions and rejections, and the circuit_breaker.rejected span events
+	metricExporter, err := stdoutmetric.New(stdoutmetric.WithWriter(os.Stdout))
+	if err != nil {
+		log.Fatal(err)
+	}
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)))
+	defer mp.Shutdown(context.Background())
+	otel.SetMeterProvider(mp)
+
+	traceExporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	if err != nil {
+		log.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(traceExporter))
+	defer tp.Shutdown(context.Background())
+	otel.SetTracerProvider(tp)
+
+	service := newExternalService()
+	defer service.Close()
+
+	transport, err := breaker.NewTransport(http.DefaultTransport, breaker.Options{
+		Settings: gobreaker.Settings{
+			MaxRequests: 1,           // Max number of requests when half-open
+			Interval:    time.Second, // Cyclic period of the closed state to clear the counts
+			Timeout:     time.Second, // Period of the open state until switch to half-open
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
+				log.Printf("Failure ratio %v", failureRatio)
+				return counts.Requests > 10 && failureRatio >= 0.3
+			},
+			OnStateChange: func(name string, from, to gobreaker.State) {
+				log.Printf("Circuit Breaker '%s' changed from '%s' to '%s'\n", name, from, to)
+			},
 		},
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
-	cb = gobreaker.NewCircuitBreaker(settings)
+	client := &http.Client{Transport: transport, Timeout: time.Second}
 
-	for i := 0; i < 50; i++ {
-		result, err := cb.Execute(func() (interface{}, error) {
-			return callExternalService()
-		})
+	call := func(i int) {
+		ctx, span := otel.Tracer("circuit-breaker-example").Start(context.Background(), "callExternalService")
+		defer span.End()
 
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, service.URL, nil)
+		resp, err := client.Do(req)
 		if err != nil {
 			log.Printf("Request %d failed: %v\n", i, err)
-		} else {
-			log.Printf("Request %d successful: %s\n", i, result)
+			return
 		}
+		resp.Body.Close()
+		log.Printf("Request %d: %s\n", i, resp.Status)
+	}
+
+	for i := 0; i < 50; i++ {
+		call(i)
 		time.Sleep(time.Millisecond * 50)
 	}
 
@@ -55,15 +97,7 @@ func main() {
 	time.Sleep(time.Second * 2)
 
 	for i := 0; i < 50; i++ {
-		result, err := cb.Execute(func() (interface{}, error) {
-			return callExternalService()
-		})
-
-		if err != nil {
-			log.Printf("Request %d failed: %v\n", i, err)
-		} else {
-			log.Printf("Request %d successful: %s\n", i, result)
-		}
+		call(i)
 		time.Sleep(time.Millisecond * 50)
 	}
 }
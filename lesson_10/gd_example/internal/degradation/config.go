@@ -0,0 +1,74 @@
+package degradation
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config maps alerts to degradation switches:
+//
+//	switches:
+//	  - name: cpu_burning_feature
+//	    hold_down: 1m
+//	    alerts:
+//	      - alertname: HighCPU
+//	        service: app
+type Config struct {
+	Switches []SwitchConfig `yaml:"switches"`
+}
+
+// SwitchConfig is a feature that is disabled while any of its alerts fires
+type SwitchConfig struct {
+	// Name of the feature, the feature label of feature_flag_enabled
+	Name string `yaml:"name"`
+	// HoldDown is how long the feature stays disabled after the last alert resolved.
+	// An alert firing again within this time keeps the feature disabled, so a flapping
+	// alert does not turn the feature on and off.
+	HoldDown time.Duration `yaml:"hold_down"`
+	// Alerts are label matchers, an alert matches if it has all the labels of any of them
+	Alerts []map[string]string `yaml:"alerts"`
+}
+
+// LoadConfig reads the YAML config from path
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that switches have unique names and at least one non-empty matcher
+func (c Config) Validate() error {
+	seen := make(map[string]bool)
+	var errs []error
+	for i, sw := range c.Switches {
+		switch {
+		case sw.Name == "":
+			errs = append(errs, fmt.Errorf("switch %d: name is empty", i))
+		case seen[sw.Name]:
+			errs = append(errs, fmt.Errorf("switch %s: duplicate name", sw.Name))
+		}
+		seen[sw.Name] = true
+		if sw.HoldDown < 0 {
+			errs = append(errs, fmt.Errorf("switch %s: negative hold_down", sw.Name))
+		}
+		if len(sw.Alerts) == 0 {
+			errs = append(errs, fmt.Errorf("switch %s: no alerts", sw.Name))
+		}
+		for j, matcher := range sw.Alerts {
+			if len(matcher) == 0 {
+				errs = append(errs, fmt.Errorf("switch %s: alert %d matches everything", sw.Name, j))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
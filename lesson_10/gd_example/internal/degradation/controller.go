@@ -0,0 +1,301 @@
+// Package degradation turns features off while Alertmanager alerts fire.
+// Alerts are mapped to named switches by labels, see Config.
+package degradation
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Controller keeps the state of the degradation switches
+type Controller struct {
+	switches map[string]*degradationSwitch
+	order    []string
+	enabled  *prometheus.GaugeVec
+}
+
+type degradationSwitch struct {
+	config  SwitchConfig
+	enabled atomic.Bool
+
+	mu sync.Mutex
+	// active are the firing alerts by key
+	active        map[string]Alert
+	degradedSince time.Time
+	restoreAt     time.Time
+	timer         *time.Timer
+	// expiry fires at the earliest EndsAt of the active alerts
+	expiry *time.Timer
+}
+
+// NewController creates a controller with all features enabled
+func NewController(cfg Config, reg prometheus.Registerer) (*Controller, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	c := &Controller{
+		switches: make(map[string]*degradationSwitch),
+		enabled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "feature_flag_enabled",
+			Help: "Whether a feature flag is enabled (1) or disabled (0).",
+		}, []string{"feature"}),
+	}
+	if err := reg.Register(c.enabled); err != nil {
+		return nil, err
+	}
+	for _, sc := range cfg.Switches {
+		sw := &degradationSwitch{config: sc, active: make(map[string]Alert)}
+		sw.enabled.Store(true)
+		c.switches[sc.Name] = sw
+		c.order = append(c.order, sc.Name)
+		c.enabled.WithLabelValues(sc.Name).Set(1)
+	}
+	return c, nil
+}
+
+// Enabled reports whether the feature is enabled. Unknown features are enabled.
+// It does not lock and is cheap enough for every request.
+func (c *Controller) Enabled(name string) bool {
+	sw, ok := c.switches[name]
+	return !ok || sw.enabled.Load()
+}
+
+// Handle applies the alerts of a webhook. Alertmanager resends the same alerts
+// on every group_interval and repeat_interval, so an alert is tracked by its
+// fingerprint and only state changes have effect. A resend also moves EndsAt forward:
+// a firing alert that is not resent until its EndsAt is treated as resolved,
+// so a lost resolved notification or send_resolved: false does not keep the feature disabled.
+func (c *Controller) Handle(webhook Webhook) {
+	for _, alert := range webhook.Alerts {
+		for _, name := range c.order {
+			sw := c.switches[name]
+			if sw.matches(alert) {
+				sw.apply(alert, c.setEnabled)
+			}
+		}
+	}
+}
+
+func (c *Controller) setEnabled(name string, enabled bool) {
+	value := 0.0
+	if enabled {
+		value = 1
+	}
+	c.enabled.WithLabelValues(name).Set(value)
+	log.Printf("Feature %s enabled: %v", name, enabled)
+}
+
+func (s *degradationSwitch) matches(alert Alert) bool {
+	for _, matcher := range s.config.Alerts {
+		matched := true
+		for name, value := range matcher {
+			if alert.Labels[name] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *degradationSwitch) apply(alert Alert, setEnabled func(string, bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := alert.key()
+	switch alert.Status {
+	case StatusFiring:
+		if existing, ok := s.active[key]; ok && !alert.StartsAt.After(existing.StartsAt) {
+			// A resend of the same occurrence extends it
+			if alert.StartsAt.Equal(existing.StartsAt) && !alert.EndsAt.Equal(existing.EndsAt) {
+				existing.EndsAt = alert.EndsAt
+				s.active[key] = existing
+				s.scheduleExpiry(setEnabled)
+			}
+			return
+		}
+		s.active[key] = alert
+		s.scheduleExpiry(setEnabled)
+		s.cancelRestore()
+		if s.enabled.Load() {
+			s.enabled.Store(false)
+			s.degradedSince = time.Now()
+			setEnabled(s.config.Name, false)
+		}
+
+	case StatusResolved:
+		existing, ok := s.active[key]
+		// A late resolve of a previous occurrence must not resolve the alert firing again
+		if !ok || existing.StartsAt.After(alert.StartsAt) {
+			return
+		}
+		delete(s.active, key)
+		s.scheduleExpiry(setEnabled)
+		s.release(setEnabled)
+	}
+}
+
+// release enables the feature, after the hold-down if there is one, when no alert is active.
+// s.mu must be held.
+func (s *degradationSwitch) release(setEnabled func(string, bool)) {
+	if len(s.active) > 0 || s.enabled.Load() {
+		return
+	}
+	if s.config.HoldDown == 0 {
+		s.restore(setEnabled)
+		return
+	}
+	s.restoreAt = time.Now().Add(s.config.HoldDown)
+	s.timer = time.AfterFunc(s.config.HoldDown, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(s.active) == 0 && !s.restoreAt.IsZero() && !time.Now().Before(s.restoreAt) {
+			s.restore(setEnabled)
+		}
+	})
+}
+
+// scheduleExpiry sets the expiry timer to the earliest EndsAt of the active alerts,
+// alerts without EndsAt never expire. s.mu must be held.
+func (s *degradationSwitch) scheduleExpiry(setEnabled func(string, bool)) {
+	if s.expiry != nil {
+		s.expiry.Stop()
+		s.expiry = nil
+	}
+	var earliest time.Time
+	for _, alert := range s.active {
+		if !alert.EndsAt.IsZero() && (earliest.IsZero() || alert.EndsAt.Before(earliest)) {
+			earliest = alert.EndsAt
+		}
+	}
+	if earliest.IsZero() {
+		return
+	}
+	s.expiry = time.AfterFunc(time.Until(earliest), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.expire(setEnabled)
+	})
+}
+
+// expire drops the alerts whose EndsAt has passed, s.mu must be held
+func (s *degradationSwitch) expire(setEnabled func(string, bool)) {
+	now := time.Now()
+	for key, alert := range s.active {
+		if !alert.EndsAt.IsZero() && !now.Before(alert.EndsAt) {
+			log.Printf("Alert %s of feature %s expired at %s without a resolved notification", key, s.config.Name, alert.EndsAt.Format(time.RFC3339))
+			delete(s.active, key)
+		}
+	}
+	s.scheduleExpiry(setEnabled)
+	s.release(setEnabled)
+}
+
+// restore enables the feature, s.mu must be held
+func (s *degradationSwitch) restore(setEnabled func(string, bool)) {
+	s.cancelRestore()
+	s.degradedSince = time.Time{}
+	s.enabled.Store(true)
+	setEnabled(s.config.Name, true)
+}
+
+func (s *degradationSwitch) cancelRestore() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.restoreAt = time.Time{}
+}
+
+// SwitchState is the state of a switch shown by the admin endpoint
+type SwitchState struct {
+	Name          string        `json:"name"`
+	Enabled       bool          `json:"enabled"`
+	DegradedSince *time.Time    `json:"degraded_since,omitempty"`
+	RestoreAt     *time.Time    `json:"restore_at,omitempty"`
+	HoldDown      string        `json:"hold_down"`
+	ActiveAlerts  []ActiveAlert `json:"active_alerts"`
+}
+
+// ActiveAlert is a firing alert that keeps a feature disabled
+type ActiveAlert struct {
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	Labels      map[string]string `json:"labels"`
+	StartsAt    time.Time         `json:"starts_at"`
+}
+
+// State returns the state of all switches in config order
+func (c *Controller) State() []SwitchState {
+	states := make([]SwitchState, 0, len(c.order))
+	for _, name := range c.order {
+		states = append(states, c.switches[name].state())
+	}
+	return states
+}
+
+func (s *degradationSwitch) state() SwitchState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := SwitchState{
+		Name:         s.config.Name,
+		Enabled:      s.enabled.Load(),
+		HoldDown:     s.config.HoldDown.String(),
+		ActiveAlerts: make([]ActiveAlert, 0, len(s.active)),
+	}
+	if !s.degradedSince.IsZero() {
+		since := s.degradedSince
+		state.DegradedSince = &since
+	}
+	if !s.restoreAt.IsZero() {
+		at := s.restoreAt
+		state.RestoreAt = &at
+	}
+	for _, alert := range s.active {
+		state.ActiveAlerts = append(state.ActiveAlerts, ActiveAlert{Fingerprint: alert.Fingerprint, Labels: alert.Labels, StartsAt: alert.StartsAt})
+	}
+	sort.Slice(state.ActiveAlerts, func(i, j int) bool {
+		return state.ActiveAlerts[i].StartsAt.Before(state.ActiveAlerts[j].StartsAt)
+	})
+	return state
+}
+
+// WebhookHandler receives Alertmanager webhooks
+func (c *Controller) WebhookHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var webhook Webhook
+		if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if webhook.Version != "" && webhook.Version != "4" {
+			http.Error(w, "Unsupported webhook version "+webhook.Version, http.StatusBadRequest)
+			return
+		}
+		log.Printf("Webhook from %s: %s, %d alerts", webhook.Receiver, webhook.Status, len(webhook.Alerts))
+		c.Handle(webhook)
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// AdminHandler shows the state of the switches as JSON
+func (c *Controller) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.State())
+	})
+}
@@ -0,0 +1,201 @@
+package degradation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// webhook is a trimmed payload as Alertmanager sends it
+const webhook = `{
+  "version": "4",
+  "groupKey": "{}/{service=\"app\"}:{alertname=\"HighCPU\"}",
+  "truncatedAlerts": 0,
+  "status": "%s",
+  "receiver": "webhook-app",
+  "groupLabels": {"alertname": "HighCPU"},
+  "commonLabels": {"alertname": "HighCPU", "service": "app"},
+  "commonAnnotations": {},
+  "externalURL": "http://alertmanager:9093",
+  "alerts": [
+    {
+      "status": "%s",
+      "labels": {"alertname": "HighCPU", "service": "app", "instance": "app:8080"},
+      "annotations": {"summary": "CPU usage is high"},
+      "startsAt": "%s",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "http://grafana:3000/alerting",
+      "fingerprint": "c5ba9d6bd2a0f2a1"
+    }
+  ]
+}`
+
+func send(t *testing.T, h http.Handler, status, startsAt string) {
+	t.Helper()
+	body := strings.NewReader(fmt.Sprintf(webhook, status, status, startsAt))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/degrade", body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("webhook status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func newController(t *testing.T, holdDown time.Duration) *Controller {
+	t.Helper()
+	c, err := NewController(Config{Switches: []SwitchConfig{
+		{Name: "cpu_burning_feature", HoldDown: holdDown, Alerts: []map[string]string{{"alertname": "HighCPU", "service": "app"}}},
+		{Name: "recommendations", Alerts: []map[string]string{{"alertname": "HighLatency"}}},
+	}}, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestFiringAndResolved(t *testing.T) {
+	c := newController(t, 0)
+	h := c.WebhookHandler()
+	gauge := c.enabled.WithLabelValues("cpu_burning_feature")
+
+	send(t, h, StatusFiring, "2025-06-19T22:00:00Z")
+	if c.Enabled("cpu_burning_feature") || testutil.ToFloat64(gauge) != 0 {
+		t.Fatal("feature enabled while its alert fires")
+	}
+	if !c.Enabled("recommendations") || !c.Enabled("unknown") {
+		t.Fatal("features without firing alerts must stay enabled")
+	}
+
+	// Alertmanager repeats the notification, it is the same alert
+	send(t, h, StatusFiring, "2025-06-19T22:00:00Z")
+	if got := len(c.State()[0].ActiveAlerts); got != 1 {
+		t.Fatalf("active alerts = %d after a repeated notification, want 1", got)
+	}
+
+	// A late resolve of an earlier occurrence does not resolve the current one
+	send(t, h, StatusResolved, "2025-06-19T21:00:00Z")
+	if c.Enabled("cpu_burning_feature") {
+		t.Fatal("feature enabled by a resolve of an earlier occurrence")
+	}
+
+	send(t, h, StatusResolved, "2025-06-19T22:00:00Z")
+	if !c.Enabled("cpu_burning_feature") || testutil.ToFloat64(gauge) != 1 {
+		t.Fatal("feature disabled after its alert resolved")
+	}
+}
+
+func TestHoldDown(t *testing.T) {
+	c := newController(t, 50*time.Millisecond)
+	h := c.WebhookHandler()
+
+	send(t, h, StatusFiring, "2025-06-19T22:00:00Z")
+	send(t, h, StatusResolved, "2025-06-19T22:00:00Z")
+	if c.Enabled("cpu_burning_feature") {
+		t.Fatal("feature enabled before the hold-down passed")
+	}
+	if c.State()[0].RestoreAt == nil {
+		t.Fatal("state has no restore_at during hold-down")
+	}
+
+	// Flapping: the alert fires again within the hold-down
+	send(t, h, StatusFiring, "2025-06-19T22:05:00Z")
+	time.Sleep(100 * time.Millisecond)
+	if c.Enabled("cpu_burning_feature") {
+		t.Fatal("feature enabled while the alert fires again")
+	}
+
+	send(t, h, StatusResolved, "2025-06-19T22:05:00Z")
+	time.Sleep(100 * time.Millisecond)
+	if !c.Enabled("cpu_burning_feature") {
+		t.Fatal("feature still disabled after the hold-down")
+	}
+}
+
+func TestFiringAlertExpires(t *testing.T) {
+	c := newController(t, 0)
+	alert := func(endsAt time.Time) Webhook {
+		return Webhook{Alerts: []Alert{{
+			Status:      StatusFiring,
+			Labels:      map[string]string{"alertname": "HighCPU", "service": "app"},
+			StartsAt:    time.Date(2025, 6, 19, 22, 0, 0, 0, time.UTC),
+			EndsAt:      endsAt,
+			Fingerprint: "c5ba9d6bd2a0f2a1",
+		}}}
+	}
+
+	c.Handle(alert(time.Now().Add(50 * time.Millisecond)))
+	// A resend before EndsAt moves it forward
+	time.Sleep(30 * time.Millisecond)
+	c.Handle(alert(time.Now().Add(80 * time.Millisecond)))
+	time.Sleep(40 * time.Millisecond)
+	if c.Enabled("cpu_burning_feature") {
+		t.Fatal("feature enabled before the extended EndsAt")
+	}
+
+	// No resolved notification comes, the alert expires at EndsAt
+	deadline := time.Now().Add(time.Second)
+	for !c.Enabled("cpu_burning_feature") {
+		if time.Now().After(deadline) {
+			t.Fatal("feature still disabled after EndsAt of its alert passed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := len(c.State()[0].ActiveAlerts); got != 0 {
+		t.Errorf("active alerts = %d after expiry, want 0", got)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	c := newController(t, time.Minute)
+	send(t, c.WebhookHandler(), StatusFiring, "2025-06-19T22:00:00Z")
+
+	rec := httptest.NewRecorder()
+	c.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/degradation", nil))
+	var states []SwitchState
+	if err := json.NewDecoder(rec.Body).Decode(&states); err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[0].Enabled || states[0].DegradedSince == nil || states[0].HoldDown != "1m0s" {
+		t.Fatalf("states = %+v", states)
+	}
+	if alerts := states[0].ActiveAlerts; len(alerts) != 1 || alerts[0].Fingerprint != "c5ba9d6bd2a0f2a1" || alerts[0].Labels["instance"] != "app:8080" {
+		t.Fatalf("active alerts = %+v", alerts)
+	}
+	if !states[1].Enabled || len(states[1].ActiveAlerts) != 0 {
+		t.Fatalf("recommendations = %+v, want enabled without alerts", states[1])
+	}
+}
+
+func TestWebhookRejectsBadRequests(t *testing.T) {
+	h := newController(t, 0).WebhookHandler()
+	for name, req := range map[string]*http.Request{
+		"method":  httptest.NewRequest(http.MethodGet, "/degrade", nil),
+		"body":    httptest.NewRequest(http.MethodPost, "/degrade", strings.NewReader("{")),
+		"version": httptest.NewRequest(http.MethodPost, "/degrade", strings.NewReader(`{"version": "3"}`)),
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code < 400 {
+			t.Errorf("%s: status = %d, want an error", name, rec.Code)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	err := Config{Switches: []SwitchConfig{
+		{Name: "a", Alerts: []map[string]string{{"alertname": "A"}}},
+		{Name: "a", Alerts: []map[string]string{{}}},
+		{Name: "b"},
+	}}.Validate()
+	for _, want := range []string{"switch a: duplicate name", "switch a: alert 0 matches everything", "switch b: no alerts"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want %q", err, want)
+		}
+	}
+}
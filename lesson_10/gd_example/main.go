@@ -1,44 +1,38 @@
 package main
 
 import (
-	"encoding/json"
+	"example/internal/degradation"
 	"fmt"
+	"log"
 	"math"
 	"net/http"
-	"sync/atomic"
+	"os"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var cpuConsumingFeatureEnabled int32 = 1
-
 var (
 	requestLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name:    "request_latency_seconds",
 		Help:    "Request latency in seconds.",
 		Buckets: prometheus.ExponentialBuckets(0.1, 1.2, 10),
 	})
-
-	featureFlagEnabled = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "feature_flag_enabled",
-			Help: "Whether a feature flag is enabled (1) or disabled (0).",
-		},
-		[]string{"feature"},
-	)
 )
 
 func init() {
 	prometheus.MustRegister(requestLatency)
-	prometheus.MustRegister(featureFlagEnabled)
 }
 
+const cpuBurningFeature = "cpu_burning_feature"
+
+var controller *degradation.Controller
+
 func burnCPU(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
-	if atomic.LoadInt32(&cpuConsumingFeatureEnabled) == 1 {
+	if controller.Enabled(cpuBurningFeature) {
 		x := 1.0
 		for i := 0; i < 1000; i++ { // x10 more cpu
 			x = math.Sin(math.Cos(math.Tan(math.Atan(x))))
@@ -56,36 +50,23 @@ func burnCPU(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "OK")
 }
 
-type AlertRequest struct {
-	Status string `json:"status"`
-}
-
-func degradeHandler(w http.ResponseWriter, r *http.Request) {
-	var alert AlertRequest
-	err := json.NewDecoder(r.Body).Decode(&alert)
+func main() {
+	configPath := os.Getenv("DEGRADATION_CONFIG")
+	if configPath == "" {
+		configPath = "degradation.yaml"
+	}
+	cfg, err := degradation.LoadConfig(configPath)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Bad request"))
-		return
+		log.Fatalf("Error loading degradation config: %v", err)
 	}
-	fmt.Println("Status: " + alert.Status)
-	if alert.Status == "firing" {
-		atomic.StoreInt32(&cpuConsumingFeatureEnabled, 0)
-		featureFlagEnabled.With(prometheus.Labels{"feature": "cpu_burning_feature"}).Set(0)
-		fmt.Fprintln(w, "Degradation enabled")
-	} else if alert.Status == "resolved" {
-		atomic.StoreInt32(&cpuConsumingFeatureEnabled, 1)
-		featureFlagEnabled.With(prometheus.Labels{"feature": "cpu_burning_feature"}).Set(1)
-		fmt.Fprintln(w, "Degradation disabled")
-
+	controller, err = degradation.NewController(cfg, prometheus.DefaultRegisterer)
+	if err != nil {
+		log.Fatalf("Error creating degradation controller: %v", err)
 	}
-}
-
-func main() {
-	featureFlagEnabled.With(prometheus.Labels{"feature": "cpu_burning_feature"}).Set(1)
 
 	http.HandleFunc("/process", burnCPU)
-	http.HandleFunc("/degrade", degradeHandler)
+	http.Handle("/degrade", controller.WebhookHandler())
+	http.Handle("/admin/degradation", controller.AdminHandler())
 	http.Handle("/metrics", promhttp.Handler())
 
 	fmt.Println("Server listening on port 8080")
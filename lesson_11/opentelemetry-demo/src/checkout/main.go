@@ -11,8 +11,10 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -38,6 +40,7 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
@@ -173,6 +176,9 @@ func main() {
 	tracer = tp.Tracer("checkout")
 
 	svc := new(checkout)
+	// gRPC dependencies by name, their connectivity is the readiness of the service.
+	// Shipping and email are called over HTTP, their connections stay unused.
+	dependencies := make(map[string]*grpc.ClientConn)
 
 	mustMapEnv(&svc.shippingSvcAddr, "SHIPPING_ADDR")
 	c := mustCreateClient(svc.shippingSvcAddr)
@@ -182,16 +188,19 @@ func main() {
 	mustMapEnv(&svc.productCatalogSvcAddr, "PRODUCT_CATALOG_ADDR")
 	c = mustCreateClient(svc.productCatalogSvcAddr)
 	svc.productCatalogSvcClient = pb.NewProductCatalogServiceClient(c)
+	dependencies["product-catalog"] = c
 	defer c.Close()
 
 	mustMapEnv(&svc.cartSvcAddr, "CART_ADDR")
 	c = mustCreateClient(svc.cartSvcAddr)
 	svc.cartSvcClient = pb.NewCartServiceClient(c)
+	dependencies["cart"] = c
 	defer c.Close()
 
 	mustMapEnv(&svc.currencySvcAddr, "CURRENCY_ADDR")
 	c = mustCreateClient(svc.currencySvcAddr)
 	svc.currencySvcClient = pb.NewCurrencyServiceClient(c)
+	dependencies["currency"] = c
 	defer c.Close()
 
 	mustMapEnv(&svc.emailSvcAddr, "EMAIL_ADDR")
@@ -202,6 +211,7 @@ func main() {
 	mustMapEnv(&svc.paymentSvcAddr, "PAYMENT_ADDR")
 	c = mustCreateClient(svc.paymentSvcAddr)
 	svc.paymentSvcClient = pb.NewPaymentServiceClient(c)
+	dependencies["payment"] = c
 	defer c.Close()
 
 	svc.kafkaBrokerSvcAddr = os.Getenv("KAFKA_ADDR")
@@ -227,9 +237,54 @@ func main() {
 
 	healthcheck := health.NewServer()
 	healthpb.RegisterHealthServer(srv, healthcheck)
-	log.Infof("starting to listen on tcp: %q", lis.Addr().String())
-	err = srv.Serve(lis)
-	log.Fatal(err)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go watchDependencies(ctx, healthcheck, dependencies)
+
+	go func() {
+		log.Infof("starting to listen on tcp: %q", lis.Addr().String())
+		if err := srv.Serve(lis); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	// NOT_SERVING while the running calls complete, so that clients move to other instances
+	healthcheck.Shutdown()
+	srv.GracefulStop()
+	log.Info("checkout gRPC server stopped")
+}
+
+// dependencyCheckInterval is how often the connectivity of the gRPC dependencies is checked
+const dependencyCheckInterval = 5 * time.Second
+
+// watchDependencies serves NOT_SERVING, for the whole server and for CheckoutService,
+// while any gRPC dependency is in TRANSIENT_FAILURE: an order can not be placed without them.
+func watchDependencies(ctx context.Context, healthcheck *health.Server, dependencies map[string]*grpc.ClientConn) {
+	ticker := time.NewTicker(dependencyCheckInterval)
+	defer ticker.Stop()
+	for {
+		servingStatus := healthpb.HealthCheckResponse_SERVING
+		for name, conn := range dependencies {
+			switch state := conn.GetState(); state {
+			case connectivity.Idle:
+				// Connections are lazy, an idle one is not known to be broken
+				conn.Connect()
+			case connectivity.TransientFailure, connectivity.Shutdown:
+				log.Warnf("dependency %s is %s", name, state)
+				servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+			}
+		}
+		healthcheck.SetServingStatus("", servingStatus)
+		healthcheck.SetServingStatus(pb.CheckoutService_ServiceDesc.ServiceName, servingStatus)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 func mustMapEnv(target *string, envKey string) {
@@ -240,14 +295,6 @@ func mustMapEnv(target *string, envKey string) {
 	*target = v
 }
 
-func (cs *checkout) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
-	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
-}
-
-func (cs *checkout) Watch(req *healthpb.HealthCheckRequest, ws healthpb.Health_WatchServer) error {
-	return status.Errorf(codes.Unimplemented, "health check via Watch not implemented")
-}
-
 func (cs *checkout) PlaceOrder(ctx context.Context, req *pb.PlaceOrderRequest) (*pb.PlaceOrderResponse, error) {
 	span := trace.SpanFromContext(ctx)
 	span.SetAttributes(
@@ -192,6 +192,8 @@ func main() {
 
 	healthcheck := health.NewServer()
 	healthpb.RegisterHealthServer(srv, healthcheck)
+	// The catalog is loaded before the server starts and reloads keep the last good one
+	healthcheck.SetServingStatus(pb.ProductCatalogService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGKILL)
 	defer cancel()
@@ -204,6 +206,8 @@ func main() {
 
 	<-ctx.Done()
 
+	// NOT_SERVING while the running calls complete, so that clients move to other instances
+	healthcheck.Shutdown()
 	srv.GracefulStop()
 	logger.Info("Product Catalog gRPC server stopped")
 }
@@ -303,14 +307,6 @@ func mustMapEnv(target *string, key string) {
 	*target = value
 }
 
-func (p *productCatalog) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
-	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
-}
-
-func (p *productCatalog) Watch(req *healthpb.HealthCheckRequest, ws healthpb.Health_WatchServer) error {
-	return status.Errorf(codes.Unimplemented, "health check via Watch not implemented")
-}
-
 func (p *productCatalog) ListProducts(ctx context.Context, req *pb.Empty) (*pb.ListProductsResponse, error) {
 	span := trace.SpanFromContext(ctx)
 